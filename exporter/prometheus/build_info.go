@@ -0,0 +1,53 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// BuildInfoName is the name of the gauge carrying Options.AppInfo.
+const BuildInfoName = "opencensus_build_info"
+
+// buildInfo returns the gauge carrying the application metadata info as its
+// labels, or nil if info is empty. The label names are sanitized like the
+// names of tag keys; an error is returned if two of them collide or a value
+// is not valid UTF-8.
+func buildInfo(info map[string]string) (prometheus.Metric, error) {
+	if len(info) == 0 {
+		return nil, nil
+	}
+	labels := make(prometheus.Labels, len(info))
+	original := make(map[string]string, len(info))
+	for k, v := range info {
+		name := sanitize(k)
+		if name == "" {
+			return nil, fmt.Errorf("invalid AppInfo label %q: empty name", k)
+		}
+		if prev, ok := original[name]; ok {
+			return nil, fmt.Errorf("invalid AppInfo labels %q and %q: both are sanitized to %q", prev, k, name)
+		}
+		if !utf8.ValidString(v) {
+			return nil, fmt.Errorf("invalid AppInfo label %q: value %q is not valid UTF-8", k, v)
+		}
+		original[name] = k
+		labels[name] = v
+	}
+	desc := prometheus.NewDesc(BuildInfoName, "Metadata of the application, such as its version, as labels of a constant 1.", nil, labels)
+	return prometheus.NewConstMetric(desc, prometheus.GaugeValue, 1)
+}
@@ -0,0 +1,109 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/cloudian/opencensus-go/metric/metricdata"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var labelNameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// histogramWithExemplars adds exemplars to the buckets of a histogram.
+type histogramWithExemplars struct {
+	prometheus.Metric
+	// exemplars maps bucket upper bounds to their exemplar.
+	exemplars map[float64]*dto.Exemplar
+}
+
+func (m *histogramWithExemplars) Write(pb *dto.Metric) error {
+	if err := m.Metric.Write(pb); err != nil {
+		return err
+	}
+	for _, b := range pb.GetHistogram().GetBucket() {
+		if e, ok := m.exemplars[b.GetUpperBound()]; ok {
+			b.Exemplar = e
+		}
+	}
+	return nil
+}
+
+// exemplarLabels maps the attachment keys of exemplars to label names, see
+// Options.ExemplarLabelMap.
+type exemplarLabels struct {
+	names  map[string]string
+	strict bool
+}
+
+// labelName returns the label name of the attachment key k, or false if its
+// attachment is dropped.
+func (l *exemplarLabels) labelName(k string) (string, bool) {
+	if name, ok := l.names[k]; ok {
+		return name, true
+	}
+	return k, !l.strict
+}
+
+// toPromExemplar converts an OpenCensus exemplar. Its string attachments
+// become the exemplar labels, named as mapped by l, other attachments are
+// ignored.
+func (l *exemplarLabels) toPromExemplar(e *metricdata.Exemplar) (*dto.Exemplar, error) {
+	ts, err := ptypes.TimestampProto(e.Timestamp)
+	if err != nil {
+		return nil, err
+	}
+	var labels []*dto.LabelPair
+	runes := 0
+	keys := make(map[string]string, len(e.Attachments))
+	for key, v := range e.Attachments {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		k, ok := l.labelName(key)
+		if !ok {
+			continue
+		}
+		if prev, ok := keys[k]; ok {
+			return nil, fmt.Errorf("exemplar attachments %q and %q are both exported as label %q", prev, key, k)
+		}
+		keys[k] = key
+		if !labelNameRegexp.MatchString(k) {
+			return nil, fmt.Errorf("exemplar label name %q is invalid", k)
+		}
+		if !utf8.ValidString(s) {
+			return nil, fmt.Errorf("exemplar label value %q is not valid UTF-8", s)
+		}
+		runes += utf8.RuneCountInString(k) + utf8.RuneCountInString(s)
+		labels = append(labels, &dto.LabelPair{Name: proto.String(k), Value: proto.String(s)})
+	}
+	if runes > prometheus.ExemplarMaxRunes {
+		return nil, fmt.Errorf("exemplar labels have %d runes, exceeding the limit of %d", runes, prometheus.ExemplarMaxRunes)
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i].GetName() < labels[j].GetName() })
+	return &dto.Exemplar{
+		Label:     labels,
+		Value:     proto.Float64(e.Value),
+		Timestamp: ts,
+	}, nil
+}
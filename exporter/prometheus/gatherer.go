@@ -0,0 +1,188 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// sortedGatherer wraps a prometheus.Gatherer and sorts its output so that
+// metric families are ordered by name and the series within a family are
+// ordered by their label values, independently of the wrapped Gatherer.
+type sortedGatherer struct {
+	prometheus.Gatherer
+}
+
+func (g *sortedGatherer) Gather() ([]*dto.MetricFamily, error) {
+	mfs, err := g.Gatherer.Gather()
+	sort.SliceStable(mfs, func(i, j int) bool {
+		return mfs[i].GetName() < mfs[j].GetName()
+	})
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			sort.SliceStable(m.Label, func(i, j int) bool {
+				return m.Label[i].GetName() < m.Label[j].GetName()
+			})
+		}
+		sort.SliceStable(mf.Metric, func(i, j int) bool {
+			return lessLabels(mf.Metric[i].Label, mf.Metric[j].Label)
+		})
+	}
+	return mfs, err
+}
+
+// lessLabels compares two sorted label sets by name and value, pair by pair.
+func lessLabels(a, b []*dto.LabelPair) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i].GetName() != b[i].GetName() {
+			return a[i].GetName() < b[i].GetName()
+		}
+		if a[i].GetValue() != b[i].GetValue() {
+			return a[i].GetValue() < b[i].GetValue()
+		}
+	}
+	return len(a) < len(b)
+}
+
+// labelSortGatherer wraps a prometheus.Gatherer and orders the labels of each
+// series with less instead of alphabetically.
+type labelSortGatherer struct {
+	prometheus.Gatherer
+	less func(a, b string) bool
+}
+
+func (g *labelSortGatherer) Gather() ([]*dto.MetricFamily, error) {
+	mfs, err := g.Gatherer.Gather()
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			sort.SliceStable(m.Label, func(i, j int) bool {
+				return g.less(m.Label[i].GetName(), m.Label[j].GetName())
+			})
+		}
+	}
+	return mfs, err
+}
+
+// histogramGatherer wraps a prometheus.Gatherer and replaces each histogram
+// family with untyped families for its bucket, sum and count series, named
+// with suffixes and with infLabel as the le label of the overflow bucket. The
+// encoders always name the series of a histogram family with the default
+// suffixes and label its overflow bucket "+Inf", in every format.
+type histogramGatherer struct {
+	prometheus.Gatherer
+	suffixes HistogramSuffixes
+	infLabel string
+	onError  func(error)
+}
+
+func (g *histogramGatherer) Gather() ([]*dto.MetricFamily, error) {
+	mfs, err := g.Gatherer.Gather()
+	// The series of the other families, which the untyped families of the
+	// histograms must not collide with.
+	names := make(map[string]bool, len(mfs))
+	for _, mf := range mfs {
+		switch mf.GetType() {
+		case dto.MetricType_HISTOGRAM:
+		case dto.MetricType_SUMMARY:
+			names[mf.GetName()] = true
+			names[mf.GetName()+defaultSumSuffix] = true
+			names[mf.GetName()+defaultCountSuffix] = true
+		default:
+			names[mf.GetName()] = true
+		}
+	}
+	out := make([]*dto.MetricFamily, 0, len(mfs))
+	for _, mf := range mfs {
+		if mf.GetType() != dto.MetricType_HISTOGRAM {
+			out = append(out, mf)
+			continue
+		}
+		series := g.histogramSeries(mf)
+		if collision := g.collision(series, names); collision != "" {
+			g.onError(fmt.Errorf("histogram %q is not exported: its series %q collide with another metric", mf.GetName(), collision))
+			continue
+		}
+		out = append(out, series...)
+	}
+	return out, err
+}
+
+// collision returns the name of the first of series that is in names, and
+// adds the names of series to names if none is.
+func (g *histogramGatherer) collision(series []*dto.MetricFamily, names map[string]bool) string {
+	for _, f := range series {
+		if names[f.GetName()] {
+			return f.GetName()
+		}
+	}
+	for _, f := range series {
+		names[f.GetName()] = true
+	}
+	return ""
+}
+
+// histogramSeries returns the bucket, sum and count series of the histogram
+// family mf as untyped families, in the order the text format lists them.
+func (g *histogramGatherer) histogramSeries(mf *dto.MetricFamily) []*dto.MetricFamily {
+	family := func(suffix string) *dto.MetricFamily {
+		return &dto.MetricFamily{
+			Name: proto.String(mf.GetName() + suffix),
+			Help: mf.Help,
+			Type: dto.MetricType_UNTYPED.Enum(),
+		}
+	}
+	buckets, sum, count := family(g.suffixes.Bucket), family(g.suffixes.Sum), family(g.suffixes.Count)
+	for _, m := range mf.Metric {
+		add := func(f *dto.MetricFamily, labels []*dto.LabelPair, value float64) {
+			f.Metric = append(f.Metric, &dto.Metric{
+				Label:       labels,
+				Untyped:     &dto.Untyped{Value: proto.Float64(value)},
+				TimestampMs: m.TimestampMs,
+			})
+		}
+		h := m.GetHistogram()
+		inf := false
+		for _, b := range h.Bucket {
+			inf = math.IsInf(b.GetUpperBound(), 1)
+			add(buckets, g.withLe(m.Label, b.GetUpperBound()), float64(b.GetCumulativeCount()))
+		}
+		if !inf {
+			// The encoders add the overflow bucket if it is missing.
+			add(buckets, g.withLe(m.Label, math.Inf(1)), float64(h.GetSampleCount()))
+		}
+		add(sum, m.Label, h.GetSampleSum())
+		add(count, m.Label, float64(h.GetSampleCount()))
+	}
+	return []*dto.MetricFamily{buckets, sum, count}
+}
+
+// withLe returns labels with an le label for the bucket bound appended, as
+// the encoders add it to the series of histogram buckets.
+func (g *histogramGatherer) withLe(labels []*dto.LabelPair, bound float64) []*dto.LabelPair {
+	le := g.infLabel
+	if !math.IsInf(bound, 1) {
+		le = strconv.FormatFloat(bound, 'g', -1, 64)
+	}
+	out := make([]*dto.LabelPair, len(labels), len(labels)+1)
+	copy(out, labels)
+	return append(out, &dto.LabelPair{Name: proto.String("le"), Value: proto.String(le)})
+}
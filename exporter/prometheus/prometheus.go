@@ -17,19 +17,69 @@
 package prometheus // import "github.com/cloudian/opencensus-go/exporter/prometheus"
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/cloudian/opencensus-go/metric/metricdata"
 	"github.com/cloudian/opencensus-go/metric/metricexport"
+	"github.com/cloudian/opencensus-go/metric/metricproducer"
+	"github.com/cloudian/opencensus-go/resource"
 	"github.com/cloudian/opencensus-go/stats/view"
+	"github.com/cloudian/opencensus-go/tag"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
 )
 
+// Errors returned by NewExporter, possibly wrapped with details; use
+// errors.Is to test for them.
+var (
+	// ErrNilGatherer is returned if a Registerer is set without a Gatherer
+	// to serve its metrics from.
+	ErrNilGatherer = errors.New("no Gatherer")
+	// ErrNilRegisterer is returned if a Gatherer is set without a
+	// Registerer to register the exporter with.
+	ErrNilRegisterer = errors.New("no Registerer")
+	// ErrRegistryMismatch is returned if the Registerer and the Gatherer
+	// are different registries.
+	ErrRegistryMismatch = errors.New("mismatched Registerer and Gatherer")
+	// ErrRegistryConflict is returned if the exporter cannot be registered
+	// with the Registerer, for example because its metrics conflict with
+	// those of another collector. The error of the Registerer, such as a
+	// prometheus.AlreadyRegisteredError, is wrapped as well.
+	ErrRegistryConflict = errors.New("cannot register the collector")
+)
+
+// registerError is ErrRegistryConflict wrapping the error of the Registerer.
+type registerError struct {
+	err error
+}
+
+func (e *registerError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrRegistryConflict, e.err)
+}
+
+func (e *registerError) Is(target error) bool {
+	return target == ErrRegistryConflict
+}
+
+func (e *registerError) Unwrap() error {
+	return e.err
+}
+
 // Exporter exports stats to Prometheus, users need
 // to register the exporter as an http.Handler to be
 // able to export.
@@ -38,6 +88,12 @@ type Exporter struct {
 	g       prometheus.Gatherer
 	c       *collector
 	handler http.Handler
+	// openMetricsHandler serves the OpenMetrics format, which is exported
+	// without the HistogramSuffixes of the other formats, and with the units
+	// of EmitUnitComment.
+	openMetricsHandler http.Handler
+	// collecting holds a token while a collection with CollectTimeout runs.
+	collecting chan struct{}
 }
 
 // Options contains options for configuring the exporter.
@@ -48,10 +104,209 @@ type Options struct {
 	Gatherer    prometheus.Gatherer
 	OnError     func(err error)
 	ConstLabels prometheus.Labels // ConstLabels will be set as labels on all views.
+
+	// SortSeries forces a fully deterministic output: metric families are
+	// sorted by name and the series of each family by their label values,
+	// regardless of the ordering guarantees of the configured Gatherer.
+	SortSeries bool
+
+	// LabelSort orders the labels of each series in the text formats, for
+	// example to put resource labels before tag labels. It reports whether the
+	// label named a goes before the label named b. Labels are ordered
+	// alphabetically by default.
+	LabelSort func(a, b string) bool
+
+	// CollectTimeout bounds the time spent collecting metrics for a single
+	// scrape. If collection takes longer, ServeHTTP responds with
+	// 503 Service Unavailable and reports the timeout to OnError instead of
+	// blocking the scraper. Collections run one at a time; scrapes wait for
+	// the running one within their timeout. A collection that times out
+	// keeps running in the background and its result is dropped, but it no
+	// longer blocks further scrapes, which start collections of their own.
+	// Zero means no timeout.
+	CollectTimeout time.Duration
+
+	// InfBucketLabel is the value of the le label of the overflow bucket of
+	// histograms, for example "inf". It must parse as positive infinity.
+	// Defaults to "+Inf". Histograms keep their type, and the label is used
+	// in the text and the OpenMetrics formats; the protobuf format has no le
+	// label and encodes the overflow bucket by its bound.
+	InfBucketLabel string
+
+	// EnableOpenMetrics serves the OpenMetrics text format to scrapers that
+	// request it. Only this format exposes exemplars: the string attachments
+	// of the exemplars recorded for histogram buckets, see
+	// stats.WithAttachmentLabels, become their labels. Attachments with keys
+	// that are not valid label names are reported to OnError and their
+	// exemplar is dropped.
+	EnableOpenMetrics bool
+
+	// HistogramSuffixes overrides the suffixes of the sum, count and bucket
+	// series of histograms, for example "_total" instead of "_count". Unset
+	// suffixes keep their default; the suffixes must be distinct. Since the
+	// suffixes of a histogram family cannot be changed, histograms lose their
+	// type: they are exported as three untyped families in all formats,
+	// protobuf included, except in OpenMetrics, which is served unchanged.
+	// A histogram whose series would collide with another metric, such as
+	// a counter named like its "_total" series, is not exported, and the
+	// collision is reported to OnError on every scrape.
+	HistogramSuffixes HistogramSuffixes
+
+	// LabelNameCase converts the names of all labels, derived from tags,
+	// resources or ConstLabels, to lower or upper case after sanitization.
+	// Metrics for which this makes two label names collide are reported to
+	// OnError and not exported.
+	LabelNameCase LabelCase
+
+	// LabelRenames renames the labels derived from tags, keyed by their
+	// sanitized tag key name, for example {"http_status": "code"}, so that
+	// labels can be renamed without re-declaring the views. The new names
+	// must be valid label names. Renames are applied before LabelNameCase.
+	// Metrics for which a renamed label collides with another label are
+	// reported to OnError and not exported.
+	LabelRenames map[string]string
+
+	// EmitUnitComment adds a "# UNIT name unit" line to the metric families
+	// with a unit in the OpenMetrics format, see EnableOpenMetrics, so that
+	// tools such as Grafana can infer it. The units of the measures are
+	// mapped to Prometheus base units: bytes are exported as "bytes", and
+	// milliseconds as "seconds". As OpenMetrics requires, only the families
+	// whose name ends with their unit, for example "_seconds", get a UNIT
+	// line. The values of these families, including the bucket bounds of
+	// histograms, are converted to the unit in all formats, so that the
+	// name tells their unit even in the formats without units; the values
+	// of the other families are exported unchanged. Dimensionless metrics,
+	// which include counts, get no UNIT line.
+	EmitUnitComment bool
+
+	// AppInfo, if set, makes the exporter emit a gauge named BuildInfoName
+	// with the value 1 and the entries of AppInfo as its labels, for example
+	// {"version": "1.2.3", "go": runtime.Version()}, following the
+	// *_build_info convention to correlate metrics with deploys. The label
+	// names are sanitized like the names of tag keys; NewExporter returns an
+	// error if two of them collide or a value is not valid UTF-8.
+	AppInfo map[string]string
+
+	// ExemplarLabelMap renames the attachment keys of exemplars to the names
+	// of their labels, for example {"traceId": "trace_id"}, to follow the
+	// OpenMetrics conventions. The new names must be valid label names.
+	// Attachments of keys that are not in the map keep their name, unless
+	// ExemplarLabelMapStrict is set, in which case they are dropped.
+	ExemplarLabelMap map[string]string
+
+	// ExemplarLabelMapStrict drops the attachments of exemplars whose keys
+	// are not in ExemplarLabelMap instead of exporting them as they are.
+	ExemplarLabelMapStrict bool
+
+	// SumCountPairs pairs Sum views with Count views, keyed by the metric
+	// name of the Sum view with the metric name of the Count view as value,
+	// for example {"http/latency": "http/requests"}. The metric name of a
+	// view is its MetricName if set and its Name otherwise, before the
+	// Namespace is added and it is sanitized. A paired Sum view is exported
+	// as a summary without quantiles, that is as the series "<name>_sum"
+	// with its sums and "<name>_count" with the counts of the same tags of
+	// the Count view, so that rate(<name>_sum[5m]) / rate(<name>_count[5m])
+	// computes an average without a histogram. The Count view must have the
+	// same tag keys as the Sum view and is still exported on its own; the
+	// count of series without a counterpart in it is 0. Views that cannot be
+	// paired are exported as usual, and reported to OnError on the first
+	// scrape that finds them, and again after Reset. NewExporter returns an
+	// error if a name is empty or a view is paired with itself.
+	SumCountPairs map[string]string
+
+	// WithTimestamps exports the samples of views with an explicit
+	// timestamp, the time their row was last updated by a recording, which
+	// helps Prometheus with staleness and backfilled data. Samples whose
+	// update time is unknown, such as those of metrics that are not views,
+	// are exported without timestamp. Some scrapers do not handle explicit
+	// timestamps, so it is off by default.
+	WithTimestamps bool
+}
+
+// HistogramSuffixes are the suffixes appended to the name of a histogram for
+// its series, see Options.HistogramSuffixes.
+type HistogramSuffixes struct {
+	Sum    string // defaults to "_sum"
+	Count  string // defaults to "_count"
+	Bucket string // defaults to "_bucket"
+}
+
+// Default histogram suffixes.
+const (
+	defaultSumSuffix    = "_sum"
+	defaultCountSuffix  = "_count"
+	defaultBucketSuffix = "_bucket"
+)
+
+var suffixRegexp = regexp.MustCompile(`^[a-zA-Z0-9_:]+$`)
+
+// withDefaults returns the suffixes with unset ones set to their defaults.
+func (s HistogramSuffixes) withDefaults() HistogramSuffixes {
+	if s.Sum == "" {
+		s.Sum = defaultSumSuffix
+	}
+	if s.Count == "" {
+		s.Count = defaultCountSuffix
+	}
+	if s.Bucket == "" {
+		s.Bucket = defaultBucketSuffix
+	}
+	return s
+}
+
+func (s HistogramSuffixes) validate() error {
+	s = s.withDefaults()
+	for _, suffix := range []string{s.Sum, s.Count, s.Bucket} {
+		if !suffixRegexp.MatchString(suffix) {
+			return fmt.Errorf("invalid histogram suffix %q: must only contain letters, digits, underscores and colons", suffix)
+		}
+	}
+	if s.Sum == s.Count || s.Sum == s.Bucket || s.Count == s.Bucket {
+		return fmt.Errorf("histogram suffixes %q, %q and %q must be distinct", s.Sum, s.Count, s.Bucket)
+	}
+	return nil
+}
+
+// isDefault reports whether the suffixes produce the default output.
+func (s HistogramSuffixes) isDefault() bool {
+	return s.withDefaults() == HistogramSuffixes{Sum: defaultSumSuffix, Count: defaultCountSuffix, Bucket: defaultBucketSuffix}
+}
+
+// LabelCase is the case label names are converted to, see
+// Options.LabelNameCase.
+type LabelCase int
+
+// Supported label name cases.
+const (
+	LabelCaseNone  LabelCase = iota // label names are kept as they are
+	LabelCaseLower                  // label names are converted to lower case
+	LabelCaseUpper                  // label names are converted to upper case
+)
+
+func (c LabelCase) apply(name string) string {
+	switch c {
+	case LabelCaseLower:
+		return strings.ToLower(name)
+	case LabelCaseUpper:
+		return strings.ToUpper(name)
+	default:
+		return name
+	}
 }
 
 // NewExporter returns an exporter that exports stats to Prometheus.
+//
+// The Registerer the exporter registers with and the Gatherer it serves
+// metrics from must be consistent: either both are left unset, in which case
+// Registry is used, or both are set, for example to the prometheus package
+// defaults. If both are a *prometheus.Registry, they must be the same.
+// Otherwise ErrNilGatherer, ErrNilRegisterer or ErrRegistryMismatch is
+// returned, and ErrRegistryConflict if the exporter cannot be registered.
 func NewExporter(o Options) (*Exporter, error) {
+	o = withoutNilRegistries(o)
+	if err := validateRegistries(o); err != nil {
+		return nil, err
+	}
 	if o.Registry == nil {
 		o.Registry = prometheus.NewRegistry()
 	}
@@ -62,19 +317,168 @@ func NewExporter(o Options) (*Exporter, error) {
 		o.Gatherer = o.Registry
 	}
 
+	if o.InfBucketLabel != "" {
+		if f, err := strconv.ParseFloat(o.InfBucketLabel, 64); err != nil || !math.IsInf(f, 1) {
+			return nil, fmt.Errorf("invalid InfBucketLabel %q: must parse as positive infinity", o.InfBucketLabel)
+		}
+	}
+
+	if err := o.HistogramSuffixes.validate(); err != nil {
+		return nil, err
+	}
+	for from, to := range o.LabelRenames {
+		if !labelNameRegexp.MatchString(to) {
+			return nil, fmt.Errorf("invalid LabelRenames target %q for label %q: not a valid label name", to, from)
+		}
+	}
+	for sum, count := range o.SumCountPairs {
+		if sum == "" || count == "" || sum == count {
+			return nil, fmt.Errorf("invalid SumCountPairs entry %q: %q: names must be non-empty and distinct", sum, count)
+		}
+	}
+	for from, to := range o.ExemplarLabelMap {
+		if !labelNameRegexp.MatchString(to) {
+			return nil, fmt.Errorf("invalid ExemplarLabelMap target %q for attachment %q: not a valid label name", to, from)
+		}
+	}
+	if _, err := buildInfo(o.AppInfo); err != nil {
+		return nil, err
+	}
+	e, err := newExporter(o, nil)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// newExporter returns an exporter for the validated options o, exporting
+// only the metrics whose resource matches match, if not nil. The exporter is
+// returned even if it cannot be registered, together with the error.
+func newExporter(o Options, match func(*resource.Resource) bool) (*Exporter, error) {
+	g := o.Gatherer
+	if o.SortSeries {
+		g = &sortedGatherer{g}
+	}
+	if o.LabelSort != nil {
+		g = &labelSortGatherer{Gatherer: g, less: o.LabelSort}
+	}
+
+	handler := promhttp.HandlerFor(g, promhttp.HandlerOpts{EnableOpenMetrics: o.EnableOpenMetrics})
 	e := &Exporter{
-		opts:    o,
-		g:       o.Gatherer,
-		handler: promhttp.HandlerFor(o.Gatherer, promhttp.HandlerOpts{}),
+		opts:               o,
+		g:                  g,
+		handler:            handler,
+		openMetricsHandler: handler,
+		collecting:         make(chan struct{}, 1),
+	}
+	infLabel := o.InfBucketLabel
+	if infLabel == "" {
+		infLabel = "+Inf"
+	}
+	if o.EmitUnitComment || infLabel != "+Inf" {
+		e.openMetricsHandler = http.HandlerFunc(e.serveOpenMetrics)
+	}
+	switch {
+	case !o.HistogramSuffixes.isDefault():
+		hg := &histogramGatherer{Gatherer: g, suffixes: o.HistogramSuffixes.withDefaults(), infLabel: infLabel, onError: e.opts.onError}
+		e.handler = promhttp.HandlerFor(hg, promhttp.HandlerOpts{})
+	case infLabel != "+Inf":
+		e.handler = e.withInfBucketLabel(handler)
 	}
 	collector := newCollector(&e.opts, o.Registerer)
+	collector.match = match
+	collector.buildInfo, _ = buildInfo(o.AppInfo)
+	collector.exemplarLabels = &exemplarLabels{names: o.ExemplarLabelMap, strict: o.ExemplarLabelMapStrict}
 	e.c = collector
-	collector.ensureRegisteredOnce()
-
+	if err := collector.ensureRegisteredOnce(); err != nil {
+		return e, err
+	}
 	return e, nil
 }
 
-var _ http.Handler = (*Exporter)(nil)
+// ForResource returns an exporter with the options of e that only exports
+// the metrics of the meters whose resource matches match, see
+// view.Meter.SetResource; metrics without a resource are passed a nil
+// resource. This allows serving the metrics of each resource, for example
+// of each tenant, on a separate path:
+//
+//	for _, tenant := range tenants {
+//		mux.Handle("/metrics/"+tenant, exporter.ForResource(prometheus.ResourceLabel("tenant", tenant)))
+//	}
+//
+// Resource labels are merged into the labels of the exported series as by e.
+// The returned exporter gathers its metrics from a registry of its own,
+// which is not the Registry of the options of e.
+func (e *Exporter) ForResource(match func(*resource.Resource) bool) *Exporter {
+	o := e.opts
+	o.Registry = prometheus.NewRegistry()
+	o.Registerer = o.Registry
+	o.Gatherer = o.Registry
+	r, err := newExporter(o, match)
+	if err != nil {
+		e.opts.onError(err)
+	}
+	return r
+}
+
+// ResourceLabel returns a resource matcher for ForResource that matches
+// the resources whose label key has the given value.
+func ResourceLabel(key, value string) func(*resource.Resource) bool {
+	return func(r *resource.Resource) bool {
+		if r == nil {
+			return false
+		}
+		v, ok := r.Labels[key]
+		return ok && v == value
+	}
+}
+
+// withoutNilRegistries returns o with the Registerer and Gatherer unset if
+// they are nil *prometheus.Registry values, which would panic when used, so
+// that they are treated as unset by NewExporter rather than at scrape time.
+func withoutNilRegistries(o Options) Options {
+	if r, ok := o.Registerer.(*prometheus.Registry); ok && r == nil {
+		o.Registerer = nil
+	}
+	if g, ok := o.Gatherer.(*prometheus.Registry); ok && g == nil {
+		o.Gatherer = nil
+	}
+	return o
+}
+
+// validateRegistries checks that the metrics registered with the Registerer
+// are served from the Gatherer. Registerers and Gatherers other than
+// *prometheus.Registry, such as wrappers, cannot be inspected and are trusted.
+func validateRegistries(o Options) error {
+	if o.Registry == nil {
+		switch {
+		case o.Registerer != nil && o.Gatherer == nil:
+			return fmt.Errorf("%w: Registerer is set without a Gatherer or Registry; metrics would not be served", ErrNilGatherer)
+		case o.Registerer == nil && o.Gatherer != nil:
+			return fmt.Errorf("%w: Gatherer is set without a Registerer or Registry; metrics would not be registered with it", ErrNilRegisterer)
+		}
+	}
+	registerer, gatherer := o.Registerer, o.Gatherer
+	if registerer == nil {
+		registerer = o.Registry
+	}
+	if gatherer == nil {
+		gatherer = o.Registry
+	}
+	r, ok := registerer.(*prometheus.Registry)
+	if !ok {
+		return nil
+	}
+	if g, ok := gatherer.(*prometheus.Registry); ok && r != g {
+		return fmt.Errorf("%w: Registerer and Gatherer are different registries; metrics would not be served", ErrRegistryMismatch)
+	}
+	return nil
+}
+
+var (
+	_ http.Handler  = (*Exporter)(nil)
+	_ view.Exporter = (*Exporter)(nil)
+)
 
 // ensureRegisteredOnce invokes reg.Register on the collector itself
 // exactly once to ensure that we don't get errors such as
@@ -82,13 +486,62 @@ var _ http.Handler = (*Exporter)(nil)
 //  already exists with the same fully-qualified name and const label values
 // which is documented by Prometheus at
 //  https://github.com/prometheus/client_golang/blob/fcc130e101e76c5d303513d0e28f4b6d732845c7/prometheus/registry.go#L89-L101
-func (c *collector) ensureRegisteredOnce() {
+func (c *collector) ensureRegisteredOnce() (err error) {
 	c.registerOnce.Do(func() {
-		if err := c.reg.Register(c); err != nil {
-			c.opts.onError(fmt.Errorf("cannot register the collector: %v", err))
+		if rerr := c.register(); rerr != nil {
+			err = &registerError{rerr}
 		}
 	})
+	return err
+}
+
+// registration is c as registered with the Registerer. It is described by
+// the descriptors of the metrics at the time of registration, which the
+// Registerer identifies it by, so that it can be unregistered after the
+// metrics changed.
+type registration struct {
+	*collector
+	descs []*prometheus.Desc
+}
+
+func (r *registration) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range r.descs {
+		ch <- d
+	}
+}
 
+// newRegistration returns a registration of c described by its current
+// metrics.
+func (c *collector) newRegistration() *registration {
+	descCh := make(chan *prometheus.Desc)
+	r := &registration{collector: c}
+	go func() {
+		c.Describe(descCh)
+		close(descCh)
+	}()
+	for d := range descCh {
+		r.descs = append(r.descs, d)
+	}
+	return r
+}
+
+// register registers c with the Registerer, described by its current
+// metrics.
+func (c *collector) register() error {
+	r := c.newRegistration()
+	c.registeredMu.Lock()
+	defer c.registeredMu.Unlock()
+	return c.registerLocked(r)
+}
+
+// registerLocked registers r as the registration of c. The registration mutex
+// must be held.
+func (c *collector) registerLocked(r *registration) error {
+	if err := c.reg.Register(r); err != nil {
+		return err
+	}
+	c.registered = r
+	return nil
 }
 
 func (o *Options) onError(err error) {
@@ -111,7 +564,88 @@ func (e *Exporter) ExportView(vd *view.Data) {
 
 // ServeHTTP serves the Prometheus endpoint.
 func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	e.handler.ServeHTTP(w, r)
+	if e.handler == nil {
+		http.Error(w, "prometheus exporter not created with NewExporter", http.StatusInternalServerError)
+		return
+	}
+	handler := e.handler
+	if e.opts.EnableOpenMetrics && expfmt.NegotiateIncludingOpenMetrics(r.Header) == expfmt.FmtOpenMetrics {
+		handler = e.openMetricsHandler
+	}
+	if e.opts.CollectTimeout <= 0 {
+		handler.ServeHTTP(w, r)
+		return
+	}
+
+	br := newBufferedResponse()
+	if err := e.serveWithTimeout(handler, br, r); err != nil {
+		e.opts.onError(err)
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	br.copyTo(w)
+}
+
+// serveWithTimeout serves r with handler into br, returning an error if it
+// did not complete within the configured CollectTimeout, including the time
+// spent waiting for a previous collection to complete. br must not be used
+// after an error, as the collection may still write to it.
+func (e *Exporter) serveWithTimeout(handler http.Handler, br *bufferedResponse, r *http.Request) error {
+	timer := time.NewTimer(e.opts.CollectTimeout)
+	defer timer.Stop()
+	select {
+	case e.collecting <- struct{}{}:
+	case <-timer.C:
+		return fmt.Errorf("a previous collection did not complete within %v", e.opts.CollectTimeout)
+	}
+
+	// Collection keeps running in the background after a timeout, with all
+	// the effects of a scrape, such as starting a new window for the views
+	// using view.Gauge; its response is dropped. The collecting token is
+	// released on completion or timeout, whichever comes first, so that a
+	// stuck collection does not fail all further scrapes.
+	var release sync.Once
+	releaseToken := func() { release.Do(func() { <-e.collecting }) }
+	done := make(chan struct{})
+	go func() {
+		defer releaseToken()
+		defer close(done)
+		handler.ServeHTTP(br, r)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-timer.C:
+		releaseToken()
+		return fmt.Errorf("collection did not complete within %v", e.opts.CollectTimeout)
+	}
+}
+
+// bufferedResponse is an http.ResponseWriter that holds the response in memory
+// until it is copied to the actual ResponseWriter.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newBufferedResponse() *bufferedResponse {
+	return &bufferedResponse{header: make(http.Header), status: http.StatusOK}
+}
+
+func (br *bufferedResponse) Header() http.Header { return br.header }
+
+func (br *bufferedResponse) Write(b []byte) (int, error) { return br.body.Write(b) }
+
+func (br *bufferedResponse) WriteHeader(status int) { br.status = status }
+
+func (br *bufferedResponse) copyTo(w http.ResponseWriter) {
+	for k, v := range br.header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(br.status)
+	w.Write(br.body.Bytes())
 }
 
 // SetConstLabel set/updates constant prometheus labels.
@@ -119,31 +653,178 @@ func (e *Exporter) SetConstLabel(name, value string) {
 	e.opts.ConstLabels[name] = value
 }
 
+// Reset drops the state the exporter keeps about the metrics it exported,
+// for example after unregistering all views, so that the next scrape only
+// reflects the currently registered views. This is the descriptors the
+// collector reported to the Registerer when it was registered, which Reset
+// re-registers it to refresh, the units of EmitUnitComment, and the pairing
+// errors of SumCountPairs reported already. Labels of a metric name must
+// still be consistent with the ones registered before, as the Registerer
+// requires. It is safe to call during scrapes, although a
+// scrape concurrent with Reset may miss the metrics of the exporter.
+func (e *Exporter) Reset() {
+	c := e.c
+	c.resetUnits()
+	c.resetPairErrors()
+	r := c.newRegistration()
+
+	c.registeredMu.Lock()
+	defer c.registeredMu.Unlock()
+	old := c.registered
+	if old == nil || !c.reg.Unregister(old) {
+		// The collector is not registered, or registered unchecked without
+		// descriptors, which the Registerer keeps nothing of.
+		return
+	}
+	if err := c.registerLocked(r); err != nil {
+		e.opts.onError(fmt.Errorf("cannot register the collector: %v", err))
+		if err := c.registerLocked(old); err != nil {
+			e.opts.onError(fmt.Errorf("cannot restore the registration of the collector: %v", err))
+		}
+	}
+}
+
+// SetExemplarsEnabled enables or disables exposing the exemplars of
+// histogram buckets in the OpenMetrics format, see
+// Options.EnableOpenMetrics, for example for privacy or volume concerns,
+// without re-creating the exporter or re-registering views. It takes effect
+// from the next scrape on and may be called concurrently with scrapes.
+// Exemplars are enabled by default. Unlike view.SetExemplarEnabled, which
+// stops retaining exemplars when recording, this only affects the exporter,
+// so exemplars are exposed again once re-enabled.
+func (e *Exporter) SetExemplarsEnabled(enabled bool) {
+	var disabled uint32
+	if !enabled {
+		disabled = 1
+	}
+	atomic.StoreUint32(&e.c.exemplarsDisabled, disabled)
+}
+
+// MetricNames returns the sorted names of the metric families the exporter
+// exports for the currently registered views, with the Namespace prefix
+// applied and sanitized as exported, for example to generate dashboards or
+// alerting rules. The names are read from the producers the exporter reads,
+// including all meters. The views registered with the meters are included
+// even without recorded data, although they are only exported once data is
+// recorded for them, except for exporters returned by ForResource, which
+// only include the views with data, as the resource of a view is only known
+// with its data. Views are named after their MetricName if set. If
+// HistogramSuffixes are set, histograms are listed as the untyped families
+// of their series, named with the suffixes, as exported in the formats
+// other than OpenMetrics.
+func (e *Exporter) MetricNames() []string {
+	ne := &nameExporter{c: e.c, names: make(map[string]struct{})}
+	e.c.reader.ReadAndExport(ne)
+	if e.c.match == nil {
+		for _, p := range metricproducer.GlobalManager().GetAll() {
+			m, ok := p.(view.Meter)
+			if !ok {
+				continue
+			}
+			for _, v := range m.RegisteredViews() {
+				histogram := v.Aggregation.Type == view.AggTypeDistribution
+				for _, name := range v.MetricNames() {
+					ne.add(promName(e.opts.Namespace, name), histogram)
+				}
+			}
+		}
+	}
+	names := make([]string, 0, len(ne.names))
+	for name := range ne.names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // collector implements prometheus.Collector
 type collector struct {
 	opts *Options
 
 	registerOnce sync.Once
 
+	// registered is the registration of the collector with reg, if any.
+	registeredMu sync.Mutex
+	registered   *registration
+
 	// reg helps collector register views dynamically.
 	reg prometheus.Registerer
 
 	// reader reads metrics from all registered producers.
 	reader *metricexport.Reader
+
+	// match, if set, selects the metrics to export by their resource.
+	match func(*resource.Resource) bool
+
+	// units are the Prometheus units of the collected metric families by
+	// name, if Options.EmitUnitComment is set.
+	unitsMu sync.Mutex
+	units   map[string]string
+
+	// sanitizedResources caches the sanitized copies of the resources of
+	// the collected metrics, see sanitized.
+	sanitizedMu        sync.Mutex
+	sanitizedResources map[*resource.Resource]*resource.Resource
+
+	// buildInfo is the gauge of Options.AppInfo, if any.
+	buildInfo prometheus.Metric
+
+	// exemplarLabels maps the attachments of exemplars to their labels.
+	exemplarLabels *exemplarLabels
+
+	// exemplarsDisabled is 1 while exemplars are disabled with
+	// SetExemplarsEnabled, use atomic to access.
+	exemplarsDisabled uint32
+
+	// pairErrors are the metric names of the Sum views of
+	// Options.SumCountPairs whose pairing error was reported, see
+	// reportPairError.
+	pairErrorsMu sync.Mutex
+	pairErrors   map[string]bool
+}
+
+// matches reports whether the metric m is exported by c.
+func (c *collector) matches(m *metricdata.Metric) bool {
+	return c.match == nil || c.match(m.Resource)
 }
 
 func (c *collector) Describe(ch chan<- *prometheus.Desc) {
 	de := &descExporter{c: c, descCh: ch}
 	c.reader.ReadAndExport(de)
+	if c.buildInfo != nil {
+		ch <- c.buildInfo.Desc()
+	}
 }
 
 // Collect fetches the statistics from OpenCensus
 // and delivers them as Prometheus Metrics.
 // Collect is invoked every time a prometheus.Gatherer is run
 // for example when the HTTP endpoint is invoked by Prometheus.
+// Descriptors are derived from the metrics read on every call and are never
+// cached, so a view that is re-registered under the same name with a
+// different aggregation is exported with its new type from the next scrape on.
+// The views using view.Gauge report the values recorded since the previous
+// collection by c.
 func (c *collector) Collect(ch chan<- prometheus.Metric) {
 	me := &metricExporter{c: c, metricCh: ch}
-	c.reader.ReadAndExport(me)
+	me.ExportMetrics(context.Background(), c.readWindow())
+	if c.buildInfo != nil {
+		ch <- c.buildInfo
+	}
+}
+
+// readWindow reads the metrics of all producers like c.reader, but reads the
+// meters of the view package through the Gauge windows of c.
+func (c *collector) readWindow() []*metricdata.Metric {
+	var metrics []*metricdata.Metric
+	for _, p := range metricproducer.GlobalManager().GetAll() {
+		if m, ok := p.(view.Meter); ok {
+			metrics = append(metrics, m.ReadWindow(c)...)
+		} else {
+			metrics = append(metrics, p.Read()...)
+		}
+	}
+	return metrics
 }
 
 func newCollector(opts *Options, registrar prometheus.Registerer) *collector {
@@ -154,28 +835,184 @@ func newCollector(opts *Options, registrar prometheus.Registerer) *collector {
 }
 
 func (c *collector) toDesc(metric *metricdata.Metric) *prometheus.Desc {
-	var labels prometheus.Labels
-	switch {
-	case metric.Resource == nil:
-		labels = c.opts.ConstLabels
-	case c.opts.ConstLabels == nil:
-		labels = metric.Resource.Labels
-	default:
-		labels = prometheus.Labels{}
-		for k, v := range c.opts.ConstLabels {
-			labels[k] = v
+	name := metricName(c.opts.Namespace, metric)
+	labels, consts, err := exportedLabels(c.opts, toPromLabels(metric.Descriptor.LabelKeys), c.sanitized(metric.Resource))
+	if err != nil {
+		return prometheus.NewInvalidDesc(fmt.Errorf("metric %q: %v", name, err))
+	}
+	return prometheus.NewDesc(name, metric.Descriptor.Description, labels, consts)
+}
+
+// exportedLabels returns the names of the variable labels and the const labels
+// of the metrics with the sanitized label names labels and the sanitized
+// resource res, as exported with opts: resource labels overwrite
+// opts.ConstLabels, then opts.LabelRenames and opts.LabelNameCase are applied.
+// It returns an error if two labels collide.
+func exportedLabels(opts *Options, labels []string, res *resource.Resource) ([]string, prometheus.Labels, error) {
+	consts := constLabels(res, opts.ConstLabels)
+	var err error
+	if len(opts.LabelRenames) > 0 {
+		if labels, err = renameLabels(opts.LabelRenames, labels, consts); err != nil {
+			return nil, nil, err
+		}
+	}
+	if opts.LabelNameCase != LabelCaseNone {
+		if labels, consts, err = applyLabelCase(opts.LabelNameCase, labels, consts); err != nil {
+			return nil, nil, err
 		}
-		// Resource labels overwrite const labels.
-		for k, v := range metric.Resource.Labels {
-			labels[k] = v
+	}
+	for _, l := range labels {
+		if _, ok := consts[l]; ok {
+			return nil, nil, fmt.Errorf("label %q is both a variable and a const label", l)
 		}
 	}
+	return labels, consts, nil
+}
 
-	return prometheus.NewDesc(
-		metricName(c.opts.Namespace, metric),
-		metric.Descriptor.Description,
-		toPromLabels(metric.Descriptor.LabelKeys),
-		labels)
+// renameLabels renames the variable labels according to renames, and returns
+// an error if this makes a label collide with another variable or const label.
+func renameLabels(renames map[string]string, labels []string, consts prometheus.Labels) ([]string, error) {
+	renamed := make([]string, len(labels))
+	original := make(map[string]string, len(labels))
+	for i, l := range labels {
+		name := l
+		if to, ok := renames[l]; ok {
+			name = to
+		}
+		if prev, ok := original[name]; ok {
+			return nil, fmt.Errorf("labels %q and %q collide as %q", prev, l, name)
+		}
+		if _, ok := consts[name]; ok && name != l {
+			return nil, fmt.Errorf("label %q collides with const label %q", l, name)
+		}
+		original[name] = l
+		renamed[i] = name
+	}
+	return renamed, nil
+}
+
+// applyLabelCase converts the variable and const label names to the case lc,
+// and returns an error if this makes two of them collide.
+func applyLabelCase(lc LabelCase, labels []string, consts prometheus.Labels) ([]string, prometheus.Labels, error) {
+	original := make(map[string]string, len(labels)+len(consts))
+	convert := func(name string) (string, error) {
+		converted := lc.apply(name)
+		if prev, ok := original[converted]; ok && prev != name {
+			return "", fmt.Errorf("label names %q and %q collide as %q", prev, name, converted)
+		}
+		original[converted] = name
+		return converted, nil
+	}
+	converted := make([]string, len(labels))
+	for i, l := range labels {
+		var err error
+		if converted[i], err = convert(l); err != nil {
+			return nil, nil, err
+		}
+	}
+	// Convert const labels in a fixed order for deterministic errors.
+	names := make([]string, 0, len(consts))
+	for k := range consts {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	convertedConsts := make(prometheus.Labels, len(consts))
+	for _, k := range names {
+		c, err := convert(k)
+		if err != nil {
+			return nil, nil, err
+		}
+		convertedConsts[c] = consts[k]
+	}
+	return converted, convertedConsts, nil
+}
+
+// maxSanitizedResources bounds the number of sanitized resources a collector
+// caches.
+const maxSanitizedResources = 64
+
+// sanitized returns res with its label keys made valid Prometheus label
+// names, see resource.Resource.Sanitize. Resources are read for every metric
+// on every scrape while they rarely change, so the sanitized copies are
+// cached by resource; the resources of meters must not be modified after
+// they are set.
+func (c *collector) sanitized(res *resource.Resource) *resource.Resource {
+	if res == nil {
+		return nil
+	}
+	c.sanitizedMu.Lock()
+	defer c.sanitizedMu.Unlock()
+	if s, ok := c.sanitizedResources[res]; ok {
+		return s
+	}
+	if c.sanitizedResources == nil || len(c.sanitizedResources) >= maxSanitizedResources {
+		c.sanitizedResources = make(map[*resource.Resource]*resource.Resource)
+	}
+	s := res.Sanitize()
+	c.sanitizedResources[res] = s
+	return s
+}
+
+// constLabels merges the labels of the sanitized resource res into the const
+// labels. Resource labels overwrite const labels. The result must not be
+// modified.
+func constLabels(res *resource.Resource, labels prometheus.Labels) prometheus.Labels {
+	switch {
+	case res == nil:
+		return labels
+	case labels == nil:
+		return res.Labels
+	}
+	merged := prometheus.Labels{}
+	for k, v := range labels {
+		merged[k] = v
+	}
+	for k, v := range res.Labels {
+		merged[k] = v
+	}
+	return merged
+}
+
+// LabelsForRow returns the full Prometheus label set an exporter with
+// ConstLabels constLabels and no other label options attaches to row r of view
+// v when the view data is associated with resource res. See
+// Exporter.LabelsForRow.
+func LabelsForRow(v *view.View, r *view.Row, res *resource.Resource, constLabels prometheus.Labels) (prometheus.Labels, error) {
+	return labelsForRow(&Options{ConstLabels: constLabels}, v, r, res)
+}
+
+// LabelsForRow returns the full Prometheus label set e attaches to row r of
+// view v when the view data is associated with resource res. Resource labels
+// overwrite const labels, and the row gets one label per tag key of the view,
+// with an empty value for the keys it has no tag for. Label names are
+// sanitized, renamed and converted like the exporter does, and like the
+// exporter LabelsForRow returns an error if two labels collide, including a
+// tag key with a const or resource label.
+func (e *Exporter) LabelsForRow(v *view.View, r *view.Row, res *resource.Resource) (prometheus.Labels, error) {
+	return labelsForRow(&e.opts, v, r, res)
+}
+
+func labelsForRow(opts *Options, v *view.View, r *view.Row, res *resource.Resource) (prometheus.Labels, error) {
+	names := make([]string, len(v.TagKeys))
+	for i, k := range v.TagKeys {
+		names[i] = sanitize(k.Name())
+	}
+	names, consts, err := exportedLabels(opts, names, res.Sanitize())
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[tag.Key]string, len(r.Tags))
+	for _, t := range r.Tags {
+		values[t.Key] = t.Value
+	}
+	labels := make(prometheus.Labels, len(consts)+len(names))
+	for k, val := range consts {
+		labels[k] = val
+	}
+	for i, k := range v.TagKeys {
+		labels[names[i]] = values[k]
+	}
+	return labels, nil
 }
 
 type metricExporter struct {
@@ -187,19 +1024,65 @@ type metricExporter struct {
 // Each OpenCensus Metric will be converted to
 // corresponding Prometheus Metric:
 // TypeCumulativeInt64 and TypeCumulativeFloat64 will be a Counter Metric,
-// TypeCumulativeDistribution will be a Histogram Metric.
-// TypeGaugeFloat64 and TypeGaugeInt64 will be a Gauge Metric
+// TypeCumulativeDistribution will be a Histogram Metric, with the bucket
+// bounds of each point as le labels. For views using view.AutoDistribution,
+// these bounds differ between series and may change between scrapes, so
+// that queries need to aggregate histograms by le with care.
+// TypeGaugeFloat64 and TypeGaugeInt64 will be a Gauge Metric,
+// TypeSummary will be a Summary Metric.
+// Views without recorded data have no time series and are not exported at
+// all, without HELP and TYPE lines, until data is recorded for them.
 func (me *metricExporter) ExportMetrics(ctx context.Context, metrics []*metricdata.Metric) error {
+	var byName map[string]*metricdata.Metric
+	if len(me.c.opts.SumCountPairs) > 0 {
+		byName = make(map[string]*metricdata.Metric, len(metrics))
+		for _, metric := range metrics {
+			if me.c.matches(metric) {
+				byName[metric.Descriptor.Name] = metric
+			}
+		}
+	}
 	for _, metric := range metrics {
+		if !me.c.matches(metric) {
+			continue
+		}
 		desc := me.c.toDesc(metric)
+		counts, paired := me.c.pairedCounts(metric, byName)
+		var exemplarMap *exemplarLabels
+		if atomic.LoadUint32(&me.c.exemplarsDisabled) == 0 {
+			exemplarMap = me.c.exemplarLabels
+		}
+		factor := 1.0
+		if me.c.opts.EmitUnitComment {
+			// OpenMetrics requires the name of a family with a unit to end
+			// with the unit. Values are only converted for these families,
+			// so that the name tells their unit in every format.
+			name := metricName(me.c.opts.Namespace, metric)
+			if unit, f := promUnit(metric.Descriptor.Unit); unit != "" && strings.HasSuffix(name, "_"+unit) {
+				me.c.setUnit(name, unit)
+				factor = f
+			}
+		}
 		for _, ts := range metric.TimeSeries {
 			tvs := toLabelValues(ts.LabelValues)
 			for _, point := range ts.Points {
-				metric, err := toPromMetric(desc, metric, point, tvs)
+				if factor != 1 {
+					point = scalePoint(point, factor)
+				}
+				var pm prometheus.Metric
+				var err error
+				if paired {
+					pm, err = toPairedSummary(desc, ts, point, counts, tvs)
+				} else {
+					pm, err = toPromMetric(desc, metric, point, tvs, exemplarMap, me.c.opts.onError)
+				}
 				if err != nil {
 					me.c.opts.onError(err)
-				} else if metric != nil {
-					me.metricCh <- metric
+				} else if pm != nil {
+					if me.c.opts.WithTimestamps && !ts.Updated.IsZero() {
+						pm = prometheus.NewMetricWithTimestamp(ts.Updated, pm)
+					}
+					me.metricCh <- pm
 				}
 			}
 		}
@@ -216,12 +1099,45 @@ type descExporter struct {
 // It is invoked when request to scrape descriptors is received.
 func (me *descExporter) ExportMetrics(ctx context.Context, metrics []*metricdata.Metric) error {
 	for _, metric := range metrics {
+		if !me.c.matches(metric) {
+			continue
+		}
 		desc := me.c.toDesc(metric)
 		me.descCh <- desc
 	}
 	return nil
 }
 
+type nameExporter struct {
+	c     *collector
+	names map[string]struct{}
+}
+
+// ExportMetrics collects the names of the exported metrics.
+func (ne *nameExporter) ExportMetrics(ctx context.Context, metrics []*metricdata.Metric) error {
+	for _, metric := range metrics {
+		if !ne.c.matches(metric) {
+			continue
+		}
+		histogram := metric.Descriptor.Type == metricdata.TypeCumulativeDistribution
+		ne.add(metricName(ne.c.opts.Namespace, metric), histogram)
+	}
+	return nil
+}
+
+// add adds the names of the families of the metric name, which is a
+// histogram if histogram is set.
+func (ne *nameExporter) add(name string, histogram bool) {
+	if !histogram || ne.c.opts.HistogramSuffixes.isDefault() {
+		ne.names[name] = struct{}{}
+		return
+	}
+	s := ne.c.opts.HistogramSuffixes.withDefaults()
+	for _, suffix := range []string{s.Bucket, s.Sum, s.Count} {
+		ne.names[name+suffix] = struct{}{}
+	}
+}
+
 func toPromLabels(mls []metricdata.LabelKey) (labels []string) {
 	for _, ml := range mls {
 		labels = append(labels, sanitize(ml.Key))
@@ -230,18 +1146,24 @@ func toPromLabels(mls []metricdata.LabelKey) (labels []string) {
 }
 
 func metricName(namespace string, m *metricdata.Metric) string {
-	var name string
+	return promName(namespace, m.Descriptor.Name)
+}
+
+// promName returns the name the metric with the given name is exported as.
+func promName(namespace, name string) string {
 	if namespace != "" {
-		name = namespace + "_"
+		return namespace + "_" + sanitize(name)
 	}
-	return name + sanitize(m.Descriptor.Name)
+	return sanitize(name)
 }
 
 func toPromMetric(
 	desc *prometheus.Desc,
 	metric *metricdata.Metric,
 	point metricdata.Point,
-	labelValues []string) (prometheus.Metric, error) {
+	labelValues []string,
+	exemplarMap *exemplarLabels,
+	onError func(error)) (prometheus.Metric, error) {
 	switch metric.Descriptor.Type {
 	case metricdata.TypeCumulativeFloat64, metricdata.TypeCumulativeInt64:
 		pv, err := toPromValue(point)
@@ -261,20 +1183,53 @@ func toPromMetric(
 		switch v := point.Value.(type) {
 		case *metricdata.Distribution:
 			points := make(map[float64]uint64)
+			exemplars := make(map[float64]*dto.Exemplar)
 			// Histograms are cumulative in Prometheus.
 			// Get cumulative bucket counts.
 			cumCount := uint64(0)
-			for i, b := range v.BucketOptions.Bounds {
-				cumCount += uint64(v.Buckets[i].Count)
-				points[b] = cumCount
+			for i, b := range v.Buckets {
+				bound := math.Inf(1)
+				if i < len(v.BucketOptions.Bounds) {
+					bound = v.BucketOptions.Bounds[i]
+				}
+				cumCount += uint64(b.Count)
+				if b.Exemplar != nil && exemplarMap != nil {
+					e, err := exemplarMap.toPromExemplar(b.Exemplar)
+					if err != nil {
+						onError(err)
+					} else {
+						exemplars[bound] = e
+					}
+				}
+				// The +Inf bucket is implied, unless it carries an exemplar.
+				if !math.IsInf(bound, 1) || exemplars[bound] != nil {
+					points[bound] = cumCount
+				}
 			}
-			return prometheus.NewConstHistogram(desc, uint64(v.Count), v.Sum, points, labelValues...)
+			hist, err := prometheus.NewConstHistogram(desc, uint64(v.Count), v.Sum, points, labelValues...)
+			if err != nil || len(exemplars) == 0 {
+				return hist, err
+			}
+			return &histogramWithExemplars{Metric: hist, exemplars: exemplars}, nil
 		default:
 			return nil, typeMismatchError(point)
 		}
 	case metricdata.TypeSummary:
-		// TODO: [rghetia] add support for TypeSummary.
-		return nil, nil
+		switch v := point.Value.(type) {
+		case *metricdata.Summary:
+			// Percentiles are in (0, 100], Prometheus quantiles in (0, 1].
+			quantiles := make(map[float64]float64, len(v.Snapshot.Percentiles))
+			for p, value := range v.Snapshot.Percentiles {
+				quantiles[p/100] = value
+			}
+			count, sum := v.Snapshot.Count, v.Snapshot.Sum
+			if v.HasCountAndSum {
+				count, sum = v.Count, v.Sum
+			}
+			return prometheus.NewConstSummary(desc, uint64(count), sum, quantiles, labelValues...)
+		default:
+			return nil, typeMismatchError(point)
+		}
 	default:
 		return nil, fmt.Errorf("aggregation %T is not yet supported", metric.Descriptor.Type)
 	}
@@ -16,10 +16,16 @@ package prometheus
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -31,6 +37,8 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
 )
 
 type mSlice []*stats.Int64Measure
@@ -377,6 +385,19 @@ tests_baz{account="test",method="issue961",region="us-east",service="bigtable"}
 # HELP tests_foo foo
 # TYPE tests_foo counter
 tests_foo{account="test",method="issue961",region="us-east",service="bigtable"} 1
+`,
+	}, {
+		name:     "resource with invalid label keys",
+		resource: &resource.Resource{Type: "test resource", Labels: map[string]string{"cloud.region": "us-east", "1zone": "a"}},
+		want: `# HELP tests_bar bar
+# TYPE tests_bar counter
+tests_bar{cloud_region="us-east",key_1zone="a",method="issue961"} 1
+# HELP tests_baz baz
+# TYPE tests_baz counter
+tests_baz{cloud_region="us-east",key_1zone="a",method="issue961"} 1
+# HELP tests_foo foo
+# TYPE tests_foo counter
+tests_foo{cloud_region="us-east",key_1zone="a",method="issue961"} 1
 `,
 	}}
 	measureLabel, _ := tag.NewKey("method")
@@ -459,153 +480,2411 @@ tests_foo{account="test",method="issue961",region="us-east",service="bigtable"}
 	}
 }
 
-func TestViewMeasureWithoutTag(t *testing.T) {
-	exporter, err := NewExporter(Options{})
+func TestLabelSort(t *testing.T) {
+	resourceLabels := map[string]string{"region": "us-east", "zone": "a"}
+	exporter, err := NewExporter(Options{
+		ConstLabels: prometheus.Labels{"service": "spanner"},
+		// Put resource labels first, then everything else alphabetically.
+		LabelSort: func(a, b string) bool {
+			_, aRes := resourceLabels[a]
+			_, bRes := resourceLabels[b]
+			if aRes != bRes {
+				return aRes
+			}
+			return a < b
+		},
+	})
 	if err != nil {
 		t.Fatalf("failed to create prometheus exporter: %v", err)
 	}
-	m := stats.Int64("tests/foo", "foo", stats.UnitDimensionless)
-	k1, _ := tag.NewKey("key/1")
-	k2, _ := tag.NewKey("key/2")
-	k3, _ := tag.NewKey("key/3")
-	k4, _ := tag.NewKey("key/4")
-	k5, _ := tag.NewKey("key/5")
-	randomKey, _ := tag.NewKey("issue659")
+
+	method := tag.MustNewKey("method")
+	m := stats.Int64("tests/label_sort", "label sort", "")
 	v := &view.View{
 		Name:        m.Name(),
 		Description: m.Description(),
-		TagKeys:     []tag.Key{k2, k5, k3, k1, k4}, // Ensure view has a tag
+		TagKeys:     []tag.Key{method},
 		Measure:     m,
 		Aggregation: view.Count(),
 	}
-	if err := view.Register(v); err != nil {
+	meter := view.NewMeter()
+	meter.SetResource(&resource.Resource{Type: "test resource", Labels: resourceLabels})
+	meter.Start()
+	defer meter.Stop()
+	if err := meter.Register(v); err != nil {
 		t.Fatalf("failed to create views: %v", err)
 	}
-	defer view.Unregister(v)
-	// Make a measure without some tags in the view.
-	ctx1, _ := tag.New(context.Background(), tag.Upsert(k4, "issue659"), tag.Upsert(randomKey, "value"), tag.Upsert(k2, "issue659"))
-	stats.Record(ctx1, m.M(1))
-	ctx2, _ := tag.New(context.Background(), tag.Upsert(k5, "issue659"), tag.Upsert(k3, "issue659"), tag.Upsert(k1, "issue659"))
-	stats.Record(ctx2, m.M(2))
+	defer meter.Unregister(v)
+
+	ctx, _ := tag.New(context.Background(), tag.Upsert(method, "get"))
+	stats.RecordWithOptions(ctx, stats.WithRecorder(meter), stats.WithMeasurements(m.M(1)))
+	if _, err := meter.RetrieveData(v.Name); err != nil {
+		t.Fatalf("failed to retrieve data: %v", err)
+	}
+
 	srv := httptest.NewServer(exporter)
 	defer srv.Close()
-	var i int
-	var output string
-	for {
-		time.Sleep(10 * time.Millisecond)
-		if i == 10 {
-			t.Fatal("no output at /metrics (100ms wait)")
-		}
-		i++
-		resp, err := http.Get(srv.URL)
-		if err != nil {
-			t.Fatalf("failed to get /metrics: %v", err)
-		}
-		body, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			t.Fatalf("failed to read body: %v", err)
-		}
-		resp.Body.Close()
-		output = string(body)
-		if output != "" {
-			break
-		}
-	}
-	if strings.Contains(output, "collected before with the same name and label values") {
-		t.Fatal("metric name and labels being duplicated but must be unique")
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("failed to get /metrics: %v", err)
 	}
-	if strings.Contains(output, "error(s) occurred") {
-		t.Fatal("error reported by prometheus registry")
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read body: %v", err)
 	}
-	want := `# HELP tests_foo foo
-# TYPE tests_foo counter
-tests_foo{key_1="",key_2="issue659",key_3="",key_4="issue659",key_5=""} 1
-tests_foo{key_1="issue659",key_2="",key_3="issue659",key_4="",key_5="issue659"} 1
+	resp.Body.Close()
+
+	want := `# HELP tests_label_sort label sort
+# TYPE tests_label_sort counter
+tests_label_sort{region="us-east",zone="a",method="get",service="spanner"} 1
 `
-	if output != want {
-		t.Fatalf("output differed from expected output: %s want: %s", output, want)
+	if diff := cmp.Diff(want, string(body)); diff != "" {
+		t.Errorf("unexpected prometheus output (-want +got):\n%s", diff)
 	}
 }
 
-func TestShareDefaultRegistry(t *testing.T) {
-	_, err := NewExporter(Options{
-		Registerer: prometheus.DefaultRegisterer,
-		Gatherer:   prometheus.DefaultGatherer,
+func TestLabelsForRow(t *testing.T) {
+	method, _ := tag.NewKey("method")
+	host, _ := tag.NewKey("host.name")
+	v := &view.View{Name: "tests/foo", TagKeys: []tag.Key{method, host}, Measure: stats.Int64("tests/foo", "foo", ""), Aggregation: view.Count()}
+	row := &view.Row{Tags: []tag.Tag{{Key: method, Value: "issue961"}}}
+
+	testCases := []struct {
+		name        string
+		constLabels prometheus.Labels
+		resource    *resource.Resource
+		want        prometheus.Labels
+		wantErr     bool
+	}{{
+		name: "neither const labels nor resource",
+		want: prometheus.Labels{"method": "issue961", "host_name": ""},
+	}, {
+		name:        "const labels only",
+		constLabels: prometheus.Labels{"service": "spanner"},
+		want:        prometheus.Labels{"method": "issue961", "host_name": "", "service": "spanner"},
+	}, {
+		name:     "resource only",
+		resource: &resource.Resource{Type: "test resource", Labels: map[string]string{"region": "us-east"}},
+		want:     prometheus.Labels{"method": "issue961", "host_name": "", "region": "us-east"},
+	}, {
+		name:        "const labels and resource with overlap and non-overlap",
+		constLabels: prometheus.Labels{"service": "spanner", "account": "test"},
+		resource:    &resource.Resource{Type: "test resource", Labels: map[string]string{"service": "bigtable", "region": "us-east"}},
+		want:        prometheus.Labels{"method": "issue961", "host_name": "", "account": "test", "region": "us-east", "service": "bigtable"},
+	}, {
+		name:     "resource with invalid label keys",
+		resource: &resource.Resource{Type: "test resource", Labels: map[string]string{"cloud.region": "us-east", "1zone": "a"}},
+		want:     prometheus.Labels{"method": "issue961", "host_name": "", "cloud_region": "us-east", "key_1zone": "a"},
+	}, {
+		name:        "tag collides with resource and const labels",
+		constLabels: prometheus.Labels{"method": "const"},
+		resource:    &resource.Resource{Type: "test resource", Labels: map[string]string{"method": "resource"}},
+		wantErr:     true,
+	}}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := LabelsForRow(v, row, tc.resource, tc.constLabels)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("LabelsForRow() = %v; want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LabelsForRow() failed: %v", err)
+			}
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("LabelsForRow() unexpected labels (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLabelsForRowMatchesExport(t *testing.T) {
+	status := tag.MustNewKey("http.status")
+	method := tag.MustNewKey("Method")
+	res := &resource.Resource{Type: "test resource", Labels: map[string]string{"cloud.Region": "us-east"}}
+	exporter, err := NewExporter(Options{
+		Registry:      prometheus.NewRegistry(),
+		ConstLabels:   prometheus.Labels{"Service": "spanner"},
+		LabelRenames:  map[string]string{"http_status": "code"},
+		LabelNameCase: LabelCaseLower,
+		OnError:       func(err error) { t.Errorf("unexpected error: %v", err) },
 	})
 	if err != nil {
 		t.Fatalf("failed to create prometheus exporter: %v", err)
 	}
-	m := stats.Int64("tests/foo", "foo", stats.UnitDimensionless)
-	v := &view.View{
-		Name:        m.Name(),
-		Description: m.Description(),
-		Measure:     m,
-		Aggregation: view.Count(),
+	m := stats.Int64("tests/labels", "labels", stats.UnitDimensionless)
+	v := &view.View{Name: m.Name(), TagKeys: []tag.Key{status, method}, Measure: m, Aggregation: view.Count()}
+	meter := view.NewMeter()
+	meter.SetResource(res)
+	meter.Start()
+	defer meter.Stop()
+	if err := meter.Register(v); err != nil {
+		t.Fatalf("failed to register view: %v", err)
 	}
-	if err := view.Register(v); err != nil {
-		t.Fatalf("failed to create views: %v", err)
+	ctx, _ := tag.New(context.Background(), tag.Upsert(status, "200"), tag.Upsert(method, "get"))
+	stats.RecordWithOptions(ctx, stats.WithRecorder(meter), stats.WithMeasurements(m.M(1)))
+	rows, err := meter.RetrieveData(v.Name)
+	if err != nil || len(rows) != 1 {
+		t.Fatalf("RetrieveData() = %v, %v; want one row", rows, err)
 	}
-	defer view.Unregister(v)
-	stats.Record(context.Background(), m.M(1))
 
-	// counter, prometheus way
-	c := prometheus.NewCounter(prometheus.CounterOpts{Name: "prom_counter", Help: "Prometheus Counter"})
-	prometheus.MustRegister(c)
+	want, err := exporter.LabelsForRow(v, rows[0], res)
+	if err != nil {
+		t.Fatalf("LabelsForRow() failed: %v", err)
+	}
+	mfs, err := exporter.g.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather: %v", err)
+	}
+	got := prometheus.Labels{}
+	for _, mf := range mfs {
+		if mf.GetName() != "tests_labels" {
+			continue
+		}
+		for _, lp := range mf.GetMetric()[0].GetLabel() {
+			got[lp.GetName()] = lp.GetValue()
+		}
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("exported labels differ from LabelsForRow() (-exported +LabelsForRow):\n%s", diff)
+	}
+}
 
-	c.Add(1)
+func TestLabelNameCase(t *testing.T) {
+	method := tag.MustNewKey("Method")
+	testCases := []struct {
+		name        string
+		labelCase   LabelCase
+		constLabels prometheus.Labels
+		want        string
+		wantErr     bool
+	}{{
+		name:        "none",
+		labelCase:   LabelCaseNone,
+		constLabels: prometheus.Labels{"Service": "spanner"},
+		want:        `tests_requests{Method="get",Region="us-east",Service="spanner"} 1`,
+	}, {
+		name:        "lower",
+		labelCase:   LabelCaseLower,
+		constLabels: prometheus.Labels{"Service": "spanner"},
+		want:        `tests_requests{method="get",region="us-east",service="spanner"} 1`,
+	}, {
+		name:        "upper",
+		labelCase:   LabelCaseUpper,
+		constLabels: prometheus.Labels{"Service": "spanner"},
+		want:        `tests_requests{METHOD="get",REGION="us-east",SERVICE="spanner"} 1`,
+	}, {
+		name:        "collision",
+		labelCase:   LabelCaseLower,
+		constLabels: prometheus.Labels{"method": "const"},
+		wantErr:     true,
+	}}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var (
+				mu   sync.Mutex
+				errs []error
+			)
+			exporter, err := NewExporter(Options{
+				ConstLabels:   tc.constLabels,
+				LabelNameCase: tc.labelCase,
+				OnError: func(err error) {
+					mu.Lock()
+					defer mu.Unlock()
+					errs = append(errs, err)
+				},
+			})
+			if err != nil {
+				t.Fatalf("failed to create prometheus exporter: %v", err)
+			}
+			m := stats.Int64("tests/requests", "requests", stats.UnitDimensionless)
+			v := &view.View{Name: m.Name(), Description: m.Description(), TagKeys: []tag.Key{method}, Measure: m, Aggregation: view.Count()}
+			meter := view.NewMeter()
+			meter.SetResource(&resource.Resource{Type: "test resource", Labels: map[string]string{"Region": "us-east"}})
+			meter.Start()
+			defer meter.Stop()
+			if err := meter.Register(v); err != nil {
+				t.Fatalf("failed to create views: %v", err)
+			}
+			ctx, _ := tag.New(context.Background(), tag.Upsert(method, "get"))
+			stats.RecordWithOptions(ctx, stats.WithRecorder(meter), stats.WithMeasurements(m.M(1)))
+			if _, err := meter.RetrieveData(v.Name); err != nil {
+				t.Fatalf("failed to retrieve data: %v", err)
+			}
 
-	// Use prometheus handler
-	srv := httptest.NewServer(promhttp.Handler())
-	defer srv.Close()
+			srv := httptest.NewServer(exporter)
+			defer srv.Close()
+			resp, err := http.Get(srv.URL)
+			if err != nil {
+				t.Fatalf("failed to get /metrics: %v", err)
+			}
+			body, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("failed to read body: %v", err)
+			}
+			resp.Body.Close()
 
-	var i int
-	var output string
-	for {
-		time.Sleep(10 * time.Millisecond)
-		if i == 10 {
-			t.Fatal("no output at /metrics (100ms wait)")
+			mu.Lock()
+			defer mu.Unlock()
+			if tc.wantErr {
+				if strings.Contains(string(body), "tests_requests") {
+					t.Errorf("metric with colliding label names was exported:\n%s", body)
+				}
+				if len(errs) == 0 || !strings.Contains(errs[0].Error(), `label names "Method" and "method" collide`) {
+					t.Errorf("collision was not reported to OnError: %v", errs)
+				}
+				return
+			}
+			if !strings.Contains(string(body), tc.want) {
+				t.Errorf("output does not contain %q:\n%s", tc.want, body)
+			}
+			if len(errs) != 0 {
+				t.Errorf("unexpected errors: %v", errs)
+			}
+		})
+	}
+}
+
+func TestLabelRenames(t *testing.T) {
+	if _, err := NewExporter(Options{LabelRenames: map[string]string{"http_status": "bad-name"}}); err == nil {
+		t.Error("NewExporter() with an invalid label rename = nil error; want error")
+	}
+
+	status := tag.MustNewKey("http_status")
+	method := tag.MustNewKey("method")
+	testCases := []struct {
+		name        string
+		renames     map[string]string
+		constLabels prometheus.Labels
+		want        string
+		wantErr     string
+	}{{
+		name:    "rename",
+		renames: map[string]string{"http_status": "code"},
+		want:    `tests_renamed{code="200",method="get"} 1`,
+	}, {
+		name:    "tag collision",
+		renames: map[string]string{"http_status": "method"},
+		wantErr: `labels "http_status" and "method" collide as "method"`,
+	}, {
+		name:        "const collision",
+		renames:     map[string]string{"http_status": "service"},
+		constLabels: prometheus.Labels{"service": "spanner"},
+		wantErr:     `label "http_status" collides with const label "service"`,
+	}}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var (
+				mu   sync.Mutex
+				errs []error
+			)
+			exporter, err := NewExporter(Options{
+				ConstLabels:  tc.constLabels,
+				LabelRenames: tc.renames,
+				OnError: func(err error) {
+					mu.Lock()
+					defer mu.Unlock()
+					errs = append(errs, err)
+				},
+			})
+			if err != nil {
+				t.Fatalf("failed to create prometheus exporter: %v", err)
+			}
+			m := stats.Int64("tests/renamed", "requests", stats.UnitDimensionless)
+			v := &view.View{Name: m.Name(), Description: m.Description(), TagKeys: []tag.Key{status, method}, Measure: m, Aggregation: view.Count()}
+			meter := view.NewMeter()
+			meter.Start()
+			defer meter.Stop()
+			if err := meter.Register(v); err != nil {
+				t.Fatalf("failed to create views: %v", err)
+			}
+			ctx, _ := tag.New(context.Background(), tag.Upsert(status, "200"), tag.Upsert(method, "get"))
+			stats.RecordWithOptions(ctx, stats.WithRecorder(meter), stats.WithMeasurements(m.M(1)))
+			if _, err := meter.RetrieveData(v.Name); err != nil {
+				t.Fatalf("failed to retrieve data: %v", err)
+			}
+
+			srv := httptest.NewServer(exporter)
+			defer srv.Close()
+			resp, err := http.Get(srv.URL)
+			if err != nil {
+				t.Fatalf("failed to get /metrics: %v", err)
+			}
+			body, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("failed to read body: %v", err)
+			}
+			resp.Body.Close()
+
+			mu.Lock()
+			defer mu.Unlock()
+			if tc.wantErr != "" {
+				if strings.Contains(string(body), "tests_renamed") {
+					t.Errorf("metric with colliding label names was exported:\n%s", body)
+				}
+				if len(errs) == 0 || !strings.Contains(errs[0].Error(), tc.wantErr) {
+					t.Errorf("collision was not reported to OnError: %v", errs)
+				}
+				return
+			}
+			if !strings.Contains(string(body), tc.want) {
+				t.Errorf("output does not contain %q:\n%s", tc.want, body)
+			}
+			if strings.Contains(string(body), "http_status") {
+				t.Errorf("output contains the renamed label http_status:\n%s", body)
+			}
+			if len(errs) != 0 {
+				t.Errorf("unexpected errors: %v", errs)
+			}
+		})
+	}
+}
+
+func TestSampleCounting(t *testing.T) {
+	exporter, err := NewExporter(Options{})
+	if err != nil {
+		t.Fatalf("failed to create prometheus exporter: %v", err)
+	}
+	key := tag.MustNewKey("queue")
+	m := stats.Int64("tests/queue_length", "queue length", stats.UnitDimensionless)
+	v := &view.View{Name: m.Name(), Description: m.Description(), TagKeys: []tag.Key{key}, Measure: m, Aggregation: view.LastValue()}
+	meter := view.NewMeter()
+	meter.Start()
+	defer meter.Stop()
+	meter.SetSampleCounting(true)
+	if err := meter.Register(v); err != nil {
+		t.Fatalf("failed to create views: %v", err)
+	}
+	for _, r := range []struct {
+		queue string
+		value int64
+	}{{"a", 3}, {"a", 5}, {"b", 1}, {"a", 2}} {
+		ctx, _ := tag.New(context.Background(), tag.Upsert(key, r.queue))
+		stats.RecordWithOptions(ctx, stats.WithRecorder(meter), stats.WithMeasurements(m.M(r.value)))
+	}
+	if _, err := meter.RetrieveData(v.Name); err != nil {
+		t.Fatalf("failed to retrieve data: %v", err)
+	}
+
+	srv := httptest.NewServer(exporter)
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("failed to get /metrics: %v", err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read body: %v", err)
+	}
+	resp.Body.Close()
+
+	for _, want := range []string{
+		"# TYPE tests_queue_length gauge",
+		`tests_queue_length{queue="a"} 2`,
+		"# TYPE tests_queue_length_samples_total counter",
+		`tests_queue_length_samples_total{queue="a"} 3`,
+		`tests_queue_length_samples_total{queue="b"} 1`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("output does not contain %q:\n%s", want, body)
 		}
-		i++
+	}
+}
 
+func TestReset(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		errs []error
+	)
+	exporter, err := NewExporter(Options{
+		EmitUnitComment: true,
+		OnError: func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			errs = append(errs, err)
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create prometheus exporter: %v", err)
+	}
+	srv := httptest.NewServer(exporter)
+	defer srv.Close()
+	scrape := func() string {
 		resp, err := http.Get(srv.URL)
 		if err != nil {
 			t.Fatalf("failed to get /metrics: %v", err)
 		}
-
+		defer resp.Body.Close()
 		body, err := ioutil.ReadAll(resp.Body)
 		if err != nil {
 			t.Fatalf("failed to read body: %v", err)
 		}
-		resp.Body.Close()
+		return string(body)
+	}
 
-		output = string(body)
-		if output != "" {
-			break
+	m := stats.Int64("tests/reset", "reset", stats.UnitBytes)
+	meter := view.NewMeter()
+	meter.Start()
+	defer meter.Stop()
+	record := func(keys ...tag.Key) {
+		v := &view.View{Name: "tests/reset", Description: "reset", TagKeys: keys, Measure: m, Aggregation: view.Sum()}
+		if err := meter.Register(v); err != nil {
+			t.Fatalf("failed to create views: %v", err)
+		}
+		ctx := context.Background()
+		for _, k := range keys {
+			ctx, _ = tag.New(ctx, tag.Upsert(k, "value"))
+		}
+		stats.RecordWithOptions(ctx, stats.WithRecorder(meter), stats.WithMeasurements(m.M(1)))
+		if _, err := meter.RetrieveData(v.Name); err != nil {
+			t.Fatalf("failed to retrieve data: %v", err)
 		}
 	}
 
-	if strings.Contains(output, "collected before with the same name and label values") {
-		t.Fatal("metric name and labels being duplicated but must be unique")
+	record(tag.MustNewKey("before"))
+	if out := scrape(); !strings.Contains(out, `tests_reset{before="value"} 1`) {
+		t.Fatalf("output does not contain the view before reset:\n%s", out)
 	}
-
-	if strings.Contains(output, "error(s) occurred") {
-		t.Fatal("error reported by prometheus registry")
+	for _, v := range meter.RegisteredViews() {
+		meter.Unregister(v)
+	}
+	exporter.Reset()
+	if out := scrape(); strings.Contains(out, "tests_reset") {
+		t.Errorf("output contains the unregistered view after reset:\n%s", out)
 	}
 
-	wantOc := `# HELP tests_foo foo
-# TYPE tests_foo counter
-tests_foo 1
-`
-	if !strings.Contains(output, wantOc) {
-		t.Errorf("output does not contain opencensus counter. Output: %s want: %s", output, wantOc)
+	// The same metric can be exported with other labels after a reset.
+	record(tag.MustNewKey("after"))
+	concurrent := make(chan struct{})
+	go func() {
+		defer close(concurrent)
+		exporter.Reset()
+	}()
+	scrape()
+	<-concurrent
+	if out := scrape(); !strings.Contains(out, `tests_reset{after="value"} 1`) || strings.Contains(out, "before") {
+		t.Errorf("output does not contain only the view registered after reset:\n%s", out)
 	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(errs) != 0 {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+}
 
-	wantP := `# HELP prom_counter Prometheus Counter
-# TYPE prom_counter counter
-prom_counter 1
-`
-	if !strings.Contains(output, wantP) {
-		t.Errorf("output does not contain opencensus counter. Output: %s want: %s", output, wantP)
+func TestAppInfo(t *testing.T) {
+	exporter, err := NewExporter(Options{
+		AppInfo: map[string]string{"version": "1.2.3", "go.version": "go1.17"},
+		OnError: func(err error) { t.Errorf("OnError: %v", err) },
+	})
+	if err != nil {
+		t.Fatalf("failed to create prometheus exporter: %v", err)
 	}
+	srv := httptest.NewServer(exporter)
+	defer srv.Close()
 
+	for i := 0; i < 2; i++ {
+		resp, err := http.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("failed to get /metrics: %v", err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("failed to read body: %v", err)
+		}
+		const want = `opencensus_build_info{go_version="go1.17",version="1.2.3"} 1`
+		if n := strings.Count(string(body), BuildInfoName+"{"); n != 1 || !strings.Contains(string(body), want) {
+			t.Errorf("got %d build info series; want exactly %q in output:\n%s", n, want, body)
+		}
+	}
+
+	for _, info := range []map[string]string{
+		{"go.version": "go1.17", "go_version": "go1.17"},
+		{"version": "\xff"},
+	} {
+		if _, err := NewExporter(Options{AppInfo: info}); err == nil {
+			t.Errorf("NewExporter(AppInfo: %q) = nil error; want an invalid AppInfo error", info)
+		}
+	}
+}
+
+func TestExemplarLabelMap(t *testing.T) {
+	m := stats.Float64("tests/mapped_exemplars", "latency with exemplars", stats.UnitMilliseconds)
+	v := &view.View{
+		Name:        "exemplar/mapped_latency",
+		Description: "this is a test",
+		Measure:     m,
+		Aggregation: view.Distribution(10),
+	}
+	if err := view.Register(v); err != nil {
+		t.Fatalf("Register error: %v", err)
+	}
+	defer view.Unregister(v)
+	stats.RecordWithOptions(context.Background(),
+		stats.WithAttachmentLabels(map[string]string{"traceId": "abc", "user": "u1"}),
+		stats.WithMeasurements(m.M(5)))
+
+	for _, strict := range []bool{false, true} {
+		exporter, err := NewExporter(Options{
+			EnableOpenMetrics:      true,
+			ExemplarLabelMap:       map[string]string{"traceId": "trace_id"},
+			ExemplarLabelMapStrict: strict,
+			OnError:                func(err error) { t.Errorf("OnError: %v", err) },
+		})
+		if err != nil {
+			t.Fatalf("failed to create prometheus exporter: %v", err)
+		}
+		srv := httptest.NewServer(exporter)
+		req, err := http.NewRequest("GET", srv.URL, nil)
+		if err != nil {
+			t.Fatalf("http.NewRequest error: %v", err)
+		}
+		req.Header.Set("Accept", "application/openmetrics-text; version=0.0.1")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("http.Get error: %v", err)
+		}
+		blob, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		srv.Close()
+		if err != nil {
+			t.Fatalf("Read body error: %v", err)
+		}
+
+		want := `exemplar_mapped_latency_bucket{le="10.0"} 1 # {trace_id="abc",user="u1"} 5.0 `
+		if strict {
+			want = `exemplar_mapped_latency_bucket{le="10.0"} 1 # {trace_id="abc"} 5.0 `
+		}
+		if !strings.Contains(string(blob), want) {
+			t.Errorf("strict %v: output does not contain %q. Output: %s", strict, want, blob)
+		}
+	}
+
+	if _, err := NewExporter(Options{ExemplarLabelMap: map[string]string{"traceId": "trace-id"}}); err == nil {
+		t.Error("NewExporter() with an invalid ExemplarLabelMap target = nil error; want an error")
+	}
+}
+
+func TestSumCountPairs(t *testing.T) {
+	exporter, err := NewExporter(Options{
+		SumCountPairs: map[string]string{"tests/paired_latency": "tests/paired_requests"},
+		OnError:       func(err error) { t.Errorf("OnError: %v", err) },
+	})
+	if err != nil {
+		t.Fatalf("failed to create prometheus exporter: %v", err)
+	}
+	m := stats.Float64("tests/paired_latency", "latency", stats.UnitDimensionless)
+	method := tag.MustNewKey("method")
+	sum := &view.View{Name: "tests/paired_latency", Description: "total latency", TagKeys: []tag.Key{method}, Measure: m, Aggregation: view.Sum()}
+	count := &view.View{Name: "tests/paired_requests", Description: "requests", TagKeys: []tag.Key{method}, Measure: m, Aggregation: view.Count()}
+	if err := view.Register(sum, count); err != nil {
+		t.Fatalf("failed to create views: %v", err)
+	}
+	defer view.Unregister(sum, count)
+
+	for method, latencies := range map[string][]float64{"GET": {1, 2, 3}, "POST": {10}} {
+		ctx, _ := tag.New(context.Background(), tag.Upsert(tag.MustNewKey("method"), method))
+		for _, l := range latencies {
+			stats.Record(ctx, m.M(l))
+		}
+	}
+
+	srv := httptest.NewServer(exporter)
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("failed to get /metrics: %v", err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("failed to read body: %v", err)
+	}
+	output := string(body)
+
+	for _, want := range []string{
+		`# HELP tests_paired_latency total latency
+# TYPE tests_paired_latency summary
+tests_paired_latency_sum{method="GET"} 6
+tests_paired_latency_count{method="GET"} 3
+tests_paired_latency_sum{method="POST"} 10
+tests_paired_latency_count{method="POST"} 1
+`,
+		// The Count view is still exported on its own.
+		`# TYPE tests_paired_requests counter
+tests_paired_requests{method="GET"} 3
+tests_paired_requests{method="POST"} 1
+`,
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output does not contain:\n%s\nOutput:\n%s", want, output)
+		}
+	}
+}
+
+func TestSumCountPairsByMetricName(t *testing.T) {
+	for _, pairs := range []map[string]string{
+		{"": "tests/requests"},
+		{"tests/latency": ""},
+		{"tests/latency": "tests/latency"},
+	} {
+		if _, err := NewExporter(Options{SumCountPairs: pairs}); err == nil {
+			t.Errorf("NewExporter() with SumCountPairs %v = nil error; want error", pairs)
+		}
+	}
+
+	var (
+		mu   sync.Mutex
+		errs []error
+	)
+	exporter, err := NewExporter(Options{
+		SumCountPairs: map[string]string{"tests/renamed_latency": "tests/renamed_requests", "tests/not_a_sum": "tests/renamed_requests"},
+		OnError: func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			errs = append(errs, err)
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create prometheus exporter: %v", err)
+	}
+	m := stats.Float64("tests/latency", "latency", stats.UnitDimensionless)
+	meter := view.NewMeter()
+	meter.Start()
+	defer meter.Stop()
+	if err := meter.Register(
+		&view.View{Name: "tests/latency_sum_view", MetricName: "tests/renamed_latency", Measure: m, Aggregation: view.Sum()},
+		&view.View{Name: "tests/requests_view", MetricName: "tests/renamed_requests", Measure: m, Aggregation: view.Count()},
+		&view.View{Name: "tests/not_a_sum", Measure: m, Aggregation: view.LastValue()},
+	); err != nil {
+		t.Fatalf("failed to create views: %v", err)
+	}
+	stats.RecordWithOptions(context.Background(), stats.WithRecorder(meter), stats.WithMeasurements(m.M(2), m.M(4)))
+	if _, err := meter.RetrieveData("tests/requests_view"); err != nil {
+		t.Fatalf("failed to retrieve data: %v", err)
+	}
+
+	srv := httptest.NewServer(exporter)
+	defer srv.Close()
+	for i := 0; i < 3; i++ {
+		resp, err := http.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("failed to get /metrics: %v", err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("failed to read body: %v", err)
+		}
+		if want := "tests_renamed_latency_sum 6\ntests_renamed_latency_count 2\n"; !strings.Contains(string(body), want) {
+			t.Errorf("output does not contain:\n%s\nOutput:\n%s", want, body)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), `"tests/not_a_sum"`) {
+		t.Errorf("pairing errors = %v; want one error for tests/not_a_sum", errs)
+	}
+}
+
+func TestWithTimestamps(t *testing.T) {
+	exporter, err := NewExporter(Options{
+		WithTimestamps: true,
+		OnError:        func(err error) { t.Errorf("OnError: %v", err) },
+	})
+	if err != nil {
+		t.Fatalf("failed to create prometheus exporter: %v", err)
+	}
+	m := stats.Int64("tests/timestamped", "bytes", stats.UnitBytes)
+	v := &view.View{Name: "tests/timestamped", Description: "timestamped bytes", Measure: m, Aggregation: view.Sum()}
+	if err := view.Register(v); err != nil {
+		t.Fatalf("failed to create views: %v", err)
+	}
+	defer view.Unregister(v)
+
+	before := time.Now()
+	stats.Record(context.Background(), m.M(5))
+	after := time.Now()
+
+	srv := httptest.NewServer(exporter)
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("failed to get /metrics: %v", err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("failed to read body: %v", err)
+	}
+	output := string(body)
+
+	var value, ms int64
+	var found bool
+	for _, line := range strings.Split(output, "\n") {
+		if n, _ := fmt.Sscanf(line, "tests_timestamped %d %d", &value, &ms); n == 2 {
+			found = true
+			break
+		}
+	}
+	if !found {
+		t.Fatalf("output has no timestamped sample of tests_timestamped:\n%s", output)
+	}
+	if value != 5 {
+		t.Errorf("value = %d; want 5", value)
+	}
+	// Timestamps are exported in milliseconds.
+	if got := time.Unix(0, ms*int64(time.Millisecond)); got.Before(before.Truncate(time.Millisecond)) || got.After(after) {
+		t.Errorf("timestamp = %v; want the recording time, between %v and %v", got, before, after)
+	}
+}
+
+func TestSanitizedResourceCache(t *testing.T) {
+	c := newCollector(&Options{}, nil)
+	res := &resource.Resource{Type: "t", Labels: map[string]string{"k-8s.pod": "p"}}
+	got := c.sanitized(res)
+	if want := map[string]string{"k_8s_pod": "p"}; !cmp.Equal(got.Labels, want) {
+		t.Errorf("sanitized labels = %v; want %v", got.Labels, want)
+	}
+	if again := c.sanitized(res); again != got {
+		t.Errorf("resource sanitized again; want the cached copy")
+	}
+	if c.sanitized(nil) != nil {
+		t.Errorf("sanitized(nil) != nil")
+	}
+}
+
+func TestSingleHeaderPerFamily(t *testing.T) {
+	exporter, err := NewExporter(Options{})
+	if err != nil {
+		t.Fatalf("failed to create prometheus exporter: %v", err)
+	}
+	key := tag.MustNewKey("id")
+	m := stats.Float64("tests/churn", "label churn", stats.UnitMilliseconds)
+	views := []*view.View{
+		{Name: "churn/count", Description: "count", Measure: m, TagKeys: []tag.Key{key}, Aggregation: view.Count()},
+		{Name: "churn/latency", Description: "latency", Measure: m, TagKeys: []tag.Key{key}, Aggregation: view.Distribution(1, 10)},
+	}
+	if err := view.Register(views...); err != nil {
+		t.Fatalf("Register error: %v", err)
+	}
+	defer view.Unregister(views...)
+
+	record := func(id int) {
+		ctx, _ := tag.New(context.Background(), tag.Upsert(key, strconv.Itoa(id)))
+		stats.Record(ctx, m.M(float64(id%20)))
+	}
+	for i := 0; i < 200; i++ {
+		record(i)
+	}
+
+	// Keep adding rows while scraping.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 200; i < 1000; i++ {
+			record(i)
+		}
+	}()
+	defer wg.Wait()
+
+	srv := httptest.NewServer(exporter)
+	defer srv.Close()
+	for scrape := 0; scrape < 5; scrape++ {
+		resp, err := http.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("http.Get error: %v", err)
+		}
+		blob, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("Read body error: %v", err)
+		}
+		resp.Body.Close()
+
+		headers := make(map[string]int)
+		for _, line := range strings.Split(string(blob), "\n") {
+			if strings.HasPrefix(line, "# HELP ") || strings.HasPrefix(line, "# TYPE ") {
+				fields := strings.Fields(line)
+				headers[fields[1]+" "+fields[2]]++
+			}
+		}
+		want := map[string]int{
+			"HELP churn_count":   1,
+			"TYPE churn_count":   1,
+			"HELP churn_latency": 1,
+			"TYPE churn_latency": 1,
+		}
+		if diff := cmp.Diff(headers, want); diff != "" {
+			t.Fatalf("scrape %d: unexpected headers (-got +want):\n%s", scrape, diff)
+		}
+	}
+}
+
+func TestViewMeasureWithoutTag(t *testing.T) {
+	exporter, err := NewExporter(Options{})
+	if err != nil {
+		t.Fatalf("failed to create prometheus exporter: %v", err)
+	}
+	m := stats.Int64("tests/foo", "foo", stats.UnitDimensionless)
+	k1, _ := tag.NewKey("key/1")
+	k2, _ := tag.NewKey("key/2")
+	k3, _ := tag.NewKey("key/3")
+	k4, _ := tag.NewKey("key/4")
+	k5, _ := tag.NewKey("key/5")
+	randomKey, _ := tag.NewKey("issue659")
+	v := &view.View{
+		Name:        m.Name(),
+		Description: m.Description(),
+		TagKeys:     []tag.Key{k2, k5, k3, k1, k4}, // Ensure view has a tag
+		Measure:     m,
+		Aggregation: view.Count(),
+	}
+	if err := view.Register(v); err != nil {
+		t.Fatalf("failed to create views: %v", err)
+	}
+	defer view.Unregister(v)
+	// Make a measure without some tags in the view.
+	ctx1, _ := tag.New(context.Background(), tag.Upsert(k4, "issue659"), tag.Upsert(randomKey, "value"), tag.Upsert(k2, "issue659"))
+	stats.Record(ctx1, m.M(1))
+	ctx2, _ := tag.New(context.Background(), tag.Upsert(k5, "issue659"), tag.Upsert(k3, "issue659"), tag.Upsert(k1, "issue659"))
+	stats.Record(ctx2, m.M(2))
+	srv := httptest.NewServer(exporter)
+	defer srv.Close()
+	var i int
+	var output string
+	for {
+		time.Sleep(10 * time.Millisecond)
+		if i == 10 {
+			t.Fatal("no output at /metrics (100ms wait)")
+		}
+		i++
+		resp, err := http.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("failed to get /metrics: %v", err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("failed to read body: %v", err)
+		}
+		resp.Body.Close()
+		output = string(body)
+		if output != "" {
+			break
+		}
+	}
+	if strings.Contains(output, "collected before with the same name and label values") {
+		t.Fatal("metric name and labels being duplicated but must be unique")
+	}
+	if strings.Contains(output, "error(s) occurred") {
+		t.Fatal("error reported by prometheus registry")
+	}
+	want := `# HELP tests_foo foo
+# TYPE tests_foo counter
+tests_foo{key_1="",key_2="issue659",key_3="",key_4="issue659",key_5=""} 1
+tests_foo{key_1="issue659",key_2="",key_3="issue659",key_4="",key_5="issue659"} 1
+`
+	if output != want {
+		t.Fatalf("output differed from expected output: %s want: %s", output, want)
+	}
+}
+
+func TestViewWithoutData(t *testing.T) {
+	exporter, err := NewExporter(Options{})
+	if err != nil {
+		t.Fatalf("failed to create prometheus exporter: %v", err)
+	}
+	m := stats.Int64("tests/unused", "unused", stats.UnitDimensionless)
+	v := &view.View{
+		Name:        m.Name(),
+		Description: m.Description(),
+		Measure:     m,
+		Aggregation: view.Count(),
+	}
+	if err := view.Register(v); err != nil {
+		t.Fatalf("failed to create views: %v", err)
+	}
+	defer view.Unregister(v)
+
+	srv := httptest.NewServer(exporter)
+	defer srv.Close()
+	scrape := func() string {
+		resp, err := http.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("failed to get /metrics: %v", err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("failed to read body: %v", err)
+		}
+		resp.Body.Close()
+		return string(body)
+	}
+
+	if got := scrape(); got != "" {
+		t.Errorf("unexpected prometheus output before recording: %q", got)
+	}
+
+	stats.Record(context.Background(), m.M(1))
+	if _, err := view.RetrieveData(v.Name); err != nil {
+		t.Fatalf("failed to retrieve data: %v", err)
+	}
+	want := `# HELP tests_unused unused
+# TYPE tests_unused counter
+tests_unused 1
+`
+	if diff := cmp.Diff(want, scrape()); diff != "" {
+		t.Errorf("unexpected prometheus output after recording (-want +got):\n%s", diff)
+	}
+}
+
+func TestShareDefaultRegistry(t *testing.T) {
+	_, err := NewExporter(Options{
+		Registerer: prometheus.DefaultRegisterer,
+		Gatherer:   prometheus.DefaultGatherer,
+	})
+	if err != nil {
+		t.Fatalf("failed to create prometheus exporter: %v", err)
+	}
+	m := stats.Int64("tests/foo", "foo", stats.UnitDimensionless)
+	v := &view.View{
+		Name:        m.Name(),
+		Description: m.Description(),
+		Measure:     m,
+		Aggregation: view.Count(),
+	}
+	if err := view.Register(v); err != nil {
+		t.Fatalf("failed to create views: %v", err)
+	}
+	defer view.Unregister(v)
+	stats.Record(context.Background(), m.M(1))
+
+	// counter, prometheus way
+	c := prometheus.NewCounter(prometheus.CounterOpts{Name: "prom_counter", Help: "Prometheus Counter"})
+	prometheus.MustRegister(c)
+
+	c.Add(1)
+
+	// Use prometheus handler
+	srv := httptest.NewServer(promhttp.Handler())
+	defer srv.Close()
+
+	var i int
+	var output string
+	for {
+		time.Sleep(10 * time.Millisecond)
+		if i == 10 {
+			t.Fatal("no output at /metrics (100ms wait)")
+		}
+		i++
+
+		resp, err := http.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("failed to get /metrics: %v", err)
+		}
+
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("failed to read body: %v", err)
+		}
+		resp.Body.Close()
+
+		output = string(body)
+		if output != "" {
+			break
+		}
+	}
+
+	if strings.Contains(output, "collected before with the same name and label values") {
+		t.Fatal("metric name and labels being duplicated but must be unique")
+	}
+
+	if strings.Contains(output, "error(s) occurred") {
+		t.Fatal("error reported by prometheus registry")
+	}
+
+	wantOc := `# HELP tests_foo foo
+# TYPE tests_foo counter
+tests_foo 1
+`
+	if !strings.Contains(output, wantOc) {
+		t.Errorf("output does not contain opencensus counter. Output: %s want: %s", output, wantOc)
+	}
+
+	wantP := `# HELP prom_counter Prometheus Counter
+# TYPE prom_counter counter
+prom_counter 1
+`
+	if !strings.Contains(output, wantP) {
+		t.Errorf("output does not contain opencensus counter. Output: %s want: %s", output, wantP)
+	}
+
+}
+
+func TestRegistererGathererValidation(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	other := prometheus.NewRegistry()
+	wrapped := prometheus.Gatherers{reg}
+	tests := []struct {
+		name    string
+		opts    Options
+		wantErr error
+	}{
+		{name: "none"},
+		{name: "registry", opts: Options{Registry: reg}},
+		// Sharing the default registry is covered by TestShareDefaultRegistry.
+		{name: "same custom registry", opts: Options{Registerer: reg, Gatherer: reg}},
+		{name: "registry and matching registerer", opts: Options{Registry: reg, Registerer: reg}},
+		{name: "registry and wrapping gatherer", opts: Options{Registry: reg, Gatherer: wrapped}},
+		{name: "only registerer", opts: Options{Registerer: reg}, wantErr: ErrNilGatherer},
+		{name: "only gatherer", opts: Options{Gatherer: prometheus.DefaultGatherer}, wantErr: ErrNilRegisterer},
+		{name: "different registries", opts: Options{Registerer: reg, Gatherer: other}, wantErr: ErrRegistryMismatch},
+		{name: "registry and different gatherer", opts: Options{Registry: reg, Gatherer: other}, wantErr: ErrRegistryMismatch},
+		{name: "default registerer and custom gatherer", opts: Options{Registerer: prometheus.DefaultRegisterer, Gatherer: reg}, wantErr: ErrRegistryMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewExporter(tt.opts)
+			if (err == nil) != (tt.wantErr == nil) || !errors.Is(err, tt.wantErr) {
+				t.Errorf("NewExporter() error = %v; want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNilRegistries(t *testing.T) {
+	var nilRegistry *prometheus.Registry
+	tests := []struct {
+		name    string
+		opts    Options
+		wantErr error
+	}{
+		{name: "default"},
+		{name: "nil registries", opts: Options{Registerer: nilRegistry, Gatherer: nilRegistry}},
+		{name: "nil registerer", opts: Options{Registerer: nil, Gatherer: prometheus.NewRegistry()}, wantErr: ErrNilRegisterer},
+		{name: "nil registry registerer", opts: Options{Registerer: nilRegistry, Gatherer: prometheus.NewRegistry()}, wantErr: ErrNilRegisterer},
+		{name: "nil registry gatherer", opts: Options{Registerer: prometheus.NewRegistry(), Gatherer: nilRegistry}, wantErr: ErrNilGatherer},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter, err := NewExporter(tt.opts)
+			if !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
+				t.Fatalf("NewExporter() error = %v; want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			rec := httptest.NewRecorder()
+			exporter.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+			if rec.Code != http.StatusOK {
+				t.Errorf("ServeHTTP() status = %d; want %d", rec.Code, http.StatusOK)
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	new(Exporter).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("ServeHTTP() of a zero Exporter status = %d; want %d", rec.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestRegistryConflict(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	opts := Options{Registry: reg, AppInfo: map[string]string{"version": "1.2.3"}}
+	if _, err := NewExporter(opts); err != nil {
+		t.Fatalf("failed to create prometheus exporter: %v", err)
+	}
+
+	// A second exporter with the same metrics conflicts with the first.
+	e, err := NewExporter(opts)
+	if e != nil || !errors.Is(err, ErrRegistryConflict) {
+		t.Errorf("NewExporter() = %v, %v; want %v", e, err, ErrRegistryConflict)
+	}
+	var already prometheus.AlreadyRegisteredError
+	if !errors.As(err, &already) {
+		t.Errorf("NewExporter() error = %v; want it to wrap a prometheus.AlreadyRegisteredError", err)
+	}
+
+	// So does a collector of another metric of the same name.
+	other := prometheus.NewRegistry()
+	other.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: BuildInfoName, Help: "Other build info."}))
+	opts.Registry = other
+	if _, err := NewExporter(opts); !errors.Is(err, ErrRegistryConflict) {
+		t.Errorf("NewExporter() error = %v; want %v", err, ErrRegistryConflict)
+	}
+}
+
+func TestSortSeries(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	// reversed mimics a Gatherer that makes no ordering guarantees.
+	reversed := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		mfs, err := reg.Gather()
+		for i, j := 0, len(mfs)-1; i < j; i, j = i+1, j-1 {
+			mfs[i], mfs[j] = mfs[j], mfs[i]
+		}
+		for _, mf := range mfs {
+			ms := mf.Metric
+			for i, j := 0, len(ms)-1; i < j; i, j = i+1, j-1 {
+				ms[i], ms[j] = ms[j], ms[i]
+			}
+		}
+		return mfs, err
+	})
+	exporter, err := NewExporter(Options{
+		Registry:   reg,
+		Gatherer:   reversed,
+		SortSeries: true,
+	})
+	if err != nil {
+		t.Fatalf("failed to create prometheus exporter: %v", err)
+	}
+
+	key := tag.MustNewKey("method")
+	meter := view.NewMeter()
+	meter.Start()
+	defer meter.Stop()
+	var vc vCreator
+	for _, name := range []string{"tests/sort_a", "tests/sort_b"} {
+		m := stats.Int64(name, name, "")
+		vc.createAndAppend(m.Name(), m.Description(), []tag.Key{key}, m, view.Count())
+	}
+	if err := meter.Register(vc...); err != nil {
+		t.Fatalf("failed to create views: %v", err)
+	}
+	defer meter.Unregister(vc...)
+
+	for _, value := range []string{"c", "a", "d", "b"} {
+		ctx, _ := tag.New(context.Background(), tag.Upsert(key, value))
+		for _, v := range vc {
+			stats.RecordWithOptions(ctx, stats.WithRecorder(meter), stats.WithMeasurements(v.Measure.(*stats.Int64Measure).M(1)))
+		}
+	}
+
+	want := `# HELP tests_sort_a tests/sort_a
+# TYPE tests_sort_a counter
+tests_sort_a{method="a"} 1
+tests_sort_a{method="b"} 1
+tests_sort_a{method="c"} 1
+tests_sort_a{method="d"} 1
+# HELP tests_sort_b tests/sort_b
+# TYPE tests_sort_b counter
+tests_sort_b{method="a"} 1
+tests_sort_b{method="b"} 1
+tests_sort_b{method="c"} 1
+tests_sort_b{method="d"} 1
+`
+	srv := httptest.NewServer(exporter)
+	defer srv.Close()
+	for i := 0; i < 5; i++ {
+		resp, err := http.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("failed to get /metrics: %v", err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("failed to read body: %v", err)
+		}
+		resp.Body.Close()
+		if diff := cmp.Diff(want, string(body)); diff != "" {
+			t.Fatalf("scrape #%d: unexpected prometheus output (-want +got):\n%s", i, diff)
+		}
+	}
+}
+
+func TestSumGauge(t *testing.T) {
+	exporter, err := NewExporter(Options{})
+	if err != nil {
+		t.Fatalf("failed to create prometheus exporter: %v", err)
+	}
+	m := stats.Int64("tests/active_connections", "active connections", stats.UnitDimensionless)
+	v := &view.View{
+		Name:        m.Name(),
+		Description: m.Description(),
+		Measure:     m,
+		Aggregation: view.SumGauge(),
+	}
+	if err := view.Register(v); err != nil {
+		t.Fatalf("failed to create views: %v", err)
+	}
+	defer view.Unregister(v)
+
+	ctx := context.Background()
+	for _, delta := range []int64{1, 1, 1, -1, 1, -1} {
+		stats.Record(ctx, m.M(delta))
+	}
+
+	srv := httptest.NewServer(exporter)
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("failed to get /metrics: %v", err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read body: %v", err)
+	}
+	resp.Body.Close()
+
+	want := `# HELP tests_active_connections active connections
+# TYPE tests_active_connections gauge
+tests_active_connections 2
+`
+	if diff := cmp.Diff(want, string(body)); diff != "" {
+		t.Errorf("unexpected prometheus output (-want +got):\n%s", diff)
+	}
+}
+
+func TestForResource(t *testing.T) {
+	exporter, err := NewExporter(Options{})
+	if err != nil {
+		t.Fatalf("failed to create prometheus exporter: %v", err)
+	}
+	m := stats.Int64("tests/tenant_requests", "requests", stats.UnitDimensionless)
+	key := tag.MustNewKey("method")
+	v := &view.View{Name: m.Name(), Description: m.Description(), TagKeys: []tag.Key{key}, Measure: m, Aggregation: view.Count()}
+
+	ctx, _ := tag.New(context.Background(), tag.Upsert(key, "GET"))
+	for tenant, n := range map[string]int{"a": 1, "b": 2} {
+		meter := view.NewMeter()
+		meter.SetResource(&resource.Resource{Type: "tenant", Labels: map[string]string{"tenant": tenant}})
+		meter.Start()
+		defer meter.Stop()
+		if err := meter.Register(v); err != nil {
+			t.Fatalf("failed to create views: %v", err)
+		}
+		defer meter.Unregister(v)
+		for i := 0; i < n; i++ {
+			stats.RecordWithOptions(ctx, stats.WithRecorder(meter), stats.WithMeasurements(m.M(1)))
+		}
+	}
+
+	scrape := func(h http.Handler, want string) {
+		t.Helper()
+		srv := httptest.NewServer(h)
+		defer srv.Close()
+		var got string
+		// Recording is asynchronous; wait for the counts to be aggregated.
+		for i := 0; i < 100; i++ {
+			resp, err := http.Get(srv.URL)
+			if err != nil {
+				t.Fatalf("failed to get /metrics: %v", err)
+			}
+			body, err := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				t.Fatalf("failed to read body: %v", err)
+			}
+			if got = string(body); got == want {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Errorf("metrics differ -got +want:\n%s", cmp.Diff(got, want))
+	}
+
+	scrape(exporter.ForResource(ResourceLabel("tenant", "a")), `# HELP tests_tenant_requests requests
+# TYPE tests_tenant_requests counter
+tests_tenant_requests{method="GET",tenant="a"} 1
+`)
+	scrape(exporter.ForResource(ResourceLabel("tenant", "b")), `# HELP tests_tenant_requests requests
+# TYPE tests_tenant_requests counter
+tests_tenant_requests{method="GET",tenant="b"} 2
+`)
+	scrape(exporter, `# HELP tests_tenant_requests requests
+# TYPE tests_tenant_requests counter
+tests_tenant_requests{method="GET",tenant="a"} 1
+tests_tenant_requests{method="GET",tenant="b"} 2
+`)
+}
+
+func TestMetricNames(t *testing.T) {
+	exporter, err := NewExporter(Options{Namespace: "tooling"})
+	if err != nil {
+		t.Fatalf("failed to create prometheus exporter: %v", err)
+	}
+	m := stats.Float64("tests/metric-names", "latency", stats.UnitMilliseconds)
+	count := &view.View{
+		Name:        "tests/metric-names/count",
+		Measure:     m,
+		Aggregation: view.Count(),
+	}
+	latency := &view.View{
+		Name:        "tests/metric-names/latency",
+		MetricName:  "myapp/latency",
+		Measure:     m,
+		Aggregation: view.Distribution(10, 100),
+	}
+	gauge := &view.View{
+		Name:        "tests/metric-names/gauge",
+		Measure:     m,
+		Aggregation: view.Gauge(),
+	}
+	if err := view.Register(count, latency, gauge); err != nil {
+		t.Fatalf("failed to create views: %v", err)
+	}
+	defer view.Unregister(count, latency, gauge)
+	stats.Record(context.Background(), m.M(1))
+
+	var got []string
+	for _, name := range exporter.MetricNames() {
+		// Views registered by other tests share the default meter.
+		if strings.HasPrefix(name, "tooling_tests_metric_names") || strings.HasPrefix(name, "tooling_myapp") {
+			got = append(got, name)
+		}
+	}
+	want := []string{
+		"tooling_myapp_latency",
+		"tooling_tests_metric_names_count",
+		"tooling_tests_metric_names_gauge_last",
+		"tooling_tests_metric_names_gauge_max",
+		"tooling_tests_metric_names_gauge_min",
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("MetricNames() differ -got +want:\n%s", diff)
+	}
+}
+
+func TestMetricNamesOfMeters(t *testing.T) {
+	exporter, err := NewExporter(Options{
+		Namespace:         "tooling",
+		HistogramSuffixes: HistogramSuffixes{Count: "_total"},
+	})
+	if err != nil {
+		t.Fatalf("failed to create prometheus exporter: %v", err)
+	}
+	m := stats.Float64("tests/meter-names", "latency", stats.UnitMilliseconds)
+	meter := view.NewMeter()
+	meter.Start()
+	defer meter.Stop()
+	// Neither view has data.
+	if err := meter.Register(
+		&view.View{Name: "tests/meter-names/latency", MetricName: "meterapp/latency", Measure: m, Aggregation: view.Distribution(10, 100)},
+		&view.View{Name: "tests/meter-names/count", Measure: m, Aggregation: view.Count()},
+	); err != nil {
+		t.Fatalf("failed to create views: %v", err)
+	}
+
+	var got []string
+	for _, name := range exporter.MetricNames() {
+		if strings.HasPrefix(name, "tooling_tests_meter_names") || strings.HasPrefix(name, "tooling_meterapp") {
+			got = append(got, name)
+		}
+	}
+	want := []string{
+		"tooling_meterapp_latency_bucket",
+		"tooling_meterapp_latency_sum",
+		"tooling_meterapp_latency_total",
+		"tooling_tests_meter_names_count",
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("MetricNames() differ -got +want:\n%s", diff)
+	}
+}
+
+func TestViewMetricName(t *testing.T) {
+	exporter, err := NewExporter(Options{})
+	if err != nil {
+		t.Fatalf("failed to create prometheus exporter: %v", err)
+	}
+	m := stats.Float64("tests/request_latency", "request latency", stats.UnitMilliseconds)
+	count := &view.View{
+		Name:        "tests/request_latency/count",
+		MetricName:  "myapp/requests",
+		Description: "requests",
+		Measure:     m,
+		Aggregation: view.Count(),
+	}
+	sum := &view.View{
+		Name:        "tests/request_latency/sum",
+		MetricName:  "myapp/request_latency_total",
+		Description: "total request latency",
+		Measure:     m,
+		Aggregation: view.Sum(),
+	}
+	if err := view.Register(count, sum); err != nil {
+		t.Fatalf("failed to create views: %v", err)
+	}
+	defer view.Unregister(count, sum)
+	if v := view.Find(count.Name); v != count {
+		t.Errorf("Find(%q) = %v; want %v", count.Name, v, count)
+	}
+
+	for _, val := range []float64{10, 25} {
+		stats.Record(context.Background(), m.M(val))
+	}
+
+	srv := httptest.NewServer(exporter)
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("failed to get /metrics: %v", err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read body: %v", err)
+	}
+	resp.Body.Close()
+
+	want := `# HELP myapp_request_latency_total total request latency
+# TYPE myapp_request_latency_total counter
+myapp_request_latency_total 35
+# HELP myapp_requests requests
+# TYPE myapp_requests counter
+myapp_requests 2
+`
+	if diff := cmp.Diff(want, string(body)); diff != "" {
+		t.Errorf("unexpected prometheus output (-want +got):\n%s", diff)
+	}
+}
+
+func TestGauge(t *testing.T) {
+	exporter, err := NewExporter(Options{})
+	if err != nil {
+		t.Fatalf("failed to create prometheus exporter: %v", err)
+	}
+	m := stats.Int64("tests/queue_length", "queue length", stats.UnitDimensionless)
+	v := &view.View{
+		Name:        m.Name(),
+		Description: m.Description(),
+		Measure:     m,
+		Aggregation: view.Gauge(),
+	}
+	if err := view.Register(v); err != nil {
+		t.Fatalf("failed to create views: %v", err)
+	}
+	defer view.Unregister(v)
+
+	// Another exporter has its own windows.
+	other, err := NewExporter(Options{Registry: prometheus.NewRegistry()})
+	if err != nil {
+		t.Fatalf("failed to create prometheus exporter: %v", err)
+	}
+	otherSrv := httptest.NewServer(other)
+	defer otherSrv.Close()
+
+	srv := httptest.NewServer(exporter)
+	defer srv.Close()
+	scrape := func(values ...int64) string {
+		for _, val := range values {
+			stats.Record(context.Background(), m.M(val))
+		}
+		if _, err := view.RetrieveData(v.Name); err != nil {
+			t.Fatalf("failed to retrieve data: %v", err)
+		}
+		resp, err := http.Get(otherSrv.URL)
+		if err != nil {
+			t.Fatalf("failed to get /metrics: %v", err)
+		}
+		resp.Body.Close()
+		resp, err = http.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("failed to get /metrics: %v", err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("failed to read body: %v", err)
+		}
+		resp.Body.Close()
+		return string(body)
+	}
+
+	want := `# HELP tests_queue_length_last queue length
+# TYPE tests_queue_length_last gauge
+tests_queue_length_last 3
+# HELP tests_queue_length_max queue length
+# TYPE tests_queue_length_max gauge
+tests_queue_length_max 12
+# HELP tests_queue_length_min queue length
+# TYPE tests_queue_length_min gauge
+tests_queue_length_min 2
+`
+	if diff := cmp.Diff(want, scrape(4, 12, 2, 3)); diff != "" {
+		t.Errorf("unexpected prometheus output (-want +got):\n%s", diff)
+	}
+
+	want = `# HELP tests_queue_length_last queue length
+# TYPE tests_queue_length_last gauge
+tests_queue_length_last 5
+# HELP tests_queue_length_max queue length
+# TYPE tests_queue_length_max gauge
+tests_queue_length_max 5
+# HELP tests_queue_length_min queue length
+# TYPE tests_queue_length_min gauge
+tests_queue_length_min 3
+`
+	if diff := cmp.Diff(want, scrape(5)); diff != "" {
+		t.Errorf("unexpected prometheus output after the first scrape (-want +got):\n%s", diff)
+	}
+}
+
+// gaugeReports signals the Last values of the Gauge views it exports,
+// dropping them while nobody is waiting.
+type gaugeReports chan int64
+
+func (r gaugeReports) ExportView(vd *view.Data) {
+	for _, row := range vd.Rows {
+		if g, ok := row.Data.(*view.GaugeData); ok {
+			select {
+			case r <- int64(g.Last):
+			default:
+			}
+		}
+	}
+}
+
+func TestGaugeWithReporting(t *testing.T) {
+	exporter, err := NewExporter(Options{})
+	if err != nil {
+		t.Fatalf("failed to create prometheus exporter: %v", err)
+	}
+	m := stats.Int64("tests/reported_queue_length", "queue length", stats.UnitDimensionless)
+	v := &view.View{
+		Name:        m.Name(),
+		Description: m.Description(),
+		Measure:     m,
+		Aggregation: view.Gauge(),
+	}
+	meter := view.NewMeter()
+	meter.Start()
+	defer meter.Stop()
+	if err := meter.Register(v); err != nil {
+		t.Fatalf("failed to create views: %v", err)
+	}
+	defer meter.Unregister(v)
+	reports := make(gaugeReports)
+	meter.RegisterExporter(reports)
+	defer meter.UnregisterExporter(reports)
+	meter.SetReportingPeriod(time.Millisecond)
+
+	srv := httptest.NewServer(exporter)
+	defer srv.Close()
+	scrape := func(values ...int64) string {
+		for _, val := range values {
+			if err := stats.RecordWithOptions(context.Background(), stats.WithRecorder(meter), stats.WithMeasurements(m.M(val))); err != nil {
+				t.Fatalf("RecordWithOptions() = %v", err)
+			}
+		}
+		// Let the view be reported a few times after the last value.
+		last := values[len(values)-1]
+		for seen := 0; seen < 3; {
+			if <-reports == last {
+				seen++
+			}
+		}
+		resp, err := http.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("failed to get /metrics: %v", err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("failed to read body: %v", err)
+		}
+		resp.Body.Close()
+		return string(body)
+	}
+	want := `# HELP tests_reported_queue_length_last queue length
+# TYPE tests_reported_queue_length_last gauge
+tests_reported_queue_length_last 3
+# HELP tests_reported_queue_length_max queue length
+# TYPE tests_reported_queue_length_max gauge
+tests_reported_queue_length_max 12
+# HELP tests_reported_queue_length_min queue length
+# TYPE tests_reported_queue_length_min gauge
+tests_reported_queue_length_min 2
+`
+	if diff := cmp.Diff(want, scrape(4, 12, 2, 3)); diff != "" {
+		t.Errorf("unexpected prometheus output (-want +got):\n%s", diff)
+	}
+
+	want = `# HELP tests_reported_queue_length_last queue length
+# TYPE tests_reported_queue_length_last gauge
+tests_reported_queue_length_last 5
+# HELP tests_reported_queue_length_max queue length
+# TYPE tests_reported_queue_length_max gauge
+tests_reported_queue_length_max 5
+# HELP tests_reported_queue_length_min queue length
+# TYPE tests_reported_queue_length_min gauge
+tests_reported_queue_length_min 3
+`
+	if diff := cmp.Diff(want, scrape(5)); diff != "" {
+		t.Errorf("unexpected prometheus output after the first scrape (-want +got):\n%s", diff)
+	}
+}
+
+func TestLastValueSummary(t *testing.T) {
+	exporter, err := NewExporter(Options{})
+	if err != nil {
+		t.Fatalf("failed to create prometheus exporter: %v", err)
+	}
+	m := stats.Int64("tests/goroutines", "goroutines", stats.UnitDimensionless)
+	v := &view.View{
+		Name:        m.Name(),
+		Description: m.Description(),
+		Measure:     m,
+		Aggregation: view.LastValueSummary(100, 0.5, 0.9, 0.99),
+	}
+	if err := view.Register(v); err != nil {
+		t.Fatalf("failed to create views: %v", err)
+	}
+	defer view.Unregister(v)
+
+	// Only the last 100 values of the ramp are kept.
+	for i := int64(1); i <= 200; i++ {
+		stats.Record(context.Background(), m.M(i))
+	}
+	if _, err := view.RetrieveData(v.Name); err != nil {
+		t.Fatalf("failed to retrieve data: %v", err)
+	}
+
+	srv := httptest.NewServer(exporter)
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("failed to get /metrics: %v", err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read body: %v", err)
+	}
+	resp.Body.Close()
+
+	want := `# HELP tests_goroutines goroutines
+# TYPE tests_goroutines summary
+tests_goroutines{quantile="0.5"} 150
+tests_goroutines{quantile="0.9"} 190
+tests_goroutines{quantile="0.99"} 199
+tests_goroutines_sum 15050
+tests_goroutines_count 100
+`
+	if diff := cmp.Diff(want, string(body)); diff != "" {
+		t.Errorf("unexpected prometheus output (-want +got):\n%s", diff)
+	}
+}
+
+func TestViewAggregationChange(t *testing.T) {
+	registries := map[string]*prometheus.Registry{
+		"registry":          prometheus.NewRegistry(),
+		"pedantic registry": prometheus.NewPedanticRegistry(),
+	}
+	for name, reg := range registries {
+		t.Run(name, func(t *testing.T) {
+			m := stats.Int64("tests/latency", "latency", stats.UnitMilliseconds)
+			count := &view.View{
+				Name:        "tests/requests",
+				Description: "requests",
+				Measure:     m,
+				Aggregation: view.Count(),
+			}
+			// Register the view before the exporter so that the collector
+			// describes its original type at registration.
+			if err := view.Register(count); err != nil {
+				t.Fatalf("failed to create views: %v", err)
+			}
+			defer view.Unregister(count)
+
+			var errs []error
+			exporter, err := NewExporter(Options{
+				Registry: reg,
+				OnError:  func(err error) { errs = append(errs, err) },
+			})
+			if err != nil {
+				t.Fatalf("failed to create prometheus exporter: %v", err)
+			}
+			srv := httptest.NewServer(exporter)
+			defer srv.Close()
+			scrape := func() string {
+				resp, err := http.Get(srv.URL)
+				if err != nil {
+					t.Fatalf("failed to get /metrics: %v", err)
+				}
+				body, err := ioutil.ReadAll(resp.Body)
+				if err != nil {
+					t.Fatalf("failed to read body: %v", err)
+				}
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusOK {
+					t.Fatalf("unexpected status %d: %s", resp.StatusCode, body)
+				}
+				return string(body)
+			}
+
+			stats.Record(context.Background(), m.M(3))
+			want := `# HELP tests_requests requests
+# TYPE tests_requests counter
+tests_requests 1
+`
+			if diff := cmp.Diff(want, scrape()); diff != "" {
+				t.Errorf("unexpected prometheus output (-want +got):\n%s", diff)
+			}
+
+			view.Unregister(count)
+			distribution := &view.View{
+				Name:        count.Name,
+				Description: count.Description,
+				Measure:     m,
+				Aggregation: view.Distribution(1, 5),
+			}
+			if err := view.Register(distribution); err != nil {
+				t.Fatalf("failed to re-register view: %v", err)
+			}
+			defer view.Unregister(distribution)
+
+			stats.Record(context.Background(), m.M(3))
+			want = `# HELP tests_requests requests
+# TYPE tests_requests histogram
+tests_requests_bucket{le="1"} 0
+tests_requests_bucket{le="5"} 1
+tests_requests_bucket{le="+Inf"} 1
+tests_requests_sum 3
+tests_requests_count 1
+`
+			if diff := cmp.Diff(want, scrape()); diff != "" {
+				t.Errorf("unexpected prometheus output after changing the aggregation (-want +got):\n%s", diff)
+			}
+			if len(errs) != 0 {
+				t.Errorf("unexpected errors: %v", errs)
+			}
+		})
+	}
+}
+
+// slowCollector blocks in its first Collect until release is closed.
+type slowCollector struct {
+	release chan struct{}
+	calls   int32 // use atomic to access
+}
+
+func (c *slowCollector) Describe(chan<- *prometheus.Desc) {}
+
+func (c *slowCollector) Collect(chan<- prometheus.Metric) {
+	if atomic.AddInt32(&c.calls, 1) == 1 {
+		<-c.release
+	}
+}
+
+func TestCollectTimeout(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	var gotErr error
+	var mu sync.Mutex
+	exporter, err := NewExporter(Options{
+		Registry:       reg,
+		CollectTimeout: 50 * time.Millisecond,
+		OnError: func(err error) {
+			mu.Lock()
+			gotErr = err
+			mu.Unlock()
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create prometheus exporter: %v", err)
+	}
+
+	srv := httptest.NewServer(exporter)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("failed to get /metrics: %v", err)
+	}
+	resp.Body.Close()
+	if got, want := resp.StatusCode, http.StatusOK; got != want {
+		t.Fatalf("StatusCode = %d without a slow collector; want %d", got, want)
+	}
+
+	slow := &slowCollector{release: make(chan struct{})}
+	var release sync.Once
+	defer release.Do(func() { close(slow.release) })
+	reg.MustRegister(slow)
+
+	resp, err = http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("failed to get /metrics: %v", err)
+	}
+	resp.Body.Close()
+	if got, want := resp.StatusCode, http.StatusServiceUnavailable; got != want {
+		t.Errorf("StatusCode = %d with a stuck collection; want %d", got, want)
+	}
+	mu.Lock()
+	if gotErr == nil {
+		t.Error("OnError was not invoked on collection timeout")
+	}
+	mu.Unlock()
+
+	// The abandoned collection is still stuck, but does not block the next
+	// scrapes.
+	for i := 0; i < 3; i++ {
+		resp, err = http.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("failed to get /metrics: %v", err)
+		}
+		resp.Body.Close()
+		if got, want := resp.StatusCode, http.StatusOK; got != want {
+			t.Errorf("StatusCode = %d for scrape %d after a stuck collection; want %d", got, i, want)
+		}
+	}
+	if got := atomic.LoadInt32(&slow.calls); got != 4 {
+		t.Errorf("slow collector collected %d times; want 4", got)
+	}
+}
+
+func TestInfBucketLabel(t *testing.T) {
+	if _, err := NewExporter(Options{InfBucketLabel: "max"}); err == nil {
+		t.Error("NewExporter() with an InfBucketLabel that is not infinity = nil error; want error")
+	}
+
+	exporter, err := NewExporter(Options{InfBucketLabel: "inf", EnableOpenMetrics: true})
+	if err != nil {
+		t.Fatalf("failed to create prometheus exporter: %v", err)
+	}
+	m := stats.Float64("tests/inf_bucket", "overflow bucket", stats.UnitDimensionless)
+	v := &view.View{
+		Name:        "inf/bucket",
+		Description: "this is a test",
+		Measure:     m,
+		Aggregation: view.Distribution(1, 10),
+	}
+	if err := view.Register(v); err != nil {
+		t.Fatalf("Register error: %v", err)
+	}
+	defer view.Unregister(v)
+	stats.Record(context.Background(), m.M(0.5), m.M(5), m.M(50))
+
+	srv := httptest.NewServer(exporter)
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("http.Get error: %v", err)
+	}
+	blob, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Read body error: %v", err)
+	}
+	resp.Body.Close()
+	output := string(blob)
+	if !resp.Uncompressed {
+		t.Error("response was not compressed although the client accepts gzip")
+	}
+
+	for _, line := range []string{
+		`# TYPE inf_bucket histogram`,
+		`inf_bucket_bucket{le="1"} 1`,
+		`inf_bucket_bucket{le="10"} 2`,
+		`inf_bucket_bucket{le="inf"} 3`,
+	} {
+		if !strings.Contains(output, line) {
+			t.Errorf("output does not contain %q. Output: %s", line, output)
+		}
+	}
+	if strings.Contains(output, `le="+Inf"`) {
+		t.Errorf("output contains the default overflow label. Output: %s", output)
+	}
+
+	// The protobuf format has no le label, the histogram keeps its type.
+	req, err := http.NewRequest("GET", srv.URL, nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	req.Header.Set("Accept", string(expfmt.FmtProtoDelim))
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("http.Get error: %v", err)
+	}
+	var mf dto.MetricFamily
+	err = expfmt.NewDecoder(resp.Body, expfmt.ResponseFormat(resp.Header)).Decode(&mf)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("failed to decode protobuf: %v", err)
+	}
+	if mf.GetName() != "inf_bucket" || mf.GetType() != dto.MetricType_HISTOGRAM {
+		t.Errorf("protobuf family = %q of type %v; want histogram inf_bucket", mf.GetName(), mf.GetType())
+	}
+
+	req, err = http.NewRequest("GET", srv.URL, nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	req.Header.Set("Accept", string(expfmt.FmtOpenMetrics))
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("http.Get error: %v", err)
+	}
+	blob, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Read body error: %v", err)
+	}
+	resp.Body.Close()
+	for _, line := range []string{
+		`# TYPE inf_bucket histogram`,
+		`inf_bucket_bucket{le="inf"} 3`,
+		`# EOF`,
+	} {
+		if !strings.Contains(string(blob), line) {
+			t.Errorf("OpenMetrics output does not contain %q. Output: %s", line, blob)
+		}
+	}
+}
+
+func TestReplaceInfBucketLabel(t *testing.T) {
+	in := `# HELP x le="+Inf"}
+x_bucket{handle="+Inf"} 1
+x_bucket{method="le=\"+Inf\"}",le="+Inf"} 2 # {le="+Inf"} 1.5
+x_bucket{le="+Inf"} 3
+`
+	want := `# HELP x le="+Inf"}
+x_bucket{handle="+Inf"} 1
+x_bucket{method="le=\"+Inf\"}",le="inf"} 2 # {le="+Inf"} 1.5
+x_bucket{le="inf"} 3
+`
+	if got := string(replaceInfBucketLabel([]byte(in), "inf")); got != want {
+		t.Errorf("replaceInfBucketLabel() = %s; want %s", got, want)
+	}
+}
+
+func TestHistogramSuffixes(t *testing.T) {
+	for _, suffixes := range []HistogramSuffixes{
+		{Sum: "bad suffix"},
+		{Count: "_sum"},
+		{Bucket: "_count"},
+	} {
+		if _, err := NewExporter(Options{HistogramSuffixes: suffixes}); err == nil {
+			t.Errorf("NewExporter() with histogram suffixes %+v = nil error; want error", suffixes)
+		}
+	}
+
+	exporter, err := NewExporter(Options{
+		HistogramSuffixes: HistogramSuffixes{Count: "_total", Bucket: "_le"},
+		EnableOpenMetrics: true,
+	})
+	if err != nil {
+		t.Fatalf("failed to create prometheus exporter: %v", err)
+	}
+	m := stats.Float64("tests/latency", "latency", stats.UnitMilliseconds)
+	histogram := &view.View{
+		Name:        "tests/latency",
+		Description: "latency",
+		Measure:     m,
+		Aggregation: view.Distribution(10),
+	}
+	summary := &view.View{
+		Name:        "tests/latency_summary",
+		Description: "latency summary",
+		Measure:     m,
+		Aggregation: view.LastValueSummary(10, 0.5),
+	}
+	if err := view.Register(histogram, summary); err != nil {
+		t.Fatalf("failed to create views: %v", err)
+	}
+	defer view.Unregister(histogram, summary)
+	stats.Record(context.Background(), m.M(5), m.M(20))
+	if _, err := view.RetrieveData(histogram.Name); err != nil {
+		t.Fatalf("failed to retrieve data: %v", err)
+	}
+
+	srv := httptest.NewServer(exporter)
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("failed to get /metrics: %v", err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read body: %v", err)
+	}
+	resp.Body.Close()
+
+	// Summaries keep their suffixes.
+	want := `# HELP tests_latency_le latency
+# TYPE tests_latency_le untyped
+tests_latency_le{le="10"} 1
+tests_latency_le{le="+Inf"} 2
+# HELP tests_latency_sum latency
+# TYPE tests_latency_sum untyped
+tests_latency_sum 25
+# HELP tests_latency_total latency
+# TYPE tests_latency_total untyped
+tests_latency_total 2
+# HELP tests_latency_summary latency summary
+# TYPE tests_latency_summary summary
+tests_latency_summary{quantile="0.5"} 5
+tests_latency_summary_sum 25
+tests_latency_summary_count 2
+`
+	if diff := cmp.Diff(want, string(body)); diff != "" {
+		t.Errorf("unexpected prometheus output (-want +got):\n%s", diff)
+	}
+
+	// The protobuf format has the same series.
+	req, err := http.NewRequest("GET", srv.URL, nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	req.Header.Set("Accept", string(expfmt.FmtProtoDelim))
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to get /metrics: %v", err)
+	}
+	types := make(map[string]dto.MetricType)
+	dec := expfmt.NewDecoder(resp.Body, expfmt.ResponseFormat(resp.Header))
+	for {
+		var mf dto.MetricFamily
+		if err := dec.Decode(&mf); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("failed to decode the protobuf response: %v", err)
+		}
+		types[mf.GetName()] = mf.GetType()
+	}
+	resp.Body.Close()
+	wantTypes := map[string]dto.MetricType{
+		"tests_latency_le":      dto.MetricType_UNTYPED,
+		"tests_latency_sum":     dto.MetricType_UNTYPED,
+		"tests_latency_total":   dto.MetricType_UNTYPED,
+		"tests_latency_summary": dto.MetricType_SUMMARY,
+	}
+	if diff := cmp.Diff(wantTypes, types); diff != "" {
+		t.Errorf("unexpected protobuf metric families (-want +got):\n%s", diff)
+	}
+
+	// OpenMetrics is served unchanged.
+	req.Header.Set("Accept", string(expfmt.FmtOpenMetrics))
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to get /metrics: %v", err)
+	}
+	body, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read body: %v", err)
+	}
+	resp.Body.Close()
+	for _, line := range []string{
+		"# TYPE tests_latency histogram",
+		`tests_latency_bucket{le="+Inf"} 2`,
+		"tests_latency_count 2",
+	} {
+		if !strings.Contains(string(body), line) {
+			t.Errorf("OpenMetrics output does not contain %q:\n%s", line, body)
+		}
+	}
+}
+
+func TestHistogramSuffixesCollision(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		errs []error
+	)
+	exporter, err := NewExporter(Options{
+		HistogramSuffixes: HistogramSuffixes{Count: "_total"},
+		OnError: func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			errs = append(errs, err)
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create prometheus exporter: %v", err)
+	}
+	m := stats.Float64("tests/requests", "requests", stats.UnitDimensionless)
+	meter := view.NewMeter()
+	meter.Start()
+	defer meter.Stop()
+	if err := meter.Register(
+		&view.View{Name: "tests/requests", Description: "requests", Measure: m, Aggregation: view.Distribution(10)},
+		&view.View{Name: "tests/requests_total", Description: "requests", Measure: m, Aggregation: view.Count()},
+	); err != nil {
+		t.Fatalf("failed to create views: %v", err)
+	}
+	stats.RecordWithOptions(context.Background(), stats.WithRecorder(meter), stats.WithMeasurements(m.M(5)))
+	if _, err := meter.RetrieveData("tests/requests"); err != nil {
+		t.Fatalf("failed to retrieve data: %v", err)
+	}
+
+	srv := httptest.NewServer(exporter)
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("failed to get /metrics: %v", err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read body: %v", err)
+	}
+	resp.Body.Close()
+
+	want := `# HELP tests_requests_total requests
+# TYPE tests_requests_total counter
+tests_requests_total 1
+`
+	if diff := cmp.Diff(want, string(body)); diff != "" {
+		t.Errorf("unexpected prometheus output (-want +got):\n%s", diff)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), `series "tests_requests_total" collide`) {
+		t.Errorf("collision was not reported to OnError: %v", errs)
+	}
+}
+
+func TestEmitUnitComment(t *testing.T) {
+	exporter, err := NewExporter(Options{EmitUnitComment: true, EnableOpenMetrics: true})
+	if err != nil {
+		t.Fatalf("failed to create prometheus exporter: %v", err)
+	}
+	size := stats.Int64("tests/units/size", "size", stats.UnitBytes)
+	latency := stats.Float64("tests/units/latency", "latency", stats.UnitMilliseconds)
+	views := []*view.View{
+		{Name: "tests/units/size_bytes", Description: "size", Measure: size, Aggregation: view.LastValue()},
+		{Name: "tests/units/latency_seconds", Description: "latency", Measure: latency, Aggregation: view.Distribution(100)},
+		{Name: "tests/units/requests", Description: "requests", Measure: latency, Aggregation: view.Count()},
+		// Not named after their unit.
+		{Name: "tests/units/size", Description: "size", Measure: size, Aggregation: view.LastValue()},
+		{Name: "tests/units/latency", Description: "latency", Measure: latency, Aggregation: view.Distribution(100)},
+	}
+	if err := view.Register(views...); err != nil {
+		t.Fatalf("failed to create views: %v", err)
+	}
+	defer view.Unregister(views...)
+	stats.Record(context.Background(), size.M(1024), latency.M(50), latency.M(250))
+	if _, err := view.RetrieveData(views[0].Name); err != nil {
+		t.Fatalf("failed to retrieve data: %v", err)
+	}
+
+	srv := httptest.NewServer(exporter)
+	defer srv.Close()
+	scrape := func(accept string) []string {
+		req, err := http.NewRequest("GET", srv.URL, nil)
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+		req.Header.Set("Accept", accept)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("failed to get /metrics: %v", err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("failed to read body: %v", err)
+		}
+		resp.Body.Close()
+		if !resp.Uncompressed {
+			t.Errorf("%s response was not compressed although the client accepts gzip", accept)
+		}
+		var got []string
+		for _, line := range strings.Split(string(body), "\n") {
+			if strings.Contains(line, "tests_units_") || strings.HasPrefix(line, "# EOF") {
+				got = append(got, line)
+			}
+		}
+		return got
+	}
+
+	want := []string{
+		"# HELP tests_units_latency latency",
+		"# TYPE tests_units_latency histogram",
+		`tests_units_latency_bucket{le="100.0"} 1`,
+		`tests_units_latency_bucket{le="+Inf"} 2`,
+		"tests_units_latency_sum 300.0",
+		"tests_units_latency_count 2",
+		"# UNIT tests_units_latency_seconds seconds",
+		"# HELP tests_units_latency_seconds latency",
+		"# TYPE tests_units_latency_seconds histogram",
+		`tests_units_latency_seconds_bucket{le="0.1"} 1`,
+		`tests_units_latency_seconds_bucket{le="+Inf"} 2`,
+		"tests_units_latency_seconds_sum 0.3",
+		"tests_units_latency_seconds_count 2",
+		"# HELP tests_units_requests requests",
+		"# TYPE tests_units_requests unknown",
+		"tests_units_requests 2.0",
+		"# HELP tests_units_size size",
+		"# TYPE tests_units_size gauge",
+		"tests_units_size 1024.0",
+		"# UNIT tests_units_size_bytes bytes",
+		"# HELP tests_units_size_bytes size",
+		"# TYPE tests_units_size_bytes gauge",
+		"tests_units_size_bytes 1024.0",
+		"# EOF",
+	}
+	if diff := cmp.Diff(want, scrape(string(expfmt.FmtOpenMetrics))); diff != "" {
+		t.Errorf("unexpected OpenMetrics output (-want +got):\n%s", diff)
+	}
+
+	// The text format has no units, but the values are converted.
+	want = []string{
+		"# HELP tests_units_latency latency",
+		"# TYPE tests_units_latency histogram",
+		`tests_units_latency_bucket{le="100"} 1`,
+		`tests_units_latency_bucket{le="+Inf"} 2`,
+		"tests_units_latency_sum 300",
+		"tests_units_latency_count 2",
+		"# HELP tests_units_latency_seconds latency",
+		"# TYPE tests_units_latency_seconds histogram",
+		`tests_units_latency_seconds_bucket{le="0.1"} 1`,
+		`tests_units_latency_seconds_bucket{le="+Inf"} 2`,
+		"tests_units_latency_seconds_sum 0.3",
+		"tests_units_latency_seconds_count 2",
+		"# HELP tests_units_requests requests",
+		"# TYPE tests_units_requests counter",
+		"tests_units_requests 2",
+		"# HELP tests_units_size size",
+		"# TYPE tests_units_size gauge",
+		"tests_units_size 1024",
+		"# HELP tests_units_size_bytes size",
+		"# TYPE tests_units_size_bytes gauge",
+		"tests_units_size_bytes 1024",
+	}
+	if diff := cmp.Diff(want, scrape(string(expfmt.FmtText))); diff != "" {
+		t.Errorf("unexpected text output (-want +got):\n%s", diff)
+	}
+}
+
+func TestOpenMetricsExemplars(t *testing.T) {
+	var errs []error
+	exporter, err := NewExporter(Options{
+		EnableOpenMetrics: true,
+		OnError:           func(err error) { errs = append(errs, err) },
+	})
+	if err != nil {
+		t.Fatalf("failed to create prometheus exporter: %v", err)
+	}
+	m := stats.Float64("tests/exemplars", "latency with exemplars", stats.UnitMilliseconds)
+	v := &view.View{
+		Name:        "exemplar/latency",
+		Description: "this is a test",
+		Measure:     m,
+		Aggregation: view.Distribution(1, 10),
+	}
+	if err := view.Register(v); err != nil {
+		t.Fatalf("Register error: %v", err)
+	}
+	defer view.Unregister(v)
+
+	ctx := context.Background()
+	stats.RecordWithOptions(ctx, stats.WithMeasurements(m.M(0.5)))
+	stats.RecordWithOptions(ctx,
+		stats.WithAttachmentLabels(map[string]string{"request_id": "abc", "user": "u1"}),
+		stats.WithMeasurements(m.M(5)))
+	stats.RecordWithOptions(ctx,
+		stats.WithAttachmentLabels(map[string]string{"request_id": "def"}),
+		stats.WithMeasurements(m.M(50)))
+
+	srv := httptest.NewServer(exporter)
+	defer srv.Close()
+	req, err := http.NewRequest("GET", srv.URL, nil)
+	if err != nil {
+		t.Fatalf("http.NewRequest error: %v", err)
+	}
+	req.Header.Set("Accept", "application/openmetrics-text; version=0.0.1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("http.Get error: %v", err)
+	}
+	blob, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Read body error: %v", err)
+	}
+	resp.Body.Close()
+	output := string(blob)
+
+	for _, line := range []string{
+		`exemplar_latency_bucket{le="1.0"} 1` + "\n",
+		`exemplar_latency_bucket{le="10.0"} 2 # {request_id="abc",user="u1"} 5.0 `,
+		`exemplar_latency_bucket{le="+Inf"} 3 # {request_id="def"} 50.0 `,
+	} {
+		if !strings.Contains(output, line) {
+			t.Errorf("output does not contain %q. Output: %s", line, output)
+		}
+	}
+
+	stats.RecordWithOptions(ctx,
+		stats.WithAttachmentLabels(map[string]string{"request-id": "ghi"}),
+		stats.WithMeasurements(m.M(5)))
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("http.Get error: %v", err)
+	}
+	blob, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Read body error: %v", err)
+	}
+	resp.Body.Close()
+	output = string(blob)
+
+	if line := `exemplar_latency_bucket{le="10.0"} 3` + "\n"; !strings.Contains(output, line) {
+		t.Errorf("output does not contain %q. Output: %s", line, output)
+	}
+	if len(errs) != 1 {
+		t.Errorf("OnError called with %v; want a single invalid label name error", errs)
+	}
+}
+
+func TestSetExemplarsEnabled(t *testing.T) {
+	exporter, err := NewExporter(Options{EnableOpenMetrics: true})
+	if err != nil {
+		t.Fatalf("failed to create prometheus exporter: %v", err)
+	}
+	m := stats.Float64("tests/toggled_exemplars", "latency with exemplars", stats.UnitMilliseconds)
+	v := &view.View{
+		Name:        "toggled_exemplar/latency",
+		Description: "this is a test",
+		Measure:     m,
+		Aggregation: view.Distribution(1, 10),
+	}
+	if err := view.Register(v); err != nil {
+		t.Fatalf("Register error: %v", err)
+	}
+	defer view.Unregister(v)
+	stats.RecordWithOptions(context.Background(),
+		stats.WithAttachmentLabels(map[string]string{"request_id": "abc"}),
+		stats.WithMeasurements(m.M(5)))
+
+	srv := httptest.NewServer(exporter)
+	defer srv.Close()
+	scrape := func() string {
+		req, err := http.NewRequest("GET", srv.URL, nil)
+		if err != nil {
+			t.Fatalf("http.NewRequest error: %v", err)
+		}
+		req.Header.Set("Accept", "application/openmetrics-text; version=0.0.1")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("http.Get error: %v", err)
+		}
+		defer resp.Body.Close()
+		blob, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("Read body error: %v", err)
+		}
+		return string(blob)
+	}
+
+	withExemplar := `toggled_exemplar_latency_bucket{le="10.0"} 1 # {request_id="abc"} 5.0 `
+	withoutExemplar := `toggled_exemplar_latency_bucket{le="10.0"} 1` + "\n"
+	for _, tc := range []struct {
+		enabled bool
+		want    string
+	}{
+		{true, withExemplar},
+		{false, withoutExemplar},
+		{true, withExemplar},
+	} {
+		exporter.SetExemplarsEnabled(tc.enabled)
+		if output := scrape(); !strings.Contains(output, tc.want) {
+			t.Errorf("with exemplars enabled %v, output does not contain %q. Output: %s", tc.enabled, tc.want, output)
+		}
+	}
+
+	// Toggling is safe during concurrent scrapes.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			exporter.SetExemplarsEnabled(i%2 == 0)
+			scrape()
+		}(i)
+	}
+	wg.Wait()
 }
@@ -0,0 +1,122 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cloudian/opencensus-go/metric/metricdata"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// pairedCounts returns the counts of the Count view paired with the Sum view
+// of metric by Options.SumCountPairs, keyed by the label values of their
+// series, or false if metric is not paired or cannot be paired, which is
+// reported to OnError. byName holds the collected metrics by metric name.
+func (c *collector) pairedCounts(metric *metricdata.Metric, byName map[string]*metricdata.Metric) (map[string]uint64, bool) {
+	countName, ok := c.opts.SumCountPairs[metric.Descriptor.Name]
+	if !ok {
+		return nil, false
+	}
+	switch metric.Descriptor.Type {
+	case metricdata.TypeCumulativeInt64, metricdata.TypeCumulativeFloat64:
+	default:
+		c.reportPairError(metric.Descriptor.Name, fmt.Errorf("cannot pair view %q with a count: it is not a Sum view", metric.Descriptor.Name))
+		return nil, false
+	}
+	count, ok := byName[countName]
+	if !ok {
+		// The Count view has no data yet, or is not registered.
+		return map[string]uint64{}, true
+	}
+	if count.Descriptor.Type != metricdata.TypeCumulativeInt64 || !sameLabelKeys(metric.Descriptor.LabelKeys, count.Descriptor.LabelKeys) {
+		c.reportPairError(metric.Descriptor.Name, fmt.Errorf("cannot pair view %q with view %q: it is not a Count view with the same tag keys", metric.Descriptor.Name, countName))
+		return nil, false
+	}
+	counts := make(map[string]uint64, len(count.TimeSeries))
+	for _, ts := range count.TimeSeries {
+		if len(ts.Points) == 0 {
+			continue
+		}
+		if v, ok := ts.Points[len(ts.Points)-1].Value.(int64); ok {
+			counts[labelValuesKey(ts.LabelValues)] = uint64(v)
+		}
+	}
+	return counts, true
+}
+
+// reportPairError reports err, the error pairing the Sum view with the
+// metric name sum, to OnError, unless an error was reported for it already.
+// Pairing is checked on every scrape, while the views rarely change.
+func (c *collector) reportPairError(sum string, err error) {
+	c.pairErrorsMu.Lock()
+	reported := c.pairErrors[sum]
+	if !reported {
+		if c.pairErrors == nil {
+			c.pairErrors = make(map[string]bool)
+		}
+		c.pairErrors[sum] = true
+	}
+	c.pairErrorsMu.Unlock()
+	if !reported {
+		c.opts.onError(err)
+	}
+}
+
+// resetPairErrors forgets the reported pairing errors, so that they are
+// reported again.
+func (c *collector) resetPairErrors() {
+	c.pairErrorsMu.Lock()
+	defer c.pairErrorsMu.Unlock()
+	c.pairErrors = nil
+}
+
+func sameLabelKeys(a, b []metricdata.LabelKey) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Key != b[i].Key {
+			return false
+		}
+	}
+	return true
+}
+
+// labelValuesKey returns a key identifying the label values of a series.
+func labelValuesKey(values []metricdata.LabelValue) string {
+	var b strings.Builder
+	for _, v := range values {
+		if v.Present {
+			b.WriteByte(1)
+		} else {
+			b.WriteByte(0)
+		}
+		fmt.Fprintf(&b, "%d:%s", len(v.Value), v.Value)
+	}
+	return b.String()
+}
+
+// toPairedSummary converts the point of a series of a Sum view to a summary
+// without quantiles whose count is that of the same series of the paired
+// Count view.
+func toPairedSummary(desc *prometheus.Desc, ts *metricdata.TimeSeries, point metricdata.Point, counts map[string]uint64, labelValues []string) (prometheus.Metric, error) {
+	sum, err := toPromValue(point)
+	if err != nil {
+		return nil, err
+	}
+	return prometheus.NewConstSummary(desc, counts[labelValuesKey(ts.LabelValues)], sum, nil, labelValues...)
+}
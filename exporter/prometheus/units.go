@@ -0,0 +1,225 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package prometheus
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/cloudian/opencensus-go/metric/metricdata"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// promUnit returns the Prometheus base unit of the OpenCensus unit u and the
+// factor converting values in u to it. The unit is empty if u has no
+// Prometheus base unit, such as dimensionless metrics.
+func promUnit(u metricdata.Unit) (unit string, factor float64) {
+	switch u {
+	case metricdata.UnitBytes:
+		return "bytes", 1
+	case metricdata.UnitMilliseconds:
+		return "seconds", 1e-3
+	case "s":
+		return "seconds", 1
+	}
+	return "", 1
+}
+
+// setUnit records the Prometheus unit of the metric family name.
+func (c *collector) setUnit(name, unit string) {
+	c.unitsMu.Lock()
+	defer c.unitsMu.Unlock()
+	if c.units == nil {
+		c.units = make(map[string]string)
+	}
+	c.units[name] = unit
+}
+
+// resetUnits drops the recorded Prometheus units.
+func (c *collector) resetUnits() {
+	c.unitsMu.Lock()
+	defer c.unitsMu.Unlock()
+	c.units = nil
+}
+
+// unit returns the Prometheus unit recorded for the metric family name.
+func (c *collector) unit(name string) string {
+	c.unitsMu.Lock()
+	defer c.unitsMu.Unlock()
+	return c.units[name]
+}
+
+// serveOpenMetrics serves the metrics of e in the OpenMetrics format, see
+// serveFamilies.
+func (e *Exporter) serveOpenMetrics(w http.ResponseWriter, r *http.Request) {
+	e.serveFamilies(w, r, expfmt.FmtOpenMetrics)
+}
+
+// withInfBucketLabel returns a handler serving the text format with
+// serveFamilies, and the other formats with handler. The protobuf format
+// encodes the overflow bucket by its bound, without le label.
+func (e *Exporter) withInfBucketLabel(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if expfmt.Negotiate(r.Header) != expfmt.FmtText {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		e.serveFamilies(w, r, expfmt.FmtText)
+	})
+}
+
+// serveFamilies serves the metrics of e in format, the text or the
+// OpenMetrics format. The encoders support neither units nor another le label
+// for the overflow bucket of histograms, so the families are encoded one by
+// one. In OpenMetrics, each family that has a unit is preceded by its UNIT
+// line, which OpenMetrics allows in any order with the HELP and TYPE lines.
+func (e *Exporter) serveFamilies(w http.ResponseWriter, r *http.Request, format expfmt.Format) {
+	mfs, err := e.g.Gather()
+	if err != nil {
+		err = fmt.Errorf("error gathering metrics: %v", err)
+		e.opts.onError(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", string(format))
+	var out io.Writer = w
+	if gzipAccepted(r.Header) {
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		defer gz.Close()
+		out = gz
+	}
+	for _, mf := range mfs {
+		name := mf.GetName()
+		if unit := e.c.unit(name); format == expfmt.FmtOpenMetrics && unit != "" {
+			if _, err := fmt.Fprintf(out, "# UNIT %s %s\n", name, unit); err != nil {
+				e.opts.onError(fmt.Errorf("error writing metrics: %v", err))
+				return
+			}
+		}
+		if err := e.encodeFamily(out, mf, format); err != nil {
+			e.opts.onError(fmt.Errorf("error encoding metric family %q: %v", name, err))
+			return
+		}
+	}
+	if format != expfmt.FmtOpenMetrics {
+		return
+	}
+	if _, err := expfmt.FinalizeOpenMetrics(out); err != nil {
+		e.opts.onError(fmt.Errorf("error writing metrics: %v", err))
+	}
+}
+
+// encodeFamily writes mf to out in format, the text or the OpenMetrics
+// format, with the InfBucketLabel of e as the le label of the overflow
+// buckets of histograms.
+func (e *Exporter) encodeFamily(out io.Writer, mf *dto.MetricFamily, format expfmt.Format) error {
+	encode := expfmt.MetricFamilyToText
+	if format == expfmt.FmtOpenMetrics {
+		encode = expfmt.MetricFamilyToOpenMetrics
+	}
+	infLabel := e.opts.InfBucketLabel
+	if mf.GetType() != dto.MetricType_HISTOGRAM || infLabel == "" || infLabel == "+Inf" {
+		_, err := encode(out, mf)
+		return err
+	}
+	var buf bytes.Buffer
+	if _, err := encode(&buf, mf); err != nil {
+		return err
+	}
+	_, err := out.Write(replaceInfBucketLabel(buf.Bytes(), infLabel))
+	return err
+}
+
+// replaceInfBucketLabel replaces the le label of the overflow buckets in the
+// encoded histogram family b with infLabel. The encoders write le as the last
+// label of a series, and escape the quotes of label values, so that only the
+// first occurrence on a line can be the le label of the series; later ones
+// belong to exemplars.
+func replaceInfBucketLabel(b []byte, infLabel string) []byte {
+	lines := bytes.SplitAfter(b, []byte("\n"))
+	for i, line := range lines {
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		j := bytes.Index(line, []byte(`le="+Inf"}`))
+		if j <= 0 || (line[j-1] != '{' && line[j-1] != ',') {
+			continue
+		}
+		replaced := append([]byte{}, line[:j]...)
+		replaced = append(replaced, `le="`+infLabel+`"}`...)
+		lines[i] = append(replaced, line[j+len(`le="+Inf"}`):]...)
+	}
+	return bytes.Join(lines, nil)
+}
+
+// gzipAccepted reports whether the request headers accept a gzip encoded
+// response.
+func gzipAccepted(header http.Header) bool {
+	for _, part := range strings.Split(header.Get("Accept-Encoding"), ",") {
+		part = strings.TrimSpace(part)
+		if part == "gzip" || strings.HasPrefix(part, "gzip;") {
+			return true
+		}
+	}
+	return false
+}
+
+// scalePoint returns p with its values multiplied by factor.
+func scalePoint(p metricdata.Point, factor float64) metricdata.Point {
+	switch v := p.Value.(type) {
+	case float64:
+		p.Value = v * factor
+	case int64:
+		p.Value = float64(v) * factor
+	case *metricdata.Distribution:
+		d := *v
+		d.Sum *= factor
+		d.SumOfSquaredDeviation *= factor * factor
+		if d.BucketOptions != nil {
+			bounds := make([]float64, len(d.BucketOptions.Bounds))
+			for i, b := range d.BucketOptions.Bounds {
+				bounds[i] = b * factor
+			}
+			d.BucketOptions = &metricdata.BucketOptions{Bounds: bounds}
+		}
+		d.Buckets = make([]metricdata.Bucket, len(v.Buckets))
+		for i, b := range v.Buckets {
+			if b.Exemplar != nil {
+				e := *b.Exemplar
+				e.Value *= factor
+				b.Exemplar = &e
+			}
+			d.Buckets[i] = b
+		}
+		p.Value = &d
+	case *metricdata.Summary:
+		s := *v
+		s.Sum *= factor
+		s.Snapshot.Sum *= factor
+		s.Snapshot.Percentiles = make(map[float64]float64, len(v.Snapshot.Percentiles))
+		for q, value := range v.Snapshot.Percentiles {
+			s.Snapshot.Percentiles[q] = value * factor
+		}
+		p.Value = &s
+	}
+	return p
+}
@@ -0,0 +1,117 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package stdout contains an exporter that prints OpenCensus view data in a
+// human-readable form, intended for local development and debugging.
+package stdout // import "github.com/cloudian/opencensus-go/exporter/stdout"
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudian/opencensus-go/stats/view"
+)
+
+// Exporter prints the rows of every exported view, one line per row.
+// Register it with view.RegisterExporter to print the view data once per
+// reporting period.
+//
+// This should NOT be used for production workloads.
+type Exporter struct {
+	mu   sync.Mutex
+	opts Options
+}
+
+// Options contains options for configuring the exporter.
+type Options struct {
+	// Writer is where the rows are printed. Defaults to os.Stdout.
+	Writer io.Writer
+
+	// Format formats a single row of the given view data, without a trailing
+	// newline. Defaults to DefaultFormat.
+	Format func(vd *view.Data, row *view.Row) string
+}
+
+// NewExporter returns an exporter that prints view data.
+func NewExporter(o Options) (*Exporter, error) {
+	if o.Writer == nil {
+		o.Writer = os.Stdout
+	}
+	if o.Format == nil {
+		o.Format = DefaultFormat
+	}
+	return &Exporter{opts: o}, nil
+}
+
+var _ view.Exporter = (*Exporter)(nil)
+
+// DefaultFormat formats a row as the end time of the reporting period, the
+// view name, the tags of the row as key=value pairs and the aggregated data,
+// for example:
+//
+//	2021-10-17T12:00:00Z http/latency    method=GET count=5 mean=12.5 buckets=[2 3 0]
+func DefaultFormat(vd *view.Data, row *view.Row) string {
+	fields := make([]string, 0, len(row.Tags)+1)
+	for _, t := range row.Tags {
+		fields = append(fields, t.Key.Name()+"="+t.Value)
+	}
+	fields = append(fields, formatData(row.Data))
+	return fmt.Sprintf("%v %-45s %s", vd.End.Format(time.RFC3339), vd.View.Name, strings.Join(fields, " "))
+}
+
+// formatData formats the aggregated data of a row.
+func formatData(data view.AggregationData) string {
+	switch d := data.(type) {
+	case *view.CountData:
+		return fmt.Sprintf("count=%d", d.Value)
+	case *view.SumData:
+		return fmt.Sprintf("sum=%v", d.Value)
+	case *view.LastValueData:
+		return fmt.Sprintf("last=%v", d.Value)
+	case *view.GaugeData:
+		return fmt.Sprintf("last=%v min=%v max=%v", d.Last, d.Min, d.Max)
+	case *view.LastValueSummaryData:
+		return fmt.Sprintf("last=%v", d.Value)
+	case *view.DistributionData:
+		return fmt.Sprintf("count=%d mean=%v buckets=%v", d.Count, d.Mean, d.CountPerBucket)
+	case *view.UniqueCountData:
+		return fmt.Sprintf("unique=%d", d.Estimate())
+	case *view.RawData:
+		return fmt.Sprintf("value=%v", d.Value)
+	case *view.CustomAggregationData:
+		return fmt.Sprintf("%v", d.Data)
+	default:
+		return fmt.Sprintf("%v", data)
+	}
+}
+
+// ExportView prints the rows of the view data, sorted by their formatted form.
+func (e *Exporter) ExportView(vd *view.Data) {
+	lines := make([]string, 0, len(vd.Rows))
+	for _, row := range vd.Rows {
+		lines = append(lines, e.opts.Format(vd, row))
+	}
+	sort.Strings(lines)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, line := range lines {
+		fmt.Fprintln(e.opts.Writer, line)
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stdout
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudian/opencensus-go/stats"
+	"github.com/cloudian/opencensus-go/stats/view"
+	"github.com/cloudian/opencensus-go/tag"
+)
+
+func TestExportView(t *testing.T) {
+	m := stats.Float64("tests/latency", "latency", stats.UnitMilliseconds)
+	k := tag.MustNewKey("method")
+	end := time.Date(2021, 10, 17, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		vd   *view.Data
+		want []string
+	}{
+		{
+			name: "count",
+			vd: &view.Data{
+				View: &view.View{Name: "tests/count", Measure: m, Aggregation: view.Count()},
+				End:  end,
+				Rows: []*view.Row{
+					{Tags: []tag.Tag{{Key: k, Value: "POST"}}, Data: &view.CountData{Value: 2}},
+					{Tags: []tag.Tag{{Key: k, Value: "GET"}}, Data: &view.CountData{Value: 5}},
+				},
+			},
+			want: []string{
+				"2021-10-17T12:00:00Z tests/count                                   method=GET count=5",
+				"2021-10-17T12:00:00Z tests/count                                   method=POST count=2",
+			},
+		},
+		{
+			name: "distribution",
+			vd: &view.Data{
+				View: &view.View{Name: "tests/distribution", Measure: m, Aggregation: view.Distribution(10)},
+				End:  end,
+				Rows: []*view.Row{
+					{Data: &view.DistributionData{Count: 3, Min: 1, Max: 20, Mean: 9, CountPerBucket: []int64{2, 1}}},
+				},
+			},
+			want: []string{
+				"2021-10-17T12:00:00Z tests/distribution                            count=3 mean=9 buckets=[2 1]",
+			},
+		},
+		{
+			name: "sum",
+			vd: &view.Data{
+				View: &view.View{Name: "tests/sum", Measure: m, Aggregation: view.Sum()},
+				End:  end,
+				Rows: []*view.Row{
+					{Tags: []tag.Tag{{Key: k, Value: "GET"}}, Data: &view.SumData{Value: 12.5}},
+				},
+			},
+			want: []string{
+				"2021-10-17T12:00:00Z tests/sum                                     method=GET sum=12.5",
+			},
+		},
+		{
+			name: "last value",
+			vd: &view.Data{
+				View: &view.View{Name: "tests/last", Measure: m, Aggregation: view.LastValue()},
+				End:  end,
+				Rows: []*view.Row{
+					{Data: &view.LastValueData{Value: 4}},
+				},
+			},
+			want: []string{
+				"2021-10-17T12:00:00Z tests/last                                    last=4",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			e, err := NewExporter(Options{Writer: &buf})
+			if err != nil {
+				t.Fatalf("NewExporter() = %v", err)
+			}
+			e.ExportView(tt.vd)
+			got := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+			if len(got) != len(tt.want) {
+				t.Fatalf("ExportView() printed %q; want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("line %d = %q; want %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestExportViewCustomFormat(t *testing.T) {
+	var buf bytes.Buffer
+	e, err := NewExporter(Options{
+		Writer: &buf,
+		Format: func(vd *view.Data, row *view.Row) string {
+			return fmt.Sprintf("%s=%d", vd.View.Name, row.Data.(*view.CountData).Value)
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewExporter() = %v", err)
+	}
+	e.ExportView(&view.Data{
+		View: &view.View{Name: "tests/count"},
+		Rows: []*view.Row{{Data: &view.CountData{Value: 7}}},
+	})
+	if got, want := buf.String(), "tests/count=7\n"; got != want {
+		t.Errorf("ExportView() printed %q; want %q", got, want)
+	}
+}
@@ -4,6 +4,7 @@ require (
 	github.com/golang/groupcache v0.0.0-20210331224755-41bb18bfe9da
 	github.com/golang/protobuf v1.4.3
 	github.com/google/go-cmp v0.5.6
+	github.com/prometheus/client_model v0.2.0
 	github.com/stretchr/testify v1.7.0
 	golang.org/x/net v0.0.0-20211014222326-fd004c51d1d6
 	golang.org/x/sys v0.0.0-20211013075003-97ac67df715c // indirect
@@ -22,14 +23,14 @@ require (
 	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c // indirect
 )
 
+require github.com/prometheus/common v0.30.0
+
 require (
 	github.com/beorn7/perks v1.0.1 // indirect
 	github.com/cespare/xxhash/v2 v2.1.1 // indirect
 	github.com/go-kit/log v0.1.0 // indirect
 	github.com/go-logfmt/logfmt v0.5.0 // indirect
 	github.com/matttproud/golang_protobuf_extensions v1.0.1 // indirect
-	github.com/prometheus/client_model v0.2.0 // indirect
-	github.com/prometheus/common v0.30.0 // indirect
 	github.com/prometheus/procfs v0.6.0 // indirect
 	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
@@ -43,4 +43,5 @@ type TimeSeries struct {
 	LabelValues []LabelValue // label values, same order as keys in the metric descriptor
 	Points      []Point      // points sequence
 	StartTime   time.Time    // time we started recording this time series
+	Updated     time.Time    // time this time series was last updated, zero if unknown
 }
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"net"
 	"net/http"
 	"net/http/httptest"
@@ -30,13 +31,6 @@ func httpHandler(statusCode, respSize int) http.Handler {
 	})
 }
 
-func updateMean(mean float64, sample, count int) float64 {
-	if count == 1 {
-		return float64(sample)
-	}
-	return mean + (float64(sample)-mean)/float64(count)
-}
-
 func TestHandlerStatsCollection(t *testing.T) {
 	if err := view.Register(DefaultServerViews...); err != nil {
 		t.Fatalf("Failed to register ochttp.DefaultServerViews error: %v", err)
@@ -58,7 +52,7 @@ func TestHandlerStatsCollection(t *testing.T) {
 		{"post 503", "POST", "http://opencensus.io/request/two", 5, 503, 1024, 16384},
 		{"no body 302", "GET", "http://opencensus.io/request/three", 2, 302, 0, 0},
 	}
-	totalCount, meanReqSize, meanRespSize := 0, 0.0, 0.0
+	totalCount, totalReqSize, totalRespSize := 0, 0, 0
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -76,10 +70,8 @@ func TestHandlerStatsCollection(t *testing.T) {
 			for i := 0; i < test.count; i++ {
 				h.ServeHTTP(w, r)
 				totalCount++
-				// Distributions do not track sum directly, we must
-				// mimic their behaviour to avoid rounding failures.
-				meanReqSize = updateMean(meanReqSize, test.reqSize, totalCount)
-				meanRespSize = updateMean(meanRespSize, test.respSize, totalCount)
+				totalReqSize += test.reqSize
+				totalRespSize += test.respSize
 			}
 		})
 	}
@@ -118,14 +110,15 @@ func TestHandlerStatsCollection(t *testing.T) {
 			t.Fatalf("%s = %d; want %d", viewName, got, want)
 		}
 
-		// We can only check sum for distribution views.
+		// We can only check sum for distribution views. Distributions do
+		// not track sum directly, so allow for rounding errors.
 		switch viewName {
 		case "opencensus.io/http/server/request_bytes":
-			if got, want := sum, meanReqSize*float64(totalCount); got != want {
+			if got, want := sum, float64(totalReqSize); math.Abs(got-want) > 1e-9*want {
 				t.Fatalf("%s = %g; want %g", viewName, got, want)
 			}
 		case "opencensus.io/http/server/response_bytes":
-			if got, want := sum, meanRespSize*float64(totalCount); got != want {
+			if got, want := sum, float64(totalRespSize); math.Abs(got-want) > 1e-9*want {
 				t.Fatalf("%s = %g; want %g", viewName, got, want)
 			}
 		}
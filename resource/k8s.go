@@ -0,0 +1,83 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resource
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/cloudian/opencensus-go/resource/resourcekeys"
+)
+
+// Environment variables used by DetectK8s. They are conventionally set from
+// the pod's metadata with the Kubernetes downward API.
+const (
+	EnvVarK8sPodName   = "POD_NAME"
+	EnvVarK8sNamespace = "POD_NAMESPACE"
+	EnvVarK8sNodeName  = "NODE_NAME"
+)
+
+// k8sServiceHostEnvVar is set by Kubernetes in all containers.
+const k8sServiceHostEnvVar = "KUBERNETES_SERVICE_HOST"
+
+// k8sNamespaceFile is the file the namespace of the pod is mounted at with
+// its service account.
+var k8sNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// hostname returns the hostname, which Kubernetes sets to the pod name.
+var hostname = os.Hostname
+
+// DetectK8s is a detector that loads resource information about the
+// Kubernetes pod the process runs in: a resource of type k8s with the
+// k8s.pod.name, k8s.namespace.name and k8s.node.name labels. The names are
+// read from the POD_NAME, POD_NAMESPACE and NODE_NAME environment variables.
+// If they are unset, the pod name defaults to the hostname and the namespace
+// to the one of the pod's service account.
+//
+// It returns nil if the process does not run in Kubernetes, which is
+// detected by the KUBERNETES_SERVICE_HOST environment variable and the
+// variables above all being unset.
+func DetectK8s(context.Context) (*Resource, error) {
+	pod := strings.TrimSpace(os.Getenv(EnvVarK8sPodName))
+	namespace := strings.TrimSpace(os.Getenv(EnvVarK8sNamespace))
+	node := strings.TrimSpace(os.Getenv(EnvVarK8sNodeName))
+	if pod == "" && namespace == "" && node == "" && os.Getenv(k8sServiceHostEnvVar) == "" {
+		return nil, nil
+	}
+	if pod == "" {
+		pod, _ = hostname()
+	}
+	if namespace == "" {
+		if b, err := ioutil.ReadFile(k8sNamespaceFile); err == nil {
+			namespace = strings.TrimSpace(string(b))
+		}
+	}
+
+	res := &Resource{Type: resourcekeys.K8SType, Labels: map[string]string{}}
+	for k, v := range map[string]string{
+		resourcekeys.K8SKeyPodName:       pod,
+		resourcekeys.K8SKeyNamespaceName: namespace,
+		resourcekeys.K8SKeyNodeName:      node,
+	} {
+		if v != "" {
+			res.Labels[k] = v
+		}
+	}
+	return res, nil
+}
+
+var _ Detector = DetectK8s
@@ -57,6 +57,84 @@ func EncodeLabels(labels map[string]string) string {
 	return s
 }
 
+const labelKeySizeLimit = 100
+
+var labelKeyRegex = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]{0,99}$`)
+
+// Validate checks that all label keys of the resource can be used as metric
+// label names without modification: a key must start with a letter, contain
+// only letters, digits and underscores, and be at most 100 characters long.
+// Keys that do not satisfy these rules can be fixed with Sanitize.
+func (r *Resource) Validate() error {
+	if r == nil {
+		return nil
+	}
+	keys := make([]string, 0, len(r.Labels))
+	for k := range r.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if !labelKeyRegex.MatchString(k) {
+			return fmt.Errorf("invalid resource label key %q", k)
+		}
+	}
+	return nil
+}
+
+// Sanitize returns a copy of the resource with all label keys rewritten to
+// satisfy Validate. Invalid characters are replaced with underscores, keys
+// not starting with a letter are prefixed with "key" and all keys are truncated
+// to 100 characters. If two keys collide after sanitization, the
+// value of the lexicographically smaller original key is kept.
+func (r *Resource) Sanitize() *Resource {
+	if r == nil {
+		return nil
+	}
+	res := &Resource{Type: r.Type}
+	if r.Labels == nil {
+		return res
+	}
+	keys := make([]string, 0, len(r.Labels))
+	for k := range r.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	res.Labels = make(map[string]string, len(r.Labels))
+	for _, k := range keys {
+		sk := sanitizeKey(k)
+		if _, ok := res.Labels[sk]; ok {
+			continue
+		}
+		res.Labels[sk] = r.Labels[k]
+	}
+	return res
+}
+
+// sanitizeKey replaces everything but ASCII letters and digits in k with
+// underscores, prefixes keys that do not start with a letter and truncates the
+// result to labelKeySizeLimit characters.
+func sanitizeKey(k string) string {
+	k = strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, k)
+	switch {
+	case k == "":
+		k = "key"
+	case k[0] >= '0' && k[0] <= '9':
+		k = "key_" + k
+	case k[0] == '_':
+		k = "key" + k
+	}
+	if len(k) > labelKeySizeLimit {
+		k = k[:labelKeySizeLimit]
+	}
+	return k
+}
+
 var labelRegex = regexp.MustCompile(`^\s*([[:ascii:]]{1,256}?)=("[[:ascii:]]{0,256}?")\s*,`)
 
 // DecodeLabels decodes a serialized label map as used in the OC_RESOURCE_LABELS variable.
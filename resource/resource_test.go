@@ -18,7 +18,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -161,3 +164,134 @@ func TestMultiDetector(t *testing.T) {
 		t.Fatalf("unexpected error: want %v, got %v", wantErr, err)
 	}
 }
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		res      *Resource
+		wantFail bool
+	}{
+		{res: nil},
+		{res: &Resource{Type: "t1"}},
+		{res: &Resource{Labels: map[string]string{"region": "us-east", "Zone_1": "a"}}},
+		{res: &Resource{Labels: map[string]string{"cloud.region": "us-east"}}, wantFail: true},
+		{res: &Resource{Labels: map[string]string{"1zone": "a"}}, wantFail: true},
+		{res: &Resource{Labels: map[string]string{"_zone": "a"}}, wantFail: true},
+		{res: &Resource{Labels: map[string]string{"": "a"}}, wantFail: true},
+		{res: &Resource{Labels: map[string]string{strings.Repeat("a", 101): "a"}}, wantFail: true},
+	}
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("case-%d", i), func(t *testing.T) {
+			err := c.res.Validate()
+			if err != nil && !c.wantFail {
+				t.Fatalf("unwanted error: %s", err)
+			}
+			if c.wantFail && err == nil {
+				t.Fatalf("wanted failure but got none for %v", c.res.Labels)
+			}
+		})
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	res := &Resource{
+		Type: "t1",
+		Labels: map[string]string{
+			"cloud.region":           "us-east",
+			"1zone":                  "a",
+			"_host":                  "h",
+			"k8s/pod-name":           "p",
+			strings.Repeat("a", 101): "long",
+			"valid_key":              "v",
+		},
+	}
+	got := res.Sanitize()
+	want := &Resource{
+		Type: "t1",
+		Labels: map[string]string{
+			"cloud_region":           "us-east",
+			"key_1zone":              "a",
+			"key_host":               "h",
+			"k8s_pod_name":           "p",
+			strings.Repeat("a", 100): "long",
+			"valid_key":              "v",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected resource: want %v, got %v", want, got)
+	}
+	if err := got.Validate(); err != nil {
+		t.Fatalf("sanitized resource is invalid: %v", err)
+	}
+	if _, ok := res.Labels["cloud.region"]; !ok {
+		t.Fatalf("Sanitize modified the original resource: %v", res.Labels)
+	}
+}
+
+func TestDetectK8s(t *testing.T) {
+	defer func(f string) { k8sNamespaceFile = f }(k8sNamespaceFile)
+	defer func(f func() (string, error)) { hostname = f }(hostname)
+	k8sNamespaceFile = filepath.Join(t.TempDir(), "namespace")
+	hostname = func() (string, error) { return "pod-from-hostname", nil }
+	for _, k := range []string{EnvVarK8sPodName, EnvVarK8sNamespace, EnvVarK8sNodeName, k8sServiceHostEnvVar} {
+		t.Setenv(k, "")
+	}
+
+	res, err := DetectK8s(context.Background())
+	if err != nil || res != nil {
+		t.Fatalf("DetectK8s() outside of Kubernetes = %v, %v; want nil, nil", res, err)
+	}
+
+	t.Setenv(EnvVarK8sPodName, "pod-1")
+	t.Setenv(EnvVarK8sNamespace, "default")
+	t.Setenv(EnvVarK8sNodeName, "node-1")
+	res, err = DetectK8s(context.Background())
+	if err != nil {
+		t.Fatalf("DetectK8s() = %v", err)
+	}
+	want := &Resource{
+		Type: "k8s",
+		Labels: map[string]string{
+			"k8s.pod.name":       "pod-1",
+			"k8s.namespace.name": "default",
+			"k8s.node.name":      "node-1",
+		},
+	}
+	if !reflect.DeepEqual(res, want) {
+		t.Errorf("DetectK8s() = %v; want %v", res, want)
+	}
+
+	// Without the downward API, the pod name and namespace are detected
+	// from the hostname and the service account.
+	t.Setenv(EnvVarK8sPodName, "")
+	t.Setenv(EnvVarK8sNamespace, "")
+	t.Setenv(EnvVarK8sNodeName, "")
+	t.Setenv(k8sServiceHostEnvVar, "10.0.0.1")
+	if err := ioutil.WriteFile(k8sNamespaceFile, []byte("kube-system\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	res, err = DetectK8s(context.Background())
+	if err != nil {
+		t.Fatalf("DetectK8s() = %v", err)
+	}
+	want = &Resource{
+		Type: "k8s",
+		Labels: map[string]string{
+			"k8s.pod.name":       "pod-from-hostname",
+			"k8s.namespace.name": "kube-system",
+		},
+	}
+	if !reflect.DeepEqual(res, want) {
+		t.Errorf("DetectK8s() = %v; want %v", res, want)
+	}
+
+	// DetectK8s composes with other detectors.
+	res, err = MultiDetector(DetectK8s, func(context.Context) (*Resource, error) {
+		return &Resource{Type: "host", Labels: map[string]string{"host.name": "h"}}, nil
+	})(context.Background())
+	if err != nil {
+		t.Fatalf("MultiDetector() = %v", err)
+	}
+	if res.Type != "k8s" || res.Labels["host.name"] != "h" || res.Labels["k8s.pod.name"] != "pod-from-hostname" {
+		t.Errorf("MultiDetector() = %v; want the k8s resource merged with the host labels", res)
+	}
+}
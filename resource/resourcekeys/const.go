@@ -27,6 +27,7 @@ const (
 	K8SKeyNamespaceName  = "k8s.namespace.name"
 	K8SKeyPodName        = "k8s.pod.name"
 	K8SKeyDeploymentName = "k8s.deployment.name"
+	K8SKeyNodeName       = "k8s.node.name"
 )
 
 // Constants for Container resources.
@@ -0,0 +1,45 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stats
+
+import (
+	"context"
+	"math"
+)
+
+// Add records delta to m, for measures aggregated by a view.SumGauge
+// view that tracks a quantity going up and down, such as the number of open
+// connections or of in-flight requests. Int64 measures record delta rounded
+// to the nearest integer. Measures other than Int64Measure and Float64Measure
+// are ignored.
+func Add(ctx context.Context, m Measure, delta float64) {
+	switch m := m.(type) {
+	case *Float64Measure:
+		Record(ctx, m.M(delta))
+	case *Int64Measure:
+		Record(ctx, m.M(int64(math.Round(delta))))
+	}
+}
+
+// Inc records 1 to m, see Add.
+func Inc(ctx context.Context, m Measure) {
+	Add(ctx, m, 1)
+}
+
+// Dec records -1 to m, see Add.
+func Dec(ctx context.Context, m Measure) {
+	Add(ctx, m, -1)
+}
@@ -16,6 +16,7 @@ package stats_test
 
 import (
 	"context"
+	"fmt"
 	"testing"
 
 	"github.com/cloudian/opencensus-go/stats"
@@ -108,6 +109,89 @@ func BenchmarkRecord8_8Tags(b *testing.B) {
 	}
 }
 
+func BenchmarkRecord8_8Tags_Signature(b *testing.B) {
+	var mutators []tag.Mutator
+	for i := 1; i <= 8; i++ {
+		mutators = append(mutators, tag.Insert(tag.MustNewKey(fmt.Sprintf("key%d", i)), "value"))
+	}
+	ctx, err := tag.New(context.Background(), mutators...)
+	if err != nil {
+		b.Fatal(err)
+	}
+	sig := tag.Signature(ctx)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		stats.RecordWithSignature(sig, m.M(1), m.M(1), m.M(1), m.M(1), m.M(1), m.M(1), m.M(1), m.M(1))
+	}
+}
+
+func BenchmarkRecord1_ExtraTag(b *testing.B) {
+	ctx, err := tag.New(context.Background(), tag.Insert(tag.MustNewKey("method"), "GET"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	status := tag.MustNewKey("status")
+
+	b.Run("RecordWithExtraTags", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			stats.RecordWithExtraTags(ctx, []tag.Tag{{Key: status, Value: "200"}}, m.M(1))
+		}
+	})
+	b.Run("New+Record", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			ctx, _ := tag.New(ctx, tag.Upsert(status, "200"))
+			stats.Record(ctx, m.M(1))
+		}
+	})
+}
+
+func BenchmarkRecord8_8Tags_Unsubscribed(b *testing.B) {
+	var mutators []tag.Mutator
+	for i := 1; i <= 8; i++ {
+		mutators = append(mutators, tag.Insert(tag.MustNewKey(fmt.Sprintf("key%d", i)), "value"))
+	}
+	ctx, err := tag.New(context.Background(), mutators...)
+	if err != nil {
+		b.Fatal(err)
+	}
+	unsubscribed := stats.Int64("BenchmarkRecord8_8Tags_Unsubscribed/m", "", stats.UnitDimensionless)
+	v := &view.View{Measure: unsubscribed, Aggregation: view.Count()}
+	if err := view.Register(v); err != nil {
+		b.Fatal(err)
+	}
+	view.Unregister(v)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		stats.Record(ctx, unsubscribed.M(1), unsubscribed.M(1), unsubscribed.M(1), unsubscribed.M(1), unsubscribed.M(1), unsubscribed.M(1), unsubscribed.M(1), unsubscribed.M(1))
+	}
+}
+
+func BenchmarkRecord8_SharedAttachments(b *testing.B) {
+	ctx := context.Background()
+	latency := stats.Float64("BenchmarkRecord8_SharedAttachments/latency", "", stats.UnitMilliseconds)
+	v := &view.View{
+		Measure:     latency,
+		Aggregation: view.Distribution(1, 10, 100),
+	}
+	if err := view.Register(v); err != nil {
+		b.Fatal(err)
+	}
+	defer view.Unregister(v)
+	attachments := stats.WithAttachments(map[string]interface{}{"request_id": "abc"})
+	ms := stats.WithMeasurements(latency.M(1), latency.M(2), latency.M(5), latency.M(10), latency.M(20), latency.M(50), latency.M(100), latency.M(200))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		stats.RecordWithOptions(ctx, attachments, ms)
+	}
+}
+
 func makeMeasure() *stats.Int64Measure {
 	m := stats.Int64("m", "test measure", "")
 	v := &view.View{
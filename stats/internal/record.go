@@ -21,5 +21,23 @@ import (
 // DefaultRecorder will be called for each Record call.
 var DefaultRecorder func(tags *tag.Map, measurement interface{}, attachments map[string]interface{})
 
+// SignatureRecorder will be called for each RecordWithSignature call.
+var SignatureRecorder func(sig *tag.Sig, measurement interface{})
+
 // SubscriptionReporter reports when a view subscribed with a measure.
 var SubscriptionReporter func(measure string)
+
+// UnsubscriptionReporter reports when a view that subscribed with a measure
+// unsubscribed. Each call undoes one call of SubscriptionReporter.
+var UnsubscriptionReporter func(measure string)
+
+// CancelledRecorder is implemented by the recorders that count the
+// recordings skipped because their context was done, see
+// stats.SkipIfCancelled.
+type CancelledRecorder interface {
+	RecordCancelled()
+}
+
+// DefaultCancelledRecorder will be called for each recording to the default
+// recorder skipped because its context was done.
+var DefaultCancelledRecorder func()
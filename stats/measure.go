@@ -16,6 +16,7 @@
 package stats
 
 import (
+	"strconv"
 	"sync"
 	"sync/atomic"
 )
@@ -46,6 +47,29 @@ type Measure interface {
 	// Units are encoded according to the case-sensitive abbreviations from the
 	// Unified Code for Units of Measure: http://unitsofmeasure.org/ucum.html
 	Unit() string
+
+	// ValueType returns the type of the values this measure takes on.
+	ValueType() ValueType
+}
+
+// ValueType is the type of the values of a measure.
+type ValueType int
+
+// Value types of measures.
+const (
+	ValueTypeInt64   ValueType = iota + 1 // values of Int64Measure
+	ValueTypeFloat64                      // values of Float64Measure
+)
+
+func (t ValueType) String() string {
+	switch t {
+	case ValueTypeInt64:
+		return "Int64"
+	case ValueTypeFloat64:
+		return "Float64"
+	default:
+		return "ValueType(" + strconv.Itoa(int(t)) + ")"
+	}
 }
 
 // measureDescriptor is the untyped descriptor associated with each measure.
@@ -53,19 +77,30 @@ type Measure interface {
 // recording APIs.
 // Two Measures with the same name will have the same measureDescriptor.
 type measureDescriptor struct {
-	subs int32 // access atomically
+	subs int32 // number of subscribers, access atomically
 
 	name        string
 	description string
 	unit        string
+	// valueType is the value type of the measure the descriptor was
+	// created for.
+	valueType ValueType
+	// err is the validation error of the measure, see SetMeasureValidation.
+	err error
 }
 
 func (m *measureDescriptor) subscribe() {
-	atomic.StoreInt32(&m.subs, 1)
+	atomic.AddInt32(&m.subs, 1)
+}
+
+func (m *measureDescriptor) unsubscribe() {
+	atomic.AddInt32(&m.subs, -1)
 }
 
+// subscribed reports whether any view or backfill is subscribed to the
+// measure. Recording is skipped for measures without subscribers.
 func (m *measureDescriptor) subscribed() bool {
-	return atomic.LoadInt32(&m.subs) == 1
+	return atomic.LoadInt32(&m.subs) > 0
 }
 
 var (
@@ -73,22 +108,48 @@ var (
 	measures = make(map[string]*measureDescriptor)
 )
 
-func registerMeasureHandle(name, desc, unit string) *measureDescriptor {
+func registerMeasureHandle(name, desc, unit string, valueType ValueType) *measureDescriptor {
 	mu.Lock()
-	defer mu.Unlock()
-
 	if stored, ok := measures[name]; ok {
+		mu.Unlock()
 		return stored
 	}
+	handler := invalidMeasureHandler
 	m := &measureDescriptor{
 		name:        name,
 		description: desc,
 		unit:        unit,
+		valueType:   valueType,
+	}
+	if handler != nil {
+		m.err = validateMeasure(desc, unit)
 	}
 	measures[name] = m
+	mu.Unlock()
+
+	if m.err != nil {
+		handler(name, m.err)
+	}
 	return m
 }
 
+// FindMeasure returns the measure created with Int64 or Float64 under the
+// given name, for example to resolve measures named in configuration, or nil
+// if there is none. The returned measure is of the type it was first created
+// with.
+func FindMeasure(name string) Measure {
+	mu.RLock()
+	d, ok := measures[name]
+	mu.RUnlock()
+	if !ok {
+		return nil
+	}
+	if d.valueType == ValueTypeInt64 {
+		return &Int64Measure{d}
+	}
+	return &Float64Measure{d}
+}
+
 // Measurement is the numeric value measured when recording stats. Each measure
 // provides methods to create measurements of their kind. For example, Int64Measure
 // provides M to convert an int64 into a measurement.
@@ -35,7 +35,7 @@ func (m *Float64Measure) M(v float64) Measurement {
 // See the documentation for interface Measure for more guidance on the
 // parameters of this function.
 func Float64(name, description, unit string) *Float64Measure {
-	mi := registerMeasureHandle(name, description, unit)
+	mi := registerMeasureHandle(name, description, unit, ValueTypeFloat64)
 	return &Float64Measure{mi}
 }
 
@@ -53,3 +53,8 @@ func (m *Float64Measure) Description() string {
 func (m *Float64Measure) Unit() string {
 	return m.desc.unit
 }
+
+// ValueType returns ValueTypeFloat64.
+func (m *Float64Measure) ValueType() ValueType {
+	return ValueTypeFloat64
+}
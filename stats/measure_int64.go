@@ -35,7 +35,7 @@ func (m *Int64Measure) M(v int64) Measurement {
 // See the documentation for interface Measure for more guidance on the
 // parameters of this function.
 func Int64(name, description, unit string) *Int64Measure {
-	mi := registerMeasureHandle(name, description, unit)
+	mi := registerMeasureHandle(name, description, unit, ValueTypeInt64)
 	return &Int64Measure{mi}
 }
 
@@ -53,3 +53,8 @@ func (m *Int64Measure) Description() string {
 func (m *Int64Measure) Unit() string {
 	return m.desc.unit
 }
+
+// ValueType returns ValueTypeInt64.
+func (m *Int64Measure) ValueType() ValueType {
+	return ValueTypeInt64
+}
@@ -0,0 +1,109 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stats_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cloudian/opencensus-go/stats"
+)
+
+func TestMeasureValueType(t *testing.T) {
+	tests := []struct {
+		m    stats.Measure
+		want stats.ValueType
+	}{
+		{stats.Int64("TestMeasureValueType/int64", "", stats.UnitDimensionless), stats.ValueTypeInt64},
+		{stats.Float64("TestMeasureValueType/float64", "", stats.UnitDimensionless), stats.ValueTypeFloat64},
+	}
+	for _, tt := range tests {
+		if got := tt.m.ValueType(); got != tt.want {
+			t.Errorf("%s: ValueType() = %v; want %v", tt.m.Name(), got, tt.want)
+		}
+	}
+	if got, want := stats.ValueTypeInt64.String(), "Int64"; got != want {
+		t.Errorf("String() = %q; want %q", got, want)
+	}
+	if got, want := stats.ValueType(0).String(), "ValueType(0)"; got != want {
+		t.Errorf("String() = %q; want %q", got, want)
+	}
+}
+
+func TestMeasureValidation(t *testing.T) {
+	var invalid []string
+	stats.SetMeasureValidation(func(name string, err error) {
+		invalid = append(invalid, name)
+	})
+	defer stats.SetMeasureValidation(nil)
+
+	for _, unit := range []string{stats.UnitDimensionless, stats.UnitBytes, stats.UnitMegabytes, "MiBy", stats.UnitPercent,
+		stats.UnitMilliseconds, stats.UnitHours, "d", "{request}", "By/s", "{request}/s"} {
+		m := stats.Int64("TestMeasureValidation/valid/"+unit, "valid", unit)
+		if err := stats.MeasureError(m); err != nil {
+			t.Errorf("MeasureError() of unit %q = %v; want nil", unit, err)
+		}
+	}
+	if len(invalid) != 0 {
+		t.Errorf("invalid measures %v; want none", invalid)
+	}
+
+	for _, unit := range []string{"bytes", "sec", "By/s/s", "{}", "kms"} {
+		m := stats.Int64("TestMeasureValidation/invalid/"+unit, "invalid", unit)
+		if stats.MeasureError(m) == nil {
+			t.Errorf("MeasureError() of unit %q = nil; want an error", unit)
+		}
+		if m.Unit() != unit {
+			t.Errorf("Unit() = %q; want the invalid unit %q kept", m.Unit(), unit)
+		}
+	}
+	stats.Int64("TestMeasureValidation/no_description", "", stats.UnitDimensionless)
+	// Measures without unit are reported, but keep their empty unit.
+	if m := stats.Float64("TestMeasureValidation/no_unit", "no unit", ""); m.Unit() != "" {
+		t.Errorf("Unit() = %q; want the empty unit kept", m.Unit())
+	}
+	want := []string{
+		"TestMeasureValidation/invalid/bytes",
+		"TestMeasureValidation/invalid/sec",
+		"TestMeasureValidation/invalid/By/s/s",
+		"TestMeasureValidation/invalid/{}",
+		"TestMeasureValidation/invalid/kms",
+		"TestMeasureValidation/no_description",
+		"TestMeasureValidation/no_unit",
+	}
+	if strings.Join(invalid, ",") != strings.Join(want, ",") {
+		t.Errorf("invalid measures %v; want %v", invalid, want)
+	}
+
+	// Measures are validated once, when created.
+	stats.SetMeasureValidation(nil)
+	if m := stats.Int64("TestMeasureValidation/unvalidated", "", "bytes"); stats.MeasureError(m) != nil {
+		t.Errorf("MeasureError() = %v without validation; want nil", stats.MeasureError(m))
+	}
+}
+
+func TestFindMeasure(t *testing.T) {
+	i := stats.Int64("TestFindMeasure/int64", "int64", stats.UnitDimensionless)
+	f := stats.Float64("TestFindMeasure/float64", "float64", stats.UnitDimensionless)
+	for _, m := range []stats.Measure{i, f} {
+		got := stats.FindMeasure(m.Name())
+		if got == nil || got.Name() != m.Name() || got.ValueType() != m.ValueType() {
+			t.Errorf("FindMeasure(%q) = %v; want a measure of type %v", m.Name(), got, m.ValueType())
+		}
+	}
+	if got := stats.FindMeasure("TestFindMeasure/unknown"); got != nil {
+		t.Errorf("FindMeasure() of an unknown measure = %v; want nil", got)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stats
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// invalidMeasureHandler is called with the measures that fail validation as
+// they are created, or nil if measures are not validated. Guarded by mu.
+var invalidMeasureHandler func(name string, err error)
+
+// SetMeasureValidation enables validating measures as they are created with
+// Int64 and Float64, if handler is not nil, or disables it. A measure is
+// invalid if its description is empty or its unit is not a valid unit, see
+// ValidUnit, which includes an empty unit. Validation does not modify
+// measures: invalid measures are still created as they are and can be
+// recorded, but handler is called with their name and the validation error,
+// for example to log it, and MeasureError returns the error. Measures that
+// were created before validation was enabled are not validated.
+func SetMeasureValidation(handler func(name string, err error)) {
+	mu.Lock()
+	defer mu.Unlock()
+	invalidMeasureHandler = handler
+}
+
+// MeasureError returns the error of the validation of m when it was created,
+// or nil if m is valid or was not validated, see SetMeasureValidation.
+func MeasureError(m Measure) error {
+	mu.RLock()
+	defer mu.RUnlock()
+	if d, ok := measures[m.Name()]; ok {
+		return d.err
+	}
+	return nil
+}
+
+func validateMeasure(desc, unit string) error {
+	if desc == "" {
+		return errors.New("empty description")
+	}
+	if unit == "" {
+		return fmt.Errorf("empty unit, use %q for dimensionless measures", UnitDimensionless)
+	}
+	if !ValidUnit(unit) {
+		return fmt.Errorf("invalid unit %q", unit)
+	}
+	return nil
+}
+
+// unitPrefixes are the SI and binary prefixes allowed for the units of
+// information.
+var unitPrefixes = []string{"", "k", "M", "G", "T", "Ki", "Mi", "Gi", "Ti"}
+
+// ValidUnit reports whether unit is in the subset of the Unified Code for
+// Units of Measure that OpenCensus recommends: UnitDimensionless, percent,
+// bytes and bits optionally with an SI or binary prefix such as "kBy" or
+// "MiBy", the time units ns, us, ms, s, min, h and d, or an annotation in
+// curly braces such as "{request}", optionally followed by a single
+// division, for example "By/s" or "{request}/s".
+func ValidUnit(unit string) bool {
+	parts := strings.SplitN(unit, "/", 2)
+	for _, p := range parts {
+		if !validUnitTerm(p) {
+			return false
+		}
+	}
+	return true
+}
+
+func validUnitTerm(term string) bool {
+	switch term {
+	case UnitDimensionless, UnitPercent, "d":
+		return true
+	}
+	if _, ok := DurationUnit(term); ok {
+		return true
+	}
+	if len(term) > 2 && term[0] == '{' && term[len(term)-1] == '}' {
+		return !strings.ContainsAny(term[1:len(term)-1], "{}/")
+	}
+	for _, prefix := range unitPrefixes {
+		if term == prefix+UnitBytes || term == prefix+UnitBits {
+			return true
+		}
+	}
+	return false
+}
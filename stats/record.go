@@ -29,6 +29,11 @@ func init() {
 		measures[measure].subscribe()
 		mu.Unlock()
 	}
+	internal.UnsubscriptionReporter = func(measure string) {
+		mu.Lock()
+		measures[measure].unsubscribe()
+		mu.Unlock()
+	}
 }
 
 // Recorder provides an interface for exporting measurement information from
@@ -44,15 +49,36 @@ type recordOptions struct {
 	mutators     []tag.Mutator
 	measurements []Measurement
 	recorder     Recorder
+	// skipIfCancelled skips recording if the context is done.
+	skipIfCancelled bool
 }
 
-// WithAttachments applies provided exemplar attachments.
+// WithAttachments applies provided exemplar attachments. The attachments are
+// shared, not copied, by the exemplars of all measurements recorded together,
+// so they must not be modified after recording.
 func WithAttachments(attachments metricdata.Attachments) Options {
 	return func(ro *recordOptions) {
 		ro.attachments = attachments
 	}
 }
 
+// WithAttachmentLabels adds the given string attachments to the exemplar
+// attachments. Exporters supporting exemplar labels, such as the Prometheus
+// exporter with OpenMetrics enabled, expose them as exemplar labels, so keys
+// should be valid label names. A later WithAttachments replaces them.
+func WithAttachmentLabels(labels map[string]string) Options {
+	return func(ro *recordOptions) {
+		attachments := make(metricdata.Attachments, len(ro.attachments)+len(labels))
+		for k, v := range ro.attachments {
+			attachments[k] = v
+		}
+		for k, v := range labels {
+			attachments[k] = v
+		}
+		ro.attachments = attachments
+	}
+}
+
 // WithTags applies provided tag mutators.
 func WithTags(mutators ...tag.Mutator) Options {
 	return func(ro *recordOptions) {
@@ -75,6 +101,31 @@ func WithRecorder(meter Recorder) Options {
 	}
 }
 
+// SkipIfCancelled skips recording if the context is cancelled or past its
+// deadline, for example to not account for requests the client gave up on.
+// Skipped recordings are counted by the internal metric
+// opencensus.io/stats/records_dropped_cancelled of the Meter recorded to,
+// see view.RegisterInternalViews.
+func SkipIfCancelled() Options {
+	return func(ro *recordOptions) {
+		ro.skipIfCancelled = true
+	}
+}
+
+// recordCancelled counts a recording to recorder, or to the default
+// recorder if nil, that was skipped because its context was done.
+func recordCancelled(recorder Recorder) {
+	if recorder == nil {
+		if internal.DefaultCancelledRecorder != nil {
+			internal.DefaultCancelledRecorder()
+		}
+		return
+	}
+	if r, ok := recorder.(internal.CancelledRecorder); ok {
+		r.RecordCancelled()
+	}
+}
+
 // Options apply changes to recordOptions.
 type Options func(*recordOptions)
 
@@ -109,6 +160,31 @@ func Record(ctx context.Context, ms ...Measurement) {
 	return
 }
 
+// RecordWithSignature records one or multiple measurements with the tag set
+// captured by sig, see tag.Signature. It is equivalent to Record with a
+// context holding the tags of sig, but avoids encoding the tags again for
+// every recording on hot paths.
+func RecordWithSignature(sig *tag.Sig, ms ...Measurement) {
+	if len(ms) == 0 {
+		return
+	}
+	recorder := internal.SignatureRecorder
+	if recorder == nil {
+		return
+	}
+	record := false
+	for _, m := range ms {
+		if m.desc.subscribed() {
+			record = true
+			break
+		}
+	}
+	if !record {
+		return
+	}
+	recorder(sig, ms)
+}
+
 // RecordWithTags records one or multiple measurements at once.
 //
 // Measurements will be tagged with the tags in the context mutated by the mutators.
@@ -118,6 +194,39 @@ func RecordWithTags(ctx context.Context, mutators []tag.Mutator, ms ...Measureme
 	return RecordWithOptions(ctx, WithTags(mutators...), WithMeasurements(ms...))
 }
 
+// RecordWithExtraTags records one or multiple measurements at once, tagged
+// with the tags in the context and extraTags upserted on top of them, for
+// example a status code only known at recording time. Unlike RecordWithTags,
+// it does not create a new context for the tags.
+func RecordWithExtraTags(ctx context.Context, extraTags []tag.Tag, ms ...Measurement) error {
+	if len(ms) == 0 {
+		return nil
+	}
+	recorder := internal.DefaultRecorder
+	if recorder == nil {
+		return nil
+	}
+	record := false
+	for _, m := range ms {
+		if m.desc.subscribed() {
+			record = true
+			break
+		}
+	}
+	if !record {
+		return nil
+	}
+	tags := tag.FromContext(ctx)
+	if len(extraTags) > 0 {
+		var err error
+		if tags, err = tags.With(extraTags...); err != nil {
+			return err
+		}
+	}
+	recorder(tags, ms, nil)
+	return nil
+}
+
 // RecordWithOptions records measurements from the given options (if any) against context
 // and tags and attachments in the options (if any).
 // If there are any tags in the context, measurements will be tagged with them.
@@ -143,6 +252,10 @@ func RecordWithOptions(ctx context.Context, ros ...Options) error {
 	if !record {
 		return nil
 	}
+	if o.skipIfCancelled && ctx.Err() != nil {
+		recordCancelled(o.recorder)
+		return nil
+	}
 	if len(o.mutators) > 0 {
 		var err error
 		if ctx, err = tag.New(ctx, o.mutators...); err != nil {
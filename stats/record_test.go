@@ -90,6 +90,232 @@ func TestRecordWithAttachments(t *testing.T) {
 	}
 }
 
+func TestRecordWithAttachmentLabels(t *testing.T) {
+	m := stats.Int64("TestRecordWithAttachmentLabels/m1", "", stats.UnitDimensionless)
+	v := &view.View{
+		Name:        "test_view_attachment_labels",
+		Measure:     m,
+		Aggregation: view.Distribution(5, 10),
+	}
+	if err := view.Register(v); err != nil {
+		t.Fatalf("Failed to register views: %v", err)
+	}
+	defer view.Unregister(v)
+
+	attachments := map[string]interface{}{metricdata.AttachmentKeySpanContext: spanCtx}
+	stats.RecordWithOptions(context.Background(),
+		stats.WithAttachments(attachments),
+		stats.WithAttachmentLabels(map[string]string{"request_id": "abc"}),
+		stats.WithMeasurements(m.M(7)))
+	rows, err := view.RetrieveData(v.Name)
+	if err != nil {
+		t.Fatalf("Failed to retrieve data %v", err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("got %d rows; want 1", len(rows))
+	}
+	e := rows[0].Data.(*view.DistributionData).ExemplarsPerBucket[1]
+	wantExemplar := &metricdata.Exemplar{Value: 7, Attachments: metricdata.Attachments{
+		metricdata.AttachmentKeySpanContext: spanCtx,
+		"request_id":                        "abc",
+	}}
+	if diff := cmpExemplar(e, wantExemplar); diff != "" {
+		t.Errorf("Unexpected Exemplar -got +want: %s", diff)
+	}
+	if len(attachments) != 1 {
+		t.Errorf("WithAttachmentLabels modified the attachments passed to WithAttachments: %v", attachments)
+	}
+}
+
+func TestRecordWithSharedAttachments(t *testing.T) {
+	m1 := stats.Float64("TestRecordWithSharedAttachments/m1", "", stats.UnitMilliseconds)
+	m2 := stats.Float64("TestRecordWithSharedAttachments/m2", "", stats.UnitMilliseconds)
+	v1 := &view.View{Measure: m1, Aggregation: view.Distribution(5, 10)}
+	v2 := &view.View{Measure: m2, Aggregation: view.Distribution(5, 10)}
+	if err := view.Register(v1, v2); err != nil {
+		t.Fatalf("Failed to register views: %v", err)
+	}
+	defer view.Unregister(v1, v2)
+
+	attachments := map[string]interface{}{metricdata.AttachmentKeySpanContext: spanCtx}
+	stats.RecordWithOptions(context.Background(),
+		stats.WithAttachments(attachments),
+		stats.WithMeasurements(m1.M(1), m2.M(7), m1.M(20)))
+
+	exemplars := map[string][]*metricdata.Exemplar{}
+	for _, v := range []*view.View{v1, v2} {
+		rows, err := view.RetrieveData(v.Name)
+		if err != nil {
+			t.Fatalf("Failed to retrieve data %v", err)
+		}
+		if len(rows) != 1 {
+			t.Fatalf("%s: got %d rows; want 1", v.Name, len(rows))
+		}
+		for _, e := range rows[0].Data.(*view.DistributionData).ExemplarsPerBucket {
+			if e != nil {
+				exemplars[v.Name] = append(exemplars[v.Name], e)
+			}
+		}
+	}
+	want := map[string][]float64{v1.Name: {1, 20}, v2.Name: {7}}
+	for name, values := range want {
+		if len(exemplars[name]) != len(values) {
+			t.Fatalf("%s: got %d exemplars; want %d", name, len(exemplars[name]), len(values))
+		}
+		for i, e := range exemplars[name] {
+			if diff := cmpExemplar(e, &metricdata.Exemplar{Value: values[i], Attachments: attachments}); diff != "" {
+				t.Errorf("%s: unexpected Exemplar -got +want: %s", name, diff)
+			}
+			// The attachments are shared rather than copied per measurement.
+			if reflect.ValueOf(e.Attachments).Pointer() != reflect.ValueOf(attachments).Pointer() {
+				t.Errorf("%s: exemplar %d has a copy of the attachments", name, i)
+			}
+		}
+	}
+}
+
+type spyRecorder struct {
+	calls int
+}
+
+func (r *spyRecorder) Record(*tag.Map, interface{}, map[string]interface{}) {
+	r.calls++
+}
+
+func TestRecordResubscribe(t *testing.T) {
+	m := stats.Int64("TestRecordResubscribe/m1", "", stats.UnitDimensionless)
+	v := &view.View{Measure: m, Aggregation: view.Count()}
+	if err := view.Register(v); err != nil {
+		t.Fatalf("Failed to register views: %v", err)
+	}
+	view.Unregister(v)
+
+	// Without subscribed views, recording stops before reaching any recorder.
+	spy := &spyRecorder{}
+	stats.RecordWithOptions(context.Background(), stats.WithRecorder(spy), stats.WithMeasurements(m.M(1)))
+	if spy.calls != 0 {
+		t.Errorf("recorder called %d times for a measure without subscribers; want 0", spy.calls)
+	}
+
+	if err := view.Register(v); err != nil {
+		t.Fatalf("Failed to register views: %v", err)
+	}
+	defer view.Unregister(v)
+	stats.Record(context.Background(), m.M(1))
+	stats.RecordWithOptions(context.Background(), stats.WithRecorder(spy), stats.WithMeasurements(m.M(1)))
+	if spy.calls != 1 {
+		t.Errorf("recorder called %d times after a view subscribed again; want 1", spy.calls)
+	}
+	rows, err := view.RetrieveData(v.Name)
+	if err != nil {
+		t.Fatalf("Failed to retrieve data %v", err)
+	}
+	if len(rows) != 1 || rows[0].Data.(*view.CountData).Value != 1 {
+		t.Errorf("got rows %v; want a count of 1", rows)
+	}
+}
+
+func TestRecordWithSignature(t *testing.T) {
+	k1 := tag.MustNewKey("k1")
+	k2 := tag.MustNewKey("k2")
+	m := stats.Int64("TestRecordWithSignature/m1", "", stats.UnitDimensionless)
+	v := &view.View{
+		Name:        "TestRecordWithSignature/count",
+		TagKeys:     []tag.Key{k1},
+		Measure:     m,
+		Aggregation: view.Count(),
+	}
+	if err := view.Register(v); err != nil {
+		t.Fatalf("Failed to register views: %v", err)
+	}
+	defer view.Unregister(v)
+
+	ctx, err := tag.New(context.Background(), tag.Insert(k1, "v1"), tag.Insert(k2, "v2"))
+	if err != nil {
+		t.Fatalf("tag.New() = %v", err)
+	}
+	sig := tag.Signature(ctx)
+	stats.Record(ctx, m.M(1))
+	stats.RecordWithSignature(sig, m.M(1))
+	stats.RecordWithSignature(sig, m.M(1))
+	stats.RecordWithSignature(tag.Signature(context.Background()), m.M(1))
+	ctx2, err := tag.New(context.Background(), tag.Insert(k2, "v2"), tag.Insert(k1, "v1"))
+	if err != nil {
+		t.Fatalf("tag.New() = %v", err)
+	}
+	if got, want := tag.Signature(ctx2).Key(), sig.Key(); got != want {
+		t.Errorf("Signature(ctx2).Key() = %q; want %q", got, want)
+	}
+	stats.RecordWithSignature(tag.Signature(ctx2), m.M(1))
+
+	rows, err := view.RetrieveData(v.Name)
+	if err != nil {
+		t.Fatalf("Failed to retrieve data %v", err)
+	}
+	got := make(map[string]int64)
+	for _, row := range rows {
+		var val string
+		if len(row.Tags) > 0 {
+			val = row.Tags[0].Value
+		}
+		got[val] = row.Data.(*view.CountData).Value
+	}
+	want := map[string]int64{"v1": 4, "": 1}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Unexpected rows -got +want: %s", diff)
+	}
+}
+
+func TestRecordWithExtraTags(t *testing.T) {
+	method := tag.MustNewKey("method")
+	status := tag.MustNewKey("status")
+	m := stats.Int64("TestRecordWithExtraTags/m1", "", stats.UnitDimensionless)
+	v := &view.View{
+		Name:        "TestRecordWithExtraTags/count",
+		TagKeys:     []tag.Key{method, status},
+		Measure:     m,
+		Aggregation: view.Count(),
+	}
+	if err := view.Register(v); err != nil {
+		t.Fatalf("Failed to register views: %v", err)
+	}
+	defer view.Unregister(v)
+
+	ctx, err := tag.New(context.Background(), tag.Insert(method, "GET"), tag.Insert(status, "unknown"))
+	if err != nil {
+		t.Fatalf("tag.New() = %v", err)
+	}
+	if err := stats.RecordWithExtraTags(ctx, []tag.Tag{{Key: status, Value: "200"}}, m.M(1)); err != nil {
+		t.Fatalf("RecordWithExtraTags() = %v", err)
+	}
+	if err := stats.RecordWithExtraTags(ctx, []tag.Tag{{Key: status, Value: "500"}}, m.M(1)); err != nil {
+		t.Fatalf("RecordWithExtraTags() = %v", err)
+	}
+	if err := stats.RecordWithExtraTags(ctx, nil, m.M(1)); err != nil {
+		t.Fatalf("RecordWithExtraTags() = %v", err)
+	}
+	if err := stats.RecordWithExtraTags(ctx, []tag.Tag{{Key: status, Value: "\x01"}}, m.M(1)); err == nil {
+		t.Error("RecordWithExtraTags() with an invalid tag value = nil error; want an error")
+	}
+	// The extra tags are not propagated in the context.
+	if got, _ := tag.FromContext(ctx).Value(status); got != "unknown" {
+		t.Errorf("context tag status = %q; want %q", got, "unknown")
+	}
+
+	rows, err := view.RetrieveData(v.Name)
+	if err != nil {
+		t.Fatalf("Failed to retrieve data %v", err)
+	}
+	got := make(map[string]int64)
+	for _, row := range rows {
+		got[row.Tags[0].Value+" "+row.Tags[1].Value] = row.Data.(*view.CountData).Value
+	}
+	want := map[string]int64{"GET 200": 1, "GET 500": 1, "GET unknown": 1}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Unexpected rows -got +want: %s", diff)
+	}
+}
+
 // Compare exemplars while ignoring exemplar timestamp, since timestamp is non-deterministic.
 func cmpExemplar(got, want *metricdata.Exemplar) string {
 	return cmp.Diff(got, want, cmpopts.IgnoreFields(metricdata.Exemplar{}, "Timestamp"), cmpopts.IgnoreUnexported(metricdata.Exemplar{}))
@@ -199,3 +425,144 @@ func TestRecordWithMeter(t *testing.T) {
 		t.Errorf("Wrong count for second_view, want %d, got %d", 1, gotCount.Value)
 	}
 }
+
+func TestRecordSince(t *testing.T) {
+	const elapsed = 1500 * time.Millisecond
+	tests := []struct {
+		m        stats.Measure
+		min, max float64
+	}{
+		{stats.Float64("TestRecordSince/ms", "", stats.UnitMilliseconds), 1500, 2500},
+		{stats.Float64("TestRecordSince/s", "", stats.UnitSeconds), 1.5, 2.5},
+		{stats.Int64("TestRecordSince/int_ms", "", stats.UnitMilliseconds), 1500, 2500},
+		{stats.Int64("TestRecordSince/int_s", "", stats.UnitSeconds), 1, 2},
+		{stats.Float64("TestRecordSince/us", "", "us"), 1.5e6, 2.5e6},
+	}
+	for _, tt := range tests {
+		v := &view.View{Name: tt.m.Name(), Measure: tt.m, Aggregation: view.LastValue()}
+		if err := view.Register(v); err != nil {
+			t.Fatalf("Register() = %v", err)
+		}
+		if err := stats.RecordSince(context.Background(), tt.m, time.Now().Add(-elapsed)); err != nil {
+			t.Errorf("RecordSince(%q) = %v", v.Name, err)
+		}
+		rows, err := view.RetrieveData(v.Name)
+		view.Unregister(v)
+		if err != nil {
+			t.Fatalf("RetrieveData(%q) = %v", v.Name, err)
+		}
+		if len(rows) != 1 {
+			t.Fatalf("%s: got %d rows; want 1", v.Name, len(rows))
+		}
+		if got := rows[0].Data.(*view.LastValueData).Value; got < tt.min || got > tt.max {
+			t.Errorf("%s: recorded %v; want in [%v, %v]", v.Name, got, tt.min, tt.max)
+		}
+	}
+
+	// Measures without a time unit are not recorded.
+	m := stats.Float64("TestRecordSince/dimensionless", "", stats.UnitDimensionless)
+	v := &view.View{Name: m.Name(), Measure: m, Aggregation: view.LastValue()}
+	if err := view.Register(v); err != nil {
+		t.Fatalf("Register() = %v", err)
+	}
+	defer view.Unregister(v)
+	if err := stats.RecordSince(context.Background(), m, time.Now().Add(-elapsed)); err == nil {
+		t.Errorf("RecordSince(%q) = nil error; want error", v.Name)
+	}
+	stats.Timer(context.Background(), m)()
+	if rows, _ := view.RetrieveData(v.Name); len(rows) != 0 {
+		t.Errorf("%s: got %d rows; want 0", v.Name, len(rows))
+	}
+}
+
+func TestIncDec(t *testing.T) {
+	conns := stats.Int64("TestIncDec/connections", "", stats.UnitDimensionless)
+	inflight := stats.Float64("TestIncDec/inflight", "", stats.UnitDimensionless)
+	for _, m := range []stats.Measure{conns, inflight} {
+		v := &view.View{Name: m.Name(), Measure: m, Aggregation: view.SumGauge()}
+		if err := view.Register(v); err != nil {
+			t.Fatalf("Register() = %v", err)
+		}
+		defer view.Unregister(v)
+
+		ctx := context.Background()
+		stats.Inc(ctx, m)
+		stats.Inc(ctx, m)
+		stats.Inc(ctx, m)
+		stats.Dec(ctx, m)
+		stats.Add(ctx, m, 5)
+		stats.Add(ctx, m, -3)
+
+		rows, err := view.RetrieveData(v.Name)
+		if err != nil {
+			t.Fatalf("RetrieveData(%q) = %v", v.Name, err)
+		}
+		if len(rows) != 1 {
+			t.Fatalf("%s: got %d rows; want 1", v.Name, len(rows))
+		}
+		if got, want := rows[0].Data.(*view.SumData).Value, 4.0; got != want {
+			t.Errorf("%s: net value = %v; want %v", v.Name, got, want)
+		}
+	}
+}
+
+func TestRecordDuration(t *testing.T) {
+	const d = 1500 * time.Millisecond
+	tests := []struct {
+		m    stats.Measure
+		want float64
+	}{
+		{stats.Float64("TestRecordDuration/ms", "", stats.UnitMilliseconds), 1500},
+		{stats.Float64("TestRecordDuration/s", "", stats.UnitSeconds), 1.5},
+		{stats.Int64("TestRecordDuration/int_s", "", stats.UnitSeconds), 1},
+	}
+	for _, tt := range tests {
+		v := &view.View{Name: tt.m.Name(), Measure: tt.m, Aggregation: view.LastValue()}
+		if err := view.Register(v); err != nil {
+			t.Fatalf("Register() = %v", err)
+		}
+		if err := stats.RecordDuration(context.Background(), tt.m, d); err != nil {
+			t.Errorf("%s: RecordDuration() = %v", v.Name, err)
+		}
+		rows, err := view.RetrieveData(v.Name)
+		view.Unregister(v)
+		if err != nil {
+			t.Fatalf("RetrieveData(%q) = %v", v.Name, err)
+		}
+		if len(rows) != 1 {
+			t.Fatalf("%s: got %d rows; want 1", v.Name, len(rows))
+		}
+		if got := rows[0].Data.(*view.LastValueData).Value; got != tt.want {
+			t.Errorf("%s: recorded %v; want %v", v.Name, got, tt.want)
+		}
+	}
+
+	m := stats.Float64("TestRecordDuration/bytes", "", stats.UnitBytes)
+	if err := stats.RecordDuration(context.Background(), m, d); err == nil {
+		t.Error("RecordDuration() to a measure of bytes = nil; want error")
+	}
+}
+
+func TestTimer(t *testing.T) {
+	m := stats.Float64("TestTimer/latency", "", stats.UnitMilliseconds)
+	v := &view.View{Name: m.Name(), Measure: m, Aggregation: view.LastValue()}
+	if err := view.Register(v); err != nil {
+		t.Fatalf("Register() = %v", err)
+	}
+	defer view.Unregister(v)
+
+	func() {
+		defer stats.Timer(context.Background(), m)()
+		time.Sleep(20 * time.Millisecond)
+	}()
+	rows, err := view.RetrieveData(v.Name)
+	if err != nil {
+		t.Fatalf("RetrieveData() = %v", err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("got %d rows; want 1", len(rows))
+	}
+	if got := rows[0].Data.(*view.LastValueData).Value; got < 20 {
+		t.Errorf("recorded %vms; want at least 20ms", got)
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stats
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// durationUnits maps the time units of the Unified Code for Units of Measure
+// to their duration.
+var durationUnits = map[string]time.Duration{
+	UnitNanoseconds:  time.Nanosecond,
+	UnitMicroseconds: time.Microsecond,
+	UnitMilliseconds: time.Millisecond,
+	UnitSeconds:      time.Second,
+	UnitMinutes:      time.Minute,
+	UnitHours:        time.Hour,
+}
+
+// DurationUnit returns the duration of the time unit, one of ns, us, ms,
+// s, min and h, or false if unit is not a time unit.
+func DurationUnit(unit string) (time.Duration, bool) {
+	d, ok := durationUnits[unit]
+	return d, ok
+}
+
+// RecordSince records the time elapsed since start to m, converted to the
+// unit of m, see RecordDuration. Nothing is recorded, and an error is
+// returned, for measures whose unit is not a time unit.
+func RecordSince(ctx context.Context, m Measure, start time.Time) error {
+	return RecordDuration(ctx, m, time.Since(start))
+}
+
+// RecordDuration records d to m, converted to the unit of m, for example as
+// fractional milliseconds for a Float64 measure of UnitMilliseconds or as
+// seconds for one of UnitSeconds. Int64 measures record d truncated to whole
+// units. RecordDuration returns an error, without recording, for measures
+// whose unit is not one of the time units ns, us, ms, s, min and h, and for
+// measures other than Int64Measure and Float64Measure.
+func RecordDuration(ctx context.Context, m Measure, d time.Duration) error {
+	if _, ok := durationUnits[m.Unit()]; !ok {
+		return fmt.Errorf("cannot record duration to measure %q: unit %q is not a time unit", m.Name(), m.Unit())
+	}
+	ms, ok := durationMeasurement(m, d)
+	if !ok {
+		return fmt.Errorf("cannot record duration to measure %q of type %T", m.Name(), m)
+	}
+	Record(ctx, ms)
+	return nil
+}
+
+// Timer returns a function that records the time elapsed since the call to
+// Timer to m, see RecordSince. Nothing is recorded for measures whose unit is
+// not a time unit. It is meant to be deferred:
+//
+//	defer stats.Timer(ctx, latency)()
+func Timer(ctx context.Context, m Measure) func() {
+	start := time.Now()
+	return func() {
+		RecordSince(ctx, m, start)
+	}
+}
+
+// durationMeasurement returns a measurement of d in the time unit of m.
+func durationMeasurement(m Measure, d time.Duration) (Measurement, bool) {
+	unit := durationUnits[m.Unit()]
+	switch m := m.(type) {
+	case *Float64Measure:
+		return m.M(float64(d) / float64(unit)), true
+	case *Int64Measure:
+		return m.M(int64(d / unit)), true
+	default:
+		return Measurement{}, false
+	}
+}
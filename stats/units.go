@@ -21,6 +21,14 @@ const (
 	UnitNone          = "1" // Deprecated: Use UnitDimensionless.
 	UnitDimensionless = "1"
 	UnitBytes         = "By"
+	UnitKilobytes     = "kBy"
+	UnitMegabytes     = "MBy"
+	UnitBits          = "bit"
+	UnitPercent       = "%"
+	UnitNanoseconds   = "ns"
+	UnitMicroseconds  = "us"
 	UnitMilliseconds  = "ms"
 	UnitSeconds       = "s"
+	UnitMinutes       = "min"
+	UnitHours         = "h"
 )
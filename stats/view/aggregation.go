@@ -15,18 +15,34 @@
 
 package view
 
-import "time"
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/cloudian/opencensus-go/stats"
+	"github.com/cloudian/opencensus-go/tag"
+)
 
 // AggType represents the type of aggregation function used on a View.
 type AggType int
 
 // All available aggregation types.
 const (
-	AggTypeNone         AggType = iota // no aggregation; reserved for future use.
-	AggTypeCount                       // the count aggregation, see Count.
-	AggTypeSum                         // the sum aggregation, see Sum.
-	AggTypeDistribution                // the distribution aggregation, see Distribution.
-	AggTypeLastValue                   // the last value aggregation, see LastValue.
+	AggTypeNone             AggType = iota // no aggregation; reserved for future use.
+	AggTypeCount                           // the count aggregation, see Count.
+	AggTypeSum                             // the sum aggregation, see Sum.
+	AggTypeDistribution                    // the distribution aggregation, see Distribution.
+	AggTypeLastValue                       // the last value aggregation, see LastValue.
+	AggTypeSumGauge                        // the sum aggregation exported as a gauge, see SumGauge.
+	AggTypeGauge                           // the last, min and max value aggregation, see Gauge.
+	AggTypeUniqueCount                     // the distinct tag value count aggregation, see UniqueCount.
+	AggTypeLastValueSummary                // the quantiles of recent last values, see LastValueSummary.
+	AggTypeCustom                          // an aggregation implemented outside of this package, see Custom.
+	AggTypeRaw                             // no aggregation, the recorded values are exported one by one, see Raw.
+	AggTypeRate                            // the rate of increase of another view, see Rate.
 )
 
 func (t AggType) String() string {
@@ -34,11 +50,18 @@ func (t AggType) String() string {
 }
 
 var aggTypeName = map[AggType]string{
-	AggTypeNone:         "None",
-	AggTypeCount:        "Count",
-	AggTypeSum:          "Sum",
-	AggTypeDistribution: "Distribution",
-	AggTypeLastValue:    "LastValue",
+	AggTypeNone:             "None",
+	AggTypeCount:            "Count",
+	AggTypeSum:              "Sum",
+	AggTypeDistribution:     "Distribution",
+	AggTypeLastValue:        "LastValue",
+	AggTypeSumGauge:         "SumGauge",
+	AggTypeGauge:            "Gauge",
+	AggTypeUniqueCount:      "UniqueCount",
+	AggTypeLastValueSummary: "LastValueSummary",
+	AggTypeCustom:           "Custom",
+	AggTypeRaw:              "Raw",
+	AggTypeRate:             "Rate",
 }
 
 // Aggregation represents a data aggregation method. Use one of the functions:
@@ -47,6 +70,31 @@ type Aggregation struct {
 	Type    AggType   // Type is the AggType of this Aggregation.
 	Buckets []float64 // Buckets are the bucket endpoints if this Aggregation represents a distribution, see Distribution.
 
+	// UpperInclusive makes the buckets of a distribution include their upper
+	// bound instead of their lower bound, so a value equal to Buckets[i] is
+	// counted in bucket i rather than i+1. This matches the "le" semantics of
+	// Prometheus histograms. It has no effect on other aggregation types.
+	UpperInclusive bool
+
+	// ExemplarBuckets, if set, limits the buckets of a distribution that
+	// retain exemplars, which may carry identifying attachments, to those it
+	// returns true for. It is called with the bucket index, see BucketIndex.
+	// This refines SetExemplarEnabled and SetExemplarFilter. ExemplarBuckets
+	// is not compared by Equal.
+	ExemplarBuckets func(bucket int) bool
+
+	uniqueKey tag.Key   // the tag whose distinct values are counted by UniqueCount
+	weightKey tag.Key   // the tag whose values weigh the values summed by WeightedSum
+	window    int       // the number of recent values kept by LastValueSummary
+	quantiles []float64 // the quantiles reported by LastValueSummary
+	custom    CustomAggregation
+	// rateSource and rateWindow are the source view and the window of Rate.
+	rateSource string
+	rateWindow time.Duration
+	// autoBuckets is the maximum number of buckets of AutoDistribution, or
+	// zero for distributions with fixed bounds.
+	autoBuckets int
+
 	newData func(time.Time) AggregationData
 }
 
@@ -63,6 +111,12 @@ var (
 			return &SumData{Start: t}
 		},
 	}
+	aggSumGauge = &Aggregation{
+		Type: AggTypeSumGauge,
+		newData: func(t time.Time) AggregationData {
+			return &SumData{Start: t, gauge: true}
+		},
+	}
 )
 
 // Count indicates that data collected and aggregated
@@ -81,6 +135,49 @@ func Sum() *Aggregation {
 	return aggSum
 }
 
+// WeightedSum sums up the recorded values like Sum, each multiplied by a
+// weight, for example bytes weighted by request priority. The weight of a
+// recording is the value of the tag weightKey parsed as a float, or 1 if the
+// tag is absent or its value is not a number. weightKey does not need to be
+// one of the TagKeys of the view.
+//
+// A view using WeightedSum is exported as a cumulative float64, whatever the
+// value type of its measure.
+func WeightedSum(weightKey tag.Key) *Aggregation {
+	return &Aggregation{
+		Type:      AggTypeSum,
+		weightKey: weightKey,
+		newData: func(t time.Time) AggregationData {
+			return &SumData{Start: t}
+		},
+	}
+}
+
+// weighted reports whether a is a WeightedSum.
+func (a *Aggregation) weighted() bool {
+	return a.weightKey != tag.Key{}
+}
+
+// weight returns the weight of a sample recorded with tags m by a
+// WeightedSum.
+func (a *Aggregation) weight(m *tag.Map) float64 {
+	if value, ok := m.Value(a.weightKey); ok {
+		if w, err := strconv.ParseFloat(value, 64); err == nil {
+			return w
+		}
+	}
+	return 1
+}
+
+// SumGauge indicates that data collected and aggregated
+// with this method will be summed up like Sum, but the result
+// is exported as a gauge rather than a cumulative value.
+// Use SumGauge for sums that can decrease, for example the
+// number of active connections recorded as +1 and -1.
+func SumGauge() *Aggregation {
+	return aggSumGauge
+}
+
 // Distribution indicates that the desired aggregation is
 // a histogram distribution.
 //
@@ -94,6 +191,10 @@ func Sum() *Aggregation {
 //     [bounds[i-1], bounds[i]) for 0 < i < length
 //     [bounds[i-1], +infinity) for i = length
 //
+// To include the upper bound of each bucket instead, that is
+// (bounds[i-1], bounds[i]], set UpperInclusive on the returned Aggregation
+// before registering the view.
+//
 // If len(bounds) is 0 then there is no histogram associated with the
 // distribution. There will be a single bucket with boundaries
 // (-infinity, +infinity).
@@ -111,6 +212,73 @@ func Distribution(bounds ...float64) *Aggregation {
 	return agg
 }
 
+// DistributionDurations converts the bucket bounds of a latency distribution,
+// given as durations, to the time unit of the measure the view records, one
+// of ns, us, ms, s, min and h, for use with Distribution:
+//
+//	bounds, err := view.DistributionDurations(stats.UnitMilliseconds,
+//		time.Millisecond, 10*time.Millisecond, 100*time.Millisecond)
+//	...
+//	v := &view.View{Measure: latency, Aggregation: view.Distribution(bounds...)}
+//
+// Bounds that are not whole units are converted to fractions, for example
+// 500µs to 0.5 milliseconds. An error is returned if unit is not a time unit.
+func DistributionDurations(unit string, bounds ...time.Duration) ([]float64, error) {
+	d, ok := stats.DurationUnit(unit)
+	if !ok {
+		return nil, fmt.Errorf("cannot convert durations to unit %q: not a time unit", unit)
+	}
+	converted := make([]float64, len(bounds))
+	for i, b := range bounds {
+		converted[i] = float64(b) / float64(d)
+	}
+	return converted, nil
+}
+
+// Equal reports whether a and other perform the same aggregation, that is
+// whether they have the same type, bucket bounds, bound inclusivity and, for
+// UniqueCount and LastValueSummary, the same parameters. Aggregations created
+// by separate calls to the same function, such as two calls to
+// Distribution(1, 10), are equal.
+func (a *Aggregation) Equal(other *Aggregation) bool {
+	if a == other {
+		return true
+	}
+	if a == nil || other == nil || a.Type != other.Type ||
+		a.UpperInclusive != other.UpperInclusive || a.uniqueKey != other.uniqueKey || a.weightKey != other.weightKey || a.window != other.window ||
+		a.autoBuckets != other.autoBuckets || a.rateSource != other.rateSource || a.rateWindow != other.rateWindow {
+		return false
+	}
+	return equalFloats(a.Buckets, other.Buckets) && equalFloats(a.quantiles, other.quantiles) &&
+		sameCustom(a.custom, other.custom)
+}
+
+func equalFloats(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i, f := range a {
+		if f != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// BucketIndex returns the index of the histogram bucket that v is counted in
+// by a distribution aggregation, that is the index into
+// DistributionData.CountPerBucket. By default buckets include their lower
+// bound and exclude their upper bound, so a value equal to Buckets[i] maps to
+// index i+1. Values below the first bound map to 0 and values greater than or
+// equal to the last bound map to len(Buckets). If UpperInclusive is set, a
+// value equal to Buckets[i] maps to index i instead.
+//
+// The result reflects the current Buckets; Register sorts them and drops
+// zero bounds, so call BucketIndex after registration.
+func (a *Aggregation) BucketIndex(v float64) int {
+	return bucketIndex(a.Buckets, v, a.UpperInclusive)
+}
+
 // LastValue only reports the last value recorded using this
 // aggregation. All other measurements will be dropped.
 func LastValue() *Aggregation {
@@ -121,3 +289,73 @@ func LastValue() *Aggregation {
 		},
 	}
 }
+
+// DefaultSummaryQuantiles are the quantiles reported by LastValueSummary if
+// none are given.
+var DefaultSummaryQuantiles = []float64{0.5, 0.9, 0.99}
+
+// LastValueSummary keeps the last window values recorded and reports the given
+// quantiles of them, in the range (0, 1], or DefaultSummaryQuantiles if none
+// are given. This describes jittery gauges, such as goroutine counts, better
+// than their last value alone. Memory per row is bounded by window, which
+// must be positive.
+//
+// A view using LastValueSummary is exported as a summary, whose count and sum
+// are those of the values in the window. RetrieveData returns the data as
+// *LastValueSummaryData.
+func LastValueSummary(window int, quantiles ...float64) *Aggregation {
+	if len(quantiles) == 0 {
+		quantiles = DefaultSummaryQuantiles
+	}
+	quantiles = append([]float64(nil), quantiles...)
+	sort.Float64s(quantiles)
+	agg := &Aggregation{
+		Type:      AggTypeLastValueSummary,
+		window:    window,
+		quantiles: quantiles,
+	}
+	agg.newData = func(_ time.Time) AggregationData {
+		return &LastValueSummaryData{window: make([]float64, 0, agg.window), quantiles: agg.quantiles}
+	}
+	return agg
+}
+
+// Gauge reports the last value recorded, like LastValue, together with the
+// minimum and maximum values recorded since the previous collection. This
+// catches transient values between collections.
+//
+// Each consumer has its own collection window: the registered view exporters
+// get the values recorded since their previous export, and readers of
+// Meter.ReadWindow, such as the Prometheus exporter, the values recorded
+// since their previous read. Other reads, such as RetrieveData and the
+// metric exporters reading the Meter as a metric producer, get the values
+// recorded since the row was created.
+//
+// A view using Gauge is exported as three gauges named after the view with
+// the suffixes "_last", "_min" and "_max".
+func Gauge() *Aggregation {
+	return &Aggregation{
+		Type: AggTypeGauge,
+		newData: func(_ time.Time) AggregationData {
+			return &GaugeData{Min: math.Inf(1), Max: math.Inf(-1)}
+		},
+	}
+}
+
+// UniqueCount approximates the number of distinct values of the tag key
+// recorded in each row, for example the number of distinct users calling an
+// endpoint, without creating a row per value. The recorded measurement values
+// are ignored, as are recordings without a value for key. key does not need to
+// be, and usually is not, one of the TagKeys of the view.
+//
+// The estimate uses a HyperLogLog sketch of fixed size per row and has a
+// standard error of about 3%. It is exported as an int64 gauge.
+func UniqueCount(key tag.Key) *Aggregation {
+	return &Aggregation{
+		Type:      AggTypeUniqueCount,
+		uniqueKey: key,
+		newData: func(_ time.Time) AggregationData {
+			return &UniqueCountData{}
+		},
+	}
+}
@@ -16,7 +16,10 @@
 package view
 
 import (
+	"fmt"
 	"math"
+	"math/rand"
+	"sort"
 	"time"
 
 	"github.com/cloudian/opencensus-go/metric/metricdata"
@@ -85,16 +88,23 @@ func (a *CountData) StartTime() time.Time {
 type SumData struct {
 	Start time.Time
 	Value float64
+	// Count is the number of values summed up, so that Value/Count is their
+	// mean. It is not exported to metric exporters.
+	Count int64
+	// gauge is set for the data of the SumGauge aggregation, whose value is
+	// not cumulative.
+	gauge bool
 }
 
 func (a *SumData) isAggregationData() bool { return true }
 
 func (a *SumData) addSample(v float64, _ map[string]interface{}, _ time.Time) {
 	a.Value += v
+	a.Count++
 }
 
 func (a *SumData) clone() AggregationData {
-	return &SumData{Value: a.Value, Start: a.Start}
+	return &SumData{Value: a.Value, Count: a.Count, Start: a.Start, gauge: a.gauge}
 }
 
 func (a *SumData) equal(other AggregationData) bool {
@@ -102,7 +112,7 @@ func (a *SumData) equal(other AggregationData) bool {
 	if !ok {
 		return false
 	}
-	return a.Start.Equal(a2.Start) && math.Pow(a.Value-a2.Value, 2) < epsilon
+	return a.Start.Equal(a2.Start) && math.Pow(a.Value-a2.Value, 2) < epsilon && a.Count == a2.Count
 }
 
 func (a *SumData) toPoint(metricType metricdata.Type, t time.Time) metricdata.Point {
@@ -111,6 +121,10 @@ func (a *SumData) toPoint(metricType metricdata.Type, t time.Time) metricdata.Po
 		return metricdata.NewInt64Point(t, int64(a.Value))
 	case metricdata.TypeCumulativeFloat64:
 		return metricdata.NewFloat64Point(t, a.Value)
+	case metricdata.TypeGaugeInt64:
+		return metricdata.NewInt64Point(t, int64(a.Value))
+	case metricdata.TypeGaugeFloat64:
+		return metricdata.NewFloat64Point(t, a.Value)
 	default:
 		panic("unsupported metricdata.Type")
 	}
@@ -136,22 +150,42 @@ type DistributionData struct {
 	SumOfSquaredDev float64 // sum of the squared deviation from the mean
 	CountPerBucket  []int64 // number of occurrences per bucket
 	// ExemplarsPerBucket is slice the same length as CountPerBucket containing
-	// an exemplar for the associated bucket, or nil.
+	// an exemplar for the associated bucket, or nil. It is nil if exemplars
+	// were disabled when the data was created, see SetExemplarEnabled.
+	// The data returned by RetrieveData and passed to exporters holds copies
+	// of the slice and of the exemplars, which can be read while recording
+	// continues. The attachments of the exemplars are shared, not copied.
 	ExemplarsPerBucket []*metricdata.Exemplar
 	bounds             []float64 // histogram distribution of the values
+	upperInclusive     bool      // whether buckets include their upper bound
+	exemplarBuckets    func(bucket int) bool
+	reservoirs         [][]*metricdata.Exemplar // the sampled exemplars per bucket, see SetExemplarReservoirSize
+	reservoirSeen      []int64                  // the number of exemplars offered to each reservoir
+	auto               *autoBuckets             // the bucket layout of AutoDistribution, if used
+	meanErr            float64                  // the rounding error of Mean, see addSample
+	sumOfSquaredDevErr float64                  // the rounding error of SumOfSquaredDev
 	Start              time.Time
 }
 
 func newDistributionData(agg *Aggregation, t time.Time) *DistributionData {
 	bucketCount := len(agg.Buckets) + 1
-	return &DistributionData{
-		CountPerBucket:     make([]int64, bucketCount),
-		ExemplarsPerBucket: make([]*metricdata.Exemplar, bucketCount),
-		bounds:             agg.Buckets,
-		Min:                math.MaxFloat64,
-		Max:                math.SmallestNonzeroFloat64,
-		Start:              t,
+	a := &DistributionData{
+		CountPerBucket:  make([]int64, bucketCount),
+		bounds:          agg.Buckets,
+		upperInclusive:  agg.UpperInclusive,
+		exemplarBuckets: agg.ExemplarBuckets,
+		Min:             math.MaxFloat64,
+		Max:             math.SmallestNonzeroFloat64,
+		Start:           t,
 	}
+	if exemplarsEnabled() {
+		a.ExemplarsPerBucket = make([]*metricdata.Exemplar, bucketCount)
+	}
+	if exemplarReservoirSize() > 1 {
+		a.reservoirs = make([][]*metricdata.Exemplar, bucketCount)
+		a.reservoirSeen = make([]int64, bucketCount)
+	}
+	return a
 }
 
 // Sum returns the sum of all samples collected.
@@ -178,53 +212,191 @@ func (a *DistributionData) addSample(v float64, attachments map[string]interface
 	a.addToBucket(v, attachments, t)
 
 	if a.Count == 1 {
-		a.Mean = v
+		a.Mean, a.meanErr = v, 0
+		a.SumOfSquaredDev, a.sumOfSquaredDevErr = 0, 0
 		return
 	}
 
-	oldMean := a.Mean
-	a.Mean = a.Mean + (v-a.Mean)/float64(a.Count)
-	a.SumOfSquaredDev = a.SumOfSquaredDev + (v-oldMean)*(v-a.Mean)
+	// Welford's online algorithm, with the rounding errors of the running
+	// mean and sum carried along: over millions of samples, the rounding
+	// errors of the mean accumulate, which skews the deviations of samples
+	// far from zero relative to their spread.
+	delta := (v - a.Mean) - a.meanErr
+	a.Mean, a.meanErr = twoSum(a.Mean, a.meanErr+delta/float64(a.Count))
+	a.SumOfSquaredDev, a.sumOfSquaredDevErr = twoSum(a.SumOfSquaredDev, a.sumOfSquaredDevErr+delta*((v-a.Mean)-a.meanErr))
+}
+
+// twoSum returns a+b rounded to a float64 and the rounding error of the sum.
+func twoSum(a, b float64) (sum, err float64) {
+	sum = a + b
+	bb := sum - a
+	err = (a - (sum - bb)) + (b - bb)
+	return sum, err
 }
 
 func (a *DistributionData) addToBucket(v float64, attachments map[string]interface{}, t time.Time) {
-	var count *int64
-	var i int
-	var b float64
-	for i, b = range a.bounds {
-		if v < b {
-			count = &a.CountPerBucket[i]
-			break
-		}
+	if a.auto != nil {
+		a.fitAutoBuckets(v)
+	}
+	if len(a.CountPerBucket) != len(a.bounds)+1 ||
+		(a.ExemplarsPerBucket != nil && len(a.ExemplarsPerBucket) != len(a.CountPerBucket)) {
+		a.resizeBuckets()
+	}
+	i := bucketIndex(a.bounds, v, a.upperInclusive)
+	a.CountPerBucket[i]++
+	if a.exemplarBuckets != nil && !a.exemplarBuckets(i) {
+		return
 	}
-	if count == nil { // Last bucket.
-		i = len(a.bounds)
-		count = &a.CountPerBucket[i]
+	if len(attachments) > 0 && a.ExemplarsPerBucket != nil && exemplarRateLimited(a.ExemplarsPerBucket[i], t) {
+		return
 	}
-	*count++
 	if exemplar := getExemplar(v, attachments, t); exemplar != nil {
+		if a.ExemplarsPerBucket == nil {
+			// Exemplars were enabled after the data was created.
+			a.ExemplarsPerBucket = make([]*metricdata.Exemplar, len(a.CountPerBucket))
+		}
 		a.ExemplarsPerBucket[i] = exemplar
+		if a.reservoirs != nil {
+			a.sampleExemplar(i, exemplar)
+		}
+	}
+}
+
+// resizeBuckets resizes CountPerBucket and ExemplarsPerBucket to one bucket
+// per bound plus the overflow bucket, in case they were set inconsistently
+// with the bounds, so recording does not panic. Counts of surplus buckets are
+// folded into the overflow bucket.
+func (a *DistributionData) resizeBuckets() {
+	n := len(a.bounds) + 1
+	if len(a.CountPerBucket) != n {
+		counts := make([]int64, n)
+		for i, c := range a.CountPerBucket {
+			if i >= n {
+				i = n - 1
+			}
+			counts[i] += c
+		}
+		a.CountPerBucket = counts
+	}
+	if a.ExemplarsPerBucket != nil && len(a.ExemplarsPerBucket) != n {
+		exemplars := make([]*metricdata.Exemplar, n)
+		copy(exemplars, a.ExemplarsPerBucket)
+		a.ExemplarsPerBucket = exemplars
+	}
+	if a.reservoirs != nil && len(a.reservoirs) != n {
+		reservoirs := make([][]*metricdata.Exemplar, n)
+		copy(reservoirs, a.reservoirs)
+		a.reservoirs = reservoirs
+		seen := make([]int64, n)
+		copy(seen, a.reservoirSeen)
+		a.reservoirSeen = seen
 	}
 }
 
-func getExemplar(v float64, attachments map[string]interface{}, t time.Time) *metricdata.Exemplar {
-	if len(attachments) == 0 {
+// ExemplarReservoir returns the exemplars sampled for the given bucket. If
+// a reservoir size greater than one was set with SetExemplarReservoirSize
+// when the data was created, they are a uniform sample of up to that many
+// of the exemplars of the bucket; otherwise they are the exemplar of
+// ExemplarsPerBucket, if any. The returned slice may be modified by the
+// caller.
+func (a *DistributionData) ExemplarReservoir(bucket int) []*metricdata.Exemplar {
+	if a.reservoirs != nil {
+		if bucket < 0 || bucket >= len(a.reservoirs) {
+			return nil
+		}
+		return copyExemplars(a.reservoirs[bucket])
+	}
+	if bucket < 0 || bucket >= len(a.ExemplarsPerBucket) || a.ExemplarsPerBucket[bucket] == nil {
 		return nil
 	}
-	return &metricdata.Exemplar{
-		Value:       v,
-		Timestamp:   t,
-		Attachments: attachments,
+	return []*metricdata.Exemplar{copyExemplar(a.ExemplarsPerBucket[bucket])}
+}
+
+// sampleExemplar offers e to the reservoir of bucket i, keeping a uniform
+// sample of the exemplars offered to it.
+func (a *DistributionData) sampleExemplar(i int, e *metricdata.Exemplar) {
+	a.reservoirSeen[i]++
+	k := exemplarReservoirSize()
+	if len(a.reservoirs[i]) < k {
+		a.reservoirs[i] = append(a.reservoirs[i], e)
+		return
+	}
+	if j := rand.Int63n(a.reservoirSeen[i]); j < int64(len(a.reservoirs[i])) {
+		a.reservoirs[i][j] = e
+	}
+}
+
+// bucketIndex returns the index of the bucket that v falls into: the first
+// bucket whose upper bound is greater than v, or greater than or equal to v if
+// upperInclusive is set, or len(bounds) for the overflow bucket.
+func bucketIndex(bounds []float64, v float64, upperInclusive bool) int {
+	for i, b := range bounds {
+		if v < b || (upperInclusive && v == b) {
+			return i
+		}
 	}
+	return len(bounds)
 }
 
 func (a *DistributionData) clone() AggregationData {
 	c := *a
 	c.CountPerBucket = append([]int64(nil), a.CountPerBucket...)
-	c.ExemplarsPerBucket = append([]*metricdata.Exemplar(nil), a.ExemplarsPerBucket...)
+	c.ExemplarsPerBucket = copyExemplars(a.ExemplarsPerBucket)
+	if a.auto != nil {
+		auto := *a.auto
+		c.auto = &auto
+	}
+	if a.reservoirs != nil {
+		c.reservoirs = make([][]*metricdata.Exemplar, len(a.reservoirs))
+		for i, r := range a.reservoirs {
+			c.reservoirs[i] = copyExemplars(r)
+		}
+		c.reservoirSeen = append([]int64(nil), a.reservoirSeen...)
+	}
 	return &c
 }
 
+// Rebin returns a copy of the distribution with its buckets merged into the
+// coarser buckets described by newBounds. Every bound in newBounds must also be
+// a bound of a, and newBounds must be sorted in increasing order; otherwise an
+// error is returned, as the counts cannot be split across finer buckets.
+// For each merged bucket, the most recent exemplar is kept; the exemplar
+// reservoirs are not, see ExemplarReservoir.
+func (a *DistributionData) Rebin(newBounds []float64) (*DistributionData, error) {
+	if !sort.Float64sAreSorted(newBounds) {
+		return nil, fmt.Errorf("cannot rebin distribution: bounds %v are not sorted", newBounds)
+	}
+	c := *a
+	c.bounds = append([]float64(nil), newBounds...)
+	c.CountPerBucket = make([]int64, len(newBounds)+1)
+	c.reservoirs, c.reservoirSeen = nil, nil
+	c.auto = nil
+	if a.ExemplarsPerBucket != nil {
+		c.ExemplarsPerBucket = make([]*metricdata.Exemplar, len(newBounds)+1)
+	}
+
+	j := 0 // index into newBounds
+	for i, count := range a.CountPerBucket {
+		// Old bucket i starts at a.bounds[i-1]. If that is the next new
+		// bound, the old bucket belongs to the next new bucket.
+		if i > 0 && i <= len(a.bounds) && j < len(newBounds) && a.bounds[i-1] == newBounds[j] {
+			j++
+		}
+		c.CountPerBucket[j] += count
+		if i < len(a.ExemplarsPerBucket) {
+			if e := a.ExemplarsPerBucket[i]; e != nil {
+				if prev := c.ExemplarsPerBucket[j]; prev == nil || e.Timestamp.After(prev.Timestamp) {
+					c.ExemplarsPerBucket[j] = e
+				}
+			}
+		}
+	}
+	if j != len(newBounds) {
+		return nil, fmt.Errorf("cannot rebin distribution with bounds %v into %v: new bounds must be a subset of the existing ones", a.bounds, newBounds)
+	}
+	return &c, nil
+}
+
 func (a *DistributionData) equal(other AggregationData) bool {
 	a2, ok := other.(*DistributionData)
 	if !ok {
@@ -253,10 +425,11 @@ func (a *DistributionData) toPoint(metricType metricdata.Type, t time.Time) metr
 	case metricdata.TypeCumulativeDistribution:
 		buckets := []metricdata.Bucket{}
 		for i := 0; i < len(a.CountPerBucket); i++ {
-			buckets = append(buckets, metricdata.Bucket{
-				Count:    a.CountPerBucket[i],
-				Exemplar: a.ExemplarsPerBucket[i],
-			})
+			b := metricdata.Bucket{Count: a.CountPerBucket[i]}
+			if i < len(a.ExemplarsPerBucket) {
+				b.Exemplar = copyExemplar(a.ExemplarsPerBucket[i])
+			}
+			buckets = append(buckets, b)
 		}
 		bucketOptions := &metricdata.BucketOptions{Bounds: a.bounds}
 
@@ -281,20 +454,26 @@ func (a *DistributionData) StartTime() time.Time {
 }
 
 // LastValueData returns the last value recorded for LastValue aggregation.
+//
+// Exemplar holds the attachments of the last recorded value, if it had any.
+// Note that exporters may not be able to expose it: the OpenMetrics format,
+// for example, does not allow exemplars on gauges.
 type LastValueData struct {
-	Value float64
+	Value    float64
+	Exemplar *metricdata.Exemplar
 }
 
 func (l *LastValueData) isAggregationData() bool {
 	return true
 }
 
-func (l *LastValueData) addSample(v float64, _ map[string]interface{}, _ time.Time) {
+func (l *LastValueData) addSample(v float64, attachments map[string]interface{}, t time.Time) {
 	l.Value = v
+	l.Exemplar = getExemplar(v, attachments, t)
 }
 
 func (l *LastValueData) clone() AggregationData {
-	return &LastValueData{l.Value}
+	return &LastValueData{Value: l.Value, Exemplar: copyExemplar(l.Exemplar)}
 }
 
 func (l *LastValueData) equal(other AggregationData) bool {
@@ -322,6 +501,198 @@ func (l *LastValueData) StartTime() time.Time {
 	return time.Time{}
 }
 
+// GaugeData is the aggregated data for the Gauge aggregation.
+// Last is the last value recorded. Min, Max and Count describe the values
+// recorded in the collection window of the consumer of the data, see Gauge.
+// A window without new values has Min and Max equal to Last and a zero
+// Count.
+type GaugeData struct {
+	Last     float64
+	Min, Max float64
+	Count    int64
+}
+
+func (g *GaugeData) isAggregationData() bool {
+	return true
+}
+
+func (g *GaugeData) addSample(v float64, _ map[string]interface{}, _ time.Time) {
+	g.Min = math.Min(g.Min, v)
+	g.Max = math.Max(g.Max, v)
+	g.Last = v
+	g.Count++
+}
+
+// reset starts a new collection window at the last value.
+func (g *GaugeData) reset() {
+	g.Min = g.Last
+	g.Max = g.Last
+	g.Count = 0
+}
+
+func (g *GaugeData) clone() AggregationData {
+	c := *g
+	return &c
+}
+
+func (g *GaugeData) equal(other AggregationData) bool {
+	a2, ok := other.(*GaugeData)
+	if !ok {
+		return false
+	}
+	return *g == *a2
+}
+
+func (g *GaugeData) toPoint(metricType metricdata.Type, t time.Time) metricdata.Point {
+	return gaugePoint(metricType, g.Last, t)
+}
+
+// StartTime returns an empty time value as start time is not recorded when using gauge
+// aggregation.
+func (g *GaugeData) StartTime() time.Time {
+	return time.Time{}
+}
+
+// LastValueSummaryData is the aggregated data for the LastValueSummary
+// aggregation. Value is the last value recorded; Quantile describes the
+// values in the window.
+type LastValueSummaryData struct {
+	Value float64
+
+	window    []float64 // the most recent values, a ring once full
+	next      int       // the index in window to overwrite next once full
+	quantiles []float64
+}
+
+func (l *LastValueSummaryData) isAggregationData() bool { return true }
+
+func (l *LastValueSummaryData) addSample(v float64, _ map[string]interface{}, _ time.Time) {
+	l.Value = v
+	if len(l.window) < cap(l.window) {
+		l.window = append(l.window, v)
+		return
+	}
+	l.window[l.next] = v
+	l.next = (l.next + 1) % len(l.window)
+}
+
+// Quantile returns the q-quantile, for q in (0, 1], of the values in the
+// window using the nearest-rank method, or 0 if no value was recorded.
+func (l *LastValueSummaryData) Quantile(q float64) float64 {
+	return quantile(l.sortedWindow(), q)
+}
+
+func (l *LastValueSummaryData) sortedWindow() []float64 {
+	sorted := append([]float64(nil), l.window...)
+	sort.Float64s(sorted)
+	return sorted
+}
+
+func quantile(sorted []float64, q float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(q*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
+
+func (l *LastValueSummaryData) clone() AggregationData {
+	c := *l
+	c.window = make([]float64, len(l.window), cap(l.window))
+	copy(c.window, l.window)
+	return &c
+}
+
+func (l *LastValueSummaryData) equal(other AggregationData) bool {
+	a2, ok := other.(*LastValueSummaryData)
+	if !ok {
+		return false
+	}
+	return l.Value == a2.Value && equalFloats(l.window, a2.window)
+}
+
+func (l *LastValueSummaryData) toPoint(_ metricdata.Type, t time.Time) metricdata.Point {
+	sorted := l.sortedWindow()
+	snapshot := metricdata.Snapshot{
+		Count:       int64(len(sorted)),
+		Percentiles: make(map[float64]float64, len(l.quantiles)),
+	}
+	for _, v := range sorted {
+		snapshot.Sum += v
+	}
+	for _, q := range l.quantiles {
+		snapshot.Percentiles[q*100] = quantile(sorted, q)
+	}
+	return metricdata.NewSummaryPoint(t, &metricdata.Summary{Snapshot: snapshot})
+}
+
+// StartTime returns an empty time value as start time is not recorded when
+// using last value summary aggregation.
+func (l *LastValueSummaryData) StartTime() time.Time {
+	return time.Time{}
+}
+
+// UniqueCountData is the aggregated data for the UniqueCount aggregation. It
+// holds a HyperLogLog sketch of the distinct tag values recorded, use Estimate
+// to get the approximate count.
+type UniqueCountData struct {
+	sketch hll
+}
+
+func (a *UniqueCountData) isAggregationData() bool { return true }
+
+// addSample is a no-op; the distinct tag values are added with addValue.
+func (a *UniqueCountData) addSample(_ float64, _ map[string]interface{}, _ time.Time) {}
+
+func (a *UniqueCountData) addValue(v string) {
+	a.sketch.add(v)
+}
+
+// Estimate returns the approximate number of distinct tag values recorded.
+func (a *UniqueCountData) Estimate() int64 {
+	return a.sketch.estimate()
+}
+
+func (a *UniqueCountData) clone() AggregationData {
+	c := *a
+	return &c
+}
+
+func (a *UniqueCountData) equal(other AggregationData) bool {
+	a2, ok := other.(*UniqueCountData)
+	if !ok {
+		return false
+	}
+	return a.sketch == a2.sketch
+}
+
+func (a *UniqueCountData) toPoint(_ metricdata.Type, t time.Time) metricdata.Point {
+	return metricdata.NewInt64Point(t, a.Estimate())
+}
+
+// StartTime returns an empty time value as start time is not recorded when
+// using unique count aggregation.
+func (a *UniqueCountData) StartTime() time.Time {
+	return time.Time{}
+}
+
+func gaugePoint(metricType metricdata.Type, v float64, t time.Time) metricdata.Point {
+	switch metricType {
+	case metricdata.TypeGaugeInt64:
+		return metricdata.NewInt64Point(t, int64(v))
+	case metricdata.TypeGaugeFloat64:
+		return metricdata.NewFloat64Point(t, v)
+	default:
+		panic("unsupported metricdata.Type")
+	}
+}
+
 // ClearStart clears the Start field from data if present. Useful for testing in cases where the
 // start time will be nondeterministic.
 func ClearStart(data AggregationData) {
@@ -16,11 +16,16 @@
 package view
 
 import (
+	"fmt"
+	"math"
+	"math/rand"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/cloudian/opencensus-go/metric/metricdata"
+	"github.com/cloudian/opencensus-go/tag"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 )
@@ -53,6 +58,13 @@ func TestDataClone(t *testing.T) {
 			name: "sum data",
 			src:  &SumData{Value: 65.7},
 		},
+		{
+			name: "last value data",
+			src: &LastValueData{
+				Value:    1.5,
+				Exemplar: &metricdata.Exemplar{Value: 1.5, Attachments: metricdata.Attachments{"trace_id": "abc"}},
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -130,6 +142,446 @@ func TestDistributionData_addSample(t *testing.T) {
 	}
 }
 
+func TestDistributionData_sumOfSquaredDev(t *testing.T) {
+	// twoPass returns the mean and the sum of squared deviations of vs,
+	// computed relative to the first value so that the large common offset
+	// of the values does not cost precision.
+	twoPass := func(vs []float64) (mean, ssd float64) {
+		var sum float64
+		for _, v := range vs {
+			sum += v - vs[0]
+		}
+		mean = sum / float64(len(vs))
+		for _, v := range vs {
+			d := v - vs[0] - mean
+			ssd += d * d
+		}
+		return vs[0] + mean, ssd
+	}
+	check := func(label string, dd *DistributionData, vs []float64) {
+		t.Helper()
+		mean, ssd := twoPass(vs)
+		if dd.Count != int64(len(vs)) {
+			t.Errorf("%s: Count = %d; want %d", label, dd.Count, len(vs))
+		}
+		if math.Abs(dd.Mean-mean) > 1e-12*math.Abs(mean) {
+			t.Errorf("%s: Mean = %v; want %v", label, dd.Mean, mean)
+		}
+		if math.Abs(dd.SumOfSquaredDev-ssd) > 1e-9*ssd {
+			t.Errorf("%s: SumOfSquaredDev = %v; want %v", label, dd.SumOfSquaredDev, ssd)
+		}
+	}
+	agg := &Aggregation{Buckets: []float64{1}}
+
+	single := newDistributionData(agg, time.Time{})
+	single.addSample(1e9+0.1, nil, time.Time{})
+	if single.Mean != 1e9+0.1 || single.SumOfSquaredDev != 0 {
+		t.Errorf("single sample: Mean = %v, SumOfSquaredDev = %v; want %v, 0", single.Mean, single.SumOfSquaredDev, 1e9+0.1)
+	}
+
+	// Many values with a spread small relative to their magnitude, where
+	// naive updates lose the deviations to cancellation.
+	r := rand.New(rand.NewSource(1))
+	vs := make([]float64, 1000000)
+	for i := range vs {
+		vs[i] = 1e9 + r.NormFloat64()
+	}
+	const recent = 1000
+	all := newDistributionData(agg, time.Time{})
+	prev := newDistributionData(agg, time.Time{})
+	allButLast := newDistributionData(agg, time.Time{})
+	for i, v := range vs {
+		all.addSample(v, nil, time.Time{})
+		if i < len(vs)-recent {
+			prev.addSample(v, nil, time.Time{})
+		}
+		if i < len(vs)-1 {
+			allButLast.addSample(v, nil, time.Time{})
+		}
+	}
+	check("high count", all, vs)
+
+	// Merged data: the values added since prev are the difference of two
+	// large distributions.
+	diff := all.clone().(*DistributionData)
+	diff.subtract(prev)
+	check("difference", diff, vs[len(vs)-recent:])
+
+	// The difference of a single value has no deviation.
+	last := all.clone().(*DistributionData)
+	last.subtract(allButLast)
+	if want := vs[len(vs)-1]; last.Count != 1 || math.Abs(last.Mean-want) > 1e-12*want || last.SumOfSquaredDev != 0 {
+		t.Errorf("single value difference: Count = %d, Mean = %v, SumOfSquaredDev = %v; want 1, %v, 0", last.Count, last.Mean, last.SumOfSquaredDev, want)
+	}
+}
+
+func TestLastValueData_addSample(t *testing.T) {
+	lv := &LastValueData{}
+	attachments := map[string]interface{}{"trace_id": "abc"}
+	t1 := time.Now()
+	lv.addSample(1, attachments, t1)
+	want := &LastValueData{
+		Value:    1,
+		Exemplar: &metricdata.Exemplar{Value: 1, Timestamp: t1, Attachments: attachments},
+	}
+	if diff := cmp.Diff(lv, want); diff != "" {
+		t.Fatalf("Unexpected LastValueData -got +want: %s", diff)
+	}
+
+	attachments2 := map[string]interface{}{"trace_id": "def"}
+	t2 := t1.Add(time.Microsecond)
+	lv.addSample(2, attachments2, t2)
+	want = &LastValueData{
+		Value:    2,
+		Exemplar: &metricdata.Exemplar{Value: 2, Timestamp: t2, Attachments: attachments2},
+	}
+	if diff := cmp.Diff(lv, want); diff != "" {
+		t.Fatalf("Unexpected LastValueData -got +want: %s", diff)
+	}
+
+	// A value recorded without attachments drops the previous exemplar.
+	lv.addSample(3, nil, t2.Add(time.Microsecond))
+	if diff := cmp.Diff(lv, &LastValueData{Value: 3}); diff != "" {
+		t.Fatalf("Unexpected LastValueData -got +want: %s", diff)
+	}
+}
+
+func TestGaugeData(t *testing.T) {
+	g := Gauge().newData(time.Time{}).(*GaugeData)
+	for _, v := range []float64{3, -1, 7, 2} {
+		g.addSample(v, nil, time.Time{})
+	}
+	if diff := cmp.Diff(g, &GaugeData{Last: 2, Min: -1, Max: 7, Count: 4}); diff != "" {
+		t.Fatalf("Unexpected GaugeData -got +want: %s", diff)
+	}
+
+	g.reset()
+	g.addSample(1, nil, time.Time{})
+	if diff := cmp.Diff(g, &GaugeData{Last: 1, Min: 1, Max: 2, Count: 1}); diff != "" {
+		t.Fatalf("Unexpected GaugeData after reset -got +want: %s", diff)
+	}
+}
+
+func TestDistributionData_maxAttachmentSize(t *testing.T) {
+	defer SetMaxAttachmentSize(0)
+	SetMaxAttachmentSize(100)
+
+	dd := newDistributionData(&Aggregation{Buckets: []float64{1, 2}}, time.Time{})
+	small := map[string]interface{}{"key": "value"}
+	large := map[string]interface{}{"key": strings.Repeat("v", 100)}
+	dropped := OversizedAttachmentsDropped()
+
+	t1 := time.Now()
+	dd.addSample(0.5, small, t1)
+	dd.addSample(1.5, large, t1)
+	if got, want := OversizedAttachmentsDropped()-dropped, int64(1); got != want {
+		t.Errorf("OversizedAttachmentsDropped() increased by %d; want %d", got, want)
+	}
+	if diff := cmp.Diff(dd.CountPerBucket, []int64{1, 1, 0}); diff != "" {
+		t.Errorf("CountPerBucket differ -got +want: %s", diff)
+	}
+	want := []*metricdata.Exemplar{{Value: 0.5, Timestamp: t1, Attachments: small}, nil, nil}
+	if diff := cmp.Diff(dd.ExemplarsPerBucket, want); diff != "" {
+		t.Errorf("ExemplarsPerBucket differ -got +want: %s", diff)
+	}
+
+	SetMaxAttachmentSize(0)
+	dd.addSample(1.5, large, t1)
+	if dd.ExemplarsPerBucket[1] == nil {
+		t.Error("ExemplarsPerBucket[1] = nil without a limit; want the exemplar")
+	}
+}
+
+func TestDistributionData_exemplarReservoir(t *testing.T) {
+	defer SetExemplarReservoirSize(1)
+	const k, n = 10, 100
+	SetExemplarReservoirSize(k)
+
+	agg := &Aggregation{Buckets: []float64{1000}}
+	t1 := time.Now()
+	picked := make([]int, n/k) // the number of exemplars picked per decile
+	const trials = 1000
+	for trial := 0; trial < trials; trial++ {
+		dd := newDistributionData(agg, time.Time{})
+		for i := 0; i < n; i++ {
+			dd.addSample(float64(i), map[string]interface{}{"i": i}, t1)
+		}
+		reservoir := dd.ExemplarReservoir(0)
+		if len(reservoir) != k {
+			t.Fatalf("ExemplarReservoir(0) has %d exemplars; want %d", len(reservoir), k)
+		}
+		if got := dd.ExemplarsPerBucket[0].Value; got != n-1 {
+			t.Fatalf("ExemplarsPerBucket[0].Value = %v; want the most recent value %v", got, n-1)
+		}
+		if got := dd.ExemplarReservoir(1); got != nil {
+			t.Fatalf("ExemplarReservoir(1) = %v; want nil", got)
+		}
+		for _, e := range reservoir {
+			picked[int(e.Value)/k]++
+		}
+	}
+	// Every decile of the recorded values should be picked k*trials/10
+	// times; allow for a margin of more than six standard deviations.
+	for d, got := range picked {
+		if want := k * trials / len(picked); got < want*4/5 || got > want*6/5 {
+			t.Errorf("decile %d picked %d times; want about %d", d, got, want)
+		}
+	}
+
+	SetExemplarReservoirSize(1)
+	dd := newDistributionData(agg, time.Time{})
+	dd.addSample(1, map[string]interface{}{"i": 1}, t1)
+	dd.addSample(2, map[string]interface{}{"i": 2}, t1)
+	if got := dd.ExemplarReservoir(0); len(got) != 1 || got[0].Value != 2 {
+		t.Errorf("ExemplarReservoir(0) without reservoir = %v; want the most recent exemplar", got)
+	}
+}
+
+func TestDistributionData_exemplarSettings(t *testing.T) {
+	defer SetExemplarEnabled(true)
+	defer SetExemplarFilter(nil)
+
+	agg := &Aggregation{
+		Buckets: []float64{1, 2},
+	}
+	attachments := map[string]interface{}{"key1": "value1"}
+
+	SetExemplarEnabled(false)
+	dd := newDistributionData(agg, time.Time{})
+	dd.addSample(0.5, attachments, time.Now())
+	if dd.ExemplarsPerBucket != nil {
+		t.Errorf("ExemplarsPerBucket = %v with exemplars disabled; want nil", dd.ExemplarsPerBucket)
+	}
+
+	SetExemplarEnabled(true)
+	SetExemplarFilter(func(v float64, attachments map[string]interface{}) bool {
+		return v > 1
+	})
+	t1 := time.Now()
+	dd.addSample(0.5, attachments, t1)
+	dd.addSample(1.5, attachments, t1)
+	want := []*metricdata.Exemplar{nil, {Value: 1.5, Timestamp: t1, Attachments: attachments}, nil}
+	if diff := cmp.Diff(dd.ExemplarsPerBucket, want); diff != "" {
+		t.Errorf("ExemplarsPerBucket differ -got +want: %s", diff)
+	}
+}
+
+func TestDistributionData_exemplarBuckets(t *testing.T) {
+	agg := Distribution(1, 2, 3)
+	// Only the buckets below 2 may carry exemplars.
+	agg.ExemplarBuckets = func(bucket int) bool { return bucket < 2 }
+	attachments := map[string]interface{}{"user": "u1"}
+
+	dd := newDistributionData(agg, time.Time{})
+	t1 := time.Now()
+	for _, v := range []float64{0.5, 1.5, 2.5, 3.5} {
+		dd.addSample(v, attachments, t1)
+	}
+	want := []*metricdata.Exemplar{
+		{Value: 0.5, Timestamp: t1, Attachments: attachments},
+		{Value: 1.5, Timestamp: t1, Attachments: attachments},
+		nil,
+		nil,
+	}
+	if diff := cmp.Diff(dd.ExemplarsPerBucket, want); diff != "" {
+		t.Errorf("ExemplarsPerBucket differ -got +want: %s", diff)
+	}
+	if diff := cmp.Diff(dd.CountPerBucket, []int64{1, 1, 1, 1}); diff != "" {
+		t.Errorf("CountPerBucket differ -got +want: %s", diff)
+	}
+}
+
+func TestDistributionData_mismatchedBuckets(t *testing.T) {
+	attachments := map[string]interface{}{"key1": "value1"}
+	tests := []struct {
+		name string
+		dd   *DistributionData
+		want []int64
+	}{
+		{
+			name: "too many buckets",
+			dd: &DistributionData{
+				CountPerBucket:     []int64{1, 2, 3, 4},
+				ExemplarsPerBucket: make([]*metricdata.Exemplar, 4),
+				bounds:             []float64{1, 2},
+			},
+			want: []int64{1, 2, 8},
+		},
+		{
+			name: "too few buckets",
+			dd: &DistributionData{
+				CountPerBucket:     []int64{1},
+				ExemplarsPerBucket: make([]*metricdata.Exemplar, 1),
+				bounds:             []float64{1, 2},
+			},
+			want: []int64{1, 0, 1},
+		},
+		{
+			name: "no buckets",
+			dd:   &DistributionData{bounds: []float64{1, 2}},
+			want: []int64{0, 0, 1},
+		},
+		{
+			name: "too few exemplars",
+			dd: &DistributionData{
+				CountPerBucket:     []int64{0, 0, 0},
+				ExemplarsPerBucket: make([]*metricdata.Exemplar, 1),
+				bounds:             []float64{1, 2},
+			},
+			want: []int64{0, 0, 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.dd.addSample(5, attachments, time.Now())
+			if diff := cmp.Diff(tt.dd.CountPerBucket, tt.want); diff != "" {
+				t.Errorf("CountPerBucket differ -got +want: %s", diff)
+			}
+			if got := len(tt.dd.ExemplarsPerBucket); got != len(tt.want) {
+				t.Errorf("len(ExemplarsPerBucket) = %d; want %d", got, len(tt.want))
+			}
+		})
+	}
+}
+
 func cmpDD(got, want *DistributionData) string {
 	return cmp.Diff(got, want, cmpopts.IgnoreFields(DistributionData{}, "SumOfSquaredDev"), cmpopts.IgnoreUnexported(DistributionData{}))
 }
+
+func TestDistributionData_Rebin(t *testing.T) {
+	agg := &Aggregation{
+		Buckets: []float64{1, 2, 5, 10},
+	}
+	dd := newDistributionData(agg, time.Time{})
+	t1 := time.Now()
+	t2 := t1.Add(time.Second)
+	for _, v := range []float64{0.5, 1.5, 1.5, 3, 7, 7, 7, 12} {
+		dd.addSample(v, nil, t1)
+	}
+	dd.addSample(4, map[string]interface{}{"k": "old"}, t1)
+	dd.addSample(6, map[string]interface{}{"k": "new"}, t2)
+
+	tests := []struct {
+		name       string
+		bounds     []float64
+		wantCounts []int64
+		wantErr    bool
+	}{
+		{
+			name:       "coarser",
+			bounds:     []float64{2, 10},
+			wantCounts: []int64{3, 6, 1},
+		},
+		{
+			name:       "same",
+			bounds:     []float64{1, 2, 5, 10},
+			wantCounts: []int64{1, 2, 2, 4, 1},
+		},
+		{
+			name:       "single bucket",
+			bounds:     nil,
+			wantCounts: []int64{10},
+		},
+		{
+			name:    "not a subset",
+			bounds:  []float64{2, 3},
+			wantErr: true,
+		},
+		{
+			name:    "unsorted",
+			bounds:  []float64{10, 2},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := dd.Rebin(tt.bounds)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Rebin(%v) error = %v; want error = %v", tt.bounds, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if diff := cmp.Diff(got.CountPerBucket, tt.wantCounts); diff != "" {
+				t.Errorf("Rebin(%v) counts -got +want: %s", tt.bounds, diff)
+			}
+			if got.Count != dd.Count || got.Sum() != dd.Sum() || got.Min != dd.Min || got.Max != dd.Max {
+				t.Errorf("Rebin(%v) changed the summary statistics: %+v", tt.bounds, got)
+			}
+		})
+	}
+
+	// Both exemplars land in the [2, 10) bucket; the most recent one is kept.
+	got, err := dd.Rebin([]float64{2, 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := got.ExemplarsPerBucket[1]; e == nil || e.Attachments["k"] != "new" {
+		t.Errorf("Rebin() exemplar = %+v; want the most recent one", e)
+	}
+	// The original distribution is left untouched.
+	if diff := cmp.Diff(dd.CountPerBucket, []int64{1, 2, 2, 4, 1}); diff != "" {
+		t.Errorf("Rebin() modified the original counts -got +want: %s", diff)
+	}
+}
+
+func TestUniqueCountData(t *testing.T) {
+	// The standard error is about 3.25%; allow for three of them.
+	const tolerance = 0.1
+	for _, n := range []int{0, 1, 10, 100, 1000, 10000, 100000} {
+		a := UniqueCount(tag.MustNewKey("user")).newData(time.Time{}).(*UniqueCountData)
+		for i := 0; i < n; i++ {
+			// Duplicates do not change the estimate.
+			a.addValue(fmt.Sprintf("user-%d", i))
+			a.addValue(fmt.Sprintf("user-%d", i))
+		}
+		got := a.Estimate()
+		if diff := math.Abs(float64(got - int64(n))); diff > tolerance*float64(n) {
+			t.Errorf("Estimate() = %d for %d distinct values; want within %v%%", got, n, tolerance*100)
+		}
+		if p := a.toPoint(metricdata.TypeGaugeInt64, time.Time{}); p.Value != got {
+			t.Errorf("toPoint() value = %v; want %v", p.Value, got)
+		}
+		if !a.equal(a.clone()) {
+			t.Error("clone() is not equal to the original")
+		}
+	}
+}
+
+func TestLastValueSummaryData(t *testing.T) {
+	agg := LastValueSummary(10, 0.99, 0.5)
+	a := agg.newData(time.Time{}).(*LastValueSummaryData)
+	if got := a.Quantile(0.5); got != 0 {
+		t.Errorf("Quantile(0.5) without values = %v; want 0", got)
+	}
+	// A ramp of 1 to 25 leaves 16 to 25 in the window.
+	for v := 1; v <= 25; v++ {
+		a.addSample(float64(v), nil, time.Time{})
+	}
+	snapshot := a.clone()
+	a.addSample(100, nil, time.Time{})
+
+	want := map[float64]float64{0.1: 16, 0.5: 20, 0.9: 24, 0.99: 25, 1: 25}
+	s := snapshot.(*LastValueSummaryData)
+	for q, v := range want {
+		if got := s.Quantile(q); got != v {
+			t.Errorf("Quantile(%v) = %v; want %v", q, got, v)
+		}
+	}
+	if s.Value != 25 {
+		t.Errorf("Value = %v; want 25", s.Value)
+	}
+	p := s.toPoint(metricdata.TypeSummary, time.Time{}).Value.(*metricdata.Summary)
+	wantSummary := &metricdata.Summary{Snapshot: metricdata.Snapshot{
+		Count:       10,
+		Sum:         205,
+		Percentiles: map[float64]float64{50: 20, 99: 25},
+	}}
+	if diff := cmp.Diff(p, wantSummary); diff != "" {
+		t.Errorf("toPoint() differs -got +want: %s", diff)
+	}
+	// The original moved on without affecting the clone.
+	if got := a.Quantile(1); got != 100 {
+		t.Errorf("Quantile(1) = %v; want 100", got)
+	}
+}
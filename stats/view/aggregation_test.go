@@ -0,0 +1,150 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package view
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/cloudian/opencensus-go/stats"
+	"github.com/cloudian/opencensus-go/tag"
+)
+
+func TestAggregation_BucketIndex(t *testing.T) {
+	agg := Distribution(1, 5, 10)
+	tests := []struct {
+		v    float64
+		want int
+	}{
+		{v: -1, want: 0},
+		{v: 0, want: 0},
+		{v: 0.999, want: 0},
+		{v: 1, want: 1},
+		{v: 4.5, want: 1},
+		{v: 5, want: 2},
+		{v: 9.999, want: 2},
+		{v: 10, want: 3},
+		{v: 1e9, want: 3},
+		{v: math.Inf(1), want: 3},
+	}
+	for _, tt := range tests {
+		got := agg.BucketIndex(tt.v)
+		if got != tt.want {
+			t.Errorf("BucketIndex(%v) = %d; want %d", tt.v, got, tt.want)
+		}
+
+		// BucketIndex must agree with the bucket addSample counts the value in.
+		dd := newDistributionData(agg, time.Time{})
+		dd.addSample(tt.v, nil, time.Time{})
+		if dd.CountPerBucket[got] != 1 {
+			t.Errorf("addSample(%v) counted in %v; BucketIndex = %d", tt.v, dd.CountPerBucket, got)
+		}
+	}
+
+	if got := Distribution().BucketIndex(42); got != 0 {
+		t.Errorf("BucketIndex() without bounds = %d; want 0", got)
+	}
+}
+
+func TestAggregation_UpperInclusive(t *testing.T) {
+	lower := Distribution(1, 5, 10)
+	upper := Distribution(1, 5, 10)
+	upper.UpperInclusive = true
+	tests := []struct {
+		v                    float64
+		wantLower, wantUpper int
+	}{
+		{v: 0, wantLower: 0, wantUpper: 0},
+		{v: 1, wantLower: 1, wantUpper: 0},
+		{v: 3, wantLower: 1, wantUpper: 1},
+		{v: 5, wantLower: 2, wantUpper: 1},
+		{v: 10, wantLower: 3, wantUpper: 2},
+		{v: 10.5, wantLower: 3, wantUpper: 3},
+	}
+	for _, tt := range tests {
+		for _, c := range []struct {
+			agg  *Aggregation
+			want int
+		}{
+			{lower, tt.wantLower},
+			{upper, tt.wantUpper},
+		} {
+			dd := newDistributionData(c.agg, time.Time{})
+			dd.addSample(tt.v, nil, time.Time{})
+			want := make([]int64, 4)
+			want[c.want] = 1
+			if diff := cmp.Diff(dd.CountPerBucket, want); diff != "" {
+				t.Errorf("UpperInclusive=%v: addSample(%v) counted in %v; want %v", c.agg.UpperInclusive, tt.v, dd.CountPerBucket, want)
+			}
+			if got := c.agg.BucketIndex(tt.v); got != c.want {
+				t.Errorf("UpperInclusive=%v: BucketIndex(%v) = %d; want %d", c.agg.UpperInclusive, tt.v, got, c.want)
+			}
+		}
+	}
+}
+
+func TestDistributionDurations(t *testing.T) {
+	got, err := DistributionDurations(stats.UnitMilliseconds,
+		500*time.Microsecond, time.Millisecond, 25*time.Millisecond, 2*time.Second)
+	if err != nil {
+		t.Fatalf("DistributionDurations() = %v", err)
+	}
+	if want := []float64{0.5, 1, 25, 2000}; !equalFloats(got, want) {
+		t.Errorf("DistributionDurations() = %v; want %v", got, want)
+	}
+	got, err = DistributionDurations(stats.UnitSeconds, 250*time.Millisecond, time.Minute)
+	if err != nil {
+		t.Fatalf("DistributionDurations() = %v", err)
+	}
+	if want := []float64{0.25, 60}; !equalFloats(got, want) {
+		t.Errorf("DistributionDurations() = %v; want %v", got, want)
+	}
+	if _, err := DistributionDurations(stats.UnitBytes, time.Second); err == nil {
+		t.Error("DistributionDurations() with unit By = nil error; want error")
+	}
+}
+
+func TestAggregation_Equal(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b *Aggregation
+		want bool
+	}{
+		{name: "same count", a: Count(), b: Count(), want: true},
+		{name: "separate last values", a: LastValue(), b: LastValue(), want: true},
+		{name: "separate distributions", a: Distribution(1, 2), b: Distribution(1, 2), want: true},
+		{name: "different bounds", a: Distribution(1, 2), b: Distribution(1, 3), want: false},
+		{name: "different bound count", a: Distribution(1, 2), b: Distribution(1), want: false},
+		{name: "different types", a: Sum(), b: SumGauge(), want: false},
+		{name: "different inclusivity", a: Distribution(1, 2), b: &Aggregation{Type: AggTypeDistribution, Buckets: []float64{1, 2}, UpperInclusive: true}, want: false},
+		{name: "same unique count key", a: UniqueCount(tag.MustNewKey("user")), b: UniqueCount(tag.MustNewKey("user")), want: true},
+		{name: "different unique count keys", a: UniqueCount(tag.MustNewKey("user")), b: UniqueCount(tag.MustNewKey("host")), want: false},
+		{name: "same summaries", a: LastValueSummary(10), b: LastValueSummary(10, 0.99, 0.9, 0.5), want: true},
+		{name: "different summary windows", a: LastValueSummary(10), b: LastValueSummary(20), want: false},
+		{name: "different summary quantiles", a: LastValueSummary(10, 0.5), b: LastValueSummary(10, 0.9), want: false},
+		{name: "nil", a: Count(), b: nil, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a.Equal(tt.b); got != tt.want {
+				t.Errorf("Equal() = %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package view
+
+import (
+	"math"
+	"time"
+
+	"github.com/cloudian/opencensus-go/metric/metricdata"
+)
+
+// autoDistributionScale is the initial resolution of the buckets of
+// AutoDistribution: each bucket spans a factor of 2^(2^-scale), about 9%.
+const autoDistributionScale = 3
+
+// minAutoBuckets is the smallest number of buckets of AutoDistribution: the
+// underflow bucket, one finite bucket and the overflow bucket.
+const minAutoBuckets = 3
+
+// AutoDistribution indicates that the values recorded for a view are
+// aggregated into a distribution whose bucket bounds adapt to the recorded
+// values, for when suitable bounds are hard to pick upfront. Each row has at
+// most maxBuckets buckets, and at least three.
+//
+// The bounds are powers of a common base, so that the buckets have the same
+// relative width. They start at a resolution of about 9% per bucket and
+// cover the range of the positive values recorded so far. When the range
+// grows beyond what maxBuckets buckets of the current resolution cover,
+// adjacent buckets are merged pairwise, doubling their relative width,
+// until it fits. Unlike splitting buckets, which would have to guess how the
+// values counted so far are spread within them, merging keeps the counts
+// exact. Values less than or equal to zero are counted in the underflow
+// bucket.
+//
+// The bounds used by a row are those of its DistributionData, which are
+// exported with each point. They differ between rows and may change between
+// exports of the same row, which backends that expect fixed bounds, such as
+// the Prometheus le label of a histogram, need to tolerate.
+// Aggregation.Buckets is empty, and UpperInclusive is ignored.
+func AutoDistribution(maxBuckets int) *Aggregation {
+	if maxBuckets < minAutoBuckets {
+		maxBuckets = minAutoBuckets
+	}
+	agg := &Aggregation{
+		Type:        AggTypeDistribution,
+		autoBuckets: maxBuckets,
+	}
+	agg.newData = func(t time.Time) AggregationData {
+		a := newDistributionData(agg, t)
+		a.auto = &autoBuckets{max: maxBuckets, scale: autoDistributionScale}
+		return a
+	}
+	return agg
+}
+
+// autoBuckets is the bucket layout of a distribution of AutoDistribution.
+// The finite buckets have the indexes min to max-1 and the overflow bucket
+// has index max, where bucket k covers [base^k, base^(k+1)) for
+// base = 2^(2^-scale).
+type autoBuckets struct {
+	max      int // the maximum number of buckets, including underflow and overflow
+	scale    int
+	min      int
+	maxIndex int
+	positive bool // whether a positive value was recorded, setting min and maxIndex
+}
+
+// index returns the index of the bucket of the positive value v at the
+// current scale.
+func (b *autoBuckets) index(v float64) int {
+	return int(math.Floor(math.Log2(v) * math.Ldexp(1, b.scale)))
+}
+
+// bound returns the lower bound of the bucket with index k.
+func (b *autoBuckets) bound(k int) float64 {
+	return math.Exp2(float64(k) * math.Ldexp(1, -b.scale))
+}
+
+// bounds returns the bucket bounds of the current layout.
+func (b *autoBuckets) bounds() []float64 {
+	bounds := make([]float64, 0, b.maxIndex-b.min+1)
+	for k := b.min; k <= b.maxIndex; k++ {
+		bounds = append(bounds, b.bound(k))
+	}
+	return bounds
+}
+
+// fitAutoBuckets extends the layout of a to cover the positive value v, merging buckets
+// as needed to keep within the maximum number of buckets.
+func (a *DistributionData) fitAutoBuckets(v float64) {
+	b := a.auto
+	if v <= 0 || math.IsInf(v, 1) || math.IsNaN(v) {
+		return
+	}
+	k := b.index(v)
+	if b.positive && k >= b.min && k <= b.maxIndex {
+		return
+	}
+	old := *b
+	newMin, newMax := k, k
+	if b.positive {
+		newMin, newMax = minInt(k, b.min), maxInt(k, b.maxIndex)
+	}
+	// The underflow bucket, the finite buckets and the overflow bucket.
+	for newMax-newMin+2 > b.max {
+		newMin >>= 1
+		newMax >>= 1
+		b.scale--
+	}
+	b.min, b.maxIndex, b.positive = newMin, newMax, true
+	a.relayoutAutoBuckets(&old)
+}
+
+// relayoutAutoBuckets moves the counts and exemplars of a from the layout old
+// to the current one, merging buckets if the scale decreased.
+func (a *DistributionData) relayoutAutoBuckets(old *autoBuckets) {
+	b := a.auto
+	a.bounds = b.bounds()
+	n := len(a.bounds) + 1
+	counts := make([]int64, n)
+	var exemplars []*metricdata.Exemplar
+	if a.ExemplarsPerBucket != nil {
+		exemplars = make([]*metricdata.Exemplar, n)
+	}
+	var reservoirs [][]*metricdata.Exemplar
+	var seen []int64
+	if a.reservoirs != nil {
+		reservoirs = make([][]*metricdata.Exemplar, n)
+		seen = make([]int64, n)
+	}
+	shift := uint(old.scale - b.scale)
+	for i, c := range a.CountPerBucket {
+		j := 0 // the underflow bucket stays
+		if i > 0 && old.positive {
+			j = (old.min+i-1)>>shift - b.min + 1
+		}
+		counts[j] += c
+		if exemplars != nil && i < len(a.ExemplarsPerBucket) {
+			if e := a.ExemplarsPerBucket[i]; e != nil {
+				if prev := exemplars[j]; prev == nil || e.Timestamp.After(prev.Timestamp) {
+					exemplars[j] = e
+				}
+			}
+		}
+		if reservoirs != nil && i < len(a.reservoirs) {
+			reservoirs[j] = append(reservoirs[j], a.reservoirs[i]...)
+			if k := exemplarReservoirSize(); len(reservoirs[j]) > k {
+				reservoirs[j] = reservoirs[j][len(reservoirs[j])-k:]
+			}
+			seen[j] += a.reservoirSeen[i]
+		}
+	}
+	a.CountPerBucket = counts
+	if exemplars != nil {
+		a.ExemplarsPerBucket = exemplars
+	}
+	if reservoirs != nil {
+		a.reservoirs, a.reservoirSeen = reservoirs, seen
+	}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
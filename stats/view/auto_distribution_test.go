@@ -0,0 +1,120 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package view
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/cloudian/opencensus-go/metric/metricdata"
+	"github.com/cloudian/opencensus-go/stats"
+)
+
+func TestAutoDistribution(t *testing.T) {
+	const maxBuckets = 20
+	agg := AutoDistribution(maxBuckets)
+	d := agg.newData(time.Now()).(*DistributionData)
+
+	// Values from 0.001 to about 1e6, in increasing and decreasing order,
+	// and values counted in the underflow bucket.
+	var values []float64
+	for v := 1.0; v < 1e6; v *= 1.37 {
+		values = append(values, v)
+	}
+	for v := 1.0; v > 1e-3; v /= 1.61 {
+		values = append(values, v)
+	}
+	values = append(values, 0, -5)
+	for i, v := range values {
+		d.addSample(v, nil, time.Time{})
+		if n := len(d.CountPerBucket); n > maxBuckets {
+			t.Fatalf("after %d values, %d buckets; want at most %d", i+1, n, maxBuckets)
+		}
+		if len(d.CountPerBucket) != len(d.bounds)+1 {
+			t.Fatalf("after %d values, %d buckets for %d bounds", i+1, len(d.CountPerBucket), len(d.bounds))
+		}
+	}
+
+	// The bounds cover the positive values.
+	if min := d.bounds[0]; min > 1e-3 {
+		t.Errorf("first bound = %v; want at most the smallest positive value 1e-3", min)
+	}
+	if last := d.bounds[len(d.bounds)-1]; last > d.Max {
+		t.Errorf("last bound = %v; want at most the largest value %v", last, d.Max)
+	}
+	if !sortedStrictly(d.bounds) {
+		t.Errorf("bounds %v are not strictly increasing", d.bounds)
+	}
+
+	// Merging buckets kept every value in the bucket it belongs to.
+	want := make([]int64, len(d.bounds)+1)
+	for _, v := range values {
+		want[bucketIndex(d.bounds, v, false)]++
+	}
+	for i := range want {
+		if d.CountPerBucket[i] != want[i] {
+			t.Errorf("CountPerBucket = %v; want %v", d.CountPerBucket, want)
+			break
+		}
+	}
+	if d.Count != int64(len(values)) {
+		t.Errorf("Count = %d; want %d", d.Count, len(values))
+	}
+}
+
+func sortedStrictly(bounds []float64) bool {
+	for i := 1; i < len(bounds); i++ {
+		if !(bounds[i] > bounds[i-1]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestAutoDistributionView(t *testing.T) {
+	restart()
+
+	m := stats.Float64("TestAutoDistributionView/latency", "", stats.UnitMilliseconds)
+	v := &View{Name: "TestAutoDistributionView/latency", Measure: m, Aggregation: AutoDistribution(8)}
+	if err := Register(v); err != nil {
+		t.Fatalf("Register() = %v", err)
+	}
+	if !v.Aggregation.Equal(AutoDistribution(8)) || v.Aggregation.Equal(AutoDistribution(9)) || v.Aggregation.Equal(Distribution()) {
+		t.Error("Equal() does not compare the bucket cap of AutoDistribution")
+	}
+	for _, value := range []float64{0.5, 3, 40, 700, 9000, 120000} {
+		stats.Record(context.Background(), m.M(value))
+	}
+	rows, err := RetrieveData(v.Name)
+	if err != nil {
+		t.Fatalf("RetrieveData() = %v", err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("RetrieveData() = %d rows; want 1", len(rows))
+	}
+	d := rows[0].Data.(*DistributionData)
+	if d.Count != 6 || len(d.CountPerBucket) > 8 {
+		t.Errorf("DistributionData has count %d and %d buckets; want 6 and at most 8", d.Count, len(d.CountPerBucket))
+	}
+	// The bounds of the row are exported with its points.
+	p := d.toPoint(getType(v), time.Now()).Value.(*metricdata.Distribution)
+	b := p.BucketOptions.Bounds
+	if len(b) == 0 || b[0] > 0.5 || math.IsInf(b[len(b)-1], 0) || len(p.Buckets) != len(b)+1 {
+		t.Errorf("exported bounds = %v for %d buckets; want finite bounds starting at most at 0.5", b, len(p.Buckets))
+	}
+}
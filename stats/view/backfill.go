@@ -0,0 +1,62 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package view
+
+import (
+	"time"
+
+	"github.com/cloudian/opencensus-go/tag"
+)
+
+// sample is a single raw measurement retained for backfilling views.
+type sample struct {
+	tags        *tag.Map
+	value       float64
+	attachments map[string]interface{}
+	t           time.Time
+}
+
+// sampleRing retains the most recent samples of a measure, up to its capacity.
+type sampleRing struct {
+	samples []sample
+	next    int
+	full    bool
+}
+
+func newSampleRing(size int) *sampleRing {
+	return &sampleRing{samples: make([]sample, size)}
+}
+
+func (r *sampleRing) add(s sample) {
+	r.samples[r.next] = s
+	r.next++
+	if r.next == len(r.samples) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+// each calls fn for the retained samples, oldest first.
+func (r *sampleRing) each(fn func(sample)) {
+	if r.full {
+		for _, s := range r.samples[r.next:] {
+			fn(s)
+		}
+	}
+	for _, s := range r.samples[:r.next] {
+		fn(s)
+	}
+}
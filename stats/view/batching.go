@@ -0,0 +1,132 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package view
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultBatchFlush is the flush interval of batched recordings if none is
+// given to SetBatching.
+const defaultBatchFlush = 10 * time.Millisecond
+
+// recordBatcher coalesces recordings into batches, which the worker
+// aggregates while acquiring its lock once.
+type recordBatcher struct {
+	enabled uint32 // 1 if batching is enabled, use atomic to access
+
+	mu    sync.Mutex
+	max   int
+	flush time.Duration
+	reqs  []*recordReq
+	timer *time.Timer
+}
+
+// SetBatching makes the default Meter coalesce recordings into batches of up
+// to maxBatch recordings, which are aggregated at once to amortize the
+// synchronization of very high recording rates. Batches are aggregated once
+// full or after the flush interval, so recorded values become visible to
+// RetrieveData and exporters up to flush later; a flush interval less than or
+// equal to zero defaults to 10ms. Recordings are aggregated in the order
+// they were made, and pending batches are aggregated by Stop.
+//
+// A maxBatch less than or equal to one disables batching, which is the
+// default, after aggregating the pending recordings.
+func SetBatching(maxBatch int, flush time.Duration) {
+	defaultWorker.SetBatching(maxBatch, flush)
+}
+
+// SetBatching makes the Meter coalesce recordings into batches of up to
+// maxBatch recordings, aggregated once full or after the flush interval.
+func (w *worker) SetBatching(maxBatch int, flush time.Duration) {
+	b := &w.batcher
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if flush <= 0 {
+		flush = defaultBatchFlush
+	}
+	if maxBatch <= 1 {
+		w.flushLocked()
+		b.max = 0
+		atomic.StoreUint32(&b.enabled, 0)
+		return
+	}
+	if len(b.reqs) >= maxBatch {
+		w.flushLocked()
+	}
+	b.max, b.flush = maxBatch, flush
+	atomic.StoreUint32(&b.enabled, 1)
+}
+
+// enqueueRecord hands req to the worker, batching it if enabled.
+func (w *worker) enqueueRecord(req *recordReq) {
+	b := &w.batcher
+	if atomic.LoadUint32(&b.enabled) == 0 {
+		w.c <- req
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.max == 0 {
+		// Batching was disabled meanwhile.
+		w.c <- req
+		return
+	}
+	b.reqs = append(b.reqs, req)
+	switch {
+	case len(b.reqs) >= b.max:
+		w.flushLocked()
+	case len(b.reqs) == 1:
+		b.timer = time.AfterFunc(b.flush, w.flushBatch)
+	}
+}
+
+// flushBatch hands the pending recordings to the worker.
+func (w *worker) flushBatch() {
+	w.batcher.mu.Lock()
+	defer w.batcher.mu.Unlock()
+	w.flushLocked()
+}
+
+// flushLocked hands the pending recordings to the worker. The batcher must
+// be locked, so that batches are sent in order.
+func (w *worker) flushLocked() {
+	b := &w.batcher
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	if len(b.reqs) == 0 {
+		return
+	}
+	w.c <- &recordBatchReq{reqs: b.reqs}
+	b.reqs = nil
+}
+
+// recordBatchReq is the command to record a batch of recordings.
+type recordBatchReq struct {
+	reqs []*recordReq
+}
+
+func (cmd *recordBatchReq) handleCommand(w *worker) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, req := range cmd.reqs {
+		req.record(w)
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package view
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudian/opencensus-go/stats"
+	"github.com/cloudian/opencensus-go/tag"
+)
+
+func TestSetBatching(t *testing.T) {
+	w := NewMeter().(*worker)
+	go w.start()
+
+	k := tag.MustNewKey("goroutine")
+	m := stats.Int64("TestSetBatching/m", "", stats.UnitDimensionless)
+	sum := &View{Name: "TestSetBatching/sum", Measure: m, TagKeys: []tag.Key{k}, Aggregation: Sum()}
+	last := &View{Name: "TestSetBatching/last", Measure: m, TagKeys: []tag.Key{k}, Aggregation: LastValue()}
+	if err := w.Register(sum, last); err != nil {
+		t.Fatalf("Register() = %v", err)
+	}
+	// A flush interval longer than the test makes Stop flush the last batch.
+	w.SetBatching(7, time.Hour)
+
+	const goroutines, n = 8, 1000
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			ctx, err := tag.New(context.Background(), tag.Insert(k, fmt.Sprint(g)))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			for i := 1; i <= n; i++ {
+				stats.RecordWithOptions(ctx, stats.WithRecorder(w), stats.WithMeasurements(m.M(int64(i))))
+			}
+		}(g)
+	}
+	wg.Wait()
+	w.Stop()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	sums := w.views[sum.Name].collectedRows()
+	lasts := w.views[last.Name].collectedRows()
+	if len(sums) != goroutines || len(lasts) != goroutines {
+		t.Fatalf("got %d sum and %d last value rows; want %d", len(sums), len(lasts), goroutines)
+	}
+	for _, row := range sums {
+		if got, want := row.Data.(*SumData).Value, float64(n*(n+1)/2); got != want {
+			t.Errorf("sum of %v = %v; want %v", row.Tags, got, want)
+		}
+	}
+	for _, row := range lasts {
+		if got := row.Data.(*LastValueData).Value; got != n {
+			t.Errorf("last value of %v = %v; want %v", row.Tags, got, n)
+		}
+	}
+}
+
+func TestSetBatchingFlushInterval(t *testing.T) {
+	w := NewMeter().(*worker)
+	go w.start()
+	defer w.Stop()
+
+	m := stats.Int64("TestSetBatchingFlushInterval/m", "", stats.UnitDimensionless)
+	v := &View{Name: "TestSetBatchingFlushInterval/count", Measure: m, Aggregation: Count()}
+	if err := w.Register(v); err != nil {
+		t.Fatalf("Register() = %v", err)
+	}
+	w.SetBatching(100, time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		stats.RecordWithOptions(context.Background(), stats.WithRecorder(w), stats.WithMeasurements(m.M(1)))
+	}
+	waitForCount(t, w, v.Name, func() int64 { return 3 })
+}
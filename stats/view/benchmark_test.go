@@ -97,6 +97,26 @@ func BenchmarkRecordViaStats(b *testing.B) {
 
 }
 
+func BenchmarkRecordViaStatsBatched(b *testing.B) {
+
+	meter := NewMeter()
+	meter.Start()
+	defer meter.Stop()
+	meter.Register(view)
+	defer meter.Unregister(view)
+	meter.SetBatching(256, 10*time.Millisecond)
+
+	ctxs := prepareContexts(10)
+	rec := stats.WithRecorder(meter)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		stats.RecordWithOptions(ctxs[i%len(ctxs)], rec, stats.WithMeasurements(m.M(1), m.M(1), m.M(1), m.M(1), m.M(1), m.M(1), m.M(1), m.M(1)))
+	}
+
+}
+
 func prepareContexts(tagCount int) []context.Context {
 	ctxs := make([]context.Context, 0, tagCount)
 	for i := 0; i < tagCount; i++ {
@@ -0,0 +1,81 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package view
+
+// cardinalityAlert is the alert set with SetCardinalityAlert for a view.
+type cardinalityAlert struct {
+	threshold int
+	cb        func(view string, count int)
+	// fired is set once the alert fired, until the count drops below the
+	// rearm level.
+	fired bool
+}
+
+// rearm returns the row count below which the alert fires again, which is
+// 90% of the threshold so that the alert does not flap around it.
+func (a *cardinalityAlert) rearm() int {
+	return a.threshold - a.threshold/10
+}
+
+// check fires the alert for the view name with count rows if needed.
+func (a *cardinalityAlert) check(name string, count int) {
+	switch {
+	case !a.fired && count >= a.threshold:
+		a.fired = true
+		a.cb(name, count)
+	case a.fired && count < a.rearm():
+		a.fired = false
+	}
+}
+
+// SetCardinalityAlert sets a callback invoked once the number of rows, that
+// is of distinct tag sets, collected for the view with the given name
+// reaches threshold, as an early warning of cardinality explosions. The
+// callback receives the view name and its row count. It fires once, and
+// only fires again after the row count dropped below 90% of the threshold,
+// for example after the view was re-registered, so that it does not fire
+// repeatedly while the count hovers around the threshold.
+//
+// The view does not need to be registered yet. The callback is invoked from
+// the goroutine aggregating the recordings, while the Meter is locked, so it
+// should return quickly and must not call into the Meter. A threshold less
+// than or equal to zero or a nil callback removes the alert of the view.
+func SetCardinalityAlert(name string, threshold int, cb func(view string, count int)) {
+	defaultWorker.SetCardinalityAlert(name, threshold, cb)
+}
+
+// SetCardinalityAlert sets a callback invoked once the number of rows
+// collected for the view with the given name reaches threshold.
+func (w *worker) SetCardinalityAlert(name string, threshold int, cb func(view string, count int)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if threshold <= 0 || cb == nil {
+		delete(w.alerts, name)
+		return
+	}
+	if w.alerts == nil {
+		w.alerts = make(map[string]*cardinalityAlert)
+	}
+	w.alerts[name] = &cardinalityAlert{threshold: threshold, cb: cb}
+}
+
+// checkCardinality checks the cardinality alert of v, if any. The worker must
+// be locked.
+func (w *worker) checkCardinality(v *viewInternal) {
+	if a := w.alerts[v.view.Name]; a != nil {
+		a.check(v.view.Name, len(v.collector.signatures))
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package view
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/cloudian/opencensus-go/stats"
+	"github.com/cloudian/opencensus-go/tag"
+)
+
+func TestSetCardinalityAlert(t *testing.T) {
+	restart()
+
+	k := tag.MustNewKey("user")
+	m := stats.Int64("TestSetCardinalityAlert/m", "", stats.UnitDimensionless)
+	v := &View{Name: "TestSetCardinalityAlert/count", Measure: m, TagKeys: []tag.Key{k}, Aggregation: Count()}
+	type alert struct {
+		view  string
+		count int
+	}
+	var alerts []alert
+	SetCardinalityAlert(v.Name, 10, func(view string, count int) {
+		alerts = append(alerts, alert{view, count})
+	})
+
+	record := func(users int) {
+		for i := 0; i < users; i++ {
+			ctx, _ := tag.New(context.Background(), tag.Upsert(k, fmt.Sprint(i)))
+			stats.Record(ctx, m.M(1))
+		}
+		// Wait for the recordings to be aggregated.
+		if _, err := RetrieveData(v.Name); err != nil {
+			t.Fatalf("RetrieveData() = %v", err)
+		}
+	}
+
+	if err := Register(v); err != nil {
+		t.Fatalf("Register() = %v", err)
+	}
+	record(9)
+	if len(alerts) != 0 {
+		t.Fatalf("alerts below threshold = %v; want none", alerts)
+	}
+	record(20)
+	record(20)
+	if want := []alert{{v.Name, 10}}; fmt.Sprint(alerts) != fmt.Sprint(want) {
+		t.Fatalf("alerts = %v; want %v", alerts, want)
+	}
+
+	// The alert fires again once the rows were reset.
+	Unregister(v)
+	if err := Register(v); err != nil {
+		t.Fatalf("Register() = %v", err)
+	}
+	record(12)
+	if want := []alert{{v.Name, 10}, {v.Name, 10}}; fmt.Sprint(alerts) != fmt.Sprint(want) {
+		t.Errorf("alerts after re-registration = %v; want %v", alerts, want)
+	}
+
+	// Removed alerts no longer fire.
+	SetCardinalityAlert(v.Name, 0, nil)
+	Unregister(v)
+	if err := Register(v); err != nil {
+		t.Fatalf("Register() = %v", err)
+	}
+	record(12)
+	if len(alerts) != 2 {
+		t.Errorf("alerts after removal = %v; want 2", alerts)
+	}
+}
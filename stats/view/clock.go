@@ -0,0 +1,90 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package view
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Clock is the source of time of the view package: the timestamps of
+// recorded values and collected data, and the reporting interval.
+// It can be replaced with SetClock, mostly to make tests deterministic.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// NewTicker returns a ticker that ticks every d, like time.NewTicker.
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker delivers the ticks of a Clock at intervals.
+type Ticker interface {
+	// C returns the channel the ticks are delivered on.
+	C() <-chan time.Time
+	// Stop turns off the ticker.
+	Stop()
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) NewTicker(d time.Duration) Ticker { return systemTicker{time.NewTicker(d)} }
+
+type systemTicker struct {
+	t *time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time { return t.t.C }
+
+func (t systemTicker) Stop() { t.t.Stop() }
+
+// clockHolder wraps the current clock, as atomic.Value requires values of a
+// consistent concrete type.
+type clockHolder struct {
+	Clock
+}
+
+var currentClock atomic.Value // clockHolder
+
+func init() {
+	currentClock.Store(clockHolder{systemClock{}})
+}
+
+// SetClock replaces the clock of the view package; nil restores the system
+// clock. The reporting ticker of the default Meter is replaced right away,
+// other Meters use the clock for their ticker once their reporting period
+// is set.
+func SetClock(c Clock) {
+	if c == nil {
+		c = systemClock{}
+	}
+	currentClock.Store(clockHolder{c})
+	req := &setReportingPeriodReq{
+		keep: true,
+		c:    make(chan bool),
+	}
+	defaultWorker.c <- req
+	<-req.c
+}
+
+func clock() Clock {
+	return currentClock.Load().(clockHolder).Clock
+}
+
+func now() time.Time {
+	return clock().Now()
+}
@@ -0,0 +1,195 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package view
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudian/opencensus-go/metric/metricdata"
+	"github.com/cloudian/opencensus-go/stats"
+)
+
+// fakeClock is a Clock that only moves when advanced.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	tickers []*fakeTicker
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTicker(d time.Duration) Ticker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTicker{clock: c, c: make(chan time.Time, 1), d: d, next: c.now.Add(d)}
+	c.tickers = append(c.tickers, t)
+	return t
+}
+
+// Advance moves the clock forward by d, firing the tickers that are due.
+// Like time.Ticker, ticks are dropped if the receiver is not keeping up.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	for _, t := range c.tickers {
+		if t.stopped {
+			continue
+		}
+		for !t.next.After(c.now) {
+			select {
+			case t.c <- t.next:
+			default:
+			}
+			t.next = t.next.Add(t.d)
+		}
+	}
+}
+
+type fakeTicker struct {
+	clock   *fakeClock
+	c       chan time.Time
+	d       time.Duration
+	next    time.Time
+	stopped bool
+}
+
+func (t *fakeTicker) C() <-chan time.Time { return t.c }
+
+func (t *fakeTicker) Stop() {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	t.stopped = true
+}
+
+type chanExporter chan *Data
+
+func (e chanExporter) ExportView(vd *Data) { e <- vd }
+
+func TestSetClock(t *testing.T) {
+	t0 := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	fc := &fakeClock{now: t0}
+	SetClock(fc)
+	defer SetClock(nil)
+	restart()
+	defer restart()
+
+	m := stats.Int64("measure/TestSetClock", "desc", "unit")
+	v := &View{Name: "TestSetClock/count", Measure: m, Aggregation: Count()}
+	if err := Register(v); err != nil {
+		t.Fatalf("cannot register: %v", err)
+	}
+	e := make(chanExporter, 1)
+	RegisterExporter(e)
+	defer UnregisterExporter(e)
+
+	stats.Record(context.Background(), m.M(1))
+	// Wait for the recording to be processed.
+	if _, err := RetrieveData(v.Name); err != nil {
+		t.Fatalf("RetrieveData: %v", err)
+	}
+
+	fc.Advance(defaultReportingDuration)
+	vd := <-e
+	if !vd.Start.Equal(t0) {
+		t.Errorf("Start = %v; want %v", vd.Start, t0)
+	}
+	if want := t0.Add(defaultReportingDuration); !vd.End.Equal(want) {
+		t.Errorf("End = %v; want %v", vd.End, want)
+	}
+	if len(vd.Rows) != 1 {
+		t.Fatalf("got %d rows; want 1", len(vd.Rows))
+	}
+	if got := vd.Rows[0].Data.StartTime(); !got.Equal(t0) {
+		t.Errorf("row StartTime = %v; want %v", got, t0)
+	}
+
+	// Changing the reporting period uses the injected clock as well.
+	SetReportingPeriod(time.Minute)
+	fc.Advance(defaultReportingDuration)
+	select {
+	case vd := <-e:
+		t.Errorf("exported before the reporting period elapsed: %v", vd)
+	default:
+	}
+	fc.Advance(time.Minute)
+	if vd := <-e; !vd.End.Equal(fc.Now()) {
+		t.Errorf("End = %v; want %v", vd.End, fc.Now())
+	}
+}
+
+func TestSetExemplarInterval(t *testing.T) {
+	t0 := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	fc := &fakeClock{now: t0}
+	SetClock(fc)
+	defer SetClock(nil)
+	SetExemplarInterval(time.Second)
+	defer SetExemplarInterval(0)
+	restart()
+	defer restart()
+
+	m := stats.Float64("measure/TestSetExemplarInterval", "desc", stats.UnitMilliseconds)
+	v := &View{Name: "TestSetExemplarInterval/latency", Measure: m, Aggregation: Distribution(100)}
+	if err := Register(v); err != nil {
+		t.Fatalf("cannot register: %v", err)
+	}
+	record := func(n int) {
+		for i := 0; i < n; i++ {
+			stats.RecordWithOptions(context.Background(),
+				stats.WithAttachmentLabels(map[string]string{"i": fmt.Sprint(i)}),
+				stats.WithMeasurements(m.M(float64(i))))
+		}
+	}
+	exemplar := func() *metricdata.Exemplar {
+		rows, err := RetrieveData(v.Name)
+		if err != nil {
+			t.Fatalf("RetrieveData: %v", err)
+		}
+		return rows[0].Data.(*DistributionData).ExemplarsPerBucket[0]
+	}
+
+	limited := RateLimitedExemplars()
+	record(50)
+	// Only the first recording of the interval is captured.
+	if e := exemplar(); e == nil || e.Value != 0 || !e.Timestamp.Equal(t0) {
+		t.Errorf("exemplar = %v; want the first value recorded at %v", e, t0)
+	}
+	if got := RateLimitedExemplars() - limited; got != 49 {
+		t.Errorf("RateLimitedExemplars() increased by %d; want 49", got)
+	}
+
+	fc.Advance(500 * time.Millisecond)
+	record(10)
+	if e := exemplar(); e.Value != 0 {
+		t.Errorf("exemplar value = %v within the interval; want 0", e.Value)
+	}
+	fc.Advance(500 * time.Millisecond)
+	record(10)
+	if e := exemplar(); e.Value != 0 || !e.Timestamp.Equal(t0.Add(time.Second)) {
+		t.Errorf("exemplar = %v after the interval; want the first value recorded at %v", e, t0.Add(time.Second))
+	}
+	if got := RateLimitedExemplars() - limited; got != 49+10+9 {
+		t.Errorf("RateLimitedExemplars() increased by %d; want %d", got, 49+10+9)
+	}
+}
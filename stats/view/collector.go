@@ -23,10 +23,28 @@ import (
 	"github.com/cloudian/opencensus-go/tag"
 )
 
+// newCollector returns a collector of the rows aggregated with a. Raw
+// aggregations collect no rows.
+func newCollector(a *Aggregation) *collector {
+	if a.Type == AggTypeRaw {
+		return &collector{a: a}
+	}
+	return &collector{signatures: make(map[string]AggregationData), updated: make(map[string]time.Time), a: a}
+}
+
 type collector struct {
 	// signatures holds the aggregations values for each unique tag signature
 	// (values for all keys) to its aggregator.
 	signatures map[string]AggregationData
+	// samples counts the samples added to each row, if sample counting is
+	// enabled, see SetSampleCounting.
+	samples map[string]int64
+	// updated holds the time of the last sample added to each row.
+	updated map[string]time.Time
+	// gaugeWindows holds the data of the rows of the Gauge aggregation since
+	// they were last read by each reader, by reader and signature, see
+	// windowedRows.
+	gaugeWindows map[interface{}]map[string]*GaugeData
 	// Aggregation is the description of the aggregation to perform for this
 	// view.
 	a *Aggregation
@@ -39,6 +57,30 @@ func (c *collector) addSample(s string, v float64, attachments map[string]interf
 		c.signatures[s] = aggregator
 	}
 	aggregator.addSample(v, attachments, t)
+	for _, window := range c.gaugeWindows {
+		if data, ok := window[s]; ok {
+			data.addSample(v, attachments, t)
+		}
+	}
+	c.updated[s] = t
+	if c.samples != nil {
+		c.samples[s]++
+	}
+}
+
+// addUniqueValue adds the tag value v to the UniqueCount data of the row with
+// signature s.
+func (c *collector) addUniqueValue(s string, v string, t time.Time) {
+	aggregator, ok := c.signatures[s]
+	if !ok {
+		aggregator = c.a.newData(t)
+		c.signatures[s] = aggregator
+	}
+	aggregator.(*UniqueCountData).addValue(v)
+	c.updated[s] = t
+	if c.samples != nil {
+		c.samples[s]++
+	}
 }
 
 // collectRows returns a snapshot of the collected Row values.
@@ -52,8 +94,72 @@ func (c *collector) collectedRows(keys []tag.Key) []*Row {
 	return rows
 }
 
+// updatedRows is like collectedRows, but also returns the time each row was
+// last updated, or the zero time if it is unknown.
+func (c *collector) updatedRows(keys []tag.Key) ([]*Row, []time.Time) {
+	rows := make([]*Row, 0, len(c.signatures))
+	updated := make([]time.Time, 0, len(c.signatures))
+	for sig, aggregator := range c.signatures {
+		rows = append(rows, &Row{Tags: decodeTags([]byte(sig), keys), Data: aggregator.clone()})
+		updated = append(updated, c.updated[sig])
+	}
+	return rows, updated
+}
+
+// windowedRows is like updatedRows, but the data of the rows of the Gauge
+// aggregation only describes the values recorded since the previous call for
+// the same reader, which starts a new window for it. Rows created since then
+// have all their data in the window.
+func (c *collector) windowedRows(keys []tag.Key, reader interface{}) ([]*Row, []time.Time) {
+	if c.a.Type != AggTypeGauge {
+		return c.updatedRows(keys)
+	}
+	window := c.gaugeWindows[reader]
+	next := make(map[string]*GaugeData, len(c.signatures))
+	rows := make([]*Row, 0, len(c.signatures))
+	updated := make([]time.Time, 0, len(c.signatures))
+	for sig, aggregator := range c.signatures {
+		data, ok := window[sig]
+		if !ok {
+			data = aggregator.(*GaugeData)
+		}
+		rows = append(rows, &Row{Tags: decodeTags([]byte(sig), keys), Data: data.clone()})
+		updated = append(updated, c.updated[sig])
+		data = data.clone().(*GaugeData)
+		data.reset()
+		next[sig] = data
+	}
+	if c.gaugeWindows == nil {
+		c.gaugeWindows = make(map[interface{}]map[string]*GaugeData)
+	}
+	c.gaugeWindows[reader] = next
+	return rows, updated
+}
+
+// dropWindows drops the windows of reader, see windowedRows.
+func (c *collector) dropWindows(reader interface{}) {
+	delete(c.gaugeWindows, reader)
+}
+
+// row returns a snapshot of the Row collected for the given signature.
+func (c *collector) row(sig string, keys []tag.Key) (*Row, bool) {
+	aggregator, ok := c.signatures[sig]
+	if !ok {
+		return nil, false
+	}
+	return &Row{Tags: decodeTags([]byte(sig), keys), Data: aggregator.clone()}, true
+}
+
 func (c *collector) clearRows() {
+	if c.signatures == nil {
+		return
+	}
 	c.signatures = make(map[string]AggregationData)
+	c.updated = make(map[string]time.Time)
+	c.gaugeWindows = nil
+	if c.samples != nil {
+		c.samples = make(map[string]int64)
+	}
 }
 
 // encodeWithKeys encodes the map by using values
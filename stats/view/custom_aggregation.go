@@ -0,0 +1,109 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package view
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/cloudian/opencensus-go/metric/metricdata"
+)
+
+// CustomAggregation is an aggregation implemented outside of this package,
+// such as an exponential moving average. Use Custom to aggregate a view
+// with it.
+type CustomAggregation interface {
+	// NewData returns the data of a new row, collected from start on.
+	NewData(start time.Time) CustomData
+	// MetricType returns the type of the metric the view is exported as,
+	// which must match the points returned by CustomData.ToPoint.
+	MetricType() metricdata.Type
+}
+
+// CustomData is the data aggregated for a row by a CustomAggregation.
+// Its methods are called by a single goroutine at a time.
+type CustomData interface {
+	// AddSample aggregates the value v recorded at time t.
+	AddSample(v float64, attachments map[string]interface{}, t time.Time)
+	// Clone returns a copy of the data that is not affected by later calls
+	// to AddSample.
+	Clone() CustomData
+	// ToPoint returns the point exported for the data at time t.
+	ToPoint(t time.Time) metricdata.Point
+}
+
+// Custom returns an aggregation that aggregates the rows of a view with the
+// CustomAggregation a. The rows returned by RetrieveData hold
+// CustomAggregationData, and exporters get the points returned by
+// CustomData.ToPoint. Views with the same name are considered the same if
+// their custom aggregations are equal with ==, so a should be comparable,
+// like a pointer.
+func Custom(a CustomAggregation) *Aggregation {
+	return &Aggregation{
+		Type:   AggTypeCustom,
+		custom: a,
+		newData: func(t time.Time) AggregationData {
+			return &CustomAggregationData{Start: t, Data: a.NewData(t)}
+		},
+	}
+}
+
+// CustomAggregationData is the aggregated data of a Custom aggregation.
+type CustomAggregationData struct {
+	Start time.Time
+	Data  CustomData
+}
+
+func (a *CustomAggregationData) isAggregationData() bool { return true }
+
+func (a *CustomAggregationData) addSample(v float64, attachments map[string]interface{}, t time.Time) {
+	a.Data.AddSample(v, attachments, t)
+}
+
+func (a *CustomAggregationData) clone() AggregationData {
+	return &CustomAggregationData{Start: a.Start, Data: a.Data.Clone()}
+}
+
+func (a *CustomAggregationData) equal(other AggregationData) bool {
+	a2, ok := other.(*CustomAggregationData)
+	if !ok {
+		return false
+	}
+	return a.Start.Equal(a2.Start) && reflect.DeepEqual(a.Data, a2.Data)
+}
+
+func (a *CustomAggregationData) toPoint(_ metricdata.Type, t time.Time) metricdata.Point {
+	return a.Data.ToPoint(t)
+}
+
+// StartTime returns the start time of the data being aggregated by
+// CustomAggregationData.
+func (a *CustomAggregationData) StartTime() time.Time {
+	return a.Start
+}
+
+// sameCustom reports whether two custom aggregations are equal, without
+// panicking on incomparable ones.
+func sameCustom(a, b CustomAggregation) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	t := reflect.TypeOf(a)
+	if t != reflect.TypeOf(b) || !t.Comparable() {
+		return false
+	}
+	return a == b
+}
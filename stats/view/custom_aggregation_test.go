@@ -0,0 +1,126 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package view
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cloudian/opencensus-go/metric/metricdata"
+	"github.com/cloudian/opencensus-go/stats"
+)
+
+// ema is an exponential moving average aggregation.
+type ema struct {
+	alpha float64
+}
+
+func (a *ema) NewData(time.Time) CustomData { return &emaData{alpha: a.alpha} }
+func (a *ema) MetricType() metricdata.Type  { return metricdata.TypeGaugeFloat64 }
+
+type emaData struct {
+	alpha float64
+	value float64
+	n     int64
+}
+
+func (d *emaData) AddSample(v float64, _ map[string]interface{}, _ time.Time) {
+	if d.n == 0 {
+		d.value = v
+	} else {
+		d.value = d.alpha*v + (1-d.alpha)*d.value
+	}
+	d.n++
+}
+
+func (d *emaData) Clone() CustomData {
+	c := *d
+	return &c
+}
+
+func (d *emaData) ToPoint(t time.Time) metricdata.Point {
+	return metricdata.NewFloat64Point(t, d.value)
+}
+
+func TestCustomAggregation(t *testing.T) {
+	restart()
+
+	m := stats.Float64("TestCustomAggregation/m", "", stats.UnitDimensionless)
+	v := &View{Name: "TestCustomAggregation/ema", Measure: m, Aggregation: Custom(&ema{alpha: 0.5})}
+	if err := Register(v); err != nil {
+		t.Fatalf("Register() = %v", err)
+	}
+	defer Unregister(v)
+
+	stats.Record(context.Background(), m.M(10), m.M(20))
+
+	rows, err := RetrieveData(v.Name)
+	if err != nil {
+		t.Fatalf("RetrieveData() = %v", err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("RetrieveData() = %d rows; want 1", len(rows))
+	}
+	data, ok := rows[0].Data.(*CustomAggregationData)
+	if !ok {
+		t.Fatalf("rows[0].Data = %T; want *CustomAggregationData", rows[0].Data)
+	}
+	if got := data.Data.(*emaData).value; got != 15 {
+		t.Errorf("EMA = %v; want 15", got)
+	}
+
+	var found bool
+	for _, metric := range defaultWorker.Read() {
+		if metric.Descriptor.Name != v.Name {
+			continue
+		}
+		found = true
+		if metric.Descriptor.Type != metricdata.TypeGaugeFloat64 {
+			t.Errorf("Descriptor.Type = %v; want %v", metric.Descriptor.Type, metricdata.TypeGaugeFloat64)
+		}
+		if len(metric.TimeSeries) != 1 || len(metric.TimeSeries[0].Points) != 1 {
+			t.Fatalf("TimeSeries = %+v; want a single point", metric.TimeSeries)
+		}
+		if got := metric.TimeSeries[0].Points[0].Value; got != 15.0 {
+			t.Errorf("point value = %v; want 15", got)
+		}
+	}
+	if !found {
+		t.Errorf("Read() has no metric %q", v.Name)
+	}
+}
+
+func TestCustomAggregationNil(t *testing.T) {
+	restart()
+
+	m := stats.Float64("TestCustomAggregationNil/m", "", stats.UnitDimensionless)
+	v := &View{Name: "TestCustomAggregationNil/v", Measure: m, Aggregation: Custom(nil)}
+	if err := Register(v); err == nil {
+		Unregister(v)
+		t.Errorf("Register() with a nil custom aggregation = nil; want error")
+	}
+}
+
+func TestCustomAggregationEqual(t *testing.T) {
+	a := &ema{alpha: 0.5}
+	if !Custom(a).Equal(Custom(a)) {
+		t.Errorf("Custom(a).Equal(Custom(a)) = false; want true")
+	}
+	if Custom(a).Equal(Custom(&ema{alpha: 0.5})) {
+		t.Errorf("Custom aggregations with different instances are equal; want not equal")
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package view
+
+import (
+	"strings"
+)
+
+// Diff computes the change between two snapshots of the rows of views, keyed
+// by view name, as returned by RetrieveData at two points in time. It returns
+// one row per row of curr, matched with the row of prev for the same view and
+// tags:
+//
+//   - the delta of CountData, of SumData of the Sum aggregation and of
+//     DistributionData, whose Min and Max stay those of curr as they cannot be
+//     computed for the delta alone;
+//   - the data of curr for rows that are not in prev, and for cumulative data
+//     that decreased or whose buckets changed, as the row was reset in between;
+//   - the data of curr for all other aggregations, which report the latest
+//     value rather than a cumulative one.
+//
+// Rows and views that are only in prev have disappeared and are left out.
+// The data of curr is copied, so the result can be modified by the caller.
+func Diff(prev, curr map[string][]*Row) map[string][]*Row {
+	diff := make(map[string][]*Row, len(curr))
+	for name, rows := range curr {
+		prevRows := make(map[string]*Row, len(prev[name]))
+		for _, r := range prev[name] {
+			prevRows[rowKey(r)] = r
+		}
+		delta := make([]*Row, 0, len(rows))
+		for _, r := range rows {
+			d := &Row{
+				Tags: append(r.Tags[:0:0], r.Tags...),
+				Data: r.Data.clone(),
+			}
+			if p, ok := prevRows[rowKey(r)]; ok {
+				subtract(d.Data, p.Data)
+			}
+			delta = append(delta, d)
+		}
+		diff[name] = delta
+	}
+	return diff
+}
+
+// rowKey returns a key identifying the tags of r.
+func rowKey(r *Row) string {
+	var b strings.Builder
+	for _, t := range r.Tags {
+		// Tag keys and values are printable ASCII, so NUL separates them
+		// unambiguously.
+		b.WriteString(t.Key.Name())
+		b.WriteByte(0)
+		b.WriteString(t.Value)
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+// subtract turns the cumulative data d into the delta since prev, unless d was
+// reset since prev. Data that is not cumulative is kept as it is.
+func subtract(d, prev AggregationData) {
+	switch d := d.(type) {
+	case *CountData:
+		if p, ok := prev.(*CountData); ok && d.Value >= p.Value {
+			d.Value -= p.Value
+		}
+	case *SumData:
+		if p, ok := prev.(*SumData); ok && !d.gauge && d.Count >= p.Count {
+			d.Value -= p.Value
+			d.Count -= p.Count
+		}
+	case *DistributionData:
+		if p, ok := prev.(*DistributionData); ok && d.Count >= p.Count && len(d.CountPerBucket) == len(p.CountPerBucket) {
+			d.subtract(p)
+		}
+	}
+}
+
+// subtract turns a into the distribution of the values added since prev.
+func (a *DistributionData) subtract(prev *DistributionData) {
+	for i, c := range a.CountPerBucket {
+		if c < prev.CountPerBucket[i] {
+			// The buckets were reset in between.
+			return
+		}
+	}
+	for i := range a.CountPerBucket {
+		a.CountPerBucket[i] -= prev.CountPerBucket[i]
+	}
+	n := a.Count - prev.Count
+	if n == 0 {
+		a.Count, a.Mean, a.SumOfSquaredDev = 0, 0, 0
+		a.meanErr, a.sumOfSquaredDevErr = 0, 0
+		return
+	}
+	// Invert the combination of the means and the sums of squared deviations
+	// of two sets of values, see https://en.wikipedia.org/wiki/Algorithms_for_calculating_variance#Parallel_algorithm.
+	// Differences are taken between the means rather than between the sums,
+	// Mean*Count, whose magnitude grows with the count, and with the rounding
+	// errors of the running values, so that the values added since prev are
+	// not lost to cancellation.
+	meanDiff := (a.Mean - prev.Mean) + (a.meanErr - prev.meanErr)
+	delta := meanDiff * float64(a.Count) / float64(n) // the mean of the values added, less prev.Mean
+	ssd := (a.SumOfSquaredDev - prev.SumOfSquaredDev) + (a.sumOfSquaredDevErr - prev.sumOfSquaredDevErr)
+	ssd -= delta * meanDiff * float64(prev.Count)
+	if ssd < 0 || n == 1 {
+		// Rounding errors, or a single value, which has no deviation.
+		ssd = 0
+	}
+	a.Count = n
+	a.Mean, a.meanErr = twoSum(prev.Mean, prev.meanErr+delta)
+	a.SumOfSquaredDev, a.sumOfSquaredDevErr = ssd, 0
+}
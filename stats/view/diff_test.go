@@ -0,0 +1,120 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package view
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cloudian/opencensus-go/tag"
+)
+
+// aggregate returns the data of agg after adding values.
+func aggregate(agg *Aggregation, values ...float64) AggregationData {
+	d := agg.newData(time.Time{})
+	for _, v := range values {
+		d.addSample(v, nil, time.Time{})
+	}
+	return d
+}
+
+func TestDiff(t *testing.T) {
+	k := tag.MustNewKey("k")
+	tags := func(v string) []tag.Tag { return []tag.Tag{{Key: k, Value: v}} }
+	dist := Distribution(2, 5)
+
+	prev := map[string][]*Row{
+		"count": {
+			{Tags: tags("a"), Data: aggregate(Count(), 1, 1)},
+			{Tags: tags("removed"), Data: aggregate(Count(), 1)},
+		},
+		"sum":          {{Tags: tags("a"), Data: aggregate(Sum(), 1, 2)}},
+		"distribution": {{Tags: tags("a"), Data: aggregate(dist, 1, 3)}},
+		"sum_gauge":    {{Tags: tags("a"), Data: aggregate(SumGauge(), 5)}},
+		"last_value":   {{Tags: tags("a"), Data: aggregate(LastValue(), 7)}},
+		"removed":      {{Tags: tags("a"), Data: aggregate(Count(), 1)}},
+	}
+	curr := map[string][]*Row{
+		"count": {
+			{Tags: tags("a"), Data: aggregate(Count(), 1, 1, 1, 1, 1)},
+			{Tags: tags("added"), Data: aggregate(Count(), 1, 1)},
+		},
+		"sum":          {{Tags: tags("a"), Data: aggregate(Sum(), 1, 2, 4, 8)}},
+		"distribution": {{Tags: tags("a"), Data: aggregate(dist, 1, 3, 4, 6, 10)}},
+		"sum_gauge":    {{Tags: tags("a"), Data: aggregate(SumGauge(), 5, -2)}},
+		"last_value":   {{Tags: tags("a"), Data: aggregate(LastValue(), 7, 3)}},
+	}
+	currCount := curr["count"][0].Data.(*CountData).Value
+
+	got := Diff(prev, curr)
+	if _, ok := got["removed"]; ok {
+		t.Errorf("Diff() has rows for a view that disappeared: %v", got["removed"])
+	}
+	if len(got) != len(curr) {
+		t.Errorf("Diff() has %d views; want %d", len(got), len(curr))
+	}
+
+	counts := map[string]int64{}
+	for _, r := range got["count"] {
+		counts[r.Tags[0].Value] = r.Data.(*CountData).Value
+	}
+	if want := map[string]int64{"a": 3, "added": 2}; !reflect.DeepEqual(counts, want) {
+		t.Errorf("count deltas = %v; want %v", counts, want)
+	}
+	if v := curr["count"][0].Data.(*CountData).Value; v != currCount {
+		t.Errorf("Diff() modified curr: count = %d; want %d", v, currCount)
+	}
+
+	if d := got["sum"][0].Data.(*SumData); d.Value != 12 || d.Count != 2 {
+		t.Errorf("sum delta = %v over %d values; want 12 over 2 values", d.Value, d.Count)
+	}
+
+	want := aggregate(dist, 4, 6, 10).(*DistributionData)
+	d := got["distribution"][0].Data.(*DistributionData)
+	if !reflect.DeepEqual(d.CountPerBucket, want.CountPerBucket) || d.Count != want.Count {
+		t.Errorf("distribution delta has %d values in buckets %v; want %d in %v", d.Count, d.CountPerBucket, want.Count, want.CountPerBucket)
+	}
+	if math.Abs(d.Mean-want.Mean) > 1e-9 || math.Abs(d.SumOfSquaredDev-want.SumOfSquaredDev) > 1e-9 {
+		t.Errorf("distribution delta has mean %v and sum of squared deviations %v; want %v and %v", d.Mean, d.SumOfSquaredDev, want.Mean, want.SumOfSquaredDev)
+	}
+
+	if v := got["sum_gauge"][0].Data.(*SumData).Value; v != 3 {
+		t.Errorf("sum gauge = %v; want the latest value 3", v)
+	}
+	if v := got["last_value"][0].Data.(*LastValueData).Value; v != 3 {
+		t.Errorf("last value = %v; want the latest value 3", v)
+	}
+}
+
+func TestDiffReset(t *testing.T) {
+	prev := map[string][]*Row{
+		"count":        {{Data: aggregate(Count(), 1, 1, 1)}},
+		"distribution": {{Data: aggregate(Distribution(2), 1, 3, 3)}},
+	}
+	curr := map[string][]*Row{
+		"count":        {{Data: aggregate(Count(), 1)}},
+		"distribution": {{Data: aggregate(Distribution(2), 1, 1, 1, 1)}},
+	}
+	got := Diff(prev, curr)
+	if v := got["count"][0].Data.(*CountData).Value; v != 1 {
+		t.Errorf("count after a reset = %d; want 1", v)
+	}
+	if d := got["distribution"][0].Data.(*DistributionData); d.Count != 4 || !reflect.DeepEqual(d.CountPerBucket, []int64{4, 0}) {
+		t.Errorf("distribution after a reset has %d values in buckets %v; want 4 in [4 0]", d.Count, d.CountPerBucket)
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package view
+
+import (
+	"reflect"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudian/opencensus-go/metric/metricdata"
+)
+
+// ExemplarFilter decides whether a recorded value with the given attachments
+// is retained as an exemplar.
+type ExemplarFilter func(value float64, attachments map[string]interface{}) bool
+
+var (
+	exemplarsDisabled uint32       // 1 if exemplars are disabled, use atomic to access
+	exemplarFilter    atomic.Value // ExemplarFilter
+
+	reservoirSize        int32 // number of exemplars sampled per bucket, use atomic to access
+	maxAttachmentSize    int64 // limit of the attachment size, use atomic to access
+	oversizedAttachments int64 // number of dropped attachments, use atomic to access
+	exemplarInterval     int64 // minimum time between exemplars of a bucket, use atomic to access
+	rateLimitedExemplars int64 // number of exemplars dropped by the interval, use atomic to access
+)
+
+// SetExemplarEnabled enables or disables retaining exemplars for all views.
+// Exemplars are enabled by default. While they are disabled, the
+// ExemplarsPerBucket of newly collected distributions stay nil, saving an
+// exemplar per bucket and row.
+func SetExemplarEnabled(enabled bool) {
+	var disabled uint32
+	if !enabled {
+		disabled = 1
+	}
+	atomic.StoreUint32(&exemplarsDisabled, disabled)
+}
+
+func exemplarsEnabled() bool {
+	return atomic.LoadUint32(&exemplarsDisabled) == 0
+}
+
+// SetExemplarFilter sets a filter that limits which recorded values are
+// retained as exemplars, for example only those of sampled traces or above
+// a threshold. Passing nil retains all values recorded with attachments.
+func SetExemplarFilter(f ExemplarFilter) {
+	exemplarFilter.Store(f)
+}
+
+// SetExemplarReservoirSize sets the number of exemplars retained per bucket
+// of the distributions created afterwards. With k greater than one, each
+// bucket keeps a uniform sample of up to k of its exemplars, see
+// DistributionData.ExemplarReservoir, which gives a richer choice of traces
+// for hot buckets at the cost of up to k exemplars per bucket and row.
+// ExemplarsPerBucket keeps holding the most recent exemplar, which is the
+// one exporters such as the Prometheus exporter expose, as OpenMetrics
+// allows a single exemplar per bucket.
+//
+// By default, and with k less than or equal to one, only the most recent
+// exemplar of each bucket is retained.
+func SetExemplarReservoirSize(k int) {
+	if k < 1 {
+		k = 1
+	}
+	atomic.StoreInt32(&reservoirSize, int32(k))
+}
+
+func exemplarReservoirSize() int {
+	return int(atomic.LoadInt32(&reservoirSize))
+}
+
+// SetMaxAttachmentSize limits the size of the attachments retained with
+// exemplars to n bytes, so that a single large attachment does not stay in
+// memory for as long as its exemplar is the latest of its bucket. The size of
+// attachments is estimated as the length of their keys, of their string and
+// []byte values and the in-memory size of their other values. Exemplars with
+// larger attachments are dropped and counted, see OversizedAttachmentsDropped;
+// the recorded value is still aggregated.
+//
+// By default, attachments of any size are retained. A limit less than or
+// equal to zero removes the limit.
+func SetMaxAttachmentSize(n int) {
+	atomic.StoreInt64(&maxAttachmentSize, int64(n))
+}
+
+// OversizedAttachmentsDropped returns the number of exemplars that were
+// dropped because their attachments exceeded the limit set with
+// SetMaxAttachmentSize.
+func OversizedAttachmentsDropped() int64 {
+	return atomic.LoadInt64(&oversizedAttachments)
+}
+
+// SetExemplarInterval limits the exemplars retained by each bucket of a
+// distribution to at most one per interval d, for example one per second, so
+// that the exemplars of hot buckets are spread over time and cost little to
+// capture. A value recorded within d of the time of the current exemplar of
+// its bucket is still aggregated, but is not considered as an exemplar and is
+// counted, see RateLimitedExemplars. Times are those of the recordings, as
+// given by the clock of the package, see SetClock.
+//
+// By default, and with d less than or equal to zero, every value recorded
+// with attachments is considered as an exemplar.
+func SetExemplarInterval(d time.Duration) {
+	atomic.StoreInt64(&exemplarInterval, int64(d))
+}
+
+// RateLimitedExemplars returns the number of exemplars that were not
+// captured because of the interval set with SetExemplarInterval.
+func RateLimitedExemplars() int64 {
+	return atomic.LoadInt64(&rateLimitedExemplars)
+}
+
+// exemplarRateLimited reports whether the exemplar of a value recorded at t
+// is not captured because prev, the current exemplar of its bucket, was
+// captured less than the interval set with SetExemplarInterval before.
+func exemplarRateLimited(prev *metricdata.Exemplar, t time.Time) bool {
+	d := time.Duration(atomic.LoadInt64(&exemplarInterval))
+	if d <= 0 || prev == nil || t.Sub(prev.Timestamp) >= d {
+		return false
+	}
+	atomic.AddInt64(&rateLimitedExemplars, 1)
+	return true
+}
+
+// attachmentSize estimates the memory retained by attachments.
+func attachmentSize(attachments map[string]interface{}) int64 {
+	var size int64
+	for k, v := range attachments {
+		size += int64(len(k))
+		switch v := v.(type) {
+		case string:
+			size += int64(len(v))
+		case []byte:
+			size += int64(len(v))
+		case nil:
+		default:
+			size += int64(reflect.TypeOf(v).Size())
+		}
+	}
+	return size
+}
+
+func getExemplar(v float64, attachments map[string]interface{}, t time.Time) *metricdata.Exemplar {
+	if len(attachments) == 0 || !exemplarsEnabled() {
+		return nil
+	}
+	if f, _ := exemplarFilter.Load().(ExemplarFilter); f != nil && !f(v, attachments) {
+		return nil
+	}
+	if max := atomic.LoadInt64(&maxAttachmentSize); max > 0 && attachmentSize(attachments) > max {
+		atomic.AddInt64(&oversizedAttachments, 1)
+		return nil
+	}
+	return &metricdata.Exemplar{
+		Value:       v,
+		Timestamp:   t,
+		Attachments: attachments,
+	}
+}
+
+// copyExemplar returns a copy of e, sharing its attachments, or nil.
+func copyExemplar(e *metricdata.Exemplar) *metricdata.Exemplar {
+	if e == nil {
+		return nil
+	}
+	c := *e
+	return &c
+}
+
+// copyExemplars returns a copy of exemplars and of the exemplars it holds.
+func copyExemplars(exemplars []*metricdata.Exemplar) []*metricdata.Exemplar {
+	if exemplars == nil {
+		return nil
+	}
+	c := make([]*metricdata.Exemplar, len(exemplars))
+	for i, e := range exemplars {
+		c[i] = copyExemplar(e)
+	}
+	return c
+}
@@ -16,6 +16,12 @@ package view
 
 // Exporter exports the collected records as view data.
 //
+// Exporters registered with RegisterExporter receive the data of every
+// registered view once per reporting period (see SetReportingPeriod), which
+// allows shipping view data to any backend, such as logs or another metrics
+// system. Meters created with NewMeter report to their own exporters only,
+// see Meter.RegisterExporter.
+//
 // The ExportView method should return quickly; if an
 // Exporter takes a significant amount of time to
 // process a Data, that work should be done on another goroutine.
@@ -43,3 +49,26 @@ func RegisterExporter(e Exporter) {
 func UnregisterExporter(e Exporter) {
 	defaultWorker.UnregisterExporter(e)
 }
+
+// ErrorExporter is an Exporter that reports the errors of exporting view
+// data. If a registered exporter implements ErrorExporter, ExportViewErr is
+// called instead of ExportView, and the errors it returns are passed to the
+// handler set with SetReportingErrorHandler.
+type ErrorExporter interface {
+	Exporter
+	ExportViewErr(viewData *Data) error
+}
+
+// SetReportingErrorHandler sets the handler of the errors of reporting view
+// data to the registered exporters, so that they can be logged or alerted on.
+// The handler receives the errors returned by ErrorExporters and, as
+// errors, the panics of exporters. Panics are always recovered so that
+// reporting continues with the next exporter and period. Without a handler,
+// export errors are dropped and panics are logged with the standard logger.
+//
+// The handler is called from the reporting goroutine and should return
+// quickly, and must not register or unregister exporters. Passing nil
+// removes the handler.
+func SetReportingErrorHandler(h func(error)) {
+	defaultWorker.SetReportingErrorHandler(h)
+}
@@ -0,0 +1,132 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package view
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/cloudian/opencensus-go/tag"
+)
+
+// Histogram is a histogram in the Prometheus data model, such as one parsed
+// from the scrape of another process.
+type Histogram struct {
+	// Buckets are the buckets of the histogram in increasing order of their
+	// upper bound. Their counts are cumulative: each counts the observations
+	// less than or equal to its upper bound. A last bucket with an infinite
+	// upper bound may be included; its count must then equal Count.
+	Buckets []HistogramBucket
+	Sum     float64 // sum of the observations
+	Count   int64   // number of observations
+}
+
+// HistogramBucket is a bucket of a Histogram.
+type HistogramBucket struct {
+	UpperBound      float64
+	CumulativeCount int64
+}
+
+// ImportHistogram adds the observations of h to the row of the registered
+// Distribution view with the given name whose tags are tags, creating the row
+// if needed. This allows a process to aggregate the histograms scraped from
+// others, for example from its child processes. Tags whose keys are not
+// TagKeys of the view are ignored.
+//
+// The upper bounds of h must be the bucket bounds of the view, and the view
+// should be UpperInclusive to match the Prometheus semantics of buckets.
+// As histograms do not keep the minimum, maximum and variance of their
+// observations, Min and Max of the row are left unchanged and the
+// observations of h are assumed to all equal their mean when updating
+// SumOfSquaredDev.
+//
+// Imported histograms are added to the row. To import successive scrapes of
+// the same cumulative histogram, import the increase since the previous
+// scrape.
+func ImportHistogram(viewName string, tags []tag.Tag, h Histogram) error {
+	return defaultWorker.ImportHistogram(viewName, tags, h)
+}
+
+// ImportHistogram adds the observations of h to the row of the registered
+// Distribution view with the given name whose tags are tags.
+func (w *worker) ImportHistogram(viewName string, tags []tag.Tag, h Histogram) error {
+	req := &importHistogramReq{
+		v:    viewName,
+		tags: tags,
+		h:    h,
+		err:  make(chan error),
+	}
+	w.c <- req
+	return <-req.err
+}
+
+// bucketCounts returns the non-cumulative counts of the buckets of h if its
+// bounds are the given bounds.
+func (h Histogram) bucketCounts(bounds []float64) ([]int64, error) {
+	buckets := h.Buckets
+	if n := len(buckets); n > 0 && math.IsInf(buckets[n-1].UpperBound, 1) {
+		if buckets[n-1].CumulativeCount != h.Count {
+			return nil, fmt.Errorf("count %d of the +Inf bucket differs from the histogram count %d", buckets[n-1].CumulativeCount, h.Count)
+		}
+		buckets = buckets[:n-1]
+	}
+	if len(buckets) != len(bounds) {
+		return nil, fmt.Errorf("histogram has %d bucket bounds; the view has %d", len(buckets), len(bounds))
+	}
+	counts := make([]int64, len(bounds)+1)
+	var prev int64
+	for i, b := range buckets {
+		if b.UpperBound != bounds[i] {
+			return nil, fmt.Errorf("histogram bucket bound %v differs from the view bucket bound %v", b.UpperBound, bounds[i])
+		}
+		if b.CumulativeCount < prev {
+			return nil, fmt.Errorf("histogram bucket counts are not cumulative at bound %v", b.UpperBound)
+		}
+		counts[i] = b.CumulativeCount - prev
+		prev = b.CumulativeCount
+	}
+	if h.Count < prev {
+		return nil, fmt.Errorf("histogram count %d is less than its bucket counts", h.Count)
+	}
+	counts[len(bounds)] = h.Count - prev
+	return counts, nil
+}
+
+// addHistogram adds count observations summing to sum, distributed in the
+// buckets according to counts.
+func (a *DistributionData) addHistogram(counts []int64, count int64, sum float64) {
+	if count == 0 {
+		return
+	}
+	if len(a.CountPerBucket) != len(a.bounds)+1 {
+		a.resizeBuckets()
+	}
+	for i, c := range counts {
+		a.CountPerBucket[i] += c
+	}
+	mean := sum / float64(count)
+	n := a.Count + count
+	if a.Count == 0 {
+		a.Mean, a.meanErr = mean, 0
+	} else {
+		// Combine the variances as for parallel aggregation, with a zero
+		// variance for the imported observations.
+		delta := (mean - a.Mean) - a.meanErr
+		a.SumOfSquaredDev, a.sumOfSquaredDevErr = twoSum(a.SumOfSquaredDev, a.sumOfSquaredDevErr+delta*delta*float64(a.Count)*float64(count)/float64(n))
+		a.Mean, a.meanErr = twoSum(a.Mean, a.meanErr+delta*float64(count)/float64(n))
+	}
+	a.Count = n
+}
@@ -0,0 +1,113 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package view
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/cloudian/opencensus-go/stats"
+	"github.com/cloudian/opencensus-go/tag"
+)
+
+func TestImportHistogram(t *testing.T) {
+	restart()
+
+	k := tag.MustNewKey("job")
+	m := stats.Float64("TestImportHistogram/latency", "", stats.UnitMilliseconds)
+	agg := Distribution(1, 5)
+	agg.UpperInclusive = true
+	v := &View{Name: "TestImportHistogram/latency", Measure: m, TagKeys: []tag.Key{k}, Aggregation: agg}
+	if err := Register(v); err != nil {
+		t.Fatalf("Register() = %v", err)
+	}
+	defer Unregister(v)
+
+	tags := []tag.Tag{{Key: k, Value: "child"}}
+	h1 := Histogram{
+		Buckets: []HistogramBucket{{1, 2}, {5, 3}, {math.Inf(1), 4}},
+		Sum:     12,
+		Count:   4,
+	}
+	h2 := Histogram{
+		Buckets: []HistogramBucket{{1, 1}, {5, 1}},
+		Sum:     20,
+		Count:   2,
+	}
+	for _, h := range []Histogram{h1, h2} {
+		if err := ImportHistogram(v.Name, tags, h); err != nil {
+			t.Fatalf("ImportHistogram() = %v", err)
+		}
+	}
+
+	rows, err := RetrieveDistributionData(v.Name)
+	if err != nil {
+		t.Fatalf("RetrieveDistributionData() = %v", err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("got %d rows; want 1", len(rows))
+	}
+	if !reflect.DeepEqual(rows[0].Tags, tags) {
+		t.Errorf("Tags = %v; want %v", rows[0].Tags, tags)
+	}
+	d := rows[0].Data
+	if diff := cmp.Diff(d.CountPerBucket, []int64{3, 1, 2}); diff != "" {
+		t.Errorf("CountPerBucket differ -got +want: %s", diff)
+	}
+	if d.Count != 6 || d.Sum() != 32 {
+		t.Errorf("Count, Sum = %v, %v; want 6, 32", d.Count, d.Sum())
+	}
+	// The observations of h1 and h2 are assumed to equal their means 3 and 10.
+	if got, want := d.SumOfSquaredDev, 4*2*49.0/6; math.Abs(got-want) > 1e-9 {
+		t.Errorf("SumOfSquaredDev = %v; want %v", got, want)
+	}
+}
+
+func TestImportHistogramErrors(t *testing.T) {
+	restart()
+
+	m := stats.Float64("TestImportHistogramErrors/latency", "", stats.UnitMilliseconds)
+	dist := &View{Name: "TestImportHistogramErrors/distribution", Measure: m, Aggregation: Distribution(1, 5)}
+	count := &View{Name: "TestImportHistogramErrors/count", Measure: m, Aggregation: Count()}
+	if err := Register(dist, count); err != nil {
+		t.Fatalf("Register() = %v", err)
+	}
+	defer Unregister(dist, count)
+
+	tests := []struct {
+		name string
+		view string
+		h    Histogram
+	}{
+		{"unregistered view", "TestImportHistogramErrors/unknown", Histogram{}},
+		{"not a distribution", count.Name, Histogram{}},
+		{"different bounds", dist.Name, Histogram{Buckets: []HistogramBucket{{1, 1}, {10, 1}}, Count: 1}},
+		{"missing bound", dist.Name, Histogram{Buckets: []HistogramBucket{{1, 1}}, Count: 1}},
+		{"not cumulative", dist.Name, Histogram{Buckets: []HistogramBucket{{1, 2}, {5, 1}}, Count: 2}},
+		{"inconsistent count", dist.Name, Histogram{Buckets: []HistogramBucket{{1, 1}, {5, 1}, {math.Inf(1), 2}}, Count: 1}},
+	}
+	for _, tt := range tests {
+		if err := ImportHistogram(tt.view, nil, tt.h); err == nil {
+			t.Errorf("%s: ImportHistogram() = nil; want error", tt.name)
+		}
+	}
+	if rows, _ := RetrieveData(dist.Name); len(rows) != 0 {
+		t.Errorf("rows after failed imports = %v; want none", rows)
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package view
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudian/opencensus-go/metric/metricdata"
+)
+
+// ViewCardinalityName is the name of the internal gauge reporting the number
+// of rows, i.e. distinct tag sets, collected for each registered view.
+// It is only reported after RegisterInternalViews is called.
+const ViewCardinalityName = "opencensus.io/stats/view_cardinality"
+
+var viewCardinalityDescriptor = metricdata.Descriptor{
+	Name:        ViewCardinalityName,
+	Description: "Number of distinct tag sets collected per view",
+	Unit:        metricdata.UnitDimensionless,
+	Type:        metricdata.TypeGaugeInt64,
+	LabelKeys:   []metricdata.LabelKey{{Key: "view"}},
+}
+
+// RecordsDroppedCancelledName is the name of the internal counter of the
+// recordings skipped because their context was done, see
+// stats.SkipIfCancelled. Each Meter counts the recordings to it, since its
+// creation. It is only reported after RegisterInternalViews is called.
+const RecordsDroppedCancelledName = "opencensus.io/stats/records_dropped_cancelled"
+
+var recordsDroppedCancelledDescriptor = metricdata.Descriptor{
+	Name:        RecordsDroppedCancelledName,
+	Description: "Number of recordings skipped because their context was done",
+	Unit:        metricdata.UnitDimensionless,
+	Type:        metricdata.TypeCumulativeInt64,
+}
+
+// recordsDroppedCancelledMetric returns the counter of the recordings to w
+// skipped because their context was done.
+func (w *worker) recordsDroppedCancelledMetric(now time.Time) *metricdata.Metric {
+	n := atomic.LoadInt64(&w.recordsDroppedCancelled)
+	return &metricdata.Metric{
+		Descriptor: recordsDroppedCancelledDescriptor,
+		TimeSeries: []*metricdata.TimeSeries{{
+			Points:    []metricdata.Point{metricdata.NewInt64Point(now, n)},
+			StartTime: w.created,
+		}},
+		Resource: w.r,
+	}
+}
+
+// viewCardinalityMetric returns the view cardinality gauge for the given
+// views, or nil if there are none. The caller must hold w.mu.
+func (w *worker) viewCardinalityMetric(now time.Time) *metricdata.Metric {
+	if len(w.views) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(w.views))
+	for name := range w.views {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	ts := make([]*metricdata.TimeSeries, 0, len(names))
+	for _, name := range names {
+		n := len(w.views[name].collector.signatures)
+		ts = append(ts, &metricdata.TimeSeries{
+			LabelValues: []metricdata.LabelValue{metricdata.NewLabelValue(name)},
+			Points:      []metricdata.Point{metricdata.NewInt64Point(now, int64(n))},
+			StartTime:   now,
+		})
+	}
+	return &metricdata.Metric{
+		Descriptor: viewCardinalityDescriptor,
+		TimeSeries: ts,
+		Resource:   w.r,
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package view
+
+import (
+	"fmt"
+
+	"github.com/cloudian/opencensus-go/stats/internal"
+)
+
+// RegisterLazy registers the views returned by fn once their measures are
+// first recorded, for libraries that define many views speculatively. Until
+// then, the views are neither canonicalized nor registered, so that views of
+// measures that are never recorded cost little more than their definition.
+// Once a measure is recorded, its views are registered as with Register and
+// the recording that triggered their registration is aggregated into them;
+// they are then indistinguishable from views registered with Register, for
+// example for RetrieveData and Unregister.
+//
+// fn is called once, before RegisterLazy returns. RegisterLazy only returns
+// an error for views without a measure; the errors of registering the views
+// later, for example because a different view with the same name is
+// registered, are passed to the handler set with SetReportingErrorHandler.
+func RegisterLazy(fn func() []*View) error {
+	return defaultWorker.RegisterLazy(fn)
+}
+
+// RegisterLazy registers the views returned by fn once their measures are
+// first recorded.
+func (w *worker) RegisterLazy(fn func() []*View) error {
+	views := fn()
+	for _, v := range views {
+		if v == nil {
+			return fmt.Errorf("cannot register nil view lazily")
+		}
+		if v.Measure == nil {
+			return fmt.Errorf("cannot register view %q lazily: no measure set", v.Name)
+		}
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, v := range views {
+		ref := w.getMeasureRef(v.Measure.Name())
+		if ref.lazy == nil {
+			// Measurements are only delivered to the worker for subscribed
+			// measures.
+			internal.SubscriptionReporter(ref.measure)
+		}
+		ref.lazy = append(ref.lazy, v)
+	}
+	return nil
+}
+
+// registerLazy registers the pending lazy views of the measure of ref. The
+// worker must be locked.
+func (w *worker) registerLazy(ref *measureRef) {
+	views := ref.lazy
+	ref.lazy = nil
+	for _, v := range views {
+		if err := v.canonicalize(); err != nil {
+			w.reportError(err)
+			continue
+		}
+		vi, err := w.registerViewLocked(v)
+		if err != nil {
+			w.reportError(fmt.Errorf("%s: %v", v.Name, err))
+			continue
+		}
+		vi.subscribe()
+	}
+	internal.UnsubscriptionReporter(ref.measure)
+}
+
+// reportError passes err to the error handler, if any.
+func (w *worker) reportError(err error) {
+	w.exportersMu.Lock()
+	defer w.exportersMu.Unlock()
+	if w.errHandler != nil {
+		w.errHandler(err)
+	}
+}
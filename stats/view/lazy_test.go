@@ -0,0 +1,75 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package view
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudian/opencensus-go/stats"
+)
+
+func TestRegisterLazy(t *testing.T) {
+	restart()
+
+	m1 := stats.Int64("TestRegisterLazy/m1", "", stats.UnitDimensionless)
+	m2 := stats.Int64("TestRegisterLazy/m2", "", stats.UnitDimensionless)
+	v1 := &View{Name: "TestRegisterLazy/v1", Measure: m1, Aggregation: Sum()}
+	v2 := &View{Name: "TestRegisterLazy/v2", Measure: m2, Aggregation: Count()}
+	calls := 0
+	err := RegisterLazy(func() []*View {
+		calls++
+		return []*View{v1, v2}
+	})
+	if err != nil {
+		t.Fatalf("RegisterLazy() = %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("RegisterLazy() called fn %d times; want 1", calls)
+	}
+	if Find(v1.Name) != nil {
+		t.Errorf("Find(%q) found view before its measure was recorded", v1.Name)
+	}
+	if _, err := RetrieveData(v1.Name); err == nil {
+		t.Errorf("RetrieveData(%q) = nil error before its measure was recorded; want error", v1.Name)
+	}
+
+	stats.Record(context.Background(), m1.M(3))
+	stats.Record(context.Background(), m1.M(4))
+
+	rows, err := RetrieveData(v1.Name)
+	if err != nil {
+		t.Fatalf("RetrieveData(%q) = %v", v1.Name, err)
+	}
+	if len(rows) != 1 || rows[0].Data.(*SumData).Value != 7 {
+		t.Errorf("RetrieveData(%q) = %v; want a sum of 7", v1.Name, rows)
+	}
+	if Find(v2.Name) != nil {
+		t.Errorf("Find(%q) found view whose measure was not recorded", v2.Name)
+	}
+	Unregister(v1)
+	if Find(v1.Name) != nil {
+		t.Errorf("Find(%q) found view after Unregister", v1.Name)
+	}
+}
+
+func TestRegisterLazyNoMeasure(t *testing.T) {
+	restart()
+
+	if err := RegisterLazy(func() []*View { return []*View{{Name: "TestRegisterLazyNoMeasure"}} }); err == nil {
+		t.Error("RegisterLazy() = nil error for a view without a measure; want error")
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"time"
+
+	"github.com/cloudian/opencensus-go/tag"
+)
+
+// Rate indicates that a view reports the per-second rate of increase of the
+// Sum or Count view named sourceView over the last window, for dashboards
+// that want a pre-computed rate of a counter. The rate of each row of the
+// source view is exported as a float64 gauge, and RetrieveData returns it as
+// the Value of a *LastValueData.
+//
+// The view must have the Measure and the TagKeys of the source view; the
+// values recorded for the measure are not aggregated into the view itself.
+// Instead, the cumulative values of the rows of the source view are sampled
+// whenever the data of the Meter is read, that is by metric readers such as
+// the Prometheus exporter, by RetrieveData and once per reporting period. The
+// rate of a row is the increase between the latest sample at least window
+// old, or the first sample of the row if there is none, and the current
+// value, divided by the seconds between them. A decrease of the cumulative
+// value, for example because the source view was re-registered, is treated
+// as a counter reset, the value after the reset being the increase since.
+func Rate(sourceView string, window time.Duration) *Aggregation {
+	return &Aggregation{
+		Type:       AggTypeRate,
+		rateSource: sourceView,
+		rateWindow: window,
+		newData: func(_ time.Time) AggregationData {
+			return &LastValueData{}
+		},
+	}
+}
+
+// rateSample is the increase of a row of the source view of a rate view since
+// it was first sampled, as of t.
+type rateSample struct {
+	t     time.Time
+	total float64
+}
+
+// rateRow is the state of the rate of a row of the source view.
+type rateRow struct {
+	last    float64      // the last cumulative value of the source row
+	total   float64      // the increase of the source row, accounting for resets
+	samples []rateSample // the samples within the window, preceded by the base of the rate
+}
+
+// rateTracker computes the rates of the rows of the source view of a view
+// using the Rate aggregation.
+type rateTracker struct {
+	rows    map[string]*rateRow
+	sampled time.Time // the time of the last sampling, if any
+}
+
+// observe adds the sample of the cumulative value of the row sig of the
+// source view at t and returns its rate over window.
+func (r *rateTracker) observe(sig string, value float64, t time.Time, window time.Duration) float64 {
+	row, ok := r.rows[sig]
+	switch {
+	case ok:
+		delta := value - row.last
+		if delta < 0 {
+			// The counter was reset.
+			delta = value
+		}
+		row.total += delta
+		row.last = value
+	case r.sampled.IsZero():
+		// The increase before the first sampling is unknown.
+		row = &rateRow{last: value}
+		r.rows[sig] = row
+	default:
+		// The row was created since the last sampling.
+		row = &rateRow{last: value, total: value, samples: []rateSample{{t: r.sampled}}}
+		r.rows[sig] = row
+	}
+	row.samples = append(row.samples, rateSample{t: t, total: row.total})
+
+	// Keep the latest sample at least window old as the base of the rate.
+	start := t.Add(-window)
+	i := 0
+	for i+1 < len(row.samples) && !row.samples[i+1].t.After(start) {
+		i++
+	}
+	row.samples = row.samples[i:]
+	base := row.samples[0]
+	elapsed := t.Sub(base.t)
+	if elapsed <= 0 {
+		return 0
+	}
+	return (row.total - base.total) / elapsed.Seconds()
+}
+
+func (v *viewInternal) isRate() bool {
+	return v.view.Aggregation.Type == AggTypeRate
+}
+
+// updateRates updates the rows of the views using the Rate aggregation from
+// their source views. The worker must be locked.
+func (w *worker) updateRates(now time.Time) {
+	for _, v := range w.views {
+		if v.isRate() && v.isSubscribed() {
+			w.updateRate(v, now)
+		}
+	}
+}
+
+// updateRate updates the rows of the rate view v. Rows the source view no
+// longer has are dropped. The worker must be locked.
+func (w *worker) updateRate(v *viewInternal, now time.Time) {
+	a := v.view.Aggregation
+	if v.rate == nil {
+		v.rate = &rateTracker{rows: make(map[string]*rateRow)}
+	}
+	rows := make(map[string]AggregationData)
+	if src, ok := w.views[a.rateSource]; ok && src.isSubscribed() && sameTagKeys(src.tagKeys, v.tagKeys) {
+		for sig, data := range src.collector.signatures {
+			var value float64
+			switch d := data.(type) {
+			case *SumData:
+				value = d.Value
+			case *CountData:
+				value = float64(d.Value)
+			default:
+				continue
+			}
+			rows[sig] = &LastValueData{Value: v.rate.observe(sig, value, now, a.rateWindow)}
+		}
+	}
+	for sig := range v.rate.rows {
+		if _, ok := rows[sig]; !ok {
+			delete(v.rate.rows, sig)
+		}
+	}
+	v.rate.sampled = now
+	v.collector.signatures = rows
+}
+
+func sameTagKeys(a, b []tag.Key) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
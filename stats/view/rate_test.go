@@ -0,0 +1,115 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cloudian/opencensus-go/metric/metricdata"
+	"github.com/cloudian/opencensus-go/stats"
+	"github.com/cloudian/opencensus-go/tag"
+)
+
+func TestRate(t *testing.T) {
+	t0 := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	fc := &fakeClock{now: t0}
+	SetClock(fc)
+	defer SetClock(nil)
+	restart()
+	defer restart()
+
+	k := tag.MustNewKey("k")
+	m := stats.Int64("measure/TestRate", "desc", stats.UnitBytes)
+	src := &View{Name: "TestRate/bytes", Measure: m, TagKeys: []tag.Key{k}, Aggregation: Sum()}
+	rate := &View{Name: "TestRate/bytes_rate", Measure: m, TagKeys: []tag.Key{k}, Aggregation: Rate(src.Name, 10*time.Second)}
+	if err := Register(src, rate); err != nil {
+		t.Fatalf("cannot register: %v", err)
+	}
+	ctx, _ := tag.New(context.Background(), tag.Upsert(k, "a"))
+	read := func() float64 {
+		t.Helper()
+		rows, err := RetrieveData(rate.Name)
+		if err != nil {
+			t.Fatalf("RetrieveData: %v", err)
+		}
+		if len(rows) != 1 {
+			t.Fatalf("got %d rows; want 1", len(rows))
+		}
+		return rows[0].Data.(*LastValueData).Value
+	}
+
+	if _, err := RetrieveData(rate.Name); err != nil {
+		t.Fatalf("RetrieveData: %v", err)
+	}
+	tests := []struct {
+		label string
+		value int64
+		want  float64
+	}{
+		// The row appeared after the first sampling, so its base is 0 at t0.
+		{"first window", 10, 10.0 / 5},
+		{"whole window", 20, 30.0 / 10},
+		// The base moves to the sample of t0+5s.
+		{"sliding window", 10, 30.0 / 10},
+		// The sum drops from 40 to 5: the increase since the reset is 5.
+		{"counter reset", -35, (5.0 + 10) / 10},
+		{"after reset", 5, (5.0 + 5) / 10},
+	}
+	for _, tt := range tests {
+		stats.Record(ctx, m.M(tt.value))
+		fc.Advance(5 * time.Second)
+		if got := read(); got != tt.want {
+			t.Errorf("%s: rate = %v; want %v", tt.label, got, tt.want)
+		}
+	}
+
+	var found bool
+	for _, metric := range defaultWorker.Read() {
+		if metric.Descriptor.Name != rate.Name {
+			continue
+		}
+		found = true
+		if metric.Descriptor.Type != metricdata.TypeGaugeFloat64 {
+			t.Errorf("metric type = %v; want %v", metric.Descriptor.Type, metricdata.TypeGaugeFloat64)
+		}
+	}
+	if !found {
+		t.Errorf("Read() has no metric %q", rate.Name)
+	}
+
+	// Rows the source no longer has are dropped.
+	Unregister(src)
+	if rows, err := RetrieveData(rate.Name); err != nil || len(rows) != 0 {
+		t.Errorf("RetrieveData() = %v, %v after unregistering the source; want no rows", rows, err)
+	}
+}
+
+func TestRateValidation(t *testing.T) {
+	restart()
+	defer restart()
+
+	m := stats.Int64("measure/TestRateValidation", "desc", stats.UnitDimensionless)
+	for _, v := range []*View{
+		{Name: "TestRateValidation/self", Measure: m, Aggregation: Rate("TestRateValidation/self", time.Second)},
+		{Name: "TestRateValidation/nosource", Measure: m, Aggregation: Rate("", time.Second)},
+		{Name: "TestRateValidation/window", Measure: m, Aggregation: Rate("TestRateValidation/count", 0)},
+	} {
+		if err := Register(v); err == nil {
+			t.Errorf("Register(%q) = nil; want error", v.Name)
+		}
+	}
+}
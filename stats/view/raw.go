@@ -0,0 +1,126 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package view
+
+import (
+	"time"
+
+	"github.com/cloudian/opencensus-go/metric/metricdata"
+	"github.com/cloudian/opencensus-go/tag"
+)
+
+// Raw indicates that the values recorded for a view are not aggregated but
+// passed on one by one to the registered exporters, for streaming exporters
+// that need every measurement, such as log exporters. Each recorded value is
+// exported right away as a Data with a single Row, holding the tags of the
+// recording and a RawData. Data.Start and Data.End are the time of the
+// recording.
+//
+// Raw views collect no rows, so they are not exported by metric exporters,
+// nor reported once per reporting period, and RetrieveData returns no rows
+// for them. Samples recorded before a raw view is registered are not
+// backfilled.
+//
+// Exporters are called on the recording path of the Meter, so that they
+// should return even more quickly than for aggregated views.
+func Raw() *Aggregation {
+	return aggRaw
+}
+
+var aggRaw = &Aggregation{
+	Type: AggTypeRaw,
+	newData: func(t time.Time) AggregationData {
+		return &RawData{Time: t}
+	},
+}
+
+// RawData is a single value recorded for a view using the Raw aggregation.
+type RawData struct {
+	Value       float64
+	Time        time.Time
+	Attachments map[string]interface{}
+}
+
+func (r *RawData) isAggregationData() bool { return true }
+
+func (r *RawData) addSample(v float64, attachments map[string]interface{}, t time.Time) {
+	r.Value, r.Attachments, r.Time = v, attachments, t
+}
+
+func (r *RawData) clone() AggregationData {
+	c := *r
+	return &c
+}
+
+func (r *RawData) equal(other AggregationData) bool {
+	r2, ok := other.(*RawData)
+	if !ok {
+		return false
+	}
+	return r.Value == r2.Value && r.Time.Equal(r2.Time)
+}
+
+func (r *RawData) toPoint(metricType metricdata.Type, t time.Time) metricdata.Point {
+	switch metricType {
+	case metricdata.TypeGaugeInt64:
+		return metricdata.NewInt64Point(r.Time, int64(r.Value))
+	case metricdata.TypeGaugeFloat64:
+		return metricdata.NewFloat64Point(r.Time, r.Value)
+	default:
+		panic("unsupported metricdata.Type")
+	}
+}
+
+// StartTime returns the time of the recording.
+func (r *RawData) StartTime() time.Time {
+	return r.Time
+}
+
+// isRaw reports whether v passes on its recorded values unaggregated.
+func (v *viewInternal) isRaw() bool {
+	return v.view.Aggregation.Type == AggTypeRaw
+}
+
+// exportRaw passes the value recorded for the raw view v with tags m on to
+// the registered exporters. The worker must be locked.
+func (w *worker) exportRaw(v *viewInternal, m *tag.Map, val float64, attachments map[string]interface{}, t time.Time) {
+	if !v.isSubscribed() || w.isPaused() {
+		return
+	}
+	if v.view.Transform != nil {
+		val = v.view.Transform(val)
+	}
+	var tags []tag.Tag
+	for _, k := range v.tagKeys {
+		if value, ok := m.Value(k); ok {
+			tags = append(tags, tag.Tag{Key: k, Value: value})
+		}
+	}
+	viewData := &Data{
+		View:  v.view,
+		Start: t,
+		End:   t,
+		Rows: []*Row{{
+			Tags: tags,
+			Data: &RawData{Value: val, Time: t, Attachments: attachments},
+		}},
+	}
+	w.exportersMu.Lock()
+	defer w.exportersMu.Unlock()
+	for e := range w.exporters {
+		w.exportView(e, viewData)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package view
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/cloudian/opencensus-go/stats"
+	"github.com/cloudian/opencensus-go/tag"
+)
+
+// rawExporter keeps the raw events it is exported.
+type rawExporter struct {
+	mu     sync.Mutex
+	events []*Data
+}
+
+func (e *rawExporter) ExportView(d *Data) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.events = append(e.events, d)
+}
+
+func TestRawAggregation(t *testing.T) {
+	w := NewMeter().(*worker)
+	go w.start()
+
+	k1 := tag.MustNewKey("k1")
+	k2 := tag.MustNewKey("k2")
+	m := stats.Float64("TestRawAggregation/m", "", stats.UnitMilliseconds)
+	v := &View{Name: "TestRawAggregation/raw", Measure: m, TagKeys: []tag.Key{k1, k2}, Aggregation: Raw()}
+	if err := w.Register(v); err != nil {
+		t.Fatalf("Register() = %v", err)
+	}
+	e := &rawExporter{}
+	w.RegisterExporter(e)
+
+	recordings := []struct {
+		mutators []tag.Mutator
+		value    float64
+		want     []tag.Tag
+	}{
+		{[]tag.Mutator{tag.Insert(k1, "a")}, 1, []tag.Tag{{Key: k1, Value: "a"}}},
+		{[]tag.Mutator{tag.Insert(k1, "a"), tag.Insert(k2, "b")}, 2, []tag.Tag{{Key: k1, Value: "a"}, {Key: k2, Value: "b"}}},
+		{[]tag.Mutator{tag.Insert(k1, "a")}, 1, []tag.Tag{{Key: k1, Value: "a"}}},
+		{nil, 3, nil},
+	}
+	for _, r := range recordings {
+		ctx, err := tag.New(context.Background(), r.mutators...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stats.RecordWithOptions(ctx, stats.WithRecorder(w), stats.WithMeasurements(m.M(r.value)))
+	}
+	if rows, err := w.RetrieveData(v.Name); err != nil || len(rows) != 0 {
+		t.Errorf("RetrieveData() = %v, %v; want no rows", rows, err)
+	}
+	w.Stop()
+	if got := w.Read(); len(got) != 0 {
+		t.Errorf("Read() = %v; want no metrics", got)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.events) != len(recordings) {
+		t.Fatalf("got %d events; want %d", len(e.events), len(recordings))
+	}
+	for i, r := range recordings {
+		d := e.events[i]
+		if d.View != v || len(d.Rows) != 1 {
+			t.Errorf("event %d = %+v; want a single row of view %q", i, d, v.Name)
+			continue
+		}
+		row := d.Rows[0]
+		if !reflect.DeepEqual(row.Tags, r.want) {
+			t.Errorf("event %d tags = %v; want %v", i, row.Tags, r.want)
+		}
+		data, ok := row.Data.(*RawData)
+		if !ok || data.Value != r.value || !data.Time.Equal(d.Start) {
+			t.Errorf("event %d data = %+v; want value %v at %v", i, row.Data, r.value, d.Start)
+		}
+	}
+}
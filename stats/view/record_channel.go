@@ -0,0 +1,145 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package view
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/cloudian/opencensus-go/stats"
+)
+
+// RecordChannelPolicy determines what happens to measurements sent to the
+// record channel while the Meter is not keeping up, see
+// SetRecordChannelPolicy.
+type RecordChannelPolicy int32
+
+// Record channel policies.
+const (
+	// RecordChannelBlock blocks senders until the Meter catches up.
+	RecordChannelBlock RecordChannelPolicy = iota
+	// RecordChannelDrop drops measurements, see RecordChannelDropped.
+	RecordChannelDrop
+)
+
+// recordChannelSize is the capacity of the record channel and of the queue
+// of measurements waiting to be aggregated.
+const recordChannelSize = 1024
+
+// recordChannel feeds the measurements sent to the record channel of a
+// worker into its queue, applying the configured policy.
+type recordChannel struct {
+	dropped int64 // access atomically
+	policy  int32 // access atomically
+
+	once  sync.Once
+	in    chan stats.Measurement
+	queue chan stats.Measurement
+	stop  chan struct{} // closed when the worker stops
+}
+
+func newRecordChannel() *recordChannel {
+	return &recordChannel{
+		queue: make(chan stats.Measurement, recordChannelSize),
+		stop:  make(chan struct{}),
+	}
+}
+
+// channel returns the record channel, starting to forward the measurements
+// sent to it on first use.
+func (rc *recordChannel) channel() chan<- stats.Measurement {
+	rc.once.Do(func() {
+		rc.in = make(chan stats.Measurement, recordChannelSize)
+		go rc.forward()
+	})
+	return rc.in
+}
+
+func (rc *recordChannel) forward() {
+	for {
+		select {
+		case m := <-rc.in:
+			if RecordChannelPolicy(atomic.LoadInt32(&rc.policy)) == RecordChannelDrop {
+				select {
+				case rc.queue <- m:
+				default:
+					atomic.AddInt64(&rc.dropped, 1)
+				}
+				continue
+			}
+			select {
+			case rc.queue <- m:
+			case <-rc.stop:
+				return
+			}
+		case <-rc.stop:
+			return
+		}
+	}
+}
+
+// RecordChannel returns a buffered channel measurements can be sent to for
+// recording without waiting for them to be aggregated. The measurements are
+// recorded without tags or attachments by the Meter's goroutine.
+// What happens to measurements sent while the Meter is not keeping up depends
+// on the policy set with SetRecordChannelPolicy.
+//
+// The channel must not be closed. Measurements sent to it after the Meter
+// stopped are not recorded.
+func RecordChannel() chan<- stats.Measurement {
+	return defaultWorker.RecordChannel()
+}
+
+// RecordChannel returns a buffered channel measurements can be sent to for
+// recording without waiting for them to be aggregated.
+func (w *worker) RecordChannel() chan<- stats.Measurement {
+	return w.rc.channel()
+}
+
+// SetRecordChannelPolicy sets the policy for measurements sent to the record
+// channel while the Meter is not keeping up. By default, senders are blocked
+// once the channel is full; with RecordChannelDrop, such measurements are
+// dropped and counted instead, see RecordChannelDropped.
+func SetRecordChannelPolicy(p RecordChannelPolicy) {
+	defaultWorker.SetRecordChannelPolicy(p)
+}
+
+// SetRecordChannelPolicy sets the policy for measurements sent to the record
+// channel while the Meter is not keeping up.
+func (w *worker) SetRecordChannelPolicy(p RecordChannelPolicy) {
+	atomic.StoreInt32(&w.rc.policy, int32(p))
+}
+
+// RecordChannelDropped returns the number of measurements sent to the record
+// channel that were dropped, see SetRecordChannelPolicy.
+func RecordChannelDropped() int64 {
+	return defaultWorker.RecordChannelDropped()
+}
+
+// RecordChannelDropped returns the number of measurements sent to the record
+// channel that were dropped.
+func (w *worker) RecordChannelDropped() int64 {
+	return atomic.LoadInt64(&w.rc.dropped)
+}
+
+// recordFromChannel records a measurement received from the record channel.
+func (w *worker) recordFromChannel(m stats.Measurement) {
+	cmd := &recordReq{
+		ms: []stats.Measurement{m},
+		t:  now(),
+	}
+	cmd.handleCommand(w)
+}
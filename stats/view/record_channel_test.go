@@ -0,0 +1,100 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package view
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cloudian/opencensus-go/stats"
+)
+
+// waitForCount waits until the count of the rows of view name reaches the
+// value returned by want.
+func waitForCount(t *testing.T, w *worker, name string, want func() int64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var got int64
+		rows, err := w.RetrieveData(name)
+		if err != nil {
+			t.Fatalf("RetrieveData() = %v", err)
+		}
+		if len(rows) == 1 {
+			got = rows[0].Data.(*CountData).Value
+		}
+		if got == want() {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("count = %d; want %d", got, want())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRecordChannel(t *testing.T) {
+	w := NewMeter().(*worker)
+	go w.start()
+	defer w.Stop()
+
+	m := stats.Int64("TestRecordChannel/m1", "", stats.UnitDimensionless)
+	v := &View{Name: "TestRecordChannel/count", Measure: m, Aggregation: Count()}
+	if err := w.Register(v); err != nil {
+		t.Fatalf("Register() = %v", err)
+	}
+
+	const n = 10 * recordChannelSize
+	ch := w.RecordChannel()
+	for i := 0; i < n; i++ {
+		ch <- m.M(1)
+	}
+	waitForCount(t, w, v.Name, func() int64 { return n })
+	if got := w.RecordChannelDropped(); got != 0 {
+		t.Errorf("RecordChannelDropped() = %d; want 0", got)
+	}
+}
+
+func TestRecordChannelDrop(t *testing.T) {
+	w := NewMeter().(*worker)
+	go w.start()
+	defer w.Stop()
+
+	m := stats.Int64("TestRecordChannelDrop/m1", "", stats.UnitDimensionless)
+	v := &View{Name: "TestRecordChannelDrop/count", Measure: m, Aggregation: Count()}
+	if err := w.Register(v); err != nil {
+		t.Fatalf("Register() = %v", err)
+	}
+	w.SetRecordChannelPolicy(RecordChannelDrop)
+
+	// Stall aggregation so that the queue overflows.
+	w.mu.Lock()
+	const n = 10 * recordChannelSize
+	ch := w.RecordChannel()
+	for i := 0; i < n; i++ {
+		ch <- m.M(1)
+	}
+	for len(ch) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	w.mu.Unlock()
+
+	// Every measurement is either aggregated or dropped.
+	waitForCount(t, w, v.Name, func() int64 { return n - w.RecordChannelDropped() })
+	if got := w.RecordChannelDropped(); got == 0 {
+		t.Error("RecordChannelDropped() = 0; want measurements to be dropped")
+	}
+}
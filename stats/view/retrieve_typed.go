@@ -0,0 +1,125 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package view
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cloudian/opencensus-go/tag"
+)
+
+// CountRow is a Row of a view with the Count aggregation.
+type CountRow struct {
+	Tags []tag.Tag
+	Data *CountData
+}
+
+// SumRow is a Row of a view with the Sum or SumGauge aggregation.
+type SumRow struct {
+	Tags []tag.Tag
+	Data *SumData
+}
+
+// DistributionRow is a Row of a view with the Distribution aggregation.
+type DistributionRow struct {
+	Tags []tag.Tag
+	Data *DistributionData
+}
+
+// LastValueRow is a Row of a view with the LastValue aggregation.
+type LastValueRow struct {
+	Tags []tag.Tag
+	Data *LastValueData
+}
+
+// RetrieveCountData is like RetrieveData, but returns an error unless the
+// view has the Count aggregation. It is intended for testing only.
+func RetrieveCountData(viewName string) ([]*CountRow, error) {
+	rows, err := retrieveTyped(defaultWorker, viewName, "count", func(d AggregationData) bool {
+		_, ok := d.(*CountData)
+		return ok
+	})
+	if err != nil {
+		return nil, err
+	}
+	typed := make([]*CountRow, len(rows))
+	for i, r := range rows {
+		typed[i] = &CountRow{Tags: r.Tags, Data: r.Data.(*CountData)}
+	}
+	return typed, nil
+}
+
+// RetrieveSumData is like RetrieveData, but returns an error unless the view
+// has the Sum or SumGauge aggregation. It is intended for testing only.
+func RetrieveSumData(viewName string) ([]*SumRow, error) {
+	rows, err := retrieveTyped(defaultWorker, viewName, "sum", func(d AggregationData) bool {
+		_, ok := d.(*SumData)
+		return ok
+	})
+	if err != nil {
+		return nil, err
+	}
+	typed := make([]*SumRow, len(rows))
+	for i, r := range rows {
+		typed[i] = &SumRow{Tags: r.Tags, Data: r.Data.(*SumData)}
+	}
+	return typed, nil
+}
+
+// RetrieveDistributionData is like RetrieveData, but returns an error unless
+// the view has the Distribution aggregation. It is intended for testing only.
+func RetrieveDistributionData(viewName string) ([]*DistributionRow, error) {
+	rows, err := retrieveTyped(defaultWorker, viewName, "distribution", func(d AggregationData) bool {
+		_, ok := d.(*DistributionData)
+		return ok
+	})
+	if err != nil {
+		return nil, err
+	}
+	typed := make([]*DistributionRow, len(rows))
+	for i, r := range rows {
+		typed[i] = &DistributionRow{Tags: r.Tags, Data: r.Data.(*DistributionData)}
+	}
+	return typed, nil
+}
+
+// RetrieveLastValueData is like RetrieveData, but returns an error unless the
+// view has the LastValue aggregation. It is intended for testing only.
+func RetrieveLastValueData(viewName string) ([]*LastValueRow, error) {
+	rows, err := retrieveTyped(defaultWorker, viewName, "last value", func(d AggregationData) bool {
+		_, ok := d.(*LastValueData)
+		return ok
+	})
+	if err != nil {
+		return nil, err
+	}
+	typed := make([]*LastValueRow, len(rows))
+	for i, r := range rows {
+		typed[i] = &LastValueRow{Tags: r.Tags, Data: r.Data.(*LastValueData)}
+	}
+	return typed, nil
+}
+
+// retrieveTyped retrieves the rows of the view registered with the given
+// name after checking with is that its aggregation produces the wanted kind
+// of data, so that mismatches are reported even if there are no rows yet.
+func retrieveTyped(w *worker, viewName, kind string, is func(AggregationData) bool) ([]*Row, error) {
+	if v := w.Find(viewName); v != nil && !is(v.Aggregation.newData(time.Time{})) {
+		return nil, fmt.Errorf("cannot retrieve %s data; view %q has aggregation %v", kind, viewName, v.Aggregation.Type)
+	}
+	return w.RetrieveData(viewName)
+}
@@ -0,0 +1,105 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package view
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/cloudian/opencensus-go/stats"
+	"github.com/cloudian/opencensus-go/tag"
+)
+
+func TestRetrieveTypedData(t *testing.T) {
+	restart()
+
+	k := tag.MustNewKey("k")
+	m := stats.Float64("TestRetrieveTypedData/m", "", stats.UnitDimensionless)
+	count := &View{Name: "TestRetrieveTypedData/count", Measure: m, TagKeys: []tag.Key{k}, Aggregation: Count()}
+	sum := &View{Name: "TestRetrieveTypedData/sum", Measure: m, TagKeys: []tag.Key{k}, Aggregation: Sum()}
+	dist := &View{Name: "TestRetrieveTypedData/distribution", Measure: m, TagKeys: []tag.Key{k}, Aggregation: Distribution(2)}
+	last := &View{Name: "TestRetrieveTypedData/last_value", Measure: m, TagKeys: []tag.Key{k}, Aggregation: LastValue()}
+	if err := Register(count, sum, dist, last); err != nil {
+		t.Fatalf("Register() = %v", err)
+	}
+	defer Unregister(count, sum, dist, last)
+
+	ctx, _ := tag.New(context.Background(), tag.Upsert(k, "v"))
+	stats.Record(ctx, m.M(1), m.M(3))
+	wantTags := []tag.Tag{{Key: k, Value: "v"}}
+
+	countRows, err := RetrieveCountData(count.Name)
+	if err != nil {
+		t.Fatalf("RetrieveCountData() = %v", err)
+	}
+	if len(countRows) != 1 || countRows[0].Data.Value != 2 || !reflect.DeepEqual(countRows[0].Tags, wantTags) {
+		t.Errorf("RetrieveCountData() = %+v; want a single row with count 2", countRows)
+	}
+
+	sumRows, err := RetrieveSumData(sum.Name)
+	if err != nil {
+		t.Fatalf("RetrieveSumData() = %v", err)
+	}
+	if len(sumRows) != 1 || sumRows[0].Data.Value != 4 || !reflect.DeepEqual(sumRows[0].Tags, wantTags) {
+		t.Errorf("RetrieveSumData() = %+v; want a single row with sum 4", sumRows)
+	}
+
+	distRows, err := RetrieveDistributionData(dist.Name)
+	if err != nil {
+		t.Fatalf("RetrieveDistributionData() = %v", err)
+	}
+	if len(distRows) != 1 || !reflect.DeepEqual(distRows[0].Data.CountPerBucket, []int64{1, 1}) || !reflect.DeepEqual(distRows[0].Tags, wantTags) {
+		t.Errorf("RetrieveDistributionData() = %+v; want a single row with bucket counts [1 1]", distRows)
+	}
+
+	lastRows, err := RetrieveLastValueData(last.Name)
+	if err != nil {
+		t.Fatalf("RetrieveLastValueData() = %v", err)
+	}
+	if len(lastRows) != 1 || lastRows[0].Data.Value != 3 || !reflect.DeepEqual(lastRows[0].Tags, wantTags) {
+		t.Errorf("RetrieveLastValueData() = %+v; want a single row with value 3", lastRows)
+	}
+}
+
+func TestRetrieveTypedDataMismatch(t *testing.T) {
+	restart()
+
+	m := stats.Float64("TestRetrieveTypedDataMismatch/m", "", stats.UnitDimensionless)
+	count := &View{Name: "TestRetrieveTypedDataMismatch/count", Measure: m, Aggregation: Count()}
+	sum := &View{Name: "TestRetrieveTypedDataMismatch/sum", Measure: m, Aggregation: Sum()}
+	if err := Register(count, sum); err != nil {
+		t.Fatalf("Register() = %v", err)
+	}
+	defer Unregister(count, sum)
+
+	// Mismatches are reported before anything is recorded.
+	if _, err := RetrieveSumData(count.Name); err == nil {
+		t.Error("RetrieveSumData() of a count view = nil error; want error")
+	}
+	if _, err := RetrieveDistributionData(count.Name); err == nil {
+		t.Error("RetrieveDistributionData() of a count view = nil error; want error")
+	}
+	if _, err := RetrieveLastValueData(sum.Name); err == nil {
+		t.Error("RetrieveLastValueData() of a sum view = nil error; want error")
+	}
+	if _, err := RetrieveCountData(sum.Name); err == nil {
+		t.Error("RetrieveCountData() of a sum view = nil error; want error")
+	}
+	if _, err := RetrieveCountData("TestRetrieveTypedDataMismatch/unregistered"); err == nil {
+		t.Error("RetrieveCountData() of an unregistered view = nil error; want error")
+	}
+}
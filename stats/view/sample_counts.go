@@ -0,0 +1,92 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package view
+
+import (
+	"time"
+
+	"github.com/cloudian/opencensus-go/metric/metricdata"
+)
+
+// SampleCountSuffix is appended to the metric name of a view for the
+// companion counter of the samples recorded for it, see SetSampleCounting.
+const SampleCountSuffix = "_samples_total"
+
+// SetSampleCounting enables or disables counting the samples recorded for
+// each row of the registered views. While enabled, metric exporters receive
+// for each view a companion cumulative int64 metric named after the metric of
+// the view with SampleCountSuffix appended, for example
+// "latency_samples_total", with the same labels and one time series per tag
+// set, counting the values recorded for the tag set. This reveals how often
+// views are updated, in particular LastValue and Gauge views, for example
+// with the Prometheus rate function.
+//
+// The counts start when counting is enabled, or when the view is
+// registered, and are reset along with the rows of the view. Views using the
+// Raw aggregation are not counted. Counting is disabled by default.
+func SetSampleCounting(enabled bool) {
+	defaultWorker.SetSampleCounting(enabled)
+}
+
+// SetSampleCounting enables or disables counting the samples recorded for
+// each row of the registered views.
+func (w *worker) SetSampleCounting(enabled bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.sampleCounting = enabled
+	for _, v := range w.views {
+		v.collector.countSamples(enabled)
+	}
+}
+
+// countSamples enables or disables counting the samples added to the rows
+// of c.
+func (c *collector) countSamples(enabled bool) {
+	switch {
+	case !enabled:
+		c.samples = nil
+	case c.samples == nil && c.signatures != nil:
+		c.samples = make(map[string]int64)
+	}
+}
+
+// sampleCountMetric returns the companion counter of the samples recorded
+// for v, or nil if v has no rows. The worker must be locked.
+func (w *worker) sampleCountMetric(v *viewInternal, now time.Time) *metricdata.Metric {
+	if len(v.collector.samples) == 0 {
+		return nil
+	}
+	desc := *v.metricDescriptor
+	desc.Name += SampleCountSuffix
+	desc.Description = "Number of samples recorded for " + v.view.Name
+	desc.Unit = metricdata.UnitDimensionless
+	desc.Type = metricdata.TypeCumulativeInt64
+	start := w.viewStartTimes[v]
+	ts := make([]*metricdata.TimeSeries, 0, len(v.collector.samples))
+	for sig, n := range v.collector.samples {
+		row := &Row{Tags: decodeTags([]byte(sig), v.tagKeys)}
+		ts = append(ts, &metricdata.TimeSeries{
+			Points:      []metricdata.Point{metricdata.NewInt64Point(now, n)},
+			LabelValues: toLabelValues(row, desc.LabelKeys),
+			StartTime:   start,
+		})
+	}
+	return &metricdata.Metric{
+		Descriptor: desc,
+		TimeSeries: ts,
+		Resource:   w.r,
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cloudian/opencensus-go/stats"
+	"github.com/cloudian/opencensus-go/tag"
+)
+
+// ViewSpec is the declarative description of a view, with plain fields so
+// that it can be loaded from configuration files, see RegisterSpecs.
+type ViewSpec struct {
+	// Name is the name of the view; it defaults to the name of the measure.
+	Name string
+	// Description is the description of the view; it defaults to the
+	// description of the measure.
+	Description string
+	// Measure is the name of the measure of the view, which must have been
+	// created with stats.Int64 or stats.Float64, see stats.FindMeasure.
+	Measure string
+	// Aggregation is the kind of the aggregation of the view, one of
+	// "count", "sum", "sum_gauge", "distribution", "last_value", "gauge"
+	// and "raw", case-insensitively. The names of the AggType values, such
+	// as "LastValue", are accepted as well.
+	Aggregation string
+	// Buckets are the bucket bounds of a distribution, see Distribution.
+	Buckets []float64
+	// TagKeys are the names of the tag keys of the view.
+	TagKeys []string
+}
+
+// specAggregations are the aggregations available to ViewSpec, which need
+// no other parameters than bucket bounds.
+var specAggregations = map[AggType]func(buckets []float64) *Aggregation{
+	AggTypeCount:        func([]float64) *Aggregation { return Count() },
+	AggTypeSum:          func([]float64) *Aggregation { return Sum() },
+	AggTypeSumGauge:     func([]float64) *Aggregation { return SumGauge() },
+	AggTypeDistribution: func(buckets []float64) *Aggregation { return Distribution(buckets...) },
+	AggTypeLastValue:    func([]float64) *Aggregation { return LastValue() },
+	AggTypeGauge:        func([]float64) *Aggregation { return Gauge() },
+	AggTypeRaw:          func([]float64) *Aggregation { return Raw() },
+}
+
+// view returns the view described by s.
+func (s ViewSpec) view() (*View, error) {
+	m := stats.FindMeasure(s.Measure)
+	if m == nil {
+		return nil, fmt.Errorf("unknown measure %q", s.Measure)
+	}
+	agg, err := s.aggregation()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]tag.Key, len(s.TagKeys))
+	for i, name := range s.TagKeys {
+		if keys[i], err = tag.NewKey(name); err != nil {
+			return nil, fmt.Errorf("invalid tag key %q: %v", name, err)
+		}
+	}
+	return &View{
+		Name:        s.Name,
+		Description: s.Description,
+		TagKeys:     keys,
+		Measure:     m,
+		Aggregation: agg,
+	}, nil
+}
+
+func (s ViewSpec) aggregation() (*Aggregation, error) {
+	for t, newAgg := range specAggregations {
+		if !strings.EqualFold(s.Aggregation, aggTypeName[t]) && !strings.EqualFold(s.Aggregation, aggSuffix[t]) {
+			continue
+		}
+		if len(s.Buckets) > 0 && t != AggTypeDistribution {
+			return nil, fmt.Errorf("bucket bounds are only supported by distributions, not by %v", t)
+		}
+		return newAgg(s.Buckets), nil
+	}
+	return nil, fmt.Errorf("unknown aggregation %q", s.Aggregation)
+}
+
+// RegisterSpecs registers the views described by specs, for example loaded
+// from a configuration file, against the measures already created. The views
+// are registered independently: the returned slice holds an error for each
+// spec, in order, which is nil if its view was registered, and otherwise
+// describes why it was not, for example an unknown measure or aggregation.
+func RegisterSpecs(specs []ViewSpec) []error {
+	return defaultWorker.RegisterSpecs(specs)
+}
+
+// RegisterSpecs registers the views described by specs.
+func (w *worker) RegisterSpecs(specs []ViewSpec) []error {
+	errs := make([]error, len(specs))
+	for i, s := range specs {
+		v, err := s.view()
+		if err == nil {
+			err = w.Register(v)
+		}
+		if err != nil {
+			errs[i] = fmt.Errorf("cannot register view spec %d (measure %q): %v", i, s.Measure, err)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,66 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"testing"
+
+	"github.com/cloudian/opencensus-go/stats"
+)
+
+func TestRegisterSpecs(t *testing.T) {
+	restart()
+
+	latency := stats.Float64("TestRegisterSpecs/latency", "request latency", stats.UnitMilliseconds)
+	stats.Int64("TestRegisterSpecs/requests", "requests", stats.UnitDimensionless)
+	specs := []ViewSpec{
+		{Measure: "TestRegisterSpecs/latency", Aggregation: "distribution", Buckets: []float64{10, 100}, TagKeys: []string{"method"}},
+		{Name: "TestRegisterSpecs/requests_count", Measure: "TestRegisterSpecs/requests", Aggregation: "Count"},
+		{Name: "TestRegisterSpecs/last_latency", Measure: "TestRegisterSpecs/latency", Aggregation: "last_value"},
+		{Name: "TestRegisterSpecs/invalid", Measure: "TestRegisterSpecs/latency", Aggregation: "histogram"},
+		{Name: "TestRegisterSpecs/unknown", Measure: "TestRegisterSpecs/unknown", Aggregation: "count"},
+		{Name: "TestRegisterSpecs/sum_buckets", Measure: "TestRegisterSpecs/requests", Aggregation: "sum", Buckets: []float64{1}},
+		{Name: "TestRegisterSpecs/bad_key", Measure: "TestRegisterSpecs/requests", Aggregation: "sum", TagKeys: []string{""}},
+	}
+	errs := RegisterSpecs(specs)
+	if len(errs) != len(specs) {
+		t.Fatalf("RegisterSpecs() returned %d errors; want one per spec", len(errs))
+	}
+	for i, wantErr := range []bool{false, false, false, true, true, true, true} {
+		if gotErr := errs[i] != nil; gotErr != wantErr {
+			t.Errorf("spec %d: error = %v; want error: %v", i, errs[i], wantErr)
+		}
+	}
+
+	v := Find("TestRegisterSpecs/latency")
+	if v == nil {
+		t.Fatal("view of spec 0 is not registered")
+	}
+	if v.Measure.Name() != latency.Name() || v.Description != "request latency" ||
+		!v.Aggregation.Equal(Distribution(10, 100)) || len(v.TagKeys) != 1 || v.TagKeys[0].Name() != "method" {
+		t.Errorf("view of spec 0 = %+v; want a distribution of the latency by method", v)
+	}
+	if v := Find("TestRegisterSpecs/requests_count"); v == nil || v.Aggregation.Type != AggTypeCount {
+		t.Errorf("view of spec 1 = %+v; want a count", v)
+	}
+	if v := Find("TestRegisterSpecs/last_latency"); v == nil || v.Aggregation.Type != AggTypeLastValue {
+		t.Errorf("view of spec 2 = %+v; want a last value", v)
+	}
+	for _, name := range []string{"TestRegisterSpecs/invalid", "TestRegisterSpecs/unknown", "TestRegisterSpecs/sum_buckets", "TestRegisterSpecs/bad_key"} {
+		if Find(name) != nil {
+			t.Errorf("view %q of an invalid spec is registered", name)
+		}
+	}
+}
@@ -17,15 +17,19 @@ package view
 
 import (
 	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"math"
 	"reflect"
 	"sort"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/cloudian/opencensus-go/metric/metricdata"
 	"github.com/cloudian/opencensus-go/stats"
+	"github.com/cloudian/opencensus-go/stats/internal"
 	"github.com/cloudian/opencensus-go/tag"
 )
 
@@ -33,11 +37,13 @@ import (
 // Views need to be passed to the Register function before data will be
 // collected and sent to Exporters.
 type View struct {
-	Name        string // Name of View. Must be unique. If unset, will default to the name of the Measure.
+	Name        string // Name of View. Must be unique. If unset, will default to the name of the Measure; Register fails if both are empty.
+	MetricName  string // MetricName is the name of the metric exported for this view. If unset, will default to Name.
 	Description string // Description is a human-readable description for this view.
 
 	// TagKeys are the tag keys describing the grouping of this view.
 	// A single Row will be produced for each combination of associated tag values.
+	// Register sorts the keys and removes duplicates.
 	TagKeys []tag.Key
 
 	// Measure is a stats.Measure to aggregate in this view.
@@ -45,6 +51,12 @@ type View struct {
 
 	// Aggregation is the aggregation function to apply to the set of Measurements.
 	Aggregation *Aggregation
+
+	// Transform, if set, is applied to every recorded value before it is
+	// aggregated, for example to clamp negative latencies to zero or to
+	// round values. It is not applied to UniqueCount views, which do not
+	// aggregate values.
+	Transform func(float64) float64
 }
 
 // WithName returns a copy of the View with a new name. This is useful for
@@ -56,16 +68,173 @@ func (v *View) WithName(name string) *View {
 	return &vNew
 }
 
-// same compares two views and returns true if they represent the same aggregation.
+// snapshot returns a copy of v that shares no modifiable state with it.
+func (v *View) snapshot() *View {
+	c := *v
+	c.TagKeys = append([]tag.Key(nil), v.TagKeys...)
+	if v.Aggregation != nil {
+		agg := *v.Aggregation
+		agg.Buckets = append([]float64(nil), v.Aggregation.Buckets...)
+		c.Aggregation = &agg
+	}
+	return &c
+}
+
+// checkMeasureType checks that the value type of the measure of v is
+// supported by its aggregation. Aggregations that export the measured values
+// as they are need to know whether they are integers or floats; the others
+// accept measures of any value type.
+func checkMeasureType(v *View) error {
+	switch v.Aggregation.Type {
+	case AggTypeCount, AggTypeDistribution, AggTypeUniqueCount, AggTypeLastValueSummary, AggTypeRaw:
+		return nil
+	case AggTypeCustom:
+		if v.Aggregation.custom == nil {
+			return fmt.Errorf("cannot register view %q: custom aggregation not set", v.Name)
+		}
+		return nil
+	case AggTypeRate:
+		switch a := v.Aggregation; {
+		case a.rateSource == "" || a.rateSource == v.Name:
+			return fmt.Errorf("cannot register view %q: the rate needs another view as its source", v.Name)
+		case a.rateWindow <= 0:
+			return fmt.Errorf("cannot register view %q: the window of the rate must be positive", v.Name)
+		}
+		return nil
+	case AggTypeSum, AggTypeSumGauge, AggTypeLastValue, AggTypeGauge:
+		switch t := v.Measure.ValueType(); t {
+		case stats.ValueTypeInt64, stats.ValueTypeFloat64:
+			return nil
+		default:
+			return fmt.Errorf("cannot register view %q: the %v aggregation needs a measure of Int64 or Float64 values, measure %q has values of type %v", v.Name, v.Aggregation.Type, v.Measure.Name(), t)
+		}
+	default:
+		return fmt.Errorf("cannot register view %q: unsupported aggregation %v", v.Name, v.Aggregation.Type)
+	}
+}
+
+// dedupTagKeys returns the sorted keys without duplicates, each of which
+// would otherwise become a separate label of the same name. The keys are
+// copied if there are duplicates, as the slice may be shared with other views.
+func dedupTagKeys(keys []tag.Key) []tag.Key {
+	for i := 1; i < len(keys); i++ {
+		if keys[i].Name() != keys[i-1].Name() {
+			continue
+		}
+		deduped := append([]tag.Key(nil), keys[:i]...)
+		for _, k := range keys[i+1:] {
+			if k.Name() != deduped[len(deduped)-1].Name() {
+				deduped = append(deduped, k)
+			}
+		}
+		return deduped
+	}
+	return keys
+}
+
+// metricName returns the name of the metric exported for v.
+func (v *View) metricName() string {
+	if v.MetricName != "" {
+		return v.MetricName
+	}
+	return v.Name
+}
+
+// aggSuffix is the suffix MultiAggregation appends to view names for each
+// aggregation type.
+var aggSuffix = map[AggType]string{
+	AggTypeCount:            "count",
+	AggTypeSum:              "sum",
+	AggTypeDistribution:     "distribution",
+	AggTypeLastValue:        "last_value",
+	AggTypeSumGauge:         "sum_gauge",
+	AggTypeGauge:            "gauge",
+	AggTypeUniqueCount:      "unique_count",
+	AggTypeLastValueSummary: "summary",
+	AggTypeCustom:           "custom",
+	AggTypeRaw:              "raw",
+	AggTypeRate:             "rate",
+}
+
+// MultiAggregation expands v into one view per aggregation, which replaces the
+// aggregation of v. The views are named after v, or its measure if v has no
+// name, with a suffix for the aggregation type, such as "_count" or
+// "_distribution". The metric name of v, if set, gets the same suffix. An
+// error is returned if two aggregations have the same type, as their names
+// would collide.
+//
+// The returned views are not registered:
+//
+//	views, err := view.MultiAggregation(&view.View{
+//	    Name:    "example.com/latency",
+//	    Measure: latency,
+//	}, view.Count(), view.Sum(), view.Distribution(10, 100, 1000))
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	if err := view.Register(views...); err != nil {
+//	    log.Fatal(err)
+//	}
+func MultiAggregation(v *View, aggs ...*Aggregation) ([]*View, error) {
+	name := v.Name
+	if name == "" && v.Measure != nil {
+		name = v.Measure.Name()
+	}
+	views := make([]*View, 0, len(aggs))
+	seen := make(map[AggType]bool, len(aggs))
+	for _, agg := range aggs {
+		if agg == nil {
+			return nil, fmt.Errorf("cannot expand view %q: aggregation not set", name)
+		}
+		if seen[agg.Type] {
+			return nil, fmt.Errorf("cannot expand view %q: more than one %v aggregation", name, agg.Type)
+		}
+		seen[agg.Type] = true
+		suffix, ok := aggSuffix[agg.Type]
+		if !ok {
+			return nil, fmt.Errorf("cannot expand view %q: unsupported aggregation %v", name, agg.Type)
+		}
+		vNew := *v
+		vNew.Name = name + "_" + suffix
+		if v.MetricName != "" {
+			vNew.MetricName = v.MetricName + "_" + suffix
+		}
+		vNew.TagKeys = append([]tag.Key(nil), v.TagKeys...)
+		vNew.Aggregation = agg
+		views = append(views, &vNew)
+	}
+	return views, nil
+}
+
+// same compares two canonicalized views and returns true if they represent
+// the same aggregation of the same measure by the same tag keys.
 func (v *View) same(other *View) bool {
 	if v == other {
 		return true
 	}
-	if v == nil {
+	if v == nil || other == nil {
+		return false
+	}
+	if len(v.TagKeys) != len(other.TagKeys) {
 		return false
 	}
-	return reflect.DeepEqual(v.Aggregation, other.Aggregation) &&
-		v.Measure.Name() == other.Measure.Name()
+	for i, k := range v.TagKeys {
+		if k != other.TagKeys[i] {
+			return false
+		}
+	}
+	return v.Aggregation.Equal(other.Aggregation) &&
+		v.Measure.Name() == other.Measure.Name() &&
+		v.metricName() == other.metricName() &&
+		sameFunc(v.Transform, other.Transform)
+}
+
+// sameFunc reports whether f and g are both nil or the same function.
+func sameFunc(f, g func(float64) float64) bool {
+	if f == nil || g == nil {
+		return f == nil && g == nil
+	}
+	return reflect.ValueOf(f).Pointer() == reflect.ValueOf(g).Pointer()
 }
 
 // ErrNegativeBucketBounds error returned if histogram contains negative bounds.
@@ -73,39 +242,197 @@ func (v *View) same(other *View) bool {
 // Deprecated: this should not be public.
 var ErrNegativeBucketBounds = errors.New("negative bucket bounds not supported")
 
+// Validate checks that v can be registered, returning the error Register
+// would return for it, without registering it or modifying it. It is useful
+// to validate views built from configuration at startup.
+//
+// Validate does not check the limits set on the default Meter, such as
+// SetMaxRegisteredViews, nor conflicts with already registered views.
+func Validate(v *View) error {
+	if v == nil {
+		return errors.New("cannot register nil view")
+	}
+	c := *v
+	c.TagKeys = append([]tag.Key(nil), v.TagKeys...)
+	if v.Aggregation != nil {
+		a := *v.Aggregation
+		a.Buckets = append([]float64(nil), a.Buckets...)
+		c.Aggregation = &a
+	}
+	return c.normalize()
+}
+
+// canonicalMu serializes the canonicalization of views, as the same View
+// may be registered concurrently with several meters.
+var canonicalMu sync.Mutex
+
 // canonicalize canonicalizes v by setting explicit
-// defaults for Name and Description and sorting the TagKeys
+// defaults for Name and Description and sorting the TagKeys.
+// It only modifies v if it is not canonical yet, so views that are
+// registered already can be read while they are registered again.
 func (v *View) canonicalize() error {
+	canonicalMu.Lock()
+	defer canonicalMu.Unlock()
+	return v.normalize()
+}
+
+// acquireBounds makes the rows of v, which is being registered, share their
+// bucket bounds with the registered views with identical bounds. The
+// Aggregation of the View is left untouched; the collector of v uses a copy
+// with the shared bounds. Each call must be followed by a call to
+// releaseBounds once v is unregistered.
+func (v *viewInternal) acquireBounds() {
+	v.bounds = acquireBounds(v.view.Aggregation.Buckets)
+	if v.view.Aggregation.Type == AggTypeDistribution && !sameFloats(v.bounds, v.collector.a.Buckets) {
+		a := *v.collector.a
+		a.Buckets = v.bounds
+		a.newData = func(t time.Time) AggregationData {
+			return newDistributionData(&a, t)
+		}
+		v.collector.a = &a
+	}
+}
+
+// releaseBounds releases the bucket bounds of v, which was unregistered, see
+// acquireBounds.
+func (v *viewInternal) releaseBounds() {
+	releaseBounds(v.bounds)
+	v.bounds = nil
+}
+
+// sameFloats reports whether a and b are the same slice.
+func sameFloats(a, b []float64) bool {
+	return len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
+}
+
+// normalize canonicalizes v without locking.
+func (v *View) normalize() error {
 	if v.Measure == nil {
 		return fmt.Errorf("cannot register view %q: measure not set", v.Name)
 	}
 	if v.Aggregation == nil {
 		return fmt.Errorf("cannot register view %q: aggregation not set", v.Name)
 	}
-	if v.Name == "" {
+	if err := checkMeasureType(v); err != nil {
+		return err
+	}
+	if v.Name == "" && v.Measure.Name() != "" {
 		v.Name = v.Measure.Name()
 	}
-	if v.Description == "" {
+	if v.Description == "" && v.Measure.Description() != "" {
 		v.Description = v.Measure.Description()
 	}
 	if err := checkViewName(v.Name); err != nil {
 		return err
 	}
-	sort.Slice(v.TagKeys, func(i, j int) bool {
+	if v.MetricName != "" {
+		if err := checkViewName(v.MetricName); err != nil {
+			return fmt.Errorf("cannot register view %q: invalid metric name: %v", v.Name, err)
+		}
+	}
+	byName := func(i, j int) bool {
 		return v.TagKeys[i].Name() < v.TagKeys[j].Name()
-	})
-	sort.Float64s(v.Aggregation.Buckets)
+	}
+	if !sort.SliceIsSorted(v.TagKeys, byName) {
+		sort.Slice(v.TagKeys, byName)
+	}
+	if keys := dedupTagKeys(v.TagKeys); len(keys) != len(v.TagKeys) {
+		v.TagKeys = keys
+	}
+	if !sort.Float64sAreSorted(v.Aggregation.Buckets) {
+		// Sort a copy; the original slice may be shared with other views.
+		v.Aggregation.Buckets = append([]float64(nil), v.Aggregation.Buckets...)
+		sort.Float64s(v.Aggregation.Buckets)
+	}
 	for _, b := range v.Aggregation.Buckets {
 		if b < 0 {
 			return ErrNegativeBucketBounds
 		}
 	}
 	// drop 0 bucket silently.
-	v.Aggregation.Buckets = dropZeroBounds(v.Aggregation.Buckets...)
+	if b := dropZeroBounds(v.Aggregation.Buckets...); len(b) != len(v.Aggregation.Buckets) {
+		v.Aggregation.Buckets = b
+	}
+	if v.Aggregation.Type == AggTypeLastValueSummary {
+		if v.Aggregation.window <= 0 {
+			return fmt.Errorf("cannot register view %q: summary window must be positive, got %d", v.Name, v.Aggregation.window)
+		}
+		for _, q := range v.Aggregation.quantiles {
+			if q <= 0 || q > 1 {
+				return fmt.Errorf("cannot register view %q: quantile %v is not in (0, 1]", v.Name, q)
+			}
+		}
+	}
 
 	return nil
 }
 
+// internedBounds is a shared bucket bounds slice and the number of
+// registered views using it.
+type internedBounds struct {
+	bounds []float64
+	refs   int
+}
+
+var (
+	boundsMu sync.Mutex
+	// interned maps the encoded bucket bounds of the registered views to
+	// their shared slice.
+	interned = make(map[string]*internedBounds)
+)
+
+func boundsKey(bounds []float64) string {
+	key := make([]byte, 8*len(bounds))
+	for i, b := range bounds {
+		binary.LittleEndian.PutUint64(key[8*i:], math.Float64bits(b))
+	}
+	return string(key)
+}
+
+// acquireBounds returns a shared slice equal to bounds, so that views with
+// identical bucket bounds share the same backing array, and counts a
+// reference to it. The returned slice must not be modified; its capacity
+// equals its length, so appending to it allocates a new array.
+//
+// Shared slices are dropped once all their references are released with
+// releaseBounds.
+func acquireBounds(bounds []float64) []float64 {
+	if len(bounds) == 0 {
+		return bounds
+	}
+	key := boundsKey(bounds)
+
+	boundsMu.Lock()
+	defer boundsMu.Unlock()
+	ib, ok := interned[key]
+	if !ok {
+		shared := append([]float64(nil), bounds...)
+		ib = &internedBounds{bounds: shared[:len(shared):len(shared)]}
+		interned[key] = ib
+	}
+	ib.refs++
+	return ib.bounds
+}
+
+// releaseBounds releases a reference to the shared slice equal to bounds
+// acquired with acquireBounds.
+func releaseBounds(bounds []float64) {
+	if len(bounds) == 0 {
+		return
+	}
+	key := boundsKey(bounds)
+
+	boundsMu.Lock()
+	defer boundsMu.Unlock()
+	ib, ok := interned[key]
+	if !ok {
+		return
+	}
+	if ib.refs--; ib.refs <= 0 {
+		delete(interned, key)
+	}
+}
+
 func dropZeroBounds(bounds ...float64) []float64 {
 	for i, bound := range bounds {
 		if bound > 0 {
@@ -121,22 +448,84 @@ type viewInternal struct {
 	subscribed       uint32 // 1 if someone is subscribed and data need to be exported, use atomic to access
 	collector        *collector
 	metricDescriptor *metricdata.Descriptor
+	// tagKeys are the tag keys of the view at registration. Rows are encoded
+	// with them rather than view.TagKeys, which the user may modify.
+	tagKeys []tag.Key
+	// sigRows caches the row signature of the tag signatures recorded with,
+	// by their key, see tag.Sig.Key.
+	sigRows map[string]string
+	// rate is the state of the rates of a view using the Rate aggregation.
+	rate *rateTracker
+	// bounds are the shared bucket bounds of the view while it is
+	// registered, see acquireBounds.
+	bounds []float64
 }
 
+// maxCachedSigs bounds the number of tag signatures cached per view, in case
+// signatures are created per recording instead of being reused.
+const maxCachedSigs = 1024
+
 func newViewInternal(v *View) (*viewInternal, error) {
 	return &viewInternal{
 		view:             v,
-		collector:        &collector{make(map[string]AggregationData), v.Aggregation},
+		collector:        newCollector(v.Aggregation),
 		metricDescriptor: viewToMetricDescriptor(v),
+		tagKeys:          append([]tag.Key(nil), v.TagKeys...),
 	}, nil
 }
 
+// tagKeysChanged reports whether the TagKeys of the view were modified since
+// it was registered.
+func (v *viewInternal) tagKeysChanged() bool {
+	if len(v.tagKeys) != len(v.view.TagKeys) {
+		return true
+	}
+	for i, k := range v.tagKeys {
+		if k != v.view.TagKeys[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// resetTagKeys drops all rows, which were encoded with the previous tag keys,
+// and adopts the current TagKeys of the view.
+func (v *viewInternal) resetTagKeys() {
+	v.clearRows()
+	v.sigRows = nil
+	v.tagKeys = append([]tag.Key(nil), v.view.TagKeys...)
+	v.metricDescriptor = viewToMetricDescriptor(v.view)
+}
+
+// compatible reports whether the rows collected for v can be moved to the
+// canonicalized view other, that is whether both aggregate the same measure
+// with the same tag keys and aggregation.
+func (v *viewInternal) compatible(other *View) bool {
+	if v.view.Measure.Name() != other.Measure.Name() || len(v.tagKeys) != len(other.TagKeys) {
+		return false
+	}
+	for i, k := range v.tagKeys {
+		if k != other.TagKeys[i] {
+			return false
+		}
+	}
+	return v.view.Aggregation.Equal(other.Aggregation) && sameFunc(v.view.Transform, other.Transform)
+}
+
+// subscribe subscribes to the view and its measure, unless already
+// subscribed.
 func (v *viewInternal) subscribe() {
-	atomic.StoreUint32(&v.subscribed, 1)
+	if atomic.CompareAndSwapUint32(&v.subscribed, 0, 1) {
+		internal.SubscriptionReporter(v.view.Measure.Name())
+	}
 }
 
+// unsubscribe undoes subscribe, so the measure can skip recording once no
+// view is subscribed to it.
 func (v *viewInternal) unsubscribe() {
-	atomic.StoreUint32(&v.subscribed, 0)
+	if atomic.CompareAndSwapUint32(&v.subscribed, 1, 0) {
+		internal.UnsubscriptionReporter(v.view.Measure.Name())
+	}
 }
 
 // isSubscribed returns true if the view is exporting
@@ -150,17 +539,57 @@ func (v *viewInternal) clearRows() {
 }
 
 func (v *viewInternal) collectedRows() []*Row {
-	return v.collector.collectedRows(v.view.TagKeys)
+	return v.collector.collectedRows(v.tagKeys)
+}
+
+func (v *viewInternal) updatedRows() ([]*Row, []time.Time) {
+	return v.collector.updatedRows(v.tagKeys)
 }
 
 func (v *viewInternal) addSample(m *tag.Map, val float64, attachments map[string]interface{}, t time.Time) {
 	if !v.isSubscribed() {
 		return
 	}
-	sig := string(encodeWithKeys(m, v.view.TagKeys))
+	sig := string(encodeWithKeys(m, v.tagKeys))
+	v.addSampleToRow(sig, m, val, attachments, t)
+}
+
+// addSampleToRow adds the sample recorded with tags m to the row with
+// signature sig.
+func (v *viewInternal) addSampleToRow(sig string, m *tag.Map, val float64, attachments map[string]interface{}, t time.Time) {
+	if a := v.view.Aggregation; a.Type == AggTypeUniqueCount {
+		if value, ok := m.Value(a.uniqueKey); ok {
+			v.collector.addUniqueValue(sig, value, t)
+		}
+		return
+	}
+	if v.view.Transform != nil {
+		val = v.view.Transform(val)
+	}
+	if a := v.view.Aggregation; a.weighted() {
+		val *= a.weight(m)
+	}
 	v.collector.addSample(sig, val, attachments, t)
 }
 
+// addSampleWithSig is like addSample, but looks up the row signature of the
+// tag signature s in the cache before encoding its tags.
+func (v *viewInternal) addSampleWithSig(s *tag.Sig, val float64, attachments map[string]interface{}, t time.Time) {
+	if !v.isSubscribed() {
+		return
+	}
+	sig, ok := v.sigRows[s.Key()]
+	if !ok {
+		sig = string(encodeWithKeys(s.Map(), v.tagKeys))
+		if v.sigRows == nil || len(v.sigRows) >= maxCachedSigs {
+			// Start over rather than keep the signatures seen first.
+			v.sigRows = make(map[string]string)
+		}
+		v.sigRows[s.Key()] = sig
+	}
+	v.addSampleToRow(sig, s.Map(), val, attachments, t)
+}
+
 // A Data is a set of rows about usage of the single measure associated
 // with the given view. Each row is specific to a unique set of tags.
 type Data struct {
@@ -188,6 +617,27 @@ func (r *Row) String() string {
 	return buffer.String()
 }
 
+// TagsMap returns the tags of r by key name, for example for templates or
+// JSON. Rows have no tag for the keys of the view that were not set when
+// recording; the names of keys, usually the TagKeys of the view, are mapped
+// to the empty string if r has no tag for them, consistently with the labels
+// exported to Prometheus:
+//
+//	for _, row := range rows {
+//		labels := row.TagsMap(v.TagKeys...)
+//		...
+//	}
+func (r *Row) TagsMap(keys ...tag.Key) map[string]string {
+	m := make(map[string]string, len(r.Tags)+len(keys))
+	for _, k := range keys {
+		m[k.Name()] = ""
+	}
+	for _, t := range r.Tags {
+		m[t.Key.Name()] = t.Value
+	}
+	return m
+}
+
 // Equal returns true if both rows are equal. Tags are expected to be ordered
 // by the key name. Even if both rows have the same tags but the tags appear in
 // different orders it will return false.
@@ -211,6 +661,9 @@ func isPrintable(str string) bool {
 }
 
 func checkViewName(name string) error {
+	if name == "" {
+		return errors.New("view name cannot be empty; set the name of the view or of its measure")
+	}
 	if len(name) > maxNameLength {
 		return fmt.Errorf("view name cannot be larger than %v", maxNameLength)
 	}
@@ -17,6 +17,12 @@ package view
 
 import (
 	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -26,6 +32,7 @@ import (
 	"github.com/cloudian/opencensus-go/metric/metricdata"
 
 	"github.com/cloudian/opencensus-go/stats"
+	"github.com/cloudian/opencensus-go/stats/internal"
 	"github.com/cloudian/opencensus-go/tag"
 )
 
@@ -235,7 +242,7 @@ func Test_View_MeasureFloat64_AggregationSum(t *testing.T) {
 			[]*Row{
 				{
 					[]tag.Tag{{Key: k1, Value: "v1"}},
-					&SumData{Value: 6, Start: ts[0]},
+					&SumData{Value: 6, Count: 2, Start: ts[0]},
 				},
 			},
 		},
@@ -248,11 +255,11 @@ func Test_View_MeasureFloat64_AggregationSum(t *testing.T) {
 			[]*Row{
 				{
 					[]tag.Tag{{Key: k1, Value: "v1"}},
-					&SumData{Value: 1, Start: ts[0]},
+					&SumData{Value: 1, Count: 1, Start: ts[0]},
 				},
 				{
 					[]tag.Tag{{Key: k2, Value: "v2"}},
-					&SumData{Value: 5, Start: ts[1]},
+					&SumData{Value: 5, Count: 1, Start: ts[1]},
 				},
 			},
 		},
@@ -268,19 +275,19 @@ func Test_View_MeasureFloat64_AggregationSum(t *testing.T) {
 			[]*Row{
 				{
 					[]tag.Tag{{Key: k1, Value: "v1"}},
-					&SumData{Value: 6, Start: ts[0]},
+					&SumData{Value: 6, Count: 2, Start: ts[0]},
 				},
 				{
 					[]tag.Tag{{Key: k1, Value: "v1 other"}},
-					&SumData{Value: 1, Start: ts[2]},
+					&SumData{Value: 1, Count: 1, Start: ts[2]},
 				},
 				{
 					[]tag.Tag{{Key: k2, Value: "v2"}},
-					&SumData{Value: 5, Start: ts[3]},
+					&SumData{Value: 5, Count: 1, Start: ts[3]},
 				},
 				{
 					[]tag.Tag{{Key: k1, Value: "v1"}, {Key: k2, Value: "v2"}},
-					&SumData{Value: 5, Start: ts[4]},
+					&SumData{Value: 5, Count: 1, Start: ts[4]},
 				},
 			},
 		},
@@ -362,6 +369,59 @@ func TestViewSortedKeys(t *testing.T) {
 	}
 }
 
+func TestRowTagsMap(t *testing.T) {
+	restart()
+
+	// The view and recordings of TestViewMeasureWithoutTag of the Prometheus
+	// exporter.
+	m := stats.Int64("TestRowTagsMap/foo", "foo", stats.UnitDimensionless)
+	k1 := tag.MustNewKey("key/1")
+	k2 := tag.MustNewKey("key/2")
+	k3 := tag.MustNewKey("key/3")
+	k4 := tag.MustNewKey("key/4")
+	k5 := tag.MustNewKey("key/5")
+	randomKey := tag.MustNewKey("issue659")
+	v := &View{
+		Name:        m.Name(),
+		TagKeys:     []tag.Key{k2, k5, k3, k1, k4},
+		Measure:     m,
+		Aggregation: Count(),
+	}
+	if err := Register(v); err != nil {
+		t.Fatalf("Register() = %v", err)
+	}
+	defer Unregister(v)
+	ctx1, _ := tag.New(context.Background(), tag.Upsert(k4, "issue659"), tag.Upsert(randomKey, "value"), tag.Upsert(k2, "issue659"))
+	stats.Record(ctx1, m.M(1))
+	ctx2, _ := tag.New(context.Background(), tag.Upsert(k5, "issue659"), tag.Upsert(k3, "issue659"), tag.Upsert(k1, "issue659"))
+	stats.Record(ctx2, m.M(2))
+
+	rows, err := RetrieveData(v.Name)
+	if err != nil {
+		t.Fatalf("RetrieveData() = %v", err)
+	}
+	var got []map[string]string
+	for _, row := range rows {
+		got = append(got, row.TagsMap(v.TagKeys...))
+	}
+	// The labels of the series exported to Prometheus, by tag key name.
+	want := []map[string]string{
+		{"key/1": "", "key/2": "issue659", "key/3": "", "key/4": "issue659", "key/5": ""},
+		{"key/1": "issue659", "key/2": "", "key/3": "issue659", "key/4": "", "key/5": "issue659"},
+	}
+	sortMaps := cmpopts.SortSlices(func(a, b map[string]string) bool { return a["key/1"] < b["key/1"] })
+	if diff := cmp.Diff(got, want, sortMaps); diff != "" {
+		t.Errorf("TagsMap() differs (-got +want):\n%s", diff)
+	}
+
+	// Without keys, only the tags of the row are included.
+	for _, row := range rows {
+		if got := row.TagsMap(); len(got) != len(row.Tags) {
+			t.Errorf("TagsMap() = %v; want the %d tags of the row", got, len(row.Tags))
+		}
+	}
+}
+
 func cmpRow(r1 *Row, r2 *Row) bool {
 	return r1.Data.StartTime().Before(r2.Data.StartTime())
 }
@@ -377,6 +437,7 @@ func TestRegisterUnregisterParity(t *testing.T) {
 		Distribution(1, 2.0, 4.0, 8.0, 16.0),
 	}
 
+	registered := RegisteredViewCount()
 	for i := 0; i < 10; i++ {
 		for _, m := range measures {
 			for _, agg := range aggregations {
@@ -392,6 +453,362 @@ func TestRegisterUnregisterParity(t *testing.T) {
 			}
 		}
 	}
+	if got := RegisteredViewCount(); got != registered {
+		t.Errorf("RegisteredViewCount() = %d; want %d", got, registered)
+	}
+}
+
+func TestRegisterUnregisterConcurrent(t *testing.T) {
+	restart()
+
+	m := stats.Int64("TestRegisterUnregisterConcurrent/m", "", stats.UnitDimensionless)
+	k := tag.MustNewKey("k")
+	newView := func() *View {
+		return &View{
+			Name:        "TestRegisterUnregisterConcurrent/count",
+			Measure:     m,
+			TagKeys:     []tag.Key{k},
+			Aggregation: Count(),
+		}
+	}
+	// Count the net subscriptions to m.
+	var subs int32
+	subscribe, unsubscribe := internal.SubscriptionReporter, internal.UnsubscriptionReporter
+	defer func() {
+		internal.SubscriptionReporter, internal.UnsubscriptionReporter = subscribe, unsubscribe
+	}()
+	internal.SubscriptionReporter = func(measure string) {
+		if measure == m.Name() {
+			atomic.AddInt32(&subs, 1)
+		}
+		subscribe(measure)
+	}
+	internal.UnsubscriptionReporter = func(measure string) {
+		if measure == m.Name() {
+			atomic.AddInt32(&subs, -1)
+		}
+		unsubscribe(measure)
+	}
+
+	shared := newView()
+	meter := NewMeter()
+	meter.Start()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				// Half of the goroutines share a view between the default
+				// worker and another meter.
+				v := shared
+				if g%2 == 0 {
+					v = newView()
+				}
+				if err := Register(v); err != nil {
+					t.Errorf("Register() = %v", err)
+					return
+				}
+				if err := meter.Register(v); err != nil {
+					t.Errorf("meter.Register() = %v", err)
+					return
+				}
+				stats.Record(context.Background(), m.M(1))
+				Unregister(v)
+				meter.Unregister(v)
+			}
+		}(g)
+	}
+	wg.Wait()
+	// Stopping a meter undoes the subscriptions of its views.
+	if err := meter.Register(newView()); err != nil {
+		t.Fatalf("meter.Register() = %v", err)
+	}
+	meter.Stop()
+	if got := atomic.LoadInt32(&subs); got != 0 {
+		t.Errorf("net subscriptions after unregistering all views = %d; want 0", got)
+	}
+
+	v := newView()
+	if err := Register(v); err != nil {
+		t.Fatalf("Register() = %v", err)
+	}
+	defer Unregister(v)
+	stats.Record(context.Background(), m.M(1))
+	rows, err := RetrieveData(v.Name)
+	if err != nil {
+		t.Fatalf("RetrieveData() = %v", err)
+	}
+	if len(rows) != 1 || rows[0].Data.(*CountData).Value != 1 {
+		t.Errorf("RetrieveData() = %v; want a single row with count 1", rows)
+	}
+	if got := atomic.LoadInt32(&subs); got != 1 {
+		t.Errorf("net subscriptions with a registered view = %d; want 1", got)
+	}
+}
+
+func TestRegisterIdempotent(t *testing.T) {
+	m := stats.Float64("TestRegisterIdempotent/m", "", stats.UnitMilliseconds)
+	other := stats.Float64("TestRegisterIdempotent/other", "", stats.UnitMilliseconds)
+	k1 := tag.MustNewKey("k1")
+	k2 := tag.MustNewKey("k2")
+	newView := func() *View {
+		return &View{
+			Name:        "TestRegisterIdempotent/latency",
+			Measure:     m,
+			TagKeys:     []tag.Key{k1, k2},
+			Aggregation: Distribution(0, 1, 5, 10),
+		}
+	}
+	v := newView()
+	if err := Register(v); err != nil {
+		t.Fatalf("Register() = %v", err)
+	}
+	defer Unregister(v)
+
+	identical := newView()
+	identical.TagKeys = []tag.Key{k2, k1}
+	identical.Description = "registered from another package"
+	if err := Register(identical); err != nil {
+		t.Errorf("Register() of an identical view = %v; want nil", err)
+	}
+
+	conflicts := map[string]func(v *View){
+		"different measure":  func(v *View) { v.Measure = other },
+		"different tag keys": func(v *View) { v.TagKeys = []tag.Key{k1} },
+		"different buckets":  func(v *View) { v.Aggregation = Distribution(1, 5, 20) },
+		"different type":     func(v *View) { v.Aggregation = Count() },
+	}
+	for name, change := range conflicts {
+		t.Run(name, func(t *testing.T) {
+			conflicting := newView()
+			change(conflicting)
+			if err := Register(conflicting); err == nil {
+				t.Error("Register() of a conflicting view = nil; want error")
+			}
+		})
+	}
+}
+
+func TestReregisterWithChangedTagKeys(t *testing.T) {
+	restart()
+	m := stats.Int64("TestReregisterWithChangedTagKeys/m", "", stats.UnitDimensionless)
+	a := tag.MustNewKey("a")
+	b := tag.MustNewKey("b")
+	c := tag.MustNewKey("c")
+	record := func() {
+		ctx, _ := tag.New(context.Background(), tag.Upsert(a, "1"), tag.Upsert(b, "2"), tag.Upsert(c, "3"))
+		stats.Record(ctx, m.M(1))
+	}
+	wantRow := func(v *View, want ...tag.Tag) {
+		t.Helper()
+		rows, err := RetrieveData(v.Name)
+		if err != nil {
+			t.Fatalf("RetrieveData() = %v", err)
+		}
+		if len(rows) != 1 {
+			t.Fatalf("got %d rows; want 1", len(rows))
+		}
+		if !reflect.DeepEqual(rows[0].Tags, want) {
+			t.Errorf("got tags %v; want %v", rows[0].Tags, want)
+		}
+		if got := rows[0].Data.(*CountData).Value; got != 1 {
+			t.Errorf("count = %d; want 1", got)
+		}
+	}
+
+	v := &View{Name: "TestReregisterWithChangedTagKeys/count", Measure: m, TagKeys: []tag.Key{a, b}, Aggregation: Count()}
+	if err := Register(v); err != nil {
+		t.Fatalf("Register() = %v", err)
+	}
+	record()
+	wantRow(v, tag.Tag{Key: a, Value: "1"}, tag.Tag{Key: b, Value: "2"})
+	Unregister(v)
+
+	// The same View is modified and registered again.
+	v.TagKeys = []tag.Key{a, c}
+	if err := Register(v); err != nil {
+		t.Fatalf("Register() = %v", err)
+	}
+	defer Unregister(v)
+	record()
+	wantRow(v, tag.Tag{Key: a, Value: "1"}, tag.Tag{Key: c, Value: "3"})
+
+	// Modifying TagKeys while registered resets the rows on the next Register.
+	v.TagKeys = []tag.Key{b}
+	if err := Register(v); err != nil {
+		t.Fatalf("Register() = %v", err)
+	}
+	record()
+	wantRow(v, tag.Tag{Key: b, Value: "2"})
+	metrics := defaultWorker.Read()
+	for _, metric := range metrics {
+		if metric.Descriptor.Name != v.Name {
+			continue
+		}
+		if diff := cmp.Diff(metric.Descriptor.LabelKeys, []metricdata.LabelKey{{Key: "b"}}); diff != "" {
+			t.Errorf("unexpected label keys (-got +want):\n%s", diff)
+		}
+		for _, ts := range metric.TimeSeries {
+			if len(ts.LabelValues) != 1 {
+				t.Errorf("got %d label values; want 1", len(ts.LabelValues))
+			}
+		}
+	}
+}
+
+func TestRegisterDuplicateTagKeys(t *testing.T) {
+	restart()
+	m := stats.Int64("TestRegisterDuplicateTagKeys/m", "", stats.UnitDimensionless)
+	k1 := tag.MustNewKey("k1")
+	k2 := tag.MustNewKey("k2")
+	keys := []tag.Key{k2, k1, k1, k2, k1}
+	v := &View{Name: "TestRegisterDuplicateTagKeys/count", Measure: m, TagKeys: keys, Aggregation: Count()}
+	if err := Register(v); err != nil {
+		t.Fatalf("Register() = %v", err)
+	}
+	defer Unregister(v)
+	if want := []tag.Key{k1, k2}; !reflect.DeepEqual(v.TagKeys, want) {
+		t.Errorf("TagKeys = %v; want %v", v.TagKeys, want)
+	}
+
+	ctx, _ := tag.New(context.Background(), tag.Upsert(k1, "a"), tag.Upsert(k2, "b"))
+	stats.Record(ctx, m.M(1))
+	rows, err := RetrieveData(v.Name)
+	if err != nil {
+		t.Fatalf("RetrieveData() = %v", err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("got %d rows; want 1", len(rows))
+	}
+	if want := []tag.Tag{{Key: k1, Value: "a"}, {Key: k2, Value: "b"}}; !reflect.DeepEqual(rows[0].Tags, want) {
+		t.Errorf("got tags %v; want %v", rows[0].Tags, want)
+	}
+	for _, metric := range defaultWorker.Read() {
+		if metric.Descriptor.Name != v.Name {
+			continue
+		}
+		if diff := cmp.Diff(metric.Descriptor.LabelKeys, []metricdata.LabelKey{{Key: "k1"}, {Key: "k2"}}); diff != "" {
+			t.Errorf("unexpected label keys (-got +want):\n%s", diff)
+		}
+		for _, ts := range metric.TimeSeries {
+			if len(ts.LabelValues) != 2 {
+				t.Errorf("got %d label values; want 2", len(ts.LabelValues))
+			}
+		}
+	}
+
+	// Registering the view again with the duplicates is not a conflict.
+	if err := Register(&View{Name: v.Name, Measure: m, TagKeys: []tag.Key{k1, k1, k2}, Aggregation: Count()}); err != nil {
+		t.Errorf("Register() of the same view with duplicate keys = %v; want nil", err)
+	}
+}
+
+// opaqueMeasure is a measure of neither Int64 nor Float64 values.
+type opaqueMeasure struct {
+	stats.Measure
+}
+
+func (opaqueMeasure) ValueType() stats.ValueType { return 0 }
+
+func TestRegisterIncompatibleMeasure(t *testing.T) {
+	restart()
+	m := opaqueMeasure{stats.Float64("TestRegisterIncompatibleMeasure/m", "", stats.UnitDimensionless)}
+	for _, agg := range []*Aggregation{Sum(), SumGauge(), LastValue(), Gauge(), {Type: AggTypeNone}} {
+		v := &View{Name: "TestRegisterIncompatibleMeasure/" + agg.Type.String(), Measure: m, Aggregation: agg}
+		err := Register(v)
+		if err == nil {
+			Unregister(v)
+			t.Errorf("Register() of a %v view = nil; want error", agg.Type)
+			continue
+		}
+		if !strings.Contains(err.Error(), agg.Type.String()) {
+			t.Errorf("Register() of a %v view = %q; want an error naming the aggregation", agg.Type, err)
+		}
+	}
+	for _, agg := range []*Aggregation{Count(), Distribution(1, 2)} {
+		v := &View{Name: "TestRegisterIncompatibleMeasure/" + agg.Type.String(), Measure: m, Aggregation: agg}
+		if err := Register(v); err != nil {
+			t.Errorf("Register() of a %v view = %v; want nil", agg.Type, err)
+		}
+		Unregister(v)
+	}
+}
+
+func TestRegisterInvalidName(t *testing.T) {
+	unnamed := stats.Int64("", "", stats.UnitDimensionless)
+	named := stats.Int64("TestRegisterInvalidName/m", "", stats.UnitDimensionless)
+	tests := []struct {
+		name string
+		view *View
+	}{
+		{name: "empty view and measure name", view: &View{Measure: unnamed, Aggregation: Count()}},
+		{name: "non-ASCII name", view: &View{Name: "latencyµs", Measure: named, Aggregation: Count()}},
+		{name: "too long name", view: &View{Name: strings.Repeat("a", maxNameLength+1), Measure: named, Aggregation: Count()}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Register(tt.view); err == nil {
+				Unregister(tt.view)
+				t.Error("Register() = nil; want error")
+			}
+		})
+	}
+
+	v := &View{Measure: named, Aggregation: Count()}
+	if err := Register(v); err != nil {
+		t.Fatalf("Register() of a view named after its measure = %v", err)
+	}
+	Unregister(v)
+}
+
+func TestMultiAggregation(t *testing.T) {
+	m := stats.Float64("TestMultiAggregation/latency", "latency", stats.UnitMilliseconds)
+	k := tag.MustNewKey("method")
+	spec := &View{Measure: m, TagKeys: []tag.Key{k}}
+	views, err := MultiAggregation(spec, Count(), Sum(), Distribution(10, 100))
+	if err != nil {
+		t.Fatalf("MultiAggregation() = %v", err)
+	}
+	if err := Register(views...); err != nil {
+		t.Fatalf("Register() = %v", err)
+	}
+	defer Unregister(views...)
+
+	want := map[string]AggType{
+		"TestMultiAggregation/latency_count":        AggTypeCount,
+		"TestMultiAggregation/latency_sum":          AggTypeSum,
+		"TestMultiAggregation/latency_distribution": AggTypeDistribution,
+	}
+	for name, aggType := range want {
+		v := Find(name)
+		if v == nil {
+			t.Errorf("Find(%q) = nil; want a registered view", name)
+			continue
+		}
+		if v.Aggregation.Type != aggType || v.Measure != m || len(v.TagKeys) != 1 || v.TagKeys[0] != k {
+			t.Errorf("Find(%q) = %+v; want a %v view of %v by %v", name, v, aggType, m.Name(), k.Name())
+		}
+	}
+	if spec.Name != "" || spec.Aggregation != nil {
+		t.Errorf("MultiAggregation() modified the spec: %+v", spec)
+	}
+
+	if _, err := MultiAggregation(spec, Distribution(1), Distribution(2)); err == nil {
+		t.Error("MultiAggregation() with colliding names = nil; want error")
+	}
+}
+
+func TestRegisterInvalidSummary(t *testing.T) {
+	m := stats.Int64("TestRegisterInvalidSummary/m", "", stats.UnitDimensionless)
+	for _, agg := range []*Aggregation{LastValueSummary(0), LastValueSummary(10, 0), LastValueSummary(10, 0.5, 1.5)} {
+		v := &View{Measure: m, Aggregation: agg}
+		if err := Register(v); err == nil {
+			Unregister(v)
+			t.Errorf("Register() with window %d and quantiles %v = nil; want error", agg.window, agg.quantiles)
+		}
+	}
 }
 
 func TestRegisterAfterMeasurement(t *testing.T) {
@@ -430,6 +847,66 @@ func TestRegisterAfterMeasurement(t *testing.T) {
 	}
 }
 
+func TestRegisterAfterMeasurement_backfill(t *testing.T) {
+	restart()
+
+	m := stats.Int64(t.Name(), "", stats.UnitDimensionless)
+	k := tag.MustNewKey("k")
+	ctx, _ := tag.New(context.Background(), tag.Upsert(k, "v"))
+	EnableBackfill(m, 3)
+
+	for i := int64(1); i <= 5; i++ {
+		stats.Record(ctx, m.M(i))
+	}
+	v := &View{
+		Measure:     m,
+		TagKeys:     []tag.Key{k},
+		Aggregation: Sum(),
+	}
+	if err := Register(v); err != nil {
+		t.Fatal(err)
+	}
+	defer Unregister(v)
+
+	rows, err := RetrieveData(v.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only the last three samples are retained: 3 + 4 + 5.
+	want := []*Row{{Tags: []tag.Tag{{Key: k, Value: "v"}}, Data: &SumData{Value: 12, Count: 3}}}
+	for _, r := range rows {
+		ClearStart(r.Data)
+	}
+	if diff := cmp.Diff(rows, want); diff != "" {
+		t.Errorf("backfilled rows differ -got +want: %s", diff)
+	}
+
+	stats.Record(ctx, m.M(10))
+	rows, err = RetrieveData(v.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rows[0].Data.(*SumData).Value; got != 22 {
+		t.Errorf("sum after backfill and a new record = %v; want 22", got)
+	}
+
+	// Without backfill, a late view only sees new samples.
+	EnableBackfill(m, 0)
+	stats.Record(ctx, m.M(100))
+	late := &View{Name: t.Name() + "/late", Measure: m, Aggregation: Count()}
+	if err := Register(late); err != nil {
+		t.Fatal(err)
+	}
+	defer Unregister(late)
+	rows, err = RetrieveData(late.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) > 0 {
+		t.Errorf("view registered with backfill disabled has data: %v", rows)
+	}
+}
+
 func TestViewRegister_negativeBucketBounds(t *testing.T) {
 	m := stats.Int64("TestViewRegister_negativeBucketBounds", "", "")
 	v := &View{
@@ -473,3 +950,203 @@ func TestViewRegister_dropZeroBuckets(t *testing.T) {
 		t.Errorf("buckets differ -got +want: %s", diff)
 	}
 }
+
+func TestRegisterCanonical(t *testing.T) {
+	m := stats.Int64("TestRegisterCanonical", "measure description", "")
+	v1 := &View{
+		Measure:     m,
+		Aggregation: Distribution(5, 0, 1),
+	}
+	v2 := &View{
+		Name:        "TestRegisterCanonical/count",
+		Measure:     m,
+		Aggregation: Count(),
+	}
+	got, err := RegisterCanonical(v1, v2)
+	if err != nil {
+		t.Fatalf("Unexpected err %s", err)
+	}
+	defer Unregister(got...)
+	if len(got) != 2 {
+		t.Fatalf("RegisterCanonical() returned %d views; want 2", len(got))
+	}
+	if got[0].Name != m.Name() || got[0].Description != m.Description() {
+		t.Errorf("view = %q, %q; want %q, %q", got[0].Name, got[0].Description, m.Name(), m.Description())
+	}
+	want := []float64{1, 5}
+	if diff := cmp.Diff(got[0].Aggregation.Buckets, want); diff != "" {
+		t.Errorf("buckets differ -got +want: %s", diff)
+	}
+	if got[1].Name != v2.Name {
+		t.Errorf("view name = %q; want %q", got[1].Name, v2.Name)
+	}
+
+	// Conflicting views are reported and have no registered view.
+	conflicting := &View{
+		Name:        v2.Name,
+		Measure:     m,
+		Aggregation: Sum(),
+	}
+	got, err = RegisterCanonical(v2, conflicting)
+	if err == nil {
+		t.Fatal("RegisterCanonical() with a conflicting view = nil error; want error")
+	}
+	if got[0] == nil || got[1] != nil {
+		t.Errorf("RegisterCanonical() = %v; want only the first view registered", got)
+	}
+}
+
+func TestViewRegister_sharedBuckets(t *testing.T) {
+	m := stats.Float64("TestViewRegister_sharedBuckets", "", stats.UnitMilliseconds)
+	var views []*View
+	for i := 0; i < 100; i++ {
+		views = append(views, &View{
+			Name:        fmt.Sprintf("TestViewRegister_sharedBuckets/%d", i),
+			Measure:     m,
+			Aggregation: Distribution(0, 1, 5, 10, 25, 50, 100),
+		})
+	}
+	// Unsorted but otherwise identical bounds are shared as well.
+	views = append(views, &View{
+		Name:        "TestViewRegister_sharedBuckets/unsorted",
+		Measure:     m,
+		Aggregation: Distribution(100, 50, 25, 10, 5, 1),
+	})
+	if err := Register(views...); err != nil {
+		t.Fatalf("Unexpected err %s", err)
+	}
+	defer Unregister(views...)
+
+	// The aggregations of the views are left untouched.
+	if got := &views[1].Aggregation.Buckets[0]; got == &views[0].Aggregation.Buckets[0] {
+		t.Error("Register() made the views share their Aggregation.Buckets")
+	}
+	if got, want := views[len(views)-1].Aggregation.Buckets, []float64{1, 5, 10, 25, 50, 100}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Aggregation.Buckets = %v; want %v", got, want)
+	}
+
+	stats.Record(context.Background(), m.M(7))
+	bounds := func(v *View) *float64 {
+		rows, err := RetrieveData(v.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &rows[0].Data.(*DistributionData).bounds[0]
+	}
+	want := bounds(views[0])
+	for _, v := range views[1:] {
+		if got := bounds(v); got != want {
+			t.Errorf("%s: distribution data does not use the shared buckets", v.Name)
+		}
+	}
+
+	other := &View{
+		Name:        "TestViewRegister_sharedBuckets/other",
+		Measure:     m,
+		Aggregation: Distribution(1, 5, 10),
+	}
+	if err := Register(other); err != nil {
+		t.Fatalf("Unexpected err %s", err)
+	}
+	defer Unregister(other)
+	stats.Record(context.Background(), m.M(7))
+	if bounds(other) == want {
+		t.Error("different buckets must not be shared")
+	}
+
+	// Shared buckets are dropped once no registered view uses them.
+	isInterned := func(bounds []float64) bool {
+		boundsMu.Lock()
+		defer boundsMu.Unlock()
+		_, ok := interned[boundsKey(bounds)]
+		return ok
+	}
+	Unregister(views[1:]...)
+	if !isInterned(views[0].Aggregation.Buckets) {
+		t.Error("buckets of a registered view were dropped")
+	}
+	Unregister(views[0])
+	if isInterned(views[0].Aggregation.Buckets) {
+		t.Error("buckets were not dropped after unregistering all the views using them")
+	}
+}
+
+func TestViewTransform(t *testing.T) {
+	restart()
+
+	m := stats.Float64("TestViewTransform/latency", "", stats.UnitMilliseconds)
+	v := &View{
+		Name:        "TestViewTransform/latency",
+		Measure:     m,
+		Aggregation: Distribution(1, 10),
+		Transform:   func(v float64) float64 { return math.Max(v, 0) },
+	}
+	if err := Register(v); err != nil {
+		t.Fatalf("Register() = %v", err)
+	}
+	defer Unregister(v)
+
+	stats.Record(context.Background(), m.M(-5), m.M(-0.5), m.M(5))
+
+	rows, err := RetrieveData(v.Name)
+	if err != nil {
+		t.Fatalf("RetrieveData() = %v", err)
+	}
+	d := rows[0].Data.(*DistributionData)
+	if got, want := d.CountPerBucket, []int64{2, 1, 0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("CountPerBucket = %v; want %v", got, want)
+	}
+	if d.Min != 0 || d.Mean != 5.0/3 {
+		t.Errorf("Min, Mean = %v, %v; want 0, %v", d.Min, d.Mean, 5.0/3)
+	}
+
+	other := *v
+	other.Transform = func(v float64) float64 { return v }
+	if err := Register(&other); err == nil {
+		t.Error("Register() of a view with the same name and another transform = nil; want error")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	restart()
+
+	m := stats.Float64("TestValidate/m", "desc", stats.UnitDimensionless)
+	k1, k2 := tag.MustNewKey("b"), tag.MustNewKey("a")
+	buckets := []float64{5, -1, 0, 10}
+	negative := &View{
+		Name:        "TestValidate/negative",
+		Measure:     m,
+		TagKeys:     []tag.Key{k1, k2},
+		Aggregation: Distribution(buckets...),
+	}
+	if err := Validate(negative); err != ErrNegativeBucketBounds {
+		t.Errorf("Validate() = %v; want %v", err, ErrNegativeBucketBounds)
+	}
+	if err := Register(negative); err != ErrNegativeBucketBounds {
+		t.Errorf("Register() = %v; want %v", err, ErrNegativeBucketBounds)
+	}
+
+	unnamed := &View{Measure: stats.Float64("", "", stats.UnitDimensionless), Aggregation: Count()}
+	if err := Validate(unnamed); err == nil {
+		t.Error("Validate() of a view without name = nil; want error")
+	}
+
+	valid := &View{
+		Name:        "TestValidate/valid",
+		Measure:     m,
+		TagKeys:     []tag.Key{k1, k2},
+		Aggregation: Distribution(10, 0, 5),
+	}
+	if err := Validate(valid); err != nil {
+		t.Errorf("Validate() = %v; want nil", err)
+	}
+	if got, want := valid.TagKeys, []tag.Key{k1, k2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("TagKeys = %v after Validate(); want unchanged %v", got, want)
+	}
+	if got, want := valid.Aggregation.Buckets, []float64{10, 0, 5}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Buckets = %v after Validate(); want unchanged %v", got, want)
+	}
+	if Find(valid.Name) != nil {
+		t.Error("Validate() registered the view")
+	}
+}
@@ -42,34 +42,38 @@ func getType(v *View) metricdata.Type {
 
 	switch agg.Type {
 	case AggTypeSum:
-		switch m.(type) {
-		case *stats.Int64Measure:
+		if agg.weighted() {
+			return metricdata.TypeCumulativeFloat64
+		}
+		switch m.ValueType() {
+		case stats.ValueTypeInt64:
 			return metricdata.TypeCumulativeInt64
-		case *stats.Float64Measure:
+		case stats.ValueTypeFloat64:
 			return metricdata.TypeCumulativeFloat64
 		default:
 			panic("unexpected measure type")
 		}
 	case AggTypeDistribution:
 		return metricdata.TypeCumulativeDistribution
-	case AggTypeLastValue:
-		switch m.(type) {
-		case *stats.Int64Measure:
+	case AggTypeLastValue, AggTypeSumGauge, AggTypeGauge, AggTypeRaw:
+		switch m.ValueType() {
+		case stats.ValueTypeInt64:
 			return metricdata.TypeGaugeInt64
-		case *stats.Float64Measure:
+		case stats.ValueTypeFloat64:
 			return metricdata.TypeGaugeFloat64
 		default:
 			panic("unexpected measure type")
 		}
+	case AggTypeUniqueCount:
+		return metricdata.TypeGaugeInt64
+	case AggTypeRate:
+		return metricdata.TypeGaugeFloat64
+	case AggTypeLastValueSummary:
+		return metricdata.TypeSummary
+	case AggTypeCustom:
+		return agg.custom.MetricType()
 	case AggTypeCount:
-		switch m.(type) {
-		case *stats.Int64Measure:
-			return metricdata.TypeCumulativeInt64
-		case *stats.Float64Measure:
-			return metricdata.TypeCumulativeInt64
-		default:
-			panic("unexpected measure type")
-		}
+		return metricdata.TypeCumulativeInt64
 	default:
 		panic("unexpected aggregation type")
 	}
@@ -85,7 +89,7 @@ func getLabelKeys(v *View) []metricdata.LabelKey {
 
 func viewToMetricDescriptor(v *View) *metricdata.Descriptor {
 	return &metricdata.Descriptor{
-		Name:        v.Name,
+		Name:        v.metricName(),
 		Description: v.Description,
 		Unit:        convertUnit(v),
 		Type:        getType(v),
@@ -119,23 +123,24 @@ func toLabelValues(row *Row, expectedKeys []metricdata.LabelKey) []metricdata.La
 	return labelValues
 }
 
-func rowToTimeseries(v *viewInternal, row *Row, now time.Time) *metricdata.TimeSeries {
+func rowToTimeseries(v *viewInternal, row *Row, updated, now time.Time) *metricdata.TimeSeries {
 	return &metricdata.TimeSeries{
 		Points:      []metricdata.Point{row.Data.toPoint(v.metricDescriptor.Type, now)},
 		LabelValues: toLabelValues(row, v.metricDescriptor.LabelKeys),
 		StartTime:   row.Data.StartTime(),
+		Updated:     updated,
 	}
 }
 
 func viewToMetric(v *viewInternal, r *resource.Resource, now time.Time) *metricdata.Metric {
-	rows := v.collectedRows()
+	rows, updated := v.updatedRows()
 	if len(rows) == 0 {
 		return nil
 	}
 
 	ts := []*metricdata.TimeSeries{}
-	for _, row := range rows {
-		ts = append(ts, rowToTimeseries(v, row, now))
+	for i, row := range rows {
+		ts = append(ts, rowToTimeseries(v, row, updated[i], now))
 	}
 
 	m := &metricdata.Metric{
@@ -145,3 +150,64 @@ func viewToMetric(v *viewInternal, r *resource.Resource, now time.Time) *metricd
 	}
 	return m
 }
+
+// gaugeSuffixes are the metrics a view using the Gauge aggregation is
+// exported as, each reporting a single field of GaugeData.
+var gaugeSuffixes = []struct {
+	suffix string
+	value  func(*GaugeData) float64
+}{
+	{"_last", func(g *GaugeData) float64 { return g.Last }},
+	{"_min", func(g *GaugeData) float64 { return g.Min }},
+	{"_max", func(g *GaugeData) float64 { return g.Max }},
+}
+
+// MetricNames returns the names of the metrics v is exported as by metric
+// exporters once data is recorded for it: its MetricName, or its Name if
+// MetricName is unset, or for the Gauge aggregation one name per reported
+// field of GaugeData. Views using the Raw aggregation are not exported as
+// metrics, so they have none.
+func (v *View) MetricNames() []string {
+	if v.Aggregation != nil && v.Aggregation.Type == AggTypeRaw {
+		return nil
+	}
+	name := v.metricName()
+	if v.Aggregation == nil || v.Aggregation.Type != AggTypeGauge {
+		return []string{name}
+	}
+	names := make([]string, len(gaugeSuffixes))
+	for i, s := range gaugeSuffixes {
+		names[i] = name + s.suffix
+	}
+	return names
+}
+
+func gaugeViewToMetrics(v *viewInternal, r *resource.Resource, now time.Time, reader interface{}) []*metricdata.Metric {
+	rows, updated := v.updatedRows()
+	if reader != nil {
+		rows, updated = v.collector.windowedRows(v.tagKeys, reader)
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	metrics := make([]*metricdata.Metric, 0, len(gaugeSuffixes))
+	for _, s := range gaugeSuffixes {
+		desc := *v.metricDescriptor
+		desc.Name += s.suffix
+		ts := make([]*metricdata.TimeSeries, 0, len(rows))
+		for i, row := range rows {
+			ts = append(ts, &metricdata.TimeSeries{
+				Points:      []metricdata.Point{gaugePoint(desc.Type, s.value(row.Data.(*GaugeData)), now)},
+				LabelValues: toLabelValues(row, desc.LabelKeys),
+				Updated:     updated[i],
+			})
+		}
+		metrics = append(metrics, &metricdata.Metric{
+			Descriptor: desc,
+			TimeSeries: ts,
+			Resource:   r,
+		})
+	}
+	return metrics
+}
@@ -277,6 +277,7 @@ func Test_ViewToMetric(t *testing.T) {
 					},
 						LabelValues: labelValues,
 						StartTime:   now,
+						Updated:     now,
 					},
 				},
 			},
@@ -305,6 +306,7 @@ func Test_ViewToMetric(t *testing.T) {
 						},
 						LabelValues: labelValues,
 						StartTime:   now,
+						Updated:     now,
 					},
 				},
 			},
@@ -320,6 +322,7 @@ func Test_ViewToMetric(t *testing.T) {
 					},
 						LabelValues: labelValues,
 						StartTime:   now,
+						Updated:     now,
 					},
 				},
 			},
@@ -335,6 +338,7 @@ func Test_ViewToMetric(t *testing.T) {
 					},
 						LabelValues: labelValues,
 						StartTime:   now,
+						Updated:     now,
 					},
 				},
 			},
@@ -350,6 +354,7 @@ func Test_ViewToMetric(t *testing.T) {
 					},
 						LabelValues: labelValues,
 						StartTime:   now,
+						Updated:     now,
 					},
 				},
 			},
@@ -365,6 +370,7 @@ func Test_ViewToMetric(t *testing.T) {
 					},
 						LabelValues: labelValues,
 						StartTime:   now,
+						Updated:     now,
 					},
 				},
 			},
@@ -380,6 +386,7 @@ func Test_ViewToMetric(t *testing.T) {
 					},
 						LabelValues: labelValues,
 						StartTime:   time.Time{},
+						Updated:     now,
 					},
 				},
 			},
@@ -395,6 +402,7 @@ func Test_ViewToMetric(t *testing.T) {
 					},
 						LabelValues: labelValues,
 						StartTime:   time.Time{},
+						Updated:     now,
 					},
 				},
 			},
@@ -410,6 +418,7 @@ func Test_ViewToMetric(t *testing.T) {
 					},
 						LabelValues: emptyLabelValues,
 						StartTime:   time.Time{},
+						Updated:     now,
 					},
 				},
 			},
@@ -563,6 +572,7 @@ func TestViewToMetric_OutOfOrderWithZeroBuckets(t *testing.T) {
 						},
 					},
 						StartTime:   now,
+						Updated:     now,
 						LabelValues: []metricdata.LabelValue{},
 					},
 				},
@@ -600,6 +610,7 @@ func TestViewToMetric_OutOfOrderWithZeroBuckets(t *testing.T) {
 						},
 					},
 						StartTime:   now,
+						Updated:     now,
 						LabelValues: []metricdata.LabelValue{},
 					},
 				},
@@ -638,6 +649,7 @@ func TestViewToMetric_OutOfOrderWithZeroBuckets(t *testing.T) {
 		}
 		got.TimeSeries[0].Points[0].Time = now
 		got.TimeSeries[0].StartTime = now
+		got.TimeSeries[0].Updated = now
 
 		want := tt.m
 		if diff := cmp.Diff(got, want); diff != "" {
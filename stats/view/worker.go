@@ -16,8 +16,12 @@
 package view
 
 import (
+	"errors"
 	"fmt"
+	"log"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cloudian/opencensus-go/resource"
@@ -33,11 +37,18 @@ func init() {
 	defaultWorker = NewMeter().(*worker)
 	go defaultWorker.start()
 	internal.DefaultRecorder = record
+	internal.SignatureRecorder = recordWithSignature
+	internal.DefaultCancelledRecorder = recordCancelled
 }
 
 type measureRef struct {
 	measure string
 	views   map[*viewInternal]struct{}
+	// backfill retains recent samples of the measure if backfill is enabled.
+	backfill *sampleRing
+	// lazy are the views of the measure registered with RegisterLazy, which
+	// are registered once the measure is recorded.
+	lazy []*View
 }
 
 type worker struct {
@@ -45,7 +56,8 @@ type worker struct {
 	views          map[string]*viewInternal
 	viewStartTimes map[*viewInternal]time.Time
 
-	timer      *time.Ticker
+	timer      Ticker
+	period     time.Duration
 	c          chan command
 	quit, done chan bool
 	mu         sync.RWMutex
@@ -53,8 +65,37 @@ type worker struct {
 
 	exportersMu sync.RWMutex
 	exporters   map[Exporter]struct{}
+	errHandler  func(error) // guarded by exportersMu
+
+	paused uint32 // 1 if reporting to exporters is paused, use atomic to access
+
+	// internalViews is set once RegisterInternalViews is called.
+	internalViews bool
+	// sampleCounting is set while SetSampleCounting is enabled.
+	sampleCounting bool
+	// alerts are the cardinality alerts by view name.
+	alerts map[string]*cardinalityAlert
+	// maxViews limits the number of registered views, if positive.
+	maxViews int
+	// maxBuckets limits the number of buckets of registered distributions,
+	// if positive.
+	maxBuckets int
+
+	rc      *recordChannel
+	batcher recordBatcher
+
+	// created is the creation time of the worker, the start time of its
+	// internal counters.
+	created time.Time
+	// recordsDroppedCancelled counts the recordings to the worker skipped
+	// because their context was done, use atomic to access.
+	recordsDroppedCancelled int64
 }
 
+// DefaultMaxBuckets is the default limit of the number of buckets of the
+// distributions of registered views, see SetMaxBuckets.
+const DefaultMaxBuckets = 1000
+
 // Meter defines an interface which allows a single process to maintain
 // multiple sets of metrics exports (intended for the advanced case where a
 // single process wants to report metrics about multiple objects, such as
@@ -67,14 +108,37 @@ type Meter interface {
 	// Find returns a registered view associated with this name.
 	// If no registered view is found, nil is returned.
 	Find(name string) *View
+	// RegisteredViews returns a snapshot of all views currently registered
+	// with this Meter, sorted by name.
+	RegisteredViews() []*View
 	// Register begins collecting data for the given views.
 	// Once a view is registered, it reports data to the registered exporters.
 	Register(views ...*View) error
+	// SetMaxRegisteredViews limits the number of views that can be registered
+	// at the same time. Register fails for views that would exceed it.
+	// A limit less than or equal to zero removes the limit.
+	SetMaxRegisteredViews(n int)
+	// RegisteredViewCount returns the number of currently registered views.
+	RegisteredViewCount() int
+	// SetMaxBuckets limits the number of buckets of distributions. Register
+	// fails for views whose distribution has more buckets.
+	// A limit less than or equal to zero removes the limit.
+	SetMaxBuckets(n int)
+	// RegisterCanonical is like Register, but also returns the registered
+	// views in the order given, after canonicalization.
+	RegisterCanonical(views ...*View) ([]*View, error)
 	// Unregister the given views. Data will not longer be exported for these views
 	// after Unregister returns.
 	// It is not necessary to unregister from views you expect to collect for the
 	// duration of your program execution.
 	Unregister(views ...*View)
+	// UnregisterByPrefix unregisters all the views whose name starts with
+	// prefix, returning the errors of exporting their final data.
+	UnregisterByPrefix(prefix string) []error
+	// ReRegister replaces the registered view old with v, preserving the
+	// rows collected for old, with their start times, if v aggregates the
+	// same measure with the same tag keys and aggregation.
+	ReRegister(old, v *View) error
 	// SetReportingPeriod sets the interval between reporting aggregated views in
 	// the program. If duration is less than or equal to zero, it enables the
 	// default behavior.
@@ -83,6 +147,12 @@ type Meter interface {
 	// duration is. For example, the Stackdriver exporter recommends a value no
 	// lower than 1 minute. Consult each exporter per your needs.
 	SetReportingPeriod(time.Duration)
+	// PauseReporting stops exporting view data to the registered exporters
+	// until ResumeReporting is called. Data keeps being aggregated meanwhile.
+	PauseReporting()
+	// ResumeReporting resumes exporting view data after PauseReporting and
+	// immediately exports the data accumulated while paused.
+	ResumeReporting()
 
 	// RegisterExporter registers an exporter.
 	// Collected data will be reported via all the
@@ -94,6 +164,9 @@ type Meter interface {
 	RegisterExporter(Exporter)
 	// UnregisterExporter unregisters an exporter.
 	UnregisterExporter(Exporter)
+	// SetReportingErrorHandler sets the handler of the errors of reporting
+	// to the registered exporters, including recovered exporter panics.
+	SetReportingErrorHandler(h func(error))
 	// SetResource may be used to set the Resource associated with this registry.
 	// This is intended to be used in cases where a single process exports metrics
 	// for multiple Resources, typically in a multi-tenant situation.
@@ -105,9 +178,64 @@ type Meter interface {
 	// Stop causes the Meter to stop processing calls and terminate data export.
 	Stop()
 
+	// EnableBackfill retains the last n samples recorded for the measure, even
+	// while no view is registered for it, and seeds views registered later
+	// with them. Passing n <= 0 disables backfill for the measure.
+	EnableBackfill(m stats.Measure, n int)
+
+	// RegisterLazy registers the views returned by fn once their measures
+	// are first recorded.
+	RegisterLazy(fn func() []*View) error
+
+	// RegisterSpecs registers the views described by specs, returning an
+	// error for each spec, which is nil if its view was registered.
+	RegisterSpecs(specs []ViewSpec) []error
+
+	// SetBatching makes the Meter coalesce recordings into batches of up to
+	// maxBatch recordings, aggregated once full or after the flush interval.
+	// A maxBatch less than or equal to one disables batching.
+	SetBatching(maxBatch int, flush time.Duration)
+
+	// RecordChannel returns a buffered channel measurements can be sent to
+	// for recording without waiting for them to be aggregated.
+	RecordChannel() chan<- stats.Measurement
+	// SetRecordChannelPolicy sets the policy for measurements sent to the
+	// record channel while the Meter is not keeping up.
+	SetRecordChannelPolicy(p RecordChannelPolicy)
+	// RecordChannelDropped returns the number of measurements sent to the
+	// record channel that were dropped.
+	RecordChannelDropped() int64
+
+	// RegisterInternalViews enables the metrics the Meter reports about
+	// itself, such as the number of rows collected per view.
+	RegisterInternalViews()
+	// SetSampleCounting enables or disables the companion counters of the
+	// samples recorded for each view.
+	SetSampleCounting(enabled bool)
+	// SetCardinalityAlert sets a callback invoked once the number of rows
+	// collected for the view with the given name reaches threshold.
+	SetCardinalityAlert(name string, threshold int, cb func(view string, count int))
+
 	// RetrieveData gets a snapshot of the data collected for the the view registered
 	// with the given name. It is intended for testing only.
 	RetrieveData(viewName string) ([]*Row, error)
+
+	// ReadWindow reads all view data as metrics, with the data of the views
+	// using the Gauge aggregation since the previous call for reader.
+	ReadWindow(reader interface{}) []*metricdata.Metric
+
+	// ImportHistogram adds the observations of a Prometheus histogram to a
+	// row of the registered Distribution view with the given name.
+	ImportHistogram(viewName string, tags []tag.Tag, h Histogram) error
+
+	// RowCount returns the number of rows collected for the view registered
+	// with the given name.
+	RowCount(viewName string) (int, error)
+
+	// IterateData invokes fn for each row collected for the view registered
+	// with the given name, stopping early if fn returns false. Recording
+	// waits for the iteration to complete, and fn must not call the Meter.
+	IterateData(viewName string, fn func(*Row) bool) error
 }
 
 var _ Meter = (*worker)(nil)
@@ -134,8 +262,32 @@ func (w *worker) Find(name string) (v *View) {
 	return resp.v
 }
 
+// RegisteredViews returns a snapshot of all currently registered views,
+// sorted by name. The returned views are copies of the registered ones, which
+// may be modified by the caller without affecting the registered views.
+func RegisteredViews() []*View {
+	return defaultWorker.RegisteredViews()
+}
+
+// RegisteredViews returns a snapshot of all views currently registered
+// with this Meter, sorted by name.
+func (w *worker) RegisteredViews() []*View {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	views := make([]*View, 0, len(w.views))
+	for _, vi := range w.views {
+		views = append(views, vi.view.snapshot())
+	}
+	sort.Slice(views, func(i, j int) bool { return views[i].Name < views[j].Name })
+	return views
+}
+
 // Register begins collecting data for the given views.
 // Once a view is registered, it reports data to the registered exporters.
+//
+// Registering a view with the same name as a registered view is a no-op if
+// both use the same measure, tag keys and aggregation, see Aggregation.Equal,
+// and an error otherwise.
 func Register(views ...*View) error {
 	return defaultWorker.Register(views...)
 }
@@ -151,6 +303,80 @@ func (w *worker) Register(views ...*View) error {
 	return <-req.err
 }
 
+// SetMaxRegisteredViews limits the number of views that can be registered at
+// the same time to n. Once the limit is reached, Register fails for views
+// that are not already registered. This guards against unbounded growth, for
+// example from dynamically generated view names. Views registered before the
+// limit is lowered stay registered.
+//
+// A limit less than or equal to zero, the default, removes the limit.
+func SetMaxRegisteredViews(n int) {
+	defaultWorker.SetMaxRegisteredViews(n)
+}
+
+// SetMaxRegisteredViews limits the number of views that can be registered
+// at the same time.
+func (w *worker) SetMaxRegisteredViews(n int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.maxViews = n
+}
+
+// SetMaxBuckets limits the number of buckets of the distributions of views
+// to n. Register fails for views with a distribution of more buckets, that is
+// with n or more bounds, as each row of such a view would hold all of them.
+// Views registered before the limit is lowered stay registered.
+//
+// The limit defaults to DefaultMaxBuckets. A limit less than or equal to zero
+// removes it.
+func SetMaxBuckets(n int) {
+	defaultWorker.SetMaxBuckets(n)
+}
+
+// SetMaxBuckets limits the number of buckets of distributions.
+func (w *worker) SetMaxBuckets(n int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.maxBuckets = n
+}
+
+// RegisteredViewCount returns the number of currently registered views.
+func RegisteredViewCount() int {
+	return defaultWorker.RegisteredViewCount()
+}
+
+// RegisteredViewCount returns the number of currently registered views.
+func (w *worker) RegisteredViewCount() int {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return len(w.views)
+}
+
+// RegisterCanonical is like Register, but also returns the registered views
+// in the order given. They reflect the canonicalization applied on
+// registration, such as the defaulted name and description, and the sorted
+// bucket bounds without zero. If a view with the same name was already
+// registered, the existing view is returned in its place. The returned views
+// must not be modified.
+//
+// If a view fails to register, its entry is nil and an error is returned.
+func RegisterCanonical(views ...*View) ([]*View, error) {
+	return defaultWorker.RegisterCanonical(views...)
+}
+
+// RegisterCanonical is like Register, but also returns the registered views
+// in the order given, after canonicalization.
+func (w *worker) RegisterCanonical(views ...*View) ([]*View, error) {
+	req := &registerViewReq{
+		views:      views,
+		err:        make(chan error),
+		registered: make([]*View, len(views)),
+	}
+	w.c <- req
+	err := <-req.err
+	return req.registered, err
+}
+
 // Unregister the given views. Data will not longer be exported for these views
 // after Unregister returns.
 // It is not necessary to unregister from views you expect to collect for the
@@ -176,6 +402,104 @@ func (w *worker) Unregister(views ...*View) {
 	<-req.done
 }
 
+// UnregisterByPrefix unregisters all the views whose name starts with prefix,
+// for example to tear down the views of a subsystem at once. As with
+// Unregister, the pending data of each view is reported to the registered
+// exporters before the view is removed; the returned errors are those of the
+// exporters implementing ErrorExporter reporting it, which are also passed to
+// the reporting error handler. The prefix must not be empty.
+func UnregisterByPrefix(prefix string) []error {
+	return defaultWorker.UnregisterByPrefix(prefix)
+}
+
+// UnregisterByPrefix unregisters all the views whose name starts with prefix.
+func (w *worker) UnregisterByPrefix(prefix string) []error {
+	if prefix == "" {
+		return []error{errors.New("cannot unregister views by prefix: the prefix is empty")}
+	}
+	req := &unregisterByPrefixReq{
+		prefix: prefix,
+		c:      make(chan []error),
+	}
+	w.c <- req
+	return <-req.c
+}
+
+// ReRegister replaces the registered view old with v, for example when views
+// are reloaded from configuration. If v aggregates the same measure with the
+// same tag keys and an equal aggregation, the rows collected for old are
+// moved to v, keeping their accumulated values and start times, so that
+// cumulative metrics continue across the change; this allows renaming a
+// view or changing its description. Otherwise the rows of old are reported
+// and dropped as by Unregister, and v starts collecting anew.
+//
+// If v cannot be registered, old remains registered and an error is
+// returned.
+func ReRegister(old, v *View) error {
+	return defaultWorker.ReRegister(old, v)
+}
+
+// ReRegister replaces the registered view old with v, preserving the rows
+// collected for old if both views are compatible.
+func (w *worker) ReRegister(old, v *View) error {
+	req := &reRegisterViewReq{
+		old: old.Name,
+		v:   v,
+		err: make(chan error),
+	}
+	w.c <- req
+	return <-req.err
+}
+
+// EnableBackfill retains the last n samples recorded for the measure m, even
+// while no view is registered for it. When a view of m is registered later,
+// it is seeded with the retained samples before it starts collecting new
+// ones. Passing n <= 0 disables backfill for the measure and drops the
+// retained samples.
+//
+// Backfill keeps up to n samples per measure in memory, including references
+// to their tag maps and attachments, so n should be kept small.
+func EnableBackfill(m stats.Measure, n int) {
+	defaultWorker.EnableBackfill(m, n)
+}
+
+// EnableBackfill retains the last n samples recorded for the measure m and
+// seeds views registered later with them.
+func (w *worker) EnableBackfill(m stats.Measure, n int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	ref := w.getMeasureRef(m.Name())
+	if n <= 0 {
+		if ref.backfill != nil {
+			ref.backfill = nil
+			internal.UnsubscriptionReporter(m.Name())
+		}
+		return
+	}
+	if ref.backfill == nil {
+		// Measurements are only delivered to the worker for subscribed measures.
+		internal.SubscriptionReporter(m.Name())
+	}
+	ref.backfill = newSampleRing(n)
+}
+
+// RegisterInternalViews enables the metrics reported about the views
+// themselves. These are the ViewCardinalityName gauge, which reports the
+// number of distinct tag sets collected for each registered view when metrics
+// are read and helps detecting cardinality explosions early, and the
+// RecordsDroppedCancelledName counter.
+func RegisterInternalViews() {
+	defaultWorker.RegisterInternalViews()
+}
+
+// RegisterInternalViews enables the metrics reported about the views
+// themselves.
+func (w *worker) RegisterInternalViews() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.internalViews = true
+}
+
 // RetrieveData gets a snapshot of the data collected for the the view registered
 // with the given name. It is intended for testing only.
 func RetrieveData(viewName string) ([]*Row, error) {
@@ -186,7 +510,7 @@ func RetrieveData(viewName string) ([]*Row, error) {
 // with the given name. It is intended for testing only.
 func (w *worker) RetrieveData(viewName string) ([]*Row, error) {
 	req := &retrieveDataReq{
-		now: time.Now(),
+		now: now(),
 		v:   viewName,
 		c:   make(chan *retrieveDataResp),
 	}
@@ -195,19 +519,80 @@ func (w *worker) RetrieveData(viewName string) ([]*Row, error) {
 	return resp.rows, resp.err
 }
 
+// RowCount returns the number of rows collected for the view registered with
+// the given name, that is the number of distinct tag value combinations
+// recorded for it. Unlike RetrieveData, it does not snapshot the rows, so it
+// is cheap enough for health checks and cardinality monitoring.
+func RowCount(viewName string) (int, error) {
+	return defaultWorker.RowCount(viewName)
+}
+
+// RowCount returns the number of rows collected for the view registered with
+// the given name.
+func (w *worker) RowCount(viewName string) (int, error) {
+	req := &rowCountReq{
+		v: viewName,
+		c: make(chan *rowCountResp),
+	}
+	w.c <- req
+	resp := <-req.c
+	return resp.n, resp.err
+}
+
+// IterateData invokes fn for each row collected for the view registered with
+// the given name, stopping early if fn returns false. Unlike RetrieveData, the
+// rows are not materialized all at once: each row is snapshotted separately
+// before it is passed to fn. Recording waits for the iteration to complete,
+// so fn should be fast, and it must not call the functions of this package.
+func IterateData(viewName string, fn func(*Row) bool) error {
+	return defaultWorker.IterateData(viewName, fn)
+}
+
+// IterateData invokes fn for each row collected for the view registered with
+// the given name, stopping early if fn returns false.
+func (w *worker) IterateData(viewName string, fn func(*Row) bool) error {
+	req := &iterateDataReq{
+		v:   viewName,
+		fn:  fn,
+		err: make(chan error),
+	}
+	w.c <- req
+	return <-req.err
+}
+
 func record(tags *tag.Map, ms interface{}, attachments map[string]interface{}) {
 	defaultWorker.Record(tags, ms, attachments)
 }
 
+func recordCancelled() {
+	defaultWorker.RecordCancelled()
+}
+
+// RecordCancelled counts a recording to w skipped because its context was
+// done, see stats.SkipIfCancelled.
+func (w *worker) RecordCancelled() {
+	atomic.AddInt64(&w.recordsDroppedCancelled, 1)
+}
+
 // Record records a set of measurements ms associated with the given tags and attachments.
 func (w *worker) Record(tags *tag.Map, ms interface{}, attachments map[string]interface{}) {
 	req := &recordReq{
 		tm:          tags,
 		ms:          ms.([]stats.Measurement),
 		attachments: attachments,
-		t:           time.Now(),
+		t:           now(),
 	}
-	w.c <- req
+	w.enqueueRecord(req)
+}
+
+func recordWithSignature(sig *tag.Sig, ms interface{}) {
+	req := &recordReq{
+		tm:  sig.Map(),
+		sig: sig,
+		ms:  ms.([]stats.Measurement),
+		t:   now(),
+	}
+	defaultWorker.enqueueRecord(req)
 }
 
 // SetReportingPeriod sets the interval between reporting aggregated views in
@@ -239,6 +624,46 @@ func (w *worker) SetReportingPeriod(d time.Duration) {
 	<-req.c // don't return until the timer is set to the new duration.
 }
 
+// PauseReporting stops exporting view data to the registered exporters until
+// ResumeReporting is called, for example during a maintenance window.
+// Measurements keep being recorded and aggregated while reporting is paused,
+// and views remain registered. Views unregistered while reporting is paused
+// are not flushed to the exporters.
+//
+// Reporting is only paused for exporters registered with RegisterExporter;
+// data read through metricexport.Reader, such as by the Prometheus exporter,
+// is unaffected.
+func PauseReporting() {
+	defaultWorker.PauseReporting()
+}
+
+// ResumeReporting resumes exporting view data after PauseReporting and
+// immediately exports the data accumulated while paused.
+func ResumeReporting() {
+	defaultWorker.ResumeReporting()
+}
+
+// PauseReporting stops exporting view data to the registered exporters until
+// ResumeReporting is called.
+func (w *worker) PauseReporting() {
+	atomic.StoreUint32(&w.paused, 1)
+}
+
+// ResumeReporting resumes exporting view data after PauseReporting and
+// immediately exports the data accumulated while paused.
+func (w *worker) ResumeReporting() {
+	if !atomic.CompareAndSwapUint32(&w.paused, 1, 0) {
+		return
+	}
+	req := &resumeReportingReq{c: make(chan struct{})}
+	w.c <- req
+	<-req.c
+}
+
+func (w *worker) isPaused() bool {
+	return atomic.LoadUint32(&w.paused) == 1
+}
+
 // NewMeter constructs a Meter instance. You should only need to use this if
 // you need to separate out Measurement recordings and View aggregations within
 // a single process.
@@ -247,10 +672,14 @@ func NewMeter() Meter {
 		measures:       make(map[string]*measureRef),
 		views:          make(map[string]*viewInternal),
 		viewStartTimes: make(map[*viewInternal]time.Time),
-		timer:          time.NewTicker(defaultReportingDuration),
+		timer:          clock().NewTicker(defaultReportingDuration),
+		period:         defaultReportingDuration,
 		c:              make(chan command, 1024),
 		quit:           make(chan bool),
 		done:           make(chan bool),
+		maxBuckets:     DefaultMaxBuckets,
+		rc:             newRecordChannel(),
+		created:        time.Now(),
 
 		exporters: make(map[Exporter]struct{}),
 	}
@@ -276,9 +705,14 @@ func (w *worker) start() {
 		select {
 		case cmd := <-w.c:
 			cmd.handleCommand(w)
-		case <-w.timer.C:
+		case m := <-w.rc.queue:
+			w.recordFromChannel(m)
+		case <-w.timer.C():
 			w.reportUsage()
 		case <-w.quit:
+			w.drain()
+			w.unsubscribeAll()
+			close(w.rc.stop)
 			w.timer.Stop()
 			close(w.c)
 			w.done <- true
@@ -287,14 +721,49 @@ func (w *worker) start() {
 	}
 }
 
+// drain handles the commands sent before the worker was stopped, so that
+// no recording made before Stop is lost.
+func (w *worker) drain() {
+	for {
+		select {
+		case cmd := <-w.c:
+			cmd.handleCommand(w)
+		default:
+			return
+		}
+	}
+}
+
 func (w *worker) Stop() {
 	prodMgr := metricproducer.GlobalManager()
 	prodMgr.DeleteProducer(w)
 
+	w.SetBatching(0, 0)
+
 	w.quit <- true
 	<-w.done
 }
 
+// unsubscribeAll undoes the subscriptions of the views and backfills of the
+// stopped worker, so that their measures are not recorded for nothing.
+func (w *worker) unsubscribeAll() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, v := range w.views {
+		v.unsubscribe()
+	}
+	for _, ref := range w.measures {
+		if ref.backfill != nil {
+			ref.backfill = nil
+			internal.UnsubscriptionReporter(ref.measure)
+		}
+		if ref.lazy != nil {
+			ref.lazy = nil
+			internal.UnsubscriptionReporter(ref.measure)
+		}
+	}
+}
+
 func (w *worker) getMeasureRef(name string) *measureRef {
 	if mr, ok := w.measures[name]; ok {
 		return mr
@@ -310,82 +779,204 @@ func (w *worker) getMeasureRef(name string) *measureRef {
 func (w *worker) tryRegisterView(v *View) (*viewInternal, error) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
+	return w.registerViewLocked(v)
+}
+
+// registerViewLocked is like tryRegisterView, but the worker must be locked.
+func (w *worker) registerViewLocked(v *View) (*viewInternal, error) {
+	return w.replaceViewLocked(v, nil, now())
+}
+
+// replaceViewLocked is like registerViewLocked, but if rows is not nil, the
+// registered view takes over these rows, collected since start, and is
+// subscribed before it is published. The worker must be locked.
+func (w *worker) replaceViewLocked(v *View, rows *collector, start time.Time) (*viewInternal, error) {
 	vi, err := newViewInternal(v)
 	if err != nil {
 		return nil, err
 	}
+	if v.Aggregation.Type == AggTypeDistribution && w.maxBuckets > 0 {
+		if buckets := maxInt(len(v.Aggregation.Buckets)+1, v.Aggregation.autoBuckets); buckets > w.maxBuckets {
+			return nil, fmt.Errorf("cannot register view %q; its distribution has %d buckets, more than the limit of %d", v.Name, buckets, w.maxBuckets)
+		}
+	}
 	if x, ok := w.views[vi.view.Name]; ok {
 		if !x.view.same(vi.view) {
 			return nil, fmt.Errorf("cannot register view %q; a different view with the same name is already registered", v.Name)
 		}
-
+		if x.tagKeysChanged() {
+			// The TagKeys of the registered view were modified in place.
+			// Rows recorded with the previous keys would not match the new
+			// label schema, so start over.
+			x.resetTagKeys()
+			w.viewStartTimes[x] = now()
+		}
 		// the view is already registered so there is nothing to do and the
 		// command is considered successful.
 		return x, nil
 	}
+	if w.maxViews > 0 && len(w.views) >= w.maxViews {
+		return nil, fmt.Errorf("cannot register view %q; the limit of %d registered views is reached", v.Name, w.maxViews)
+	}
+	if rows != nil {
+		rows.a = vi.view.Aggregation
+		vi.collector = rows
+		vi.subscribe()
+	}
+	vi.acquireBounds()
 	w.views[vi.view.Name] = vi
-	w.viewStartTimes[vi] = time.Now()
+	w.viewStartTimes[vi] = start
+	vi.collector.countSamples(w.sampleCounting)
 	ref := w.getMeasureRef(vi.view.Measure.Name())
 	ref.views[vi] = struct{}{}
+	if rows == nil && ref.backfill != nil && !vi.isRaw() && !vi.isRate() {
+		ref.backfill.each(func(s sample) {
+			sig := string(encodeWithKeys(s.tags, vi.tagKeys))
+			vi.addSampleToRow(sig, s.tags, s.value, s.attachments, s.t)
+		})
+	}
 	return vi, nil
 }
 
-func (w *worker) unregisterView(v *viewInternal) {
-	w.mu.Lock()
-	defer w.mu.Unlock()
+// unregisterViewLocked removes v from the registered views. The worker must be
+// locked.
+func (w *worker) unregisterViewLocked(v *viewInternal) {
 	delete(w.views, v.view.Name)
 	delete(w.viewStartTimes, v)
 	if measure := w.measures[v.view.Measure.Name()]; measure != nil {
 		delete(measure.views, v)
 	}
+	v.releaseBounds()
 }
 
-func (w *worker) reportView(v *viewInternal) {
-	if !v.isSubscribed() {
-		return
+// restoreView registers v again after unregisterView, with its previous
+// start time.
+// The worker must be locked.
+func (w *worker) restoreView(v *viewInternal, start time.Time) {
+	v.acquireBounds()
+	w.views[v.view.Name] = v
+	w.viewStartTimes[v] = start
+	w.getMeasureRef(v.view.Measure.Name()).views[v] = struct{}{}
+}
+
+// reportView exports the data of v to the registered exporters. The worker
+// must be locked.
+func (w *worker) reportView(v *viewInternal) (errs []error) {
+	if !v.isSubscribed() || w.isPaused() || v.isRaw() {
+		return nil
 	}
 	rows := v.collectedRows()
 	viewData := &Data{
 		View:  v.view,
 		Start: w.viewStartTimes[v],
-		End:   time.Now(),
+		End:   now(),
 		Rows:  rows,
 	}
 	w.exportersMu.Lock()
 	defer w.exportersMu.Unlock()
 	for e := range w.exporters {
+		data := viewData
+		if v.view.Aggregation.Type == AggTypeGauge {
+			// Each exporter has its own window of Gauge data.
+			windowed := *viewData
+			windowed.Rows, _ = v.collector.windowedRows(v.tagKeys, e)
+			data = &windowed
+		}
+		if err := w.exportView(e, data); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// exportView exports viewData to e, passing its errors and recovered panics
+// to the error handler, or logging the panics if no handler is set. It
+// returns the error of e, if any.
+func (w *worker) exportView(e Exporter, viewData *Data) error {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		err := fmt.Errorf("exporter %T panicked exporting view %q: %v", e, viewData.View.Name, r)
+		if w.errHandler != nil {
+			w.errHandler(err)
+		} else {
+			log.Printf("opencensus: %v", err)
+		}
+	}()
+	ee, ok := e.(ErrorExporter)
+	if !ok {
 		e.ExportView(viewData)
+		return nil
 	}
+	err := ee.ExportViewErr(viewData)
+	if err == nil {
+		return nil
+	}
+	err = fmt.Errorf("exporter %T failed to export view %q: %w", e, viewData.View.Name, err)
+	if w.errHandler != nil {
+		w.errHandler(err)
+	}
+	return err
 }
 
 func (w *worker) reportUsage() {
 	w.mu.Lock()
 	defer w.mu.Unlock()
+	w.updateRates(now())
 	for _, v := range w.views {
 		w.reportView(v)
 	}
 }
 
-func (w *worker) toMetric(v *viewInternal, now time.Time) *metricdata.Metric {
+func (w *worker) toMetrics(v *viewInternal, now time.Time, reader interface{}) []*metricdata.Metric {
 	if !v.isSubscribed() {
 		return nil
 	}
 
-	return viewToMetric(v, w.r, now)
+	if v.view.Aggregation.Type == AggTypeGauge {
+		return gaugeViewToMetrics(v, w.r, now, reader)
+	}
+	if metric := viewToMetric(v, w.r, now); metric != nil {
+		return []*metricdata.Metric{metric}
+	}
+	return nil
 }
 
 // Read reads all view data and returns them as metrics.
 // It is typically invoked by metric reader to export stats in metric format.
 func (w *worker) Read() []*metricdata.Metric {
+	return w.read(nil)
+}
+
+// ReadWindow is like Read, but the metrics of the views using the Gauge
+// aggregation only describe the values recorded since the previous call with
+// the same reader, see Gauge.
+func (w *worker) ReadWindow(reader interface{}) []*metricdata.Metric {
+	return w.read(reader)
+}
+
+// read reads all view data, through the Gauge windows of reader if not nil.
+func (w *worker) read(reader interface{}) []*metricdata.Metric {
 	w.mu.Lock()
 	defer w.mu.Unlock()
-	now := time.Now()
+	now := now()
+	w.updateRates(now)
 	metrics := make([]*metricdata.Metric, 0, len(w.views))
 	for _, v := range w.views {
-		metric := w.toMetric(v, now)
-		if metric != nil {
+		metrics = append(metrics, w.toMetrics(v, now, reader)...)
+		if w.sampleCounting && v.isSubscribed() {
+			if metric := w.sampleCountMetric(v, now); metric != nil {
+				metrics = append(metrics, metric)
+			}
+		}
+	}
+	if w.internalViews {
+		if metric := w.viewCardinalityMetric(now); metric != nil {
 			metrics = append(metrics, metric)
 		}
+		metrics = append(metrics, w.recordsDroppedCancelledMetric(now))
 	}
 	return metrics
 }
@@ -398,8 +989,20 @@ func (w *worker) RegisterExporter(e Exporter) {
 }
 
 func (w *worker) UnregisterExporter(e Exporter) {
+	w.exportersMu.Lock()
+	delete(w.exporters, e)
+	w.exportersMu.Unlock()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, v := range w.views {
+		v.collector.dropWindows(e)
+	}
+}
+
+func (w *worker) SetReportingErrorHandler(h func(error)) {
 	w.exportersMu.Lock()
 	defer w.exportersMu.Unlock()
 
-	delete(w.exporters, e)
+	w.errHandler = h
 }
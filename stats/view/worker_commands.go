@@ -16,13 +16,14 @@
 package view
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/cloudian/opencensus-go/stats"
-	"github.com/cloudian/opencensus-go/stats/internal"
 	"github.com/cloudian/opencensus-go/tag"
 )
 
@@ -53,6 +54,8 @@ func (cmd *getViewByNameReq) handleCommand(w *worker) {
 type registerViewReq struct {
 	views []*View
 	err   chan error
+	// registered, if not nil, receives the registered view for each of views.
+	registered []*View
 }
 
 func (cmd *registerViewReq) handleCommand(w *worker) {
@@ -63,13 +66,15 @@ func (cmd *registerViewReq) handleCommand(w *worker) {
 		}
 	}
 	var errstr []string
-	for _, view := range cmd.views {
+	for i, view := range cmd.views {
 		vi, err := w.tryRegisterView(view)
 		if err != nil {
 			errstr = append(errstr, fmt.Sprintf("%s: %v", view.Name, err))
 			continue
 		}
-		internal.SubscriptionReporter(view.Measure.Name())
+		if cmd.registered != nil {
+			cmd.registered[i] = vi.view
+		}
 		vi.subscribe()
 	}
 	if len(errstr) > 0 {
@@ -88,6 +93,8 @@ type unregisterFromViewReq struct {
 }
 
 func (cmd *unregisterFromViewReq) handleCommand(w *worker) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 	for _, name := range cmd.views {
 		vi, ok := w.views[name]
 		if !ok {
@@ -103,11 +110,94 @@ func (cmd *unregisterFromViewReq) handleCommand(w *worker) {
 			// The collected data can be cleared.
 			vi.clearRows()
 		}
-		w.unregisterView(vi)
+		w.unregisterViewLocked(vi)
 	}
 	cmd.done <- struct{}{}
 }
 
+// unregisterByPrefixReq is the command to unregister the views whose name
+// starts with a prefix.
+type unregisterByPrefixReq struct {
+	prefix string
+	c      chan []error
+}
+
+func (cmd *unregisterByPrefixReq) handleCommand(w *worker) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var names []string
+	for name := range w.views {
+		if strings.HasPrefix(name, cmd.prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var errs []error
+	for _, name := range names {
+		vi := w.views[name]
+		errs = append(errs, w.reportView(vi)...)
+		vi.unsubscribe()
+		if !vi.isSubscribed() {
+			vi.clearRows()
+		}
+		w.unregisterViewLocked(vi)
+	}
+	cmd.c <- errs
+}
+
+// reRegisterViewReq is the command to replace a registered view.
+type reRegisterViewReq struct {
+	old string
+	v   *View
+	err chan error
+}
+
+func (cmd *reRegisterViewReq) handleCommand(w *worker) {
+	if err := cmd.v.canonicalize(); err != nil {
+		cmd.err <- err
+		return
+	}
+	// The old view is replaced atomically for readers of the worker.
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	vi, ok := w.views[cmd.old]
+	_, taken := w.views[cmd.v.Name]
+	start := w.viewStartTimes[vi]
+	if !ok {
+		cmd.err <- fmt.Errorf("cannot re-register view %q; it is not registered", cmd.old)
+		return
+	}
+	if taken && cmd.v.Name != cmd.old {
+		cmd.err <- fmt.Errorf("cannot re-register view %q as %q; a view with that name is already registered", cmd.old, cmd.v.Name)
+		return
+	}
+
+	var rows *collector
+	rowsStart := now()
+	if vi.compatible(cmd.v) {
+		rows, rowsStart = vi.collector, start
+	} else {
+		// Report pending data for this view before dropping it.
+		w.reportView(vi)
+	}
+
+	w.unregisterViewLocked(vi)
+	nvi, err := w.replaceViewLocked(cmd.v, rows, rowsStart)
+	if err != nil {
+		w.restoreView(vi, start)
+		cmd.err <- err
+		return
+	}
+	nvi.subscribe()
+	if rows != nil {
+		// The rows now belong to the new view.
+		vi.collector = newCollector(vi.view.Aggregation)
+	}
+	vi.clearRows()
+	vi.unsubscribe()
+	cmd.err <- nil
+}
+
 // retrieveDataReq is the command to retrieve data for a view.
 type retrieveDataReq struct {
 	now time.Time
@@ -139,16 +229,133 @@ func (cmd *retrieveDataReq) handleCommand(w *worker) {
 		}
 		return
 	}
+	if vi.isRate() {
+		w.updateRate(vi, cmd.now)
+	}
 	cmd.c <- &retrieveDataResp{
 		vi.collectedRows(),
 		nil,
 	}
 }
 
+// iterateDataReq is the command to iterate over the rows collected for a
+// view.
+type iterateDataReq struct {
+	v   string
+	fn  func(*Row) bool
+	err chan error
+}
+
+func (cmd *iterateDataReq) handleCommand(w *worker) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	vi, ok := w.views[cmd.v]
+	if !ok {
+		cmd.err <- fmt.Errorf("cannot retrieve data; view %q is not registered", cmd.v)
+		return
+	}
+	if !vi.isSubscribed() {
+		cmd.err <- fmt.Errorf("cannot retrieve data; view %q has no subscriptions or collection is not forcibly started", cmd.v)
+		return
+	}
+	for sig := range vi.collector.signatures {
+		row, _ := vi.collector.row(sig, vi.tagKeys)
+		if !cmd.fn(row) {
+			break
+		}
+	}
+	cmd.err <- nil
+}
+
+// rowCountReq is the command to count the rows collected for a view.
+type rowCountReq struct {
+	v string
+	c chan *rowCountResp
+}
+
+type rowCountResp struct {
+	n   int
+	err error
+}
+
+func (cmd *rowCountReq) handleCommand(w *worker) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	vi, ok := w.views[cmd.v]
+	if !ok {
+		cmd.c <- &rowCountResp{
+			err: fmt.Errorf("cannot count rows; view %q is not registered", cmd.v),
+		}
+		return
+	}
+	if !vi.isSubscribed() {
+		cmd.c <- &rowCountResp{
+			err: fmt.Errorf("cannot count rows; view %q has no subscriptions or collection is not forcibly started", cmd.v),
+		}
+		return
+	}
+	cmd.c <- &rowCountResp{n: len(vi.collector.signatures)}
+}
+
+// importHistogramReq is the command to add a histogram to a row of a
+// Distribution view.
+type importHistogramReq struct {
+	v    string
+	tags []tag.Tag
+	h    Histogram
+	err  chan error
+}
+
+func (cmd *importHistogramReq) handleCommand(w *worker) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	vi, ok := w.views[cmd.v]
+	if !ok {
+		cmd.err <- fmt.Errorf("cannot import histogram; view %q is not registered", cmd.v)
+		return
+	}
+	if !vi.isSubscribed() {
+		cmd.err <- fmt.Errorf("cannot import histogram; view %q has no subscriptions or collection is not forcibly started", cmd.v)
+		return
+	}
+	if vi.view.Aggregation.Type != AggTypeDistribution {
+		cmd.err <- fmt.Errorf("cannot import histogram; view %q has a %v aggregation, not a distribution", cmd.v, vi.view.Aggregation.Type)
+		return
+	}
+	if vi.view.Aggregation.autoBuckets > 0 {
+		cmd.err <- fmt.Errorf("cannot import histogram into view %q: its distribution has automatic bucket bounds", cmd.v)
+		return
+	}
+	counts, err := cmd.h.bucketCounts(vi.view.Aggregation.Buckets)
+	if err != nil {
+		cmd.err <- fmt.Errorf("cannot import histogram into view %q: %v", cmd.v, err)
+		return
+	}
+	mutators := make([]tag.Mutator, len(cmd.tags))
+	for i, t := range cmd.tags {
+		mutators[i] = tag.Upsert(t.Key, t.Value)
+	}
+	ctx, err := tag.New(context.Background(), mutators...)
+	if err != nil {
+		cmd.err <- fmt.Errorf("cannot import histogram into view %q: %v", cmd.v, err)
+		return
+	}
+	sig := string(encodeWithKeys(tag.FromContext(ctx), vi.tagKeys))
+	data, ok := vi.collector.signatures[sig]
+	if !ok {
+		data = vi.collector.a.newData(now())
+		vi.collector.signatures[sig] = data
+	}
+	data.(*DistributionData).addHistogram(counts, cmd.h.Count, cmd.h.Sum)
+	vi.collector.updated[sig] = now()
+	cmd.err <- nil
+}
+
 // recordReq is the command to record data related to multiple measures
 // at once.
 type recordReq struct {
 	tm          *tag.Map
+	sig         *tag.Sig // if set, tm is the map of sig
 	ms          []stats.Measurement
 	attachments map[string]interface{}
 	t           time.Time
@@ -157,13 +364,36 @@ type recordReq struct {
 func (cmd *recordReq) handleCommand(w *worker) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
+	cmd.record(w)
+}
+
+// record records the measurements of cmd. The worker must be locked.
+func (cmd *recordReq) record(w *worker) {
 	for _, m := range cmd.ms {
 		if (m == stats.Measurement{}) { // not registered
 			continue
 		}
 		ref := w.getMeasureRef(m.Measure().Name())
+		if ref.lazy != nil {
+			w.registerLazy(ref)
+		}
+		if ref.backfill != nil {
+			ref.backfill.add(sample{tags: cmd.tm, value: m.Value(), attachments: cmd.attachments, t: cmd.t})
+		}
 		for v := range ref.views {
-			v.addSample(cmd.tm, m.Value(), cmd.attachments, cmd.t)
+			switch {
+			case v.isRate():
+				// Rates are derived from their source view when read.
+			case v.isRaw():
+				w.exportRaw(v, cmd.tm, m.Value(), cmd.attachments, cmd.t)
+			case cmd.sig != nil:
+				v.addSampleWithSig(cmd.sig, m.Value(), cmd.attachments, cmd.t)
+			default:
+				v.addSample(cmd.tm, m.Value(), cmd.attachments, cmd.t)
+			}
+			if len(w.alerts) > 0 {
+				w.checkCardinality(v)
+			}
 		}
 	}
 }
@@ -172,15 +402,31 @@ func (cmd *recordReq) handleCommand(w *worker) {
 // reporting the collected data to the registered clients.
 type setReportingPeriodReq struct {
 	d time.Duration
-	c chan bool
+	// keep recreates the timer with the current period, e.g. after the
+	// clock changed.
+	keep bool
+	c    chan bool
 }
 
 func (cmd *setReportingPeriodReq) handleCommand(w *worker) {
 	w.timer.Stop()
-	if cmd.d <= 0 {
-		w.timer = time.NewTicker(defaultReportingDuration)
-	} else {
-		w.timer = time.NewTicker(cmd.d)
+	if !cmd.keep {
+		w.period = cmd.d
+		if w.period <= 0 {
+			w.period = defaultReportingDuration
+		}
 	}
+	w.timer = clock().NewTicker(w.period)
 	cmd.c <- true
 }
+
+// resumeReportingReq is the command to report all views right after
+// reporting has been resumed.
+type resumeReportingReq struct {
+	c chan struct{}
+}
+
+func (cmd *resumeReportingReq) handleCommand(w *worker) {
+	w.reportUsage()
+	cmd.c <- struct{}{}
+}
@@ -16,9 +16,14 @@
 package view
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"log"
+	"os"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -137,8 +142,8 @@ func Test_Worker_MultiExport(t *testing.T) {
 
 	m := stats.Float64("Test_Worker_MultiExport/MF1", "desc MF1", "unit")
 	key := tag.MustNewKey(("key"))
-	count := &View{"VF1", "description", []tag.Key{key}, m, Count()}
-	sum := &View{"VF2", "description", []tag.Key{}, m, Sum()}
+	count := &View{"VF1", "", "description", []tag.Key{key}, m, Count(), nil}
+	sum := &View{"VF2", "", "description", []tag.Key{}, m, Sum(), nil}
 
 	Register(count, sum)
 	worker2.Register(count) // Don't compute the sum for worker2, to verify independence of computation.
@@ -254,8 +259,8 @@ func Test_Worker_RecordFloat64(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	v1 := &View{"VF1", "desc VF1", []tag.Key{k1, k2}, m, Count()}
-	v2 := &View{"VF2", "desc VF2", []tag.Key{k1, k2}, m, Count()}
+	v1 := &View{"VF1", "", "desc VF1", []tag.Key{k1, k2}, m, Count(), nil}
+	v2 := &View{"VF2", "", "desc VF2", []tag.Key{k1, k2}, m, Count(), nil}
 
 	type want struct {
 		v    *View
@@ -360,6 +365,625 @@ func Test_Worker_RecordFloat64(t *testing.T) {
 	}
 }
 
+func TestRegisteredViews(t *testing.T) {
+	restart()
+
+	m := stats.Int64("TestRegisteredViews/m1", "", stats.UnitDimensionless)
+	views := []*View{
+		{Name: "TestRegisteredViews/c", Measure: m, Aggregation: Count()},
+		{Name: "TestRegisteredViews/a", Measure: m, Aggregation: Sum()},
+		{Name: "TestRegisteredViews/b", Measure: m, Aggregation: LastValue()},
+	}
+	if err := Register(views...); err != nil {
+		t.Fatalf("cannot register: %v", err)
+	}
+	defer Unregister(views...)
+
+	got := RegisteredViews()
+	var gotNames []string
+	for _, v := range got {
+		gotNames = append(gotNames, v.Name)
+	}
+	wantNames := []string{"TestRegisteredViews/a", "TestRegisteredViews/b", "TestRegisteredViews/c"}
+	if diff := cmp.Diff(gotNames, wantNames); diff != "" {
+		t.Errorf("RegisteredViews() names differ -got +want: %s", diff)
+	}
+
+	// Mutating the returned slice or views must not affect the registry.
+	got[0].Name = "TestRegisteredViews/mutated"
+	got[0].TagKeys = append(got[0].TagKeys, tag.MustNewKey("mutated"))
+	got[0] = nil
+	again := RegisteredViews()
+	if len(again) != 3 || again[0] == nil {
+		t.Fatalf("RegisteredViews() = %v; want a fresh copy of 3 views", again)
+	}
+	if again[0] == views[1] {
+		t.Error("RegisteredViews() returned the registered view; want a copy")
+	}
+	if again[0].Name != "TestRegisteredViews/a" || len(again[0].TagKeys) != 0 {
+		t.Errorf("RegisteredViews()[0] = %+v; want the unmodified registered view", again[0])
+	}
+
+	Unregister(views[0])
+	if got, want := len(RegisteredViews()), 2; got != want {
+		t.Errorf("len(RegisteredViews()) = %d after Unregister; want %d", got, want)
+	}
+}
+
+func TestMaxRegisteredViews(t *testing.T) {
+	restart()
+
+	m := stats.Int64("TestMaxRegisteredViews/m1", "", stats.UnitDimensionless)
+	newView := func(i int) *View {
+		return &View{Name: "TestMaxRegisteredViews/v" + strconv.Itoa(i), Measure: m, Aggregation: Count()}
+	}
+	SetMaxRegisteredViews(3)
+	for i := 0; i < 3; i++ {
+		if err := Register(newView(i)); err != nil {
+			t.Fatalf("Register() = %v", err)
+		}
+	}
+	if got, want := RegisteredViewCount(), 3; got != want {
+		t.Errorf("RegisteredViewCount() = %d; want %d", got, want)
+	}
+
+	if err := Register(newView(3)); err == nil {
+		t.Error("Register() past the limit = nil; want error")
+	}
+	if err := Register(newView(0)); err != nil {
+		t.Errorf("Register() of an already registered view at the limit = %v; want nil", err)
+	}
+	if got, want := RegisteredViewCount(), 3; got != want {
+		t.Errorf("RegisteredViewCount() = %d; want %d", got, want)
+	}
+
+	Unregister(newView(0))
+	if err := Register(newView(3)); err != nil {
+		t.Errorf("Register() after Unregister = %v; want nil", err)
+	}
+
+	SetMaxRegisteredViews(0)
+	if err := Register(newView(4)); err != nil {
+		t.Errorf("Register() without a limit = %v; want nil", err)
+	}
+	if got, want := RegisteredViewCount(), 4; got != want {
+		t.Errorf("RegisteredViewCount() = %d; want %d", got, want)
+	}
+}
+
+func TestMaxBuckets(t *testing.T) {
+	restart()
+
+	m := stats.Float64("TestMaxBuckets/m1", "", stats.UnitDimensionless)
+	small := &View{Name: "TestMaxBuckets/small", Measure: m, Aggregation: Distribution(1, 2)}
+	large := &View{Name: "TestMaxBuckets/large", Measure: m, Aggregation: Distribution(1, 2, 3)}
+
+	SetMaxBuckets(3)
+	if err := Register(small); err != nil {
+		t.Fatalf("Register(%v) = %v; want nil", small.Name, err)
+	}
+	if err := Register(large); err == nil {
+		t.Errorf("Register(%v) with 4 buckets and a limit of 3 = nil; want error", large.Name)
+	}
+	if v := Find(large.Name); v != nil {
+		t.Errorf("Find(%v) = %v; want nil", large.Name, v)
+	}
+
+	SetMaxBuckets(0)
+	if err := Register(large); err != nil {
+		t.Errorf("Register(%v) without a limit = %v; want nil", large.Name, err)
+	}
+	Unregister(small, large)
+}
+
+func TestRowCount(t *testing.T) {
+	restart()
+
+	m := stats.Int64("TestRowCount/m1", "", stats.UnitDimensionless)
+	k := tag.MustNewKey("k")
+	v := &View{Name: "TestRowCount/v1", Measure: m, TagKeys: []tag.Key{k}, Aggregation: Count()}
+
+	if _, err := RowCount(v.Name); err == nil {
+		t.Error("RowCount() of an unregistered view = nil error; want error")
+	}
+	if err := Register(v); err != nil {
+		t.Fatalf("Register() = %v", err)
+	}
+	defer Unregister(v)
+
+	if got, err := RowCount(v.Name); err != nil || got != 0 {
+		t.Errorf("RowCount() = %d, %v; want 0, nil", got, err)
+	}
+	for _, val := range []string{"a", "b", "c", "a", "b"} {
+		ctx, err := tag.New(context.Background(), tag.Upsert(k, val))
+		if err != nil {
+			t.Fatal(err)
+		}
+		stats.Record(ctx, m.M(1))
+	}
+	if got, err := RowCount(v.Name); err != nil || got != 3 {
+		t.Errorf("RowCount() = %d, %v; want 3, nil", got, err)
+	}
+	rows, err := RetrieveData(v.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := RowCount(v.Name); got != len(rows) {
+		t.Errorf("RowCount() = %d; want len(RetrieveData()) = %d", got, len(rows))
+	}
+}
+
+func TestIterateData(t *testing.T) {
+	restart()
+
+	m := stats.Int64("TestIterateData/m1", "", stats.UnitDimensionless)
+	k := tag.MustNewKey("k")
+	v := &View{Name: "TestIterateData/count", Measure: m, TagKeys: []tag.Key{k}, Aggregation: Count()}
+	if err := Register(v); err != nil {
+		t.Fatalf("cannot register: %v", err)
+	}
+	defer Unregister(v)
+
+	const rows = 10000
+	for i := 0; i < rows; i++ {
+		ctx, _ := tag.New(context.Background(), tag.Upsert(k, strconv.Itoa(i)))
+		stats.Record(ctx, m.M(1))
+	}
+
+	seen := make(map[string]bool)
+	err := IterateData(v.Name, func(r *Row) bool {
+		if got := r.Data.(*CountData).Value; got != 1 {
+			t.Errorf("row %v: count = %d; want 1", r.Tags, got)
+		}
+		seen[r.Tags[0].Value] = true
+		return true
+	})
+	if err != nil {
+		t.Fatalf("IterateData() = %v", err)
+	}
+	if got := len(seen); got != rows {
+		t.Errorf("IterateData() visited %d rows; want %d", got, rows)
+	}
+
+	visited := 0
+	err = IterateData(v.Name, func(r *Row) bool {
+		visited++
+		return visited < 10
+	})
+	if err != nil {
+		t.Fatalf("IterateData() = %v", err)
+	}
+	if visited != 10 {
+		t.Errorf("IterateData() visited %d rows after early termination; want 10", visited)
+	}
+
+	if err := IterateData("TestIterateData/unknown", func(*Row) bool { return true }); err == nil {
+		t.Error("IterateData() for an unregistered view = nil; want error")
+	}
+}
+
+func TestIterateDataDuringUnregister(t *testing.T) {
+	w := NewMeter().(*worker)
+	w.Start()
+	defer w.Stop()
+
+	m := stats.Int64("TestIterateDataDuringUnregister/m1", "", stats.UnitDimensionless)
+	k := tag.MustNewKey("k")
+	v := &View{Name: "TestIterateDataDuringUnregister/count", Measure: m, TagKeys: []tag.Key{k}, Aggregation: Count()}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			if err := w.Register(v); err != nil {
+				t.Errorf("Register() = %v", err)
+				return
+			}
+			for j := 0; j < 10; j++ {
+				tags, _ := tag.New(context.Background(), tag.Upsert(k, strconv.Itoa(j)))
+				w.Record(tag.FromContext(tags), []stats.Measurement{m.M(1)}, nil)
+			}
+			w.Unregister(v)
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		// The view may be unregistered; only the rows visited matter.
+		w.IterateData(v.Name, func(r *Row) bool {
+			if got := r.Data.(*CountData).Value; got < 1 {
+				t.Errorf("row %v: count = %d; want at least 1", r.Tags, got)
+			}
+			return true
+		})
+	}
+}
+
+func TestViewCardinality(t *testing.T) {
+	restart()
+
+	m := stats.Int64("TestViewCardinality/m1", "", stats.UnitDimensionless)
+	k := tag.MustNewKey("k")
+	v1 := &View{Name: "TestViewCardinality/v1", Measure: m, TagKeys: []tag.Key{k}, Aggregation: Count()}
+	v2 := &View{Name: "TestViewCardinality/v2", Measure: m, Aggregation: Count()}
+	if err := Register(v1, v2); err != nil {
+		t.Fatalf("cannot register: %v", err)
+	}
+
+	for _, val := range []string{"a", "b", "c", "a"} {
+		ctx, _ := tag.New(context.Background(), tag.Upsert(k, val))
+		stats.Record(ctx, m.M(1))
+	}
+	// Wait for the recordings to be processed.
+	if _, err := RetrieveData(v1.Name); err != nil {
+		t.Fatalf("RetrieveData() = %v", err)
+	}
+
+	for _, metric := range defaultWorker.Read() {
+		if metric.Descriptor.Name == ViewCardinalityName {
+			t.Fatalf("Read() reported %q before RegisterInternalViews", ViewCardinalityName)
+		}
+	}
+
+	RegisterInternalViews()
+	var got map[string]int64
+	for _, metric := range defaultWorker.Read() {
+		if metric.Descriptor.Name != ViewCardinalityName {
+			continue
+		}
+		got = make(map[string]int64)
+		for _, ts := range metric.TimeSeries {
+			got[ts.LabelValues[0].Value] = ts.Points[0].Value.(int64)
+		}
+	}
+	want := map[string]int64{v1.Name: 3, v2.Name: 1}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("view cardinality mismatch (-got +want):\n%s", diff)
+	}
+}
+
+func TestRecordsDroppedCancelled(t *testing.T) {
+	restart()
+	RegisterInternalViews()
+
+	m := stats.Int64("TestRecordsDroppedCancelled/m1", "", stats.UnitDimensionless)
+	v := &View{Name: "TestRecordsDroppedCancelled/v1", Measure: m, Aggregation: Count()}
+	if err := Register(v); err != nil {
+		t.Fatalf("cannot register: %v", err)
+	}
+	defer Unregister(v)
+
+	dropped := func() int64 {
+		for _, metric := range defaultWorker.Read() {
+			if metric.Descriptor.Name == RecordsDroppedCancelledName {
+				return metric.TimeSeries[0].Points[0].Value.(int64)
+			}
+		}
+		t.Fatalf("Read() did not report %q", RecordsDroppedCancelledName)
+		return 0
+	}
+	before := dropped()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := stats.RecordWithOptions(ctx, stats.SkipIfCancelled(), stats.WithMeasurements(m.M(1))); err != nil {
+		t.Fatalf("RecordWithOptions() = %v", err)
+	}
+	rows, err := RetrieveData(v.Name)
+	if err != nil {
+		t.Fatalf("RetrieveData() = %v", err)
+	}
+	if len(rows) != 0 {
+		t.Errorf("got %d rows after recording with a cancelled context; want 0", len(rows))
+	}
+	if got := dropped() - before; got != 1 {
+		t.Errorf("%s increased by %d; want 1", RecordsDroppedCancelledName, got)
+	}
+
+	// Without SkipIfCancelled, the context is not checked.
+	if err := stats.RecordWithOptions(ctx, stats.WithMeasurements(m.M(1))); err != nil {
+		t.Fatalf("RecordWithOptions() = %v", err)
+	}
+	if rows, _ := RetrieveData(v.Name); len(rows) != 1 {
+		t.Errorf("got %d rows after recording without SkipIfCancelled; want 1", len(rows))
+	}
+
+	// Recordings to another meter are counted by that meter.
+	meter := NewMeter()
+	meter.Start()
+	defer meter.Stop()
+	meter.RegisterInternalViews()
+	if err := meter.Register(v); err != nil {
+		t.Fatalf("cannot register: %v", err)
+	}
+	before = dropped()
+	if err := stats.RecordWithOptions(ctx, stats.SkipIfCancelled(), stats.WithRecorder(meter), stats.WithMeasurements(m.M(1))); err != nil {
+		t.Fatalf("RecordWithOptions() = %v", err)
+	}
+	if got := dropped() - before; got != 0 {
+		t.Errorf("%s of the default meter increased by %d for a recording to another meter; want 0", RecordsDroppedCancelledName, got)
+	}
+	var got int64 = -1
+	for _, metric := range meter.(*worker).Read() {
+		if metric.Descriptor.Name == RecordsDroppedCancelledName {
+			got = metric.TimeSeries[0].Points[0].Value.(int64)
+		}
+	}
+	if got != 1 {
+		t.Errorf("%s of the other meter = %d; want 1", RecordsDroppedCancelledName, got)
+	}
+}
+
+func TestGaugeAggregation(t *testing.T) {
+	restart()
+
+	m := stats.Int64("TestGaugeAggregation/m1", "", stats.UnitDimensionless)
+	v := &View{Name: "TestGaugeAggregation/queue", Measure: m, Aggregation: Gauge()}
+	if err := Register(v); err != nil {
+		t.Fatalf("cannot register: %v", err)
+	}
+
+	gauges := func(metrics []*metricdata.Metric) map[string]int64 {
+		got := make(map[string]int64)
+		for _, metric := range metrics {
+			if metric.Descriptor.Type != metricdata.TypeGaugeInt64 {
+				t.Errorf("metric %q has type %v; want %v", metric.Descriptor.Name, metric.Descriptor.Type, metricdata.TypeGaugeInt64)
+			}
+			got[metric.Descriptor.Name] = metric.TimeSeries[0].Points[0].Value.(int64)
+		}
+		return got
+	}
+	read := func(values ...int64) map[string]int64 {
+		for _, val := range values {
+			stats.Record(context.Background(), m.M(val))
+		}
+		// Wait for the recordings to be processed.
+		if _, err := RetrieveData(v.Name); err != nil {
+			t.Fatalf("RetrieveData() = %v", err)
+		}
+		// Reading, reporting and reading for another reader do not start a
+		// new window for the reader.
+		defaultWorker.Read()
+		defaultWorker.reportUsage()
+		defaultWorker.ReadWindow("other")
+		return gauges(defaultWorker.ReadWindow("reader"))
+	}
+
+	tests := []struct {
+		values []int64
+		want   map[string]int64
+	}{
+		{
+			values: []int64{5, 1, 9, 4},
+			want: map[string]int64{
+				"TestGaugeAggregation/queue_last": 4,
+				"TestGaugeAggregation/queue_min":  1,
+				"TestGaugeAggregation/queue_max":  9,
+			},
+		},
+		{
+			values: []int64{6, 7},
+			want: map[string]int64{
+				"TestGaugeAggregation/queue_last": 7,
+				"TestGaugeAggregation/queue_min":  4,
+				"TestGaugeAggregation/queue_max":  7,
+			},
+		},
+		{
+			// Without new values, min and max are the last value.
+			want: map[string]int64{
+				"TestGaugeAggregation/queue_last": 7,
+				"TestGaugeAggregation/queue_min":  7,
+				"TestGaugeAggregation/queue_max":  7,
+			},
+		},
+	}
+	for i, tt := range tests {
+		if diff := cmp.Diff(read(tt.values...), tt.want); diff != "" {
+			t.Errorf("collection %d: gauges differ (-got +want):\n%s", i, diff)
+		}
+	}
+
+	// Without windows, the data describes all the values recorded.
+	want := map[string]int64{
+		"TestGaugeAggregation/queue_last": 7,
+		"TestGaugeAggregation/queue_min":  1,
+		"TestGaugeAggregation/queue_max":  9,
+	}
+	if diff := cmp.Diff(gauges(defaultWorker.Read()), want); diff != "" {
+		t.Errorf("Read(): gauges differ (-got +want):\n%s", diff)
+	}
+}
+
+func TestUniqueCountAggregation(t *testing.T) {
+	restart()
+
+	m := stats.Int64("TestUniqueCountAggregation/requests", "", stats.UnitDimensionless)
+	endpoint := tag.MustNewKey("endpoint")
+	user := tag.MustNewKey("user")
+	v := &View{Name: "TestUniqueCountAggregation/users", Measure: m, TagKeys: []tag.Key{endpoint}, Aggregation: UniqueCount(user)}
+	if err := Register(v); err != nil {
+		t.Fatalf("cannot register: %v", err)
+	}
+	defer Unregister(v)
+
+	record := func(ep string, users int) {
+		for i := 0; i < users; i++ {
+			ctx, _ := tag.New(context.Background(), tag.Upsert(endpoint, ep), tag.Upsert(user, strconv.Itoa(i)))
+			stats.Record(ctx, m.M(1), m.M(1))
+		}
+	}
+	record("/a", 3)
+	record("/b", 20)
+	// Recordings without the user tag are ignored.
+	ctx, _ := tag.New(context.Background(), tag.Upsert(endpoint, "/a"))
+	stats.Record(ctx, m.M(1))
+
+	rows, err := RetrieveData(v.Name)
+	if err != nil {
+		t.Fatalf("RetrieveData() = %v", err)
+	}
+	got := make(map[string]int64)
+	for _, row := range rows {
+		got[row.Tags[0].Value] = row.Data.(*UniqueCountData).Estimate()
+	}
+	if diff := cmp.Diff(got, map[string]int64{"/a": 3, "/b": 20}); diff != "" {
+		t.Errorf("unexpected estimates (-got +want):\n%s", diff)
+	}
+
+	for _, metric := range defaultWorker.Read() {
+		if metric.Descriptor.Name != v.Name {
+			continue
+		}
+		if metric.Descriptor.Type != metricdata.TypeGaugeInt64 {
+			t.Errorf("metric type = %v; want %v", metric.Descriptor.Type, metricdata.TypeGaugeInt64)
+		}
+		if len(metric.TimeSeries) != 2 {
+			t.Errorf("got %d time series; want 2", len(metric.TimeSeries))
+		}
+	}
+}
+
+func TestWeightedSumAggregation(t *testing.T) {
+	restart()
+
+	m := stats.Int64("TestWeightedSumAggregation/bytes", "", stats.UnitBytes)
+	priority := tag.MustNewKey("priority")
+	v := &View{Name: "TestWeightedSumAggregation/weighted_bytes", Measure: m, Aggregation: WeightedSum(priority)}
+	if err := Register(v); err != nil {
+		t.Fatalf("cannot register: %v", err)
+	}
+	defer Unregister(v)
+
+	record := func(value int64, weight string) {
+		ctx := context.Background()
+		if weight != "" {
+			ctx, _ = tag.New(ctx, tag.Upsert(priority, weight))
+		}
+		stats.Record(ctx, m.M(value))
+	}
+	record(10, "2")
+	record(4, "0.5")
+	// Recordings without a numeric weight count once.
+	record(3, "")
+	record(5, "high")
+
+	rows, err := RetrieveData(v.Name)
+	if err != nil {
+		t.Fatalf("RetrieveData() = %v", err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("got %d rows; want 1", len(rows))
+	}
+	if got, want := rows[0].Data.(*SumData).Value, 20+2+3+5.0; got != want {
+		t.Errorf("weighted sum = %v; want %v", got, want)
+	}
+
+	for _, metric := range defaultWorker.Read() {
+		if metric.Descriptor.Name != v.Name {
+			continue
+		}
+		if metric.Descriptor.Type != metricdata.TypeCumulativeFloat64 {
+			t.Errorf("metric type = %v; want %v", metric.Descriptor.Type, metricdata.TypeCumulativeFloat64)
+		}
+	}
+	if WeightedSum(priority).Equal(Sum()) || !WeightedSum(priority).Equal(WeightedSum(priority)) {
+		t.Error("WeightedSum is not compared by its weight key")
+	}
+}
+
+func TestRetrieveDataCopiesExemplars(t *testing.T) {
+	restart()
+
+	m := stats.Float64("TestRetrieveDataCopiesExemplars/latency", "", stats.UnitMilliseconds)
+	v := &View{Name: "TestRetrieveDataCopiesExemplars/latency", Measure: m, Aggregation: Distribution(10, 100)}
+	if err := Register(v); err != nil {
+		t.Fatalf("cannot register: %v", err)
+	}
+	defer Unregister(v)
+	attachments := stats.WithAttachments(map[string]interface{}{"request_id": "abc"})
+	record := func(val float64) {
+		stats.RecordWithOptions(context.Background(), attachments, stats.WithMeasurements(m.M(val)))
+	}
+	exemplars := func() []*metricdata.Exemplar {
+		rows, err := RetrieveData(v.Name)
+		if err != nil {
+			t.Fatalf("RetrieveData() = %v", err)
+		}
+		return rows[0].Data.(*DistributionData).ExemplarsPerBucket
+	}
+
+	record(5)
+	got := exemplars()
+	got[0].Value = -1
+	if e := exemplars()[0]; e.Value != 5 {
+		t.Fatalf("modifying a retrieved exemplar changed the collected one to %v", e.Value)
+	}
+
+	// Run with -race: reading retrieved exemplars must not race with
+	// recording and collection.
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			record(float64(i % 200))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				defaultWorker.Read()
+			}
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		for _, e := range exemplars() {
+			if e != nil {
+				e.Value = -1
+			}
+		}
+	}
+	close(done)
+	wg.Wait()
+}
+
+func TestSumDataCount(t *testing.T) {
+	restart()
+
+	m := stats.Float64("TestSumDataCount/latency", "", stats.UnitMilliseconds)
+	v := &View{Name: "TestSumDataCount/latency", Measure: m, Aggregation: Sum()}
+	if err := Register(v); err != nil {
+		t.Fatalf("cannot register: %v", err)
+	}
+	defer Unregister(v)
+	for _, val := range []float64{2, 4.5, 7, 10.5} {
+		stats.Record(context.Background(), m.M(val))
+	}
+
+	rows, err := RetrieveData(v.Name)
+	if err != nil {
+		t.Fatalf("RetrieveData() = %v", err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("got %d rows; want 1", len(rows))
+	}
+	got := rows[0].Data.(*SumData)
+	if got.Value != 24 || got.Count != 4 {
+		t.Errorf("got Value %v and Count %d; want 24 and 4", got.Value, got.Count)
+	}
+	if mean := got.Value / float64(got.Count); mean != 6 {
+		t.Errorf("mean = %v; want 6", mean)
+	}
+}
 func TestReportUsage(t *testing.T) {
 	ctx := context.Background()
 
@@ -417,6 +1041,335 @@ func TestReportUsage(t *testing.T) {
 
 }
 
+func TestMeterRegisterExporter(t *testing.T) {
+	restart()
+
+	m := stats.Int64("measure/TestMeterRegisterExporter", "desc", "unit")
+	v := &View{Name: "TestMeterRegisterExporter", Measure: m, Aggregation: Count()}
+
+	meter := NewMeter()
+	meter.Start()
+	defer meter.Stop()
+
+	global := &vdExporter{}
+	RegisterExporter(global)
+	defer UnregisterExporter(global)
+	scoped := &vdExporter{}
+	meter.RegisterExporter(scoped)
+	defer meter.UnregisterExporter(scoped)
+
+	if err := Register(v); err != nil {
+		t.Fatalf("Register() = %v", err)
+	}
+	if err := meter.Register(v); err != nil {
+		t.Fatalf("meter.Register() = %v", err)
+	}
+	stats.Record(context.Background(), m.M(1))
+	meter.Record(tag.FromContext(context.Background()), []stats.Measurement{m.M(1), m.M(1)}, nil)
+
+	// Unregistering reports the pending data of the view.
+	meter.Unregister(v)
+	Unregister(v)
+
+	count := func(e *vdExporter) []int64 {
+		e.Lock()
+		defer e.Unlock()
+		var counts []int64
+		for _, vd := range e.vds {
+			for _, r := range vd.Rows {
+				counts = append(counts, r.Data.(*CountData).Value)
+			}
+		}
+		return counts
+	}
+	if diff := cmp.Diff(count(scoped), []int64{2}); diff != "" {
+		t.Errorf("meter exporter counts differ (-got +want):\n%s", diff)
+	}
+	if diff := cmp.Diff(count(global), []int64{1}); diff != "" {
+		t.Errorf("global exporter counts differ (-got +want):\n%s", diff)
+	}
+}
+
+func TestReRegister(t *testing.T) {
+	t0 := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	fc := &fakeClock{now: t0}
+	SetClock(fc)
+	defer SetClock(nil)
+
+	w := NewMeter().(*worker)
+	w.Start()
+	defer w.Stop()
+
+	k := tag.MustNewKey("k")
+	m := stats.Int64("measure/TestReRegister", "desc", "unit")
+	v1 := &View{Name: "TestReRegister/v1", Measure: m, TagKeys: []tag.Key{k}, Aggregation: Sum()}
+	if err := w.Register(v1); err != nil {
+		t.Fatalf("Register() = %v", err)
+	}
+	tags, _ := tag.New(context.Background(), tag.Upsert(k, "a"))
+	w.Record(tag.FromContext(tags), []stats.Measurement{m.M(3)}, nil)
+
+	fc.Advance(time.Hour)
+	v2 := &View{Name: "TestReRegister/v2", Description: "renamed", Measure: m, TagKeys: []tag.Key{k}, Aggregation: Sum()}
+	if err := w.ReRegister(v1, v2); err != nil {
+		t.Fatalf("ReRegister() = %v", err)
+	}
+	if w.Find(v1.Name) != nil {
+		t.Errorf("Find(%q) != nil after ReRegister()", v1.Name)
+	}
+	w.Record(tag.FromContext(tags), []stats.Measurement{m.M(4)}, nil)
+	rows, err := w.RetrieveData(v2.Name)
+	if err != nil {
+		t.Fatalf("RetrieveData() = %v", err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("RetrieveData() = %d rows; want 1", len(rows))
+	}
+	if got := rows[0].Data.(*SumData); got.Value != 7 || !got.Start.Equal(t0) {
+		t.Errorf("migrated row = %+v; want sum 7 started at %v", got, t0)
+	}
+
+	fc.Advance(time.Hour)
+	v3 := &View{Name: "TestReRegister/v2", Measure: m, Aggregation: Sum()}
+	if err := w.ReRegister(v2, v3); err != nil {
+		t.Fatalf("ReRegister() = %v", err)
+	}
+	w.Record(tag.FromContext(tags), []stats.Measurement{m.M(5)}, nil)
+	rows, err = w.RetrieveData(v3.Name)
+	if err != nil {
+		t.Fatalf("RetrieveData() = %v", err)
+	}
+	if got := rows[0].Data.(*SumData); got.Value != 5 || !got.Start.Equal(t0.Add(2*time.Hour)) {
+		t.Errorf("row after incompatible change = %+v; want sum 5 started at %v", got, t0.Add(2*time.Hour))
+	}
+
+	if err := w.ReRegister(v1, v3); err == nil {
+		t.Error("ReRegister() of an unregistered view = nil; want error")
+	}
+}
+
+func TestReRegisterAtomic(t *testing.T) {
+	w := NewMeter().(*worker)
+	w.Start()
+	defer w.Stop()
+
+	m := stats.Int64("measure/TestReRegisterAtomic", "desc", "unit")
+	views := []*View{
+		{Name: "TestReRegisterAtomic", Description: "a", Measure: m, Aggregation: Sum()},
+		{Name: "TestReRegisterAtomic", Description: "b", Measure: m, Aggregation: Sum()},
+	}
+	if err := w.Register(views[0]); err != nil {
+		t.Fatalf("Register() = %v", err)
+	}
+	w.Record(nil, []stats.Measurement{m.M(3)}, nil)
+	if _, err := w.RetrieveData(views[0].Name); err != nil {
+		t.Fatalf("RetrieveData() = %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 2000; i++ {
+			if err := w.ReRegister(views[i%2], views[(i+1)%2]); err != nil {
+				t.Errorf("ReRegister() = %v", err)
+				return
+			}
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		var found bool
+		for _, metric := range w.Read() {
+			if metric.Descriptor.Name != views[0].Name {
+				continue
+			}
+			found = true
+			if len(metric.TimeSeries) != 1 || metric.TimeSeries[0].Points[0].Value != int64(3) {
+				t.Fatalf("Read() during ReRegister() = %v; want the migrated row", metric.TimeSeries)
+			}
+		}
+		if !found {
+			t.Fatal("Read() during ReRegister() is missing the view")
+		}
+	}
+}
+
+type panicExporter struct{}
+
+func (panicExporter) ExportView(*Data) { panic("export failed") }
+
+type errExporter struct{}
+
+func (errExporter) ExportView(*Data) {}
+
+func (errExporter) ExportViewErr(*Data) error { return errors.New("backend unavailable") }
+
+func TestExportViewPanicWithoutHandler(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	w := NewMeter().(*worker)
+	v := &View{Name: "TestExportViewPanicWithoutHandler"}
+	if err := w.exportView(panicExporter{}, &Data{View: v}); err != nil {
+		t.Errorf("exportView() = %v; want nil", err)
+	}
+	if !strings.Contains(buf.String(), "panicked") || !strings.Contains(buf.String(), "export failed") {
+		t.Errorf("panic was not logged, log output: %q", buf.String())
+	}
+}
+
+func TestReportingErrorHandler(t *testing.T) {
+	restart()
+
+	m := stats.Int64("measure/TestReportingErrorHandler", "desc", "unit")
+	v := &View{Name: "TestReportingErrorHandler", Measure: m, Aggregation: Count()}
+	if err := Register(v); err != nil {
+		t.Fatalf("Register() = %v", err)
+	}
+	defer Unregister(v)
+
+	var (
+		mu   sync.Mutex
+		errs []error
+	)
+	SetReportingErrorHandler(func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, err)
+	})
+	defer SetReportingErrorHandler(nil)
+
+	e := &countExporter{}
+	for _, exp := range []Exporter{panicExporter{}, errExporter{}, e} {
+		RegisterExporter(exp)
+		defer UnregisterExporter(exp)
+	}
+
+	stats.Record(context.Background(), m.M(1))
+	SetReportingPeriod(10 * time.Millisecond)
+	defer SetReportingPeriod(time.Hour)
+
+	// Wait for two reporting periods, to verify reporting continues after
+	// the exporter panicked.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		n := len(errs)
+		mu.Unlock()
+		e.Lock()
+		total := e.totalCount
+		e.Unlock()
+		if n >= 4 && total >= 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d errors and %d exported counts; want at least 4 and 2", n, total)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	SetReportingPeriod(time.Hour)
+	mu.Lock()
+	defer mu.Unlock()
+	var panics, failures int
+	for _, err := range errs {
+		switch {
+		case strings.Contains(err.Error(), "panicked") && strings.Contains(err.Error(), "export failed"):
+			panics++
+		case strings.Contains(err.Error(), "backend unavailable"):
+			failures++
+		default:
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if panics == 0 || failures == 0 {
+		t.Errorf("got %d panic errors and %d export errors; want both", panics, failures)
+	}
+}
+
+func TestPauseResumeReporting(t *testing.T) {
+	restart()
+	ctx := context.Background()
+
+	m := stats.Int64("measure/TestPauseResumeReporting", "desc", "unit")
+	v := &View{Name: "TestPauseResumeReporting", Measure: m, Aggregation: Count()}
+	if err := Register(v); err != nil {
+		t.Fatalf("cannot register: %v", err)
+	}
+
+	e := &countExporter{}
+	RegisterExporter(e)
+	defer UnregisterExporter(e)
+
+	PauseReporting()
+	SetReportingPeriod(10 * time.Millisecond)
+	stats.Record(ctx, m.M(1))
+	stats.Record(ctx, m.M(1))
+	stats.Record(ctx, m.M(1))
+
+	time.Sleep(50 * time.Millisecond)
+
+	e.Lock()
+	count := e.totalCount
+	e.Unlock()
+	if count != 0 {
+		t.Fatalf("exporter received count data = %v while paused; want none", count)
+	}
+
+	SetReportingPeriod(time.Hour)
+	ResumeReporting()
+
+	e.Lock()
+	count = e.count
+	e.Unlock()
+	if got, want := count, int64(3); got != want {
+		t.Errorf("count data exported on resume = %v; want %v", got, want)
+	}
+}
+
+func TestExporterCalledPerInterval(t *testing.T) {
+	restart()
+	ctx := context.Background()
+
+	m := stats.Int64("measure/TestExporterCalledPerInterval", "desc", "unit")
+	count := &View{Name: "TestExporterCalledPerInterval/count", Measure: m, Aggregation: Count()}
+	sum := &View{Name: "TestExporterCalledPerInterval/sum", Measure: m, Aggregation: Sum()}
+	if err := Register(count, sum); err != nil {
+		t.Fatalf("cannot register: %v", err)
+	}
+	stats.Record(ctx, m.M(2))
+
+	e := &vdExporter{}
+	RegisterExporter(e)
+	SetReportingPeriod(10 * time.Millisecond)
+	time.Sleep(55 * time.Millisecond)
+	UnregisterExporter(e)
+
+	e.Lock()
+	defer e.Unlock()
+	perView := make(map[string]int)
+	for _, vd := range e.vds {
+		perView[vd.View.Name]++
+		if len(vd.Rows) != 1 {
+			t.Errorf("%s: exported %d rows; want 1", vd.View.Name, len(vd.Rows))
+		}
+		if vd.End.Before(vd.Start) {
+			t.Errorf("%s: exported data ends (%v) before it starts (%v)", vd.View.Name, vd.End, vd.Start)
+		}
+	}
+	for _, v := range []*View{count, sum} {
+		// At least a few reporting periods have elapsed.
+		if got := perView[v.Name]; got < 2 {
+			t.Errorf("%s: exported %d times; want one export per reporting period", v.Name, got)
+		}
+	}
+}
+
 func Test_SetReportingPeriodReqNeverBlocks(t *testing.T) {
 	t.Parallel()
 
@@ -661,3 +1614,57 @@ func (ts byLabel) Less(i, j int) bool {
 	}
 	return false
 }
+
+func TestUnregisterByPrefix(t *testing.T) {
+	restart()
+	defer restart()
+	SetReportingPeriod(time.Hour)
+
+	m := stats.Int64("measure/TestUnregisterByPrefix", "desc", "unit")
+	var group []*View
+	for _, name := range []string{"subsystem/a", "subsystem/b", "subsystem/c"} {
+		group = append(group, &View{Name: name, Measure: m, Aggregation: Count()})
+	}
+	other := &View{Name: "other/subsystem", Measure: m, Aggregation: Count()}
+	if err := Register(append(group, other)...); err != nil {
+		t.Fatalf("cannot register: %v", err)
+	}
+	e := &vdExporter{}
+	RegisterExporter(e)
+	RegisterExporter(errExporter{})
+	stats.Record(context.Background(), m.M(1))
+
+	errs := UnregisterByPrefix("subsystem/")
+	if len(errs) != len(group) {
+		t.Errorf("UnregisterByPrefix() = %v; want an error of errExporter per view", errs)
+	}
+	for _, v := range group {
+		if Find(v.Name) != nil {
+			t.Errorf("view %q is still registered", v.Name)
+		}
+		if _, err := RetrieveData(v.Name); err == nil {
+			t.Errorf("RetrieveData(%q) = nil error after unregistering", v.Name)
+		}
+	}
+	if Find(other.Name) == nil {
+		t.Errorf("view %q was unregistered; want it to remain", other.Name)
+	}
+	if rows, err := RetrieveData(other.Name); err != nil || len(rows) != 1 {
+		t.Errorf("RetrieveData(%q) = %v, %v; want its row", other.Name, rows, err)
+	}
+
+	// The pending data of the unregistered views was reported.
+	e.Lock()
+	var reported []string
+	for _, vd := range e.vds {
+		reported = append(reported, vd.View.Name)
+	}
+	e.Unlock()
+	if want := []string{"subsystem/a", "subsystem/b", "subsystem/c"}; !cmp.Equal(reported, want) {
+		t.Errorf("reported views = %v; want %v", reported, want)
+	}
+
+	if errs := UnregisterByPrefix(""); len(errs) != 1 || Find(other.Name) == nil {
+		t.Errorf("UnregisterByPrefix(\"\") = %v; want an error and no view unregistered", errs)
+	}
+}
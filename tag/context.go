@@ -17,16 +17,20 @@ package tag
 
 import (
 	"context"
+	"sync/atomic"
 )
 
 // FromContext returns the tag map stored in the context.
 func FromContext(ctx context.Context) *Map {
 	// The returned tag map shouldn't be mutated.
-	ts := ctx.Value(mapCtxKey)
-	if ts == nil {
+	switch ts := ctx.Value(mapCtxKey).(type) {
+	case *Map:
+		return ts
+	case *scope:
+		return ts.current()
+	default:
 		return nil
 	}
-	return ts.(*Map)
 }
 
 // NewContext creates a new context with the given tag map.
@@ -38,6 +42,45 @@ func NewContext(ctx context.Context, m *Map) context.Context {
 	return context.WithValue(ctx, mapCtxKey, m)
 }
 
+// WithTags is like New, but additionally returns a function that restores
+// the tag map of the returned context to the exact map of ctx. It allows
+// scoping tags to a block:
+//
+//	ctx, restore, err := tag.WithTags(ctx, tag.Upsert(key, "value"))
+//	if err != nil {
+//		// handle error
+//	}
+//	defer restore()
+//
+// Contexts derived from the returned context with New or NewContext keep
+// their own tag maps after restore is called.
+func WithTags(ctx context.Context, mutator ...Mutator) (context.Context, func(), error) {
+	prior := FromContext(ctx)
+	tctx, err := New(ctx, mutator...)
+	if err != nil {
+		return ctx, func() {}, err
+	}
+	s := &scope{m: FromContext(tctx), prior: prior}
+	return context.WithValue(ctx, mapCtxKey, s), s.restore, nil
+}
+
+// scope is a tag map that can be reverted to the tag map it replaced.
+type scope struct {
+	m, prior *Map
+	restored uint32 // 1 once restore is called, use atomic to access
+}
+
+func (s *scope) current() *Map {
+	if atomic.LoadUint32(&s.restored) == 1 {
+		return s.prior
+	}
+	return s.m
+}
+
+func (s *scope) restore() {
+	atomic.StoreUint32(&s.restored, 1)
+}
+
 type ctxKey struct{}
 
 var mapCtxKey = ctxKey{}
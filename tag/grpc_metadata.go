@@ -0,0 +1,57 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package tag
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// GRPCMetadataKey is the gRPC metadata key the tags are propagated in by
+// ToGRPCMetadata, in the binary format of Encode. It is the key gRPC
+// propagates the tags set with its stats.SetTags in, which the ocgrpc plugin
+// uses, so that both interoperate.
+const GRPCMetadataKey = "grpc-tags-bin"
+
+// FromGRPCMetadata decodes the tags propagated in md with ToGRPCMetadata.
+// If md has no tags, an empty map is returned. If the tags are corrupt, an
+// error is returned. The tags received can be added to a context with
+// NewContext.
+func FromGRPCMetadata(md metadata.MD) (*Map, error) {
+	values := md.Get(GRPCMetadataKey)
+	if len(values) == 0 {
+		return newMap(), nil
+	}
+	m, err := Decode([]byte(values[0]))
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode tags from gRPC metadata %q: %v", GRPCMetadataKey, err)
+	}
+	return m, nil
+}
+
+// ToGRPCMetadata encodes the tags in ctx into gRPC metadata, for example to
+// propagate them with metadata.NewOutgoingContext without the ocgrpc plugin.
+// Only the tags with unlimited propagation are encoded, see WithTTL. The
+// metadata is empty if ctx has no tags.
+func ToGRPCMetadata(ctx context.Context) metadata.MD {
+	m := FromContext(ctx)
+	if m == nil || len(m.m) == 0 {
+		return metadata.MD{}
+	}
+	return metadata.Pairs(GRPCMetadataKey, string(Encode(m)))
+}
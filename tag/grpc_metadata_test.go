@@ -0,0 +1,78 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package tag
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+)
+
+func TestGRPCMetadataRoundTrip(t *testing.T) {
+	k1 := MustNewKey("k1")
+	k2 := MustNewKey("k2")
+	local := MustNewKey("local")
+	ctx, err := New(context.Background(),
+		Insert(k1, "v1"),
+		Insert(k2, "v2"),
+		Insert(local, "not propagated", WithTTL(TTLNoPropagation)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	md := ToGRPCMetadata(ctx)
+	if got := len(md.Get(GRPCMetadataKey)); got != 1 {
+		t.Fatalf("ToGRPCMetadata() has %d values for %q; want 1", got, GRPCMetadataKey)
+	}
+	m, err := FromGRPCMetadata(md)
+	if err != nil {
+		t.Fatalf("FromGRPCMetadata() = %v", err)
+	}
+	want := map[Key]string{k1: "v1", k2: "v2"}
+	got := map[Key]string{}
+	for k, v := range m.m {
+		got[k] = v.value
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FromGRPCMetadata(ToGRPCMetadata()) = %v; want %v", got, want)
+	}
+}
+
+func TestGRPCMetadataAbsent(t *testing.T) {
+	if md := ToGRPCMetadata(context.Background()); len(md) != 0 {
+		t.Errorf("ToGRPCMetadata() without tags = %v; want empty metadata", md)
+	}
+	for _, md := range []metadata.MD{nil, metadata.Pairs("other", "value")} {
+		m, err := FromGRPCMetadata(md)
+		if err != nil {
+			t.Errorf("FromGRPCMetadata(%v) = %v", md, err)
+			continue
+		}
+		if m == nil || len(m.m) != 0 {
+			t.Errorf("FromGRPCMetadata(%v) = %v; want an empty map", md, m)
+		}
+	}
+}
+
+func TestGRPCMetadataCorrupt(t *testing.T) {
+	md := metadata.Pairs(GRPCMetadataKey, "\x00\x00\x05k")
+	if m, err := FromGRPCMetadata(md); err == nil {
+		t.Errorf("FromGRPCMetadata() with corrupt tags = %v, nil error; want error", m)
+	}
+}
@@ -18,7 +18,9 @@ package tag
 import (
 	"bytes"
 	"context"
+	"encoding/binary"
 	"fmt"
+	"hash/fnv"
 	"sort"
 )
 
@@ -67,6 +69,59 @@ func (m *Map) String() string {
 	return buffer.String()
 }
 
+// Hash returns a hash of the tags in m, which does not depend on the order
+// the tags were inserted in, nor on their metadata. Maps with the same tags
+// have the same hash, like the rows of a view are the same for the same tag
+// values, and maps with different tags have different hashes with high
+// probability. It can be used to key caches by tag set.
+func (m *Map) Hash() uint64 {
+	h := fnv.New64a()
+	if m == nil {
+		return h.Sum64()
+	}
+	keys := make([]Key, 0, len(m.m))
+	for k := range m.m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Name() < keys[j].Name() })
+
+	// Prefix names and values with their length, so that the encoding of
+	// different tags cannot be the same.
+	var buf [binary.MaxVarintLen64]byte
+	write := func(s string) {
+		n := binary.PutUvarint(buf[:], uint64(len(s)))
+		h.Write(buf[:n])
+		h.Write([]byte(s))
+	}
+	for _, k := range keys {
+		write(k.name)
+		write(m.m[k].value)
+	}
+	return h.Sum64()
+}
+
+// With returns a copy of m with tags upserted, as by New with an Upsert
+// mutator for each of them, but without creating a context. m is not
+// modified and may be nil.
+func (m *Map) With(tags ...Tag) (*Map, error) {
+	var orig map[Key]tagContent
+	if m != nil {
+		orig = m.m
+	}
+	n := &Map{m: make(map[Key]tagContent, len(orig)+len(tags))}
+	for k, v := range orig {
+		n.m[k] = v
+	}
+	for _, t := range tags {
+		v := normalizeValue(t.Value)
+		if !checkValue(v) {
+			return nil, fmt.Errorf("key:%q value:%q: %v", t.Key.Name(), t.Value, errInvalidValue)
+		}
+		n.upsert(t.Key, v, createMetadatas())
+	}
+	return n, nil
+}
+
 func (m *Map) insert(k Key, v string, md metadatas) {
 	if _, ok := m.m[k]; ok {
 		return
@@ -107,6 +162,7 @@ type Mutator interface {
 func Insert(k Key, v string, mds ...Metadata) Mutator {
 	return &mutator{
 		fn: func(m *Map) (*Map, error) {
+			v := normalizeValue(v)
 			if !checkValue(v) {
 				return nil, errInvalidValue
 			}
@@ -126,6 +182,7 @@ func Insert(k Key, v string, mds ...Metadata) Mutator {
 func Update(k Key, v string, mds ...Metadata) Mutator {
 	return &mutator{
 		fn: func(m *Map) (*Map, error) {
+			v := normalizeValue(v)
 			if !checkValue(v) {
 				return nil, errInvalidValue
 			}
@@ -146,6 +203,7 @@ func Update(k Key, v string, mds ...Metadata) Mutator {
 func Upsert(k Key, v string, mds ...Metadata) Mutator {
 	return &mutator{
 		fn: func(m *Map) (*Map, error) {
+			v := normalizeValue(v)
 			if !checkValue(v) {
 				return nil, errInvalidValue
 			}
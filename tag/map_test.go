@@ -47,6 +47,46 @@ func TestContext(t *testing.T) {
 	}
 }
 
+func TestWithTags(t *testing.T) {
+	k1, _ := NewKey("k1")
+	k2, _ := NewKey("k2")
+
+	ctx, _ := New(context.Background(), Insert(k1, "v1"))
+	prior := FromContext(ctx)
+
+	scoped, restore, err := WithTags(ctx, Insert(k2, "v2"), Update(k1, "v1-scoped"))
+	if err != nil {
+		t.Fatalf("WithTags() = %v", err)
+	}
+	want := newMap()
+	want.insert(k1, "v1-scoped", ttlUnlimitedPropMd)
+	want.insert(k2, "v2", ttlUnlimitedPropMd)
+	if got := FromContext(scoped); !reflect.DeepEqual(got, want) {
+		t.Errorf("Map in scope = %#v; want %#v", got, want)
+	}
+
+	restore()
+	if got := FromContext(scoped); got != prior {
+		t.Errorf("Map after restore = %#v; want the prior map %#v", got, prior)
+	}
+	if _, ok := FromContext(scoped).Value(k2); ok {
+		t.Errorf("tag %v still present after restore", k2)
+	}
+
+	empty, restore, err := WithTags(context.Background(), Insert(k1, "v1"))
+	if err != nil {
+		t.Fatalf("WithTags() = %v", err)
+	}
+	restore()
+	if got := FromContext(empty); got != nil {
+		t.Errorf("Map after restore = %#v; want nil", got)
+	}
+
+	if _, _, err := WithTags(ctx, Insert(k2, "\x01")); err == nil {
+		t.Error("WithTags() with an invalid value = nil error; want error")
+	}
+}
+
 func TestDo(t *testing.T) {
 	k1, _ := NewKey("k1")
 	k2, _ := NewKey("k2")
@@ -173,6 +213,78 @@ func TestNewMap(t *testing.T) {
 	}
 }
 
+func TestMapHash(t *testing.T) {
+	k1, _ := NewKey("k1")
+	k2, _ := NewKey("k2")
+	k3, _ := NewKey("k3")
+	newMap := func(mutators ...Mutator) *Map {
+		ctx, err := New(context.Background(), mutators...)
+		if err != nil {
+			t.Fatalf("New() = %v", err)
+		}
+		return FromContext(ctx)
+	}
+
+	m := newMap(Insert(k1, "v1"), Insert(k2, "v2"))
+	same := []*Map{
+		newMap(Insert(k2, "v2"), Insert(k1, "v1")),
+		newMap(Insert(k1, "v1"), Insert(k3, "v3"), Insert(k2, "v2"), Delete(k3)),
+		newMap(Insert(k1, "v1", WithTTL(TTLNoPropagation)), Upsert(k2, "v2")),
+	}
+	for i, other := range same {
+		if m.Hash() != other.Hash() {
+			t.Errorf("#%d: Hash() of %v = %x; want %x like %v", i, other, other.Hash(), m.Hash(), m)
+		}
+	}
+
+	different := []*Map{
+		nil,
+		newMap(Insert(k1, "v1")),
+		newMap(Insert(k1, "v1"), Insert(k2, "v3")),
+		newMap(Insert(k1, "v1"), Insert(k3, "v2")),
+		newMap(Insert(k1, "v1v2"), Insert(k2, "")),
+		newMap(Insert(k1, "v1"), Insert(k2, "v2"), Insert(k3, "v3")),
+	}
+	seen := map[uint64]*Map{m.Hash(): m}
+	for _, other := range different {
+		if prev, ok := seen[other.Hash()]; ok {
+			t.Errorf("Hash() of %v = Hash() of %v; want different", other, prev)
+		}
+		seen[other.Hash()] = other
+	}
+}
+
+func TestMapWith(t *testing.T) {
+	k1, _ := NewKey("k1")
+	k2, _ := NewKey("k2")
+	ctx, err := New(context.Background(), Insert(k1, "v1"), Insert(k2, "v2"))
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+	m := FromContext(ctx)
+
+	got, err := m.With(Tag{Key: k2, Value: "v3"})
+	if err != nil {
+		t.Fatalf("With() = %v", err)
+	}
+	want, _ := New(ctx, Upsert(k2, "v3"))
+	if !reflect.DeepEqual(got, FromContext(want)) {
+		t.Errorf("With() = %v; want %v", got, FromContext(want))
+	}
+	if v, _ := m.Value(k2); v != "v2" {
+		t.Errorf("With() modified the original map: %v", m)
+	}
+
+	var empty *Map
+	only, _ := New(context.Background(), Upsert(k1, "v1"))
+	if got, err := empty.With(Tag{Key: k1, Value: "v1"}); err != nil || !reflect.DeepEqual(got, FromContext(only)) {
+		t.Errorf("With() on a nil map = %v, %v; want %v", got, err, FromContext(only))
+	}
+	if _, err := m.With(Tag{Key: k1, Value: "\x01"}); err == nil {
+		t.Error("With() with an invalid value = nil error; want an error")
+	}
+}
+
 func TestNewMapWithMetadata(t *testing.T) {
 	k3, _ := NewKey("k3")
 	k4, _ := NewKey("k4")
@@ -386,3 +498,54 @@ func makeTestTagMapWithMetadata(tcs ...tagContent) *Map {
 	}
 	return m
 }
+
+func TestValueNormalizer(t *testing.T) {
+	// foldAccents maps the composed and decomposed forms of an accented
+	// letter to the same ASCII letter.
+	foldAccents := strings.NewReplacer("\u00e9", "e", "e\u0301", "e").Replace
+	SetValueNormalizer(foldAccents)
+	defer SetValueNormalizer(nil)
+
+	k := MustNewKey("k")
+	composed := "caf\u00e9"
+	decomposed := "cafe\u0301"
+
+	var values []string
+	for _, m := range []Mutator{Insert(k, composed), Upsert(k, decomposed)} {
+		ctx, err := New(context.Background(), m)
+		if err != nil {
+			t.Fatalf("New() = %v; want no error", err)
+		}
+		v, _ := FromContext(ctx).Value(k)
+		values = append(values, v)
+	}
+	if values[0] != "cafe" || values[0] != values[1] {
+		t.Errorf("normalized values = %q; want both to be %q", values, "cafe")
+	}
+
+	ctx, _ := New(context.Background(), Insert(k, "cafe"))
+	ctx, err := New(ctx, Update(k, decomposed))
+	if err != nil {
+		t.Fatalf("New() = %v; want no error", err)
+	}
+	if v, _ := FromContext(ctx).Value(k); v != "cafe" {
+		t.Errorf("Update value = %q; want %q", v, "cafe")
+	}
+
+	// Length checks apply to the normalized value.
+	long := strings.Repeat("\u00e9", 200)
+	if _, err := New(context.Background(), Insert(k, long)); err != nil {
+		t.Errorf("New() = %v; want no error for a value within limits after normalization", err)
+	}
+	SetValueNormalizer(nil)
+	if _, err := New(context.Background(), Insert(k, composed)); err == nil {
+		t.Error("New() = nil error; want non-ASCII value to be rejected without a normalizer")
+	}
+
+	// A normalizer must map values to ASCII: composing the decomposed form
+	// leaves it non-ASCII, so it is still rejected.
+	SetValueNormalizer(strings.NewReplacer("e\u0301", "\u00e9").Replace)
+	if _, err := New(context.Background(), Insert(k, decomposed)); err == nil {
+		t.Error("New() = nil error; want a value normalized to non-ASCII to be rejected")
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package tag
+
+import "sync/atomic"
+
+// valueNormalizer holds the func(string) string set by SetValueNormalizer.
+var valueNormalizer atomic.Value
+
+// SetValueNormalizer sets a function that is applied to every tag value
+// passed to Insert, Update and Upsert before the value is validated and
+// stored. It allows equivalent values, such as differently encoded unicode
+// strings, to be folded into a single representation so that they end up
+// in the same series. Validation, including the length limit, applies to the
+// normalized value.
+//
+// As tag values are restricted to printable ASCII, the normalizer must map
+// the values it accepts to ASCII: values it leaves non-ASCII are rejected as
+// without a normalizer. A Unicode normalization such as NFC alone is thus not
+// enough; the normalizer should also transliterate the values, for example
+// by decomposing them with NFD and dropping the combining marks.
+//
+// Passing nil removes the normalizer. SetValueNormalizer is safe for
+// concurrent use, but it is intended to be called once during program
+// initialization.
+func SetValueNormalizer(f func(string) string) {
+	if f == nil {
+		f = identity
+	}
+	valueNormalizer.Store(f)
+}
+
+func identity(v string) string { return v }
+
+func normalizeValue(v string) string {
+	f, ok := valueNormalizer.Load().(func(string) string)
+	if !ok {
+		return v
+	}
+	return f(v)
+}
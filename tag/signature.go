@@ -0,0 +1,66 @@
+// Copyright 2021, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package tag
+
+import (
+	"context"
+	"sort"
+)
+
+// Sig is a tag set captured for repeated recording, see Signature.
+type Sig struct {
+	m   *Map
+	key string
+}
+
+// Signature captures the tag map in ctx for recording the same tag set
+// repeatedly with stats.RecordWithSignature. Views remember the row of
+// recently seen tag sets by their Key, so recording with a signature skips
+// encoding the tags for the row on most calls. Create signatures once, not
+// per recording, as Signature itself encodes the tags.
+func Signature(ctx context.Context) *Sig {
+	m := FromContext(ctx)
+	return &Sig{m: m, key: signatureKey(m)}
+}
+
+// Map returns the captured tag map. It must not be modified.
+func (s *Sig) Map() *Map {
+	return s.m
+}
+
+// Key returns a string identifying the captured tag set: the keys of
+// signatures are equal if and only if their tag sets are equal.
+func (s *Sig) Key() string {
+	return s.key
+}
+
+// signatureKey encodes the tags of m ordered by key name.
+func signatureKey(m *Map) string {
+	if m == nil {
+		return ""
+	}
+	keys := make([]Key, 0, len(m.m))
+	for k := range m.m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].name < keys[j].name })
+	eg := &encoderGRPC{buf: make([]byte, 16*len(keys))}
+	for _, k := range keys {
+		eg.writeStringWithVarintLen(k.name)
+		eg.writeStringWithVarintLen(m.m[k].value)
+	}
+	return string(eg.bytes())
+}